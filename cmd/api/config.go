@@ -1,8 +0,0 @@
-package main
-
-import "github.com/dmitrymomot/go-env"
-
-// Application configuration.
-var (
-	httpPort = env.GetInt("HTTP_PORT", 8080)
-)
@@ -0,0 +1,557 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dmitrymomot/go-smart-monolith/pkg/app/apptest"
+	"github.com/dmitrymomot/go-smart-monolith/pkg/auth"
+	"github.com/dmitrymomot/go-smart-monolith/pkg/oidc/oidctest"
+
+	"github.com/stretchr/testify/require"
+)
+
+// jwtSecret signs the access tokens of the test users.
+const jwtSecret = "test-secret-test-secret-test-secret"
+
+// callbackHost is the host of the OIDC callback: it's unknown before the server is started,
+// so it's replaced by the test, see oidcLogin.
+const callbackHost = "app.test"
+
+// Test the monolith: all the modules are built into a single binary
+// and the user service calls the players service in-process.
+func TestMonolith(t *testing.T) {
+	// No players endpoint is configured, so HTTP calls would fail.
+	// The admin signs in with the identity provider that verified the email.
+	idp := oidctest.NewProvider(t)
+	idp.SignIn(oidctest.Identity{Subject: "admin", Email: "admin@mail.dev", EmailVerified: true})
+	srv := apptest.NewServer(t, map[string]string{
+		"DEPS_TRANSPORT":          "inproc",
+		"USER_JWT_SECRET":         jwtSecret,
+		"USER_ADMIN_EMAILS":       "admin@mail.dev",
+		"USER_OIDC_NAME":          "test",
+		"USER_OIDC_ISSUER_URL":    idp.Issuer(),
+		"USER_OIDC_CLIENT_ID":     oidctest.ClientID,
+		"USER_OIDC_CLIENT_SECRET": oidctest.ClientSecret,
+		"USER_OIDC_REDIRECT_URL":  "http://" + callbackHost + "/users/oidc/test/callback",
+	}, modules()...)
+
+	// Create a user.
+	res, err := http.Post(srv.URL+"/users", "application/json", strings.NewReader(`{"email":"test@mail.dev","password":"password"}`))
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.Equal(t, http.StatusCreated, res.StatusCode)
+
+	var created struct{ ID string }
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&created))
+
+	// The user's token: the users can get and change only themselves.
+	token, err := auth.NewJWT(jwtSecret).Issue(created.ID, time.Minute)
+	require.NoError(t, err)
+	get := func(path string) *http.Response {
+		req, err := http.NewRequest(http.MethodGet, srv.URL+path, nil)
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer "+token)
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		return res
+	}
+
+	// Set the player name: the users can change only their own player names.
+	res, err = http.Post(srv.URL+"/users", "application/json", strings.NewReader(`{"email":"player@mail.dev","password":"password"}`))
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.Equal(t, http.StatusCreated, res.StatusCode)
+	var other struct{ ID string }
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&other))
+	otherToken, err := auth.NewJWT(jwtSecret).Issue(other.ID, time.Minute)
+	require.NoError(t, err)
+	for bearer, code := range map[string]int{
+		"":         http.StatusUnauthorized,
+		otherToken: http.StatusForbidden,
+		token:      http.StatusNoContent,
+	} {
+		req, err := http.NewRequest(http.MethodPut, srv.URL+"/players/"+created.ID, strings.NewReader(`{"player_name":"player"}`))
+		require.NoError(t, err)
+		if bearer != "" {
+			req.Header.Set("Authorization", "Bearer "+bearer)
+		}
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		require.Equal(t, code, res.StatusCode)
+	}
+
+	// Get the user enriched with the player name from the players module.
+	res = get("/users/" + created.ID)
+	defer res.Body.Close()
+	require.Equal(t, http.StatusOK, res.StatusCode)
+
+	var u struct {
+		PlayerName string `json:"player_name"`
+	}
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&u))
+	require.Equal(t, "player", u.PlayerName)
+
+	// Anonymous callers can't get the users.
+	res, err = http.Get(srv.URL + "/users/" + created.ID)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.Equal(t, http.StatusUnauthorized, res.StatusCode)
+
+	// Getting other users and listing the users is allowed only to the admins.
+	for _, path := range []string{
+		"/users/other",
+		"/users?ids=" + created.ID + ",missing",
+		"/users?limit=10&email_prefix=test&order=desc",
+	} {
+		res = get(path)
+		defer res.Body.Close()
+		require.Equal(t, http.StatusForbidden, res.StatusCode, path)
+	}
+
+	// The admin proves the email ownership with the identity provider and is granted the admin role.
+	adminToken, _ := oidcLogin(t, srv.URL)
+	getAsAdmin := func(path string) *http.Response {
+		req, err := http.NewRequest(http.MethodGet, srv.URL+path, nil)
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer "+adminToken)
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		return res
+	}
+
+	// Get the users in a batch: the missing ones are reported without failing the request.
+	res = getAsAdmin("/users?ids=" + created.ID + ",missing")
+	defer res.Body.Close()
+	require.Equal(t, http.StatusOK, res.StatusCode)
+
+	var batch struct {
+		Users []struct {
+			ID         string `json:"id"`
+			PlayerName string `json:"player_name"`
+		}
+		Errors []struct{ ID string }
+	}
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&batch))
+	require.Len(t, batch.Users, 1)
+	require.Equal(t, "player", batch.Users[0].PlayerName)
+	require.Len(t, batch.Errors, 1)
+	require.Equal(t, "missing", batch.Errors[0].ID)
+
+	// List the users page by page.
+	res = getAsAdmin("/users?limit=10&email_prefix=test&order=desc")
+	defer res.Body.Close()
+	require.Equal(t, http.StatusOK, res.StatusCode)
+
+	var page struct {
+		Users []struct {
+			ID string `json:"id"`
+		}
+		NextCursor string `json:"next_cursor"`
+	}
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&page))
+	require.Len(t, page.Users, 1)
+	require.Equal(t, created.ID, page.Users[0].ID)
+	require.Empty(t, page.NextCursor)
+
+	// Update the profile: the ETag guards against the lost updates.
+	res = get("/users/" + created.ID)
+	defer res.Body.Close()
+	etag := res.Header.Get("ETag")
+	require.NotEmpty(t, etag)
+
+	updateProfile := func(ifMatch string) int {
+		req, err := http.NewRequest(http.MethodPatch, srv.URL+"/users/"+created.ID, strings.NewReader(`{"display_name":"John"}`))
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("If-Match", ifMatch)
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		return res.StatusCode
+	}
+	require.Equal(t, http.StatusNoContent, updateProfile(etag))
+	require.Equal(t, http.StatusPreconditionFailed, updateProfile(etag), "the user was changed")
+
+	// The password reset request doesn't reveal whether the user exists, even if the email is invalid.
+	for _, email := range []string{"test@mail.dev", "unknown@mail.dev", "not-an-email"} {
+		res, err = http.Post(srv.URL+"/users/password/forgot", "application/json", strings.NewReader(`{"email":"`+email+`"}`))
+		require.NoError(t, err)
+		defer res.Body.Close()
+		require.Equal(t, http.StatusAccepted, res.StatusCode)
+	}
+
+	// Login with the password: the user has no MFA, so the access token is issued at once.
+	res, err = http.Post(srv.URL+"/users/login", "application/json", strings.NewReader(`{"email":"test@mail.dev","password":"password"}`))
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.Equal(t, http.StatusOK, res.StatusCode)
+
+	var login struct {
+		AccessToken string `json:"access_token"`
+		MFARequired bool   `json:"mfa_required"`
+	}
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&login))
+	require.NotEmpty(t, login.AccessToken)
+	require.False(t, login.MFARequired)
+
+	// Create an API key: it has only the scopes its owner has the permissions for.
+	req, err := http.NewRequest(http.MethodPost, srv.URL+"/users/"+created.ID+"/api-keys", strings.NewReader(`{"name":"ci","scopes":["users:read"]}`))
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer "+token)
+	res, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.Equal(t, http.StatusCreated, res.StatusCode)
+
+	var apiKey struct {
+		ID  string `json:"id"`
+		Key string `json:"key"`
+	}
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&apiKey))
+	require.True(t, strings.HasPrefix(apiKey.Key, "sk_"))
+
+	withAPIKey := func(method, path string) int {
+		req, err := http.NewRequest(method, srv.URL+path, nil)
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer "+apiKey.Key)
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		return res.StatusCode
+	}
+	require.Equal(t, http.StatusForbidden, withAPIKey(http.MethodGet, "/users/"+created.ID), "the owner isn't an admin")
+	require.Equal(t, http.StatusForbidden, withAPIKey(http.MethodGet, "/users/"+created.ID+"/api-keys"), "the key doesn't act as the owner")
+
+	// Revoke the key: it stops working at once.
+	req, err = http.NewRequest(http.MethodDelete, srv.URL+"/users/"+created.ID+"/api-keys/"+apiKey.ID, nil)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer "+token)
+	res, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.Equal(t, http.StatusNoContent, res.StatusCode)
+	require.Equal(t, http.StatusUnauthorized, withAPIKey(http.MethodGet, "/users/"+created.ID))
+
+	// All the dependencies are healthy, the players service is in-process.
+	res, err = http.Get(srv.URL + "/readyz")
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.Equal(t, http.StatusOK, res.StatusCode)
+}
+
+// Test the login with the identity provider: the user is created on the first login
+// and logs in as the same user afterwards.
+func TestMonolith_OIDCLogin(t *testing.T) {
+	idp := oidctest.NewProvider(t)
+	idp.SignIn(oidctest.Identity{Subject: "subject-1", Email: "oidc@mail.dev", EmailVerified: true})
+
+	srv := apptest.NewServer(t, map[string]string{
+		"DEPS_TRANSPORT":          "inproc",
+		"USER_JWT_SECRET":         jwtSecret,
+		"USER_OIDC_NAME":          "test",
+		"USER_OIDC_ISSUER_URL":    idp.Issuer(),
+		"USER_OIDC_CLIENT_ID":     oidctest.ClientID,
+		"USER_OIDC_CLIENT_SECRET": oidctest.ClientSecret,
+		"USER_OIDC_REDIRECT_URL":  "http://" + callbackHost + "/users/oidc/test/callback",
+	}, modules()...)
+
+	// login returns the user the access token is issued to.
+	login := func() (string, string) {
+		token, callback := oidcLogin(t, srv.URL)
+		claims, err := auth.NewJWT(jwtSecret).Verify(token)
+		require.NoError(t, err)
+		return claims.Subject, callback
+	}
+
+	first, callback := login()
+	second, _ := login()
+	require.Equal(t, first, second, "the identity is linked to the created user")
+
+	// The callback can't be replayed.
+	res, err := http.Get(callback)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.Equal(t, http.StatusUnauthorized, res.StatusCode)
+
+	// The created user has no password.
+	res, err = http.Post(srv.URL+"/users/login", "application/json", strings.NewReader(`{"email":"oidc@mail.dev","password":""}`))
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.Equal(t, http.StatusUnauthorized, res.StatusCode)
+}
+
+// oidcLogin runs the login flow with the test identity provider in a browser:
+// the state cookie is kept between the redirects. It returns the access token and the callback URL.
+func oidcLogin(t *testing.T, baseURL string) (string, string) {
+	t.Helper()
+
+	srvURL, err := url.Parse(baseURL)
+	require.NoError(t, err)
+	jar, err := cookiejar.New(nil)
+	require.NoError(t, err)
+	browser := &http.Client{
+		Jar: jar,
+		CheckRedirect: func(req *http.Request, _ []*http.Request) error {
+			if req.URL.Host == callbackHost {
+				return http.ErrUseLastResponse
+			}
+			return nil
+		},
+	}
+
+	res, err := browser.Get(baseURL + "/users/oidc/test/login")
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.Equal(t, http.StatusFound, res.StatusCode)
+
+	callback, err := url.Parse(res.Header.Get("Location"))
+	require.NoError(t, err)
+	callback.Scheme, callback.Host = srvURL.Scheme, srvURL.Host
+	res, err = browser.Get(callback.String())
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.Equal(t, http.StatusOK, res.StatusCode)
+
+	var login struct {
+		AccessToken string `json:"access_token"`
+	}
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&login))
+	require.NotEmpty(t, login.AccessToken)
+	return login.AccessToken, callback.String()
+}
+
+// Test the sessions: the users see where they are logged in and log out the devices.
+func TestMonolith_Sessions(t *testing.T) {
+	srv := apptest.NewServer(t, map[string]string{
+		"DEPS_TRANSPORT":  "inproc",
+		"USER_JWT_SECRET": jwtSecret,
+	}, modules()...)
+
+	res, err := http.Post(srv.URL+"/users", "application/json", strings.NewReader(`{"email":"test@mail.dev","password":"password"}`))
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.Equal(t, http.StatusCreated, res.StatusCode)
+	var created struct{ ID string }
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&created))
+
+	login := func(userAgent string) string {
+		req, err := http.NewRequest(http.MethodPost, srv.URL+"/users/login", strings.NewReader(`{"email":"test@mail.dev","password":"password"}`))
+		require.NoError(t, err)
+		req.Header.Set("User-Agent", userAgent)
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		var login struct {
+			AccessToken string `json:"access_token"`
+		}
+		require.NoError(t, json.NewDecoder(res.Body).Decode(&login))
+		return login.AccessToken
+	}
+	call := func(method, path, token string) *http.Response {
+		req, err := http.NewRequest(method, srv.URL+path, nil)
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer "+token)
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		return res
+	}
+
+	laptop := login("Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36")
+	phone := login("Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.0 Mobile/15E148 Safari/604.1")
+
+	// The sessions are listed with the devices, the caller's one is marked.
+	res = call(http.MethodGet, "/users/me/sessions", laptop)
+	defer res.Body.Close()
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	var list struct {
+		Sessions []struct {
+			ID      string `json:"id"`
+			Device  string `json:"device"`
+			IP      string `json:"ip"`
+			Current bool   `json:"current"`
+		} `json:"sessions"`
+	}
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&list))
+	require.Len(t, list.Sessions, 2)
+	devices := map[string]bool{}
+	var phoneSession string
+	for _, s := range list.Sessions {
+		devices[s.Device] = s.Current
+		require.Equal(t, "127.0.0.1", s.IP)
+		if !s.Current {
+			phoneSession = s.ID
+		}
+	}
+	require.Equal(t, map[string]bool{"Chrome on Windows": true, "Safari on iOS": false}, devices)
+
+	// Log out the phone: its token stops working at once.
+	res = call(http.MethodDelete, "/users/me/sessions/"+phoneSession, laptop)
+	defer res.Body.Close()
+	require.Equal(t, http.StatusNoContent, res.StatusCode)
+	res = call(http.MethodGet, "/users/"+created.ID, phone)
+	defer res.Body.Close()
+	require.Equal(t, http.StatusUnauthorized, res.StatusCode)
+	res = call(http.MethodDelete, "/users/me/sessions/"+phoneSession, laptop)
+	defer res.Body.Close()
+	require.Equal(t, http.StatusNotFound, res.StatusCode)
+
+	// Only the admins can revoke the sessions of the other users.
+	other := login("curl/8.0")
+	res = call(http.MethodDelete, "/users/other/sessions", other)
+	defer res.Body.Close()
+	require.Equal(t, http.StatusForbidden, res.StatusCode)
+
+	// Revoke all the sessions.
+	res = call(http.MethodDelete, "/users/"+created.ID+"/sessions", laptop)
+	defer res.Body.Close()
+	require.Equal(t, http.StatusNoContent, res.StatusCode)
+	for _, token := range []string{laptop, other} {
+		res = call(http.MethodGet, "/users/me/sessions", token)
+		defer res.Body.Close()
+		require.Equal(t, http.StatusUnauthorized, res.StatusCode)
+	}
+}
+
+// Test the login lockout: the password can't be guessed.
+func TestMonolith_Lockout(t *testing.T) {
+	srv := apptest.NewServer(t, map[string]string{
+		"DEPS_TRANSPORT":  "inproc",
+		"USER_JWT_SECRET": jwtSecret,
+	}, modules()...)
+
+	res, err := http.Post(srv.URL+"/users", "application/json", strings.NewReader(`{"email":"test@mail.dev","password":"password"}`))
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.Equal(t, http.StatusCreated, res.StatusCode)
+	var created struct{ ID string }
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&created))
+
+	login := func(password string) int {
+		res, err := http.Post(srv.URL+"/users/login", "application/json", strings.NewReader(`{"email":"test@mail.dev","password":"`+password+`"}`))
+		require.NoError(t, err)
+		defer res.Body.Close()
+		return res.StatusCode
+	}
+	for i := 0; i < 5; i++ {
+		require.Equal(t, http.StatusUnauthorized, login("wrong"))
+	}
+	require.Equal(t, http.StatusTooManyRequests, login("password"), "the account is locked")
+
+	// Only the admins can unlock the accounts.
+	token, err := auth.NewJWT(jwtSecret).Issue(created.ID, time.Minute)
+	require.NoError(t, err)
+	req, err := http.NewRequest(http.MethodPost, srv.URL+"/users/"+created.ID+"/unlock", nil)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer "+token)
+	res, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.Equal(t, http.StatusForbidden, res.StatusCode)
+}
+
+func TestMonolith_RateLimit(t *testing.T) {
+	srv := apptest.NewServer(t, map[string]string{
+		"DEPS_TRANSPORT":          "inproc",
+		"USER_RATE_LIMIT_BACKEND": "storage",
+		"USER_RATE_LIMIT_IP":      "6/1m",
+		"USER_RATE_LIMIT_ROUTES":  "POST /users=2/1h",
+	}, modules()...)
+
+	createUser := func(email string) *http.Response {
+		res, err := http.Post(srv.URL+"/users", "application/json", strings.NewReader(`{"email":"`+email+`","password":"password"}`))
+		require.NoError(t, err)
+		res.Body.Close()
+		return res
+	}
+	res := createUser("a@mail.dev")
+	require.Equal(t, http.StatusCreated, res.StatusCode)
+	require.Equal(t, "1", res.Header.Get("RateLimit-Remaining"))
+	require.Equal(t, http.StatusCreated, createUser("b@mail.dev").StatusCode)
+
+	res = createUser("c@mail.dev")
+	require.Equal(t, http.StatusTooManyRequests, res.StatusCode)
+	// A token is refilled in 30m, less the time the sign-ups took.
+	retryAfter, err := strconv.Atoi(res.Header.Get("Retry-After"))
+	require.NoError(t, err)
+	require.InDelta(t, 1800, retryAfter, 60)
+
+	res, err = http.Post(srv.URL+"/users/", "application/json", strings.NewReader(`{"email":"c@mail.dev","password":"password"}`))
+	require.NoError(t, err)
+	res.Body.Close()
+	require.Equal(t, http.StatusTooManyRequests, res.StatusCode, "the trailing slash doesn't skip the limit")
+
+	// The other endpoints have their own limits.
+	res, err = http.Get(srv.URL + "/users")
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.NotEqual(t, http.StatusTooManyRequests, res.StatusCode)
+	require.Equal(t, "600", res.Header.Get("RateLimit-Limit"))
+
+	// All the requests from the IP are limited before the auth, even with an invalid token.
+	withInvalidToken := func() int {
+		req, err := http.NewRequest(http.MethodGet, srv.URL+"/users/me/sessions", nil)
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer invalid")
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		return res.StatusCode
+	}
+	require.Equal(t, http.StatusUnauthorized, withInvalidToken(), "the 6th request from the IP")
+	require.Equal(t, http.StatusTooManyRequests, withInvalidToken())
+}
+
+func TestMonolith_Idempotency(t *testing.T) {
+	srv := apptest.NewServer(t, map[string]string{
+		"DEPS_TRANSPORT":  "inproc",
+		"USER_JWT_SECRET": jwtSecret,
+	}, modules()...)
+
+	createUser := func(key, email string) (*http.Response, string) {
+		req, err := http.NewRequest(http.MethodPost, srv.URL+"/users", strings.NewReader(`{"email":"`+email+`","password":"password"}`))
+		require.NoError(t, err)
+		req.Header.Set("Idempotency-Key", key)
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		body, err := io.ReadAll(res.Body)
+		require.NoError(t, err)
+		return res, string(body)
+	}
+
+	res, created := createUser("8e3c6b1e-key", "test@mail.dev")
+	require.Equal(t, http.StatusCreated, res.StatusCode)
+
+	// The retry gets the same user, not 409 for the taken email.
+	res, replayed := createUser("8e3c6b1e-key", "test@mail.dev")
+	require.Equal(t, http.StatusCreated, res.StatusCode)
+	require.Equal(t, "true", res.Header.Get("Idempotent-Replayed"))
+	require.Equal(t, created, replayed)
+
+	res, _ = createUser("8e3c6b1e-key", "other@mail.dev")
+	require.Equal(t, http.StatusUnprocessableEntity, res.StatusCode, "the key is reused")
+	res, _ = createUser("another-key", "test@mail.dev")
+	require.Equal(t, http.StatusConflict, res.StatusCode, "the email is taken")
+
+	// The logins are not deduplicated, so the access tokens are never stored.
+	for i := 0; i < 2; i++ {
+		req, err := http.NewRequest(http.MethodPost, srv.URL+"/users/login", strings.NewReader(`{"email":"test@mail.dev","password":"password"}`))
+		require.NoError(t, err)
+		req.Header.Set("Idempotency-Key", "login-key")
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		require.Empty(t, res.Header.Get("Idempotent-Replayed"))
+	}
+}
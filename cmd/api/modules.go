@@ -0,0 +1,17 @@
+package main
+
+import (
+	"github.com/dmitrymomot/go-smart-monolith/internal/player"
+	"github.com/dmitrymomot/go-smart-monolith/internal/user"
+	"github.com/dmitrymomot/go-smart-monolith/pkg/module"
+)
+
+// modules returns the list of services the monolith is built of.
+// Modules are initialized in this order, so register dependencies first.
+// ...Register more services here.
+func modules() []module.Module {
+	return []module.Module{
+		player.NewModule(),
+		user.NewModule(), // Calls the player module in-process.
+	}
+}
@@ -0,0 +1,12 @@
+package main
+
+import (
+	"github.com/dmitrymomot/go-smart-monolith/internal/player"
+	"github.com/dmitrymomot/go-smart-monolith/pkg/app"
+)
+
+// The player service as a standalone binary.
+// It's built of the same module as the monolith (see cmd/api).
+func main() {
+	app.Main(player.NewModule())
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/dmitrymomot/go-smart-monolith/internal/player"
+	"github.com/dmitrymomot/go-smart-monolith/pkg/app/apptest"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Test the player service started alone.
+func TestStandalone(t *testing.T) {
+	srv := apptest.NewServer(t, nil, player.NewModule())
+
+	// Unknown player.
+	res, err := http.Get(srv.URL + "/players/user-id")
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.Equal(t, http.StatusNotFound, res.StatusCode)
+
+	// The player names can't be changed: no user module authenticates the callers.
+	for _, header := range []string{"", "Bearer token"} {
+		req, err := http.NewRequest(http.MethodPut, srv.URL+"/players/user-id", strings.NewReader(`{"player_name":"player"}`))
+		require.NoError(t, err)
+		if header != "" {
+			req.Header.Set("Authorization", header)
+		}
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		require.Equal(t, http.StatusUnauthorized, res.StatusCode, header)
+	}
+
+	// The player is not created.
+	res, err = http.Get(srv.URL + "/players/user-id")
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.Equal(t, http.StatusNotFound, res.StatusCode)
+}
@@ -0,0 +1,13 @@
+package main
+
+import (
+	"github.com/dmitrymomot/go-smart-monolith/internal/user"
+	"github.com/dmitrymomot/go-smart-monolith/pkg/app"
+)
+
+// The user service as a standalone binary.
+// It's built of the same module as the monolith (see cmd/api),
+// but calls other services over the network.
+func main() {
+	app.Main(user.NewModule())
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dmitrymomot/go-smart-monolith/internal/user"
+	"github.com/dmitrymomot/go-smart-monolith/pkg/app/apptest"
+	"github.com/dmitrymomot/go-smart-monolith/pkg/auth"
+
+	"github.com/stretchr/testify/require"
+)
+
+// jwtSecret signs the access tokens of the test users.
+const jwtSecret = "test-secret-test-secret-test-secret"
+
+// Test the user service started alone: the players service is a remote dependency.
+func TestStandalone(t *testing.T) {
+	// Fake remote players service.
+	players := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/healthz" {
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"user_id":     strings.TrimPrefix(r.URL.Path, "/players/"),
+			"player_name": "remote player",
+		})
+	}))
+	defer players.Close()
+
+	srv := apptest.NewServer(t, map[string]string{
+		"DEPS_TRANSPORT":           "remote",
+		"USER_PLAYER_SVC_ENDPOINT": players.URL,
+		"USER_JWT_SECRET":          jwtSecret,
+	}, user.NewModule())
+
+	// Create a user.
+	res, err := http.Post(srv.URL+"/users", "application/json", strings.NewReader(`{"email":"test@mail.dev","password":"password"}`))
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.Equal(t, http.StatusCreated, res.StatusCode)
+
+	var created struct{ ID string }
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&created))
+	require.NotEmpty(t, created.ID)
+
+	// Get the user enriched with the player name from the remote service.
+	token, err := auth.NewJWT(jwtSecret).Issue(created.ID, time.Minute)
+	require.NoError(t, err)
+	req, err := http.NewRequest(http.MethodGet, srv.URL+"/users/"+created.ID, nil)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer "+token)
+	res, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.Equal(t, http.StatusOK, res.StatusCode)
+
+	var u struct {
+		Email      string `json:"email"`
+		PlayerName string `json:"player_name"`
+	}
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&u))
+	require.Equal(t, "test@mail.dev", u.Email)
+	require.Equal(t, "remote player", u.PlayerName)
+
+	// The remote dependency is probed by the readiness check.
+	res, err = http.Get(srv.URL + "/readyz")
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.Equal(t, http.StatusOK, res.StatusCode)
+}
@@ -0,0 +1,55 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/dmitrymomot/go-smart-monolith/internal/player/domain"
+	kvstorage "github.com/dmitrymomot/go-smart-monolith/pkg/storage"
+)
+
+// keyPrefix separates players from other services data in the shared storage.
+const keyPrefix = "player:"
+
+type (
+	// Storage is a storage service adapter.
+	// It's just an implementation of the repository pattern.
+	Storage struct {
+		client storageClient
+	}
+
+	// Low-level storage client. Redis, mongo, pg, etc.
+	storageClient interface {
+		Get(ctx context.Context, key string) (interface{}, error)
+		Set(ctx context.Context, key string, value interface{}) error
+	}
+)
+
+// New is a factory function that creates a new storage service adapter.
+func New(client storageClient) *Storage {
+	return &Storage{
+		client: client,
+	}
+}
+
+// GetPlayerByUserID gets a player by user ID.
+func (s *Storage) GetPlayerByUserID(ctx context.Context, userID string) (domain.Player, error) {
+	v, err := s.client.Get(ctx, keyPrefix+userID)
+	if err != nil {
+		if errors.Is(err, kvstorage.ErrNotFound) {
+			return domain.Player{}, fmt.Errorf("%w: %v", domain.ErrPlayerNotFound, err)
+		}
+		return domain.Player{}, err
+	}
+	p, ok := v.(domain.Player)
+	if !ok {
+		return domain.Player{}, fmt.Errorf("unexpected value type %T of player %s", v, userID)
+	}
+	return p, nil
+}
+
+// StorePlayer stores a player.
+func (s *Storage) StorePlayer(ctx context.Context, player domain.Player) error {
+	return s.client.Set(ctx, keyPrefix+player.UserID, player)
+}
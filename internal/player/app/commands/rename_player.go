@@ -0,0 +1,77 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/dmitrymomot/go-smart-monolith/internal/player/domain"
+)
+
+var (
+	// ErrInvalidPlayerName is returned when the player name is empty.
+	ErrInvalidPlayerName = errors.New("invalid player name")
+	// ErrFailedToRenamePlayer is returned when the player can't be stored.
+	ErrFailedToRenamePlayer = errors.New("failed to rename player")
+)
+
+type (
+	// RenamePlayerCommand represents the request body for RenamePlayer.
+	RenamePlayerCommand struct {
+		UserID     string `json:"user_id"`
+		PlayerName string `json:"player_name"`
+	}
+
+	// PlayerRenamedEvent represents the event body for PlayerRenamed.
+	PlayerRenamedEvent struct {
+		UserID  string `json:"user_id"`
+		OldName string `json:"old_name"`
+		NewName string `json:"new_name"`
+	}
+
+	// renamePlayerRepository represents the repository interface for RenamePlayer.
+	renamePlayerRepository interface {
+		GetPlayerByUserID(ctx context.Context, userID string) (domain.Player, error)
+		StorePlayer(ctx context.Context, player domain.Player) error
+	}
+)
+
+// RenamePlayer sets the player name of the user.
+// The player is created if the user doesn't have one yet.
+func RenamePlayer(repo renamePlayerRepository) func(ctx context.Context, cmd RenamePlayerCommand) ([]interface{}, error) {
+	return func(ctx context.Context, cmd RenamePlayerCommand) ([]interface{}, error) {
+		if cmd.PlayerName == "" {
+			return nil, ErrInvalidPlayerName
+		}
+
+		// Missing player is not an error, it'll be created.
+		// Any other error fails the command, so an existing player is never overwritten.
+		player, err := repo.GetPlayerByUserID(ctx, cmd.UserID)
+		switch {
+		case errors.Is(err, domain.ErrPlayerNotFound):
+			player = domain.NewPlayer(cmd.UserID, "")
+		case err != nil:
+			return nil, fmt.Errorf("%w: %v", ErrFailedToRenamePlayer, err)
+		}
+
+		// Nothing to do, so no event.
+		oldName := player.PlayerName
+		if oldName == cmd.PlayerName {
+			return nil, nil
+		}
+
+		player.PlayerName = cmd.PlayerName
+		if err := repo.StorePlayer(ctx, player); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrFailedToRenamePlayer, err)
+		}
+
+		// Return the event.
+		return []interface{}{
+			PlayerRenamedEvent{
+				UserID:  player.UserID,
+				OldName: oldName,
+				NewName: player.PlayerName,
+			},
+		}, nil
+	}
+}
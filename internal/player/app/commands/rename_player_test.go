@@ -0,0 +1,117 @@
+package commands_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/dmitrymomot/go-smart-monolith/internal/player/app/commands"
+	"github.com/dmitrymomot/go-smart-monolith/internal/player/domain"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// renamePlayerRepository is a mock implementation of the renamePlayerRepository
+// interface.
+type renamePlayerRepository struct {
+	mock.Mock
+}
+
+// GetPlayerByUserID is a mock implementation of the GetPlayerByUserID method.
+func (m *renamePlayerRepository) GetPlayerByUserID(ctx context.Context, userID string) (domain.Player, error) {
+	args := m.Called(ctx, userID)
+	return args.Get(0).(domain.Player), args.Error(1)
+}
+
+// StorePlayer is a mock implementation of the StorePlayer method.
+func (m *renamePlayerRepository) StorePlayer(ctx context.Context, player domain.Player) error {
+	args := m.Called(ctx, player)
+	return args.Error(0)
+}
+
+func TestRenamePlayer(t *testing.T) {
+	t.Parallel()
+
+	// Test data.
+	var (
+		userID  = "user-id"
+		oldName = "old name"
+		newName = "new name"
+	)
+
+	// Rename existing player.
+	t.Run("success", func(t *testing.T) {
+		repo := &renamePlayerRepository{}
+		repo.On("GetPlayerByUserID", mock.Anything, userID).Return(domain.NewPlayer(userID, oldName), nil)
+		repo.On("StorePlayer", mock.Anything, domain.NewPlayer(userID, newName)).Return(nil)
+
+		events, err := commands.RenamePlayer(repo)(context.Background(), commands.RenamePlayerCommand{
+			UserID:     userID,
+			PlayerName: newName,
+		})
+		require.NoError(t, err)
+		require.Equal(t, []interface{}{commands.PlayerRenamedEvent{
+			UserID:  userID,
+			OldName: oldName,
+			NewName: newName,
+		}}, events)
+
+		repo.AssertExpectations(t)
+	})
+
+	// Player is created if it doesn't exist.
+	t.Run("create", func(t *testing.T) {
+		repo := &renamePlayerRepository{}
+		repo.On("GetPlayerByUserID", mock.Anything, userID).Return(domain.Player{}, domain.ErrPlayerNotFound)
+		repo.On("StorePlayer", mock.Anything, domain.NewPlayer(userID, newName)).Return(nil)
+
+		events, err := commands.RenamePlayer(repo)(context.Background(), commands.RenamePlayerCommand{
+			UserID:     userID,
+			PlayerName: newName,
+		})
+		require.NoError(t, err)
+		require.Len(t, events, 1)
+
+		repo.AssertExpectations(t)
+	})
+
+	// The player is not overwritten if it can't be read.
+	t.Run("storage error", func(t *testing.T) {
+		repo := &renamePlayerRepository{}
+		repo.On("GetPlayerByUserID", mock.Anything, userID).Return(domain.Player{}, errors.New("storage is down"))
+
+		_, err := commands.RenamePlayer(repo)(context.Background(), commands.RenamePlayerCommand{
+			UserID:     userID,
+			PlayerName: newName,
+		})
+		require.ErrorIs(t, err, commands.ErrFailedToRenamePlayer)
+
+		repo.AssertExpectations(t)
+	})
+
+	// Same name, nothing to do.
+	t.Run("unchanged", func(t *testing.T) {
+		repo := &renamePlayerRepository{}
+		repo.On("GetPlayerByUserID", mock.Anything, userID).Return(domain.NewPlayer(userID, newName), nil)
+
+		events, err := commands.RenamePlayer(repo)(context.Background(), commands.RenamePlayerCommand{
+			UserID:     userID,
+			PlayerName: newName,
+		})
+		require.NoError(t, err)
+		require.Len(t, events, 0)
+
+		repo.AssertExpectations(t)
+	})
+
+	// Empty name.
+	t.Run("invalid_name", func(t *testing.T) {
+		repo := &renamePlayerRepository{}
+
+		_, err := commands.RenamePlayer(repo)(context.Background(), commands.RenamePlayerCommand{
+			UserID: userID,
+		})
+		require.ErrorIs(t, err, commands.ErrInvalidPlayerName)
+	})
+}
@@ -0,0 +1,45 @@
+package queries
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/dmitrymomot/go-smart-monolith/internal/player/domain"
+)
+
+// ErrPlayerNotFound is returned when the player doesn't exist.
+var ErrPlayerNotFound = errors.New("player not found")
+
+type (
+	// GetPlayerQuery represents the request body for GetPlayer.
+	GetPlayerQuery struct {
+		UserID string
+	}
+
+	// Player represents the response body for GetPlayer.
+	Player struct {
+		UserID     string
+		PlayerName string
+	}
+
+	// getPlayerRepository represents the repository for GetPlayer.
+	getPlayerRepository interface {
+		GetPlayerByUserID(ctx context.Context, userID string) (domain.Player, error)
+	}
+)
+
+// GetPlayer gets a player by user ID.
+func GetPlayer(repo getPlayerRepository) func(ctx context.Context, query GetPlayerQuery) (Player, error) {
+	return func(ctx context.Context, query GetPlayerQuery) (Player, error) {
+		p, err := repo.GetPlayerByUserID(ctx, query.UserID)
+		if err != nil {
+			return Player{}, fmt.Errorf("%w: %v", ErrPlayerNotFound, err)
+		}
+
+		return Player{
+			UserID:     p.UserID,
+			PlayerName: p.PlayerName,
+		}, nil
+	}
+}
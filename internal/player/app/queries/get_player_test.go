@@ -0,0 +1,41 @@
+package queries_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/dmitrymomot/go-smart-monolith/internal/player/app/queries"
+	"github.com/dmitrymomot/go-smart-monolith/internal/player/domain"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// mockGetPlayerRepository is a mock of the getPlayerRepository interface.
+type mockGetPlayerRepository struct {
+	mock.Mock
+}
+
+// GetPlayerByUserID provides a mock function with given fields: userID
+func (m *mockGetPlayerRepository) GetPlayerByUserID(ctx context.Context, userID string) (domain.Player, error) {
+	args := m.Called(ctx, userID)
+	return args.Get(0).(domain.Player), args.Error(1)
+}
+
+func TestGetPlayer(t *testing.T) {
+	repo := new(mockGetPlayerRepository)
+	repo.On("GetPlayerByUserID", mock.Anything, "user-id").Return(domain.NewPlayer("user-id", "player"), nil)
+	repo.On("GetPlayerByUserID", mock.Anything, "unknown").Return(domain.Player{}, errors.New("not found"))
+
+	handler := queries.GetPlayer(repo)
+
+	res, err := handler(context.Background(), queries.GetPlayerQuery{UserID: "user-id"})
+	require.NoError(t, err)
+	require.Equal(t, queries.Player{UserID: "user-id", PlayerName: "player"}, res)
+
+	_, err = handler(context.Background(), queries.GetPlayerQuery{UserID: "unknown"})
+	require.ErrorIs(t, err, queries.ErrPlayerNotFound)
+
+	repo.AssertExpectations(t)
+}
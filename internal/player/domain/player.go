@@ -0,0 +1,20 @@
+package domain
+
+import "errors"
+
+// ErrPlayerNotFound is returned by the repository when the user has no player.
+var ErrPlayerNotFound = errors.New("player not found")
+
+// Player is the game profile of a user.
+type Player struct {
+	UserID     string `json:"user_id"`
+	PlayerName string `json:"player_name"`
+}
+
+// NewPlayer creates a new player.
+func NewPlayer(userID, playerName string) Player {
+	return Player{
+		UserID:     userID,
+		PlayerName: playerName,
+	}
+}
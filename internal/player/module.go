@@ -0,0 +1,122 @@
+package player
+
+import (
+	"context"
+	"errors"
+
+	"github.com/dmitrymomot/go-smart-monolith/internal/player/app/queries"
+	playergrpc "github.com/dmitrymomot/go-smart-monolith/internal/player/ports/grpc"
+	"github.com/dmitrymomot/go-smart-monolith/internal/player/ports/restapi"
+	"github.com/dmitrymomot/go-smart-monolith/internal/player/service"
+	"github.com/dmitrymomot/go-smart-monolith/pkg/contracts/playerapi"
+	"github.com/dmitrymomot/go-smart-monolith/pkg/contracts/userapi"
+	"github.com/dmitrymomot/go-smart-monolith/pkg/health"
+	"github.com/dmitrymomot/go-smart-monolith/pkg/module"
+
+	"github.com/go-chi/chi/v5"
+	"google.golang.org/grpc"
+)
+
+// Module is the player service module.
+// It plugs the player service into the monolith or a standalone binary.
+// It also implements playerapi.Service, so other modules built
+// into the same binary can call it in-process.
+type Module struct {
+	cnf     service.Config
+	svc     service.Service
+	modules *module.Registry
+}
+
+// NewModule creates a new player service module.
+func NewModule() *Module {
+	return &Module{}
+}
+
+// Name returns the module name.
+func (m *Module) Name() string {
+	return playerapi.ModuleName
+}
+
+// Config returns the player service config to be populated by the registry.
+func (m *Module) Config() interface{} {
+	return &m.cnf
+}
+
+// Init builds the player service.
+func (m *Module) Init(deps module.Deps) error {
+	m.svc = service.NewService(deps.Storage, deps.Logger, deps.NATS, m.cnf)
+	m.modules = deps.Modules
+	return nil
+}
+
+// Routes mounts the player service HTTP endpoints.
+// The callers are authenticated by the user module, if it's built into the same binary.
+// It's looked up here, not in Init: the user module is initialized after this one.
+func (m *Module) Routes(r chi.Router) {
+	var users userapi.Authenticator
+	if m.modules != nil {
+		if mod, ok := m.modules.Lookup(userapi.ModuleName); ok {
+			users, _ = mod.(userapi.Authenticator)
+		}
+	}
+	r.Mount("/players", restapi.NewServer(m.svc, users))
+}
+
+// RegisterGRPC registers the player service gRPC port.
+func (m *Module) RegisterGRPC(s grpc.ServiceRegistrar) {
+	playergrpc.NewServer(m.svc).Register(s)
+}
+
+// GRPCInterceptors returns the player service gRPC interceptors.
+func (m *Module) GRPCInterceptors() []grpc.UnaryServerInterceptor {
+	return nil
+}
+
+// Subscribers returns the player service message bus subscribers.
+func (m *Module) Subscribers() []module.Subscriber {
+	return nil
+}
+
+// Jobs returns the player service background jobs.
+func (m *Module) Jobs() []module.Job {
+	return nil
+}
+
+// HealthChecks returns the player service dependency probes.
+func (m *Module) HealthChecks() []health.Check {
+	return nil
+}
+
+// GetPlayer implements playerapi.Service for in-process calls.
+// It maps the internal query response to the public API model.
+func (m *Module) GetPlayer(ctx context.Context, userID string) (playerapi.Player, error) {
+	p, err := m.svc.GetPlayer(ctx, queries.GetPlayerQuery{UserID: userID})
+	if err != nil {
+		if errors.Is(err, queries.ErrPlayerNotFound) {
+			return playerapi.Player{}, playerapi.ErrPlayerNotFound
+		}
+		return playerapi.Player{}, err
+	}
+
+	return playerapi.Player{
+		UserID:     p.UserID,
+		PlayerName: p.PlayerName,
+	}, nil
+}
+
+// GetPlayers implements playerapi.BatchService for in-process calls.
+// The users without a player are skipped.
+func (m *Module) GetPlayers(ctx context.Context, userIDs []string) (map[string]playerapi.Player, error) {
+	res := make(map[string]playerapi.Player, len(userIDs))
+	for _, id := range userIDs {
+		p, err := m.GetPlayer(ctx, id)
+		if err != nil {
+			if errors.Is(err, playerapi.ErrPlayerNotFound) {
+				continue
+			}
+			return nil, err
+		}
+		res[id] = p
+	}
+	return res, nil
+}
@@ -0,0 +1,50 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+
+	playerv1 "github.com/dmitrymomot/go-smart-monolith/api/player/v1"
+	"github.com/dmitrymomot/go-smart-monolith/internal/player/app/queries"
+	"github.com/dmitrymomot/go-smart-monolith/internal/player/service"
+
+	grpclib "google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Server is the gRPC port of the player service.
+type Server struct {
+	playerv1.UnimplementedPlayerServiceServer
+	svc service.Service
+}
+
+// NewServer creates a new gRPC port of the player service.
+func NewServer(svc service.Service) *Server {
+	return &Server{svc: svc}
+}
+
+// Register registers the player service on the given gRPC server.
+func (s *Server) Register(r grpclib.ServiceRegistrar) {
+	playerv1.RegisterPlayerServiceServer(r, s)
+}
+
+// GetPlayer gets a player by user ID.
+func (s *Server) GetPlayer(ctx context.Context, req *playerv1.GetPlayerRequest) (*playerv1.GetPlayerResponse, error) {
+	player, err := s.svc.GetPlayer(ctx, queries.GetPlayerQuery{
+		UserID: req.GetUserId(),
+	})
+	if err != nil {
+		if errors.Is(err, queries.ErrPlayerNotFound) {
+			return nil, status.Error(codes.NotFound, err.Error())
+		}
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+
+	return &playerv1.GetPlayerResponse{
+		Player: &playerv1.Player{
+			UserId:     player.UserID,
+			PlayerName: player.PlayerName,
+		},
+	}, nil
+}
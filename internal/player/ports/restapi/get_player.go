@@ -0,0 +1,48 @@
+package restapi
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/dmitrymomot/go-smart-monolith/internal/player/app/queries"
+	"github.com/dmitrymomot/go-smart-monolith/internal/player/service"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// PlayerResponse represents the response body for GetPlayer.
+// Note: the format is a part of the players service public API,
+// see pkg/contracts/playerapi.
+type PlayerResponse struct {
+	UserID     string `json:"user_id"`
+	PlayerName string `json:"player_name"`
+}
+
+// getPlayerEndpointHandler is a function that handles the HTTP request to get a player.
+func getPlayerEndpointHandler(svc service.Service) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Execute the query.
+		player, err := svc.GetPlayer(r.Context(), queries.GetPlayerQuery{
+			UserID: chi.URLParam(r, "userID"),
+		})
+		if err != nil {
+			code := http.StatusInternalServerError
+			if errors.Is(err, queries.ErrPlayerNotFound) {
+				code = http.StatusNotFound
+			}
+			http.Error(w, err.Error(), code)
+			return
+		}
+
+		// Return the response.
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(PlayerResponse{
+			UserID:     player.UserID,
+			PlayerName: player.PlayerName,
+		}); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package restapi
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/dmitrymomot/go-smart-monolith/internal/player/app/commands"
+	"github.com/dmitrymomot/go-smart-monolith/internal/player/service"
+	"github.com/dmitrymomot/go-smart-monolith/pkg/auth"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// renamePlayerEndpointHandler is a function that handles the HTTP request to set the player name.
+// The users can change only their own player names, the same as their profiles.
+func renamePlayerEndpointHandler(svc service.Service) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := chi.URLParam(r, "userID")
+		if p, ok := auth.PrincipalFromContext(r.Context()); !ok || p.UserID != userID {
+			http.Error(w, auth.ErrForbidden.Error(), http.StatusForbidden)
+			return
+		}
+
+		// Parse the request body.
+		payload := struct {
+			PlayerName string `json:"player_name"`
+		}{}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// Execute the command.
+		if _, err := svc.RenamePlayer(r.Context(), commands.RenamePlayerCommand{
+			UserID:     userID,
+			PlayerName: payload.PlayerName,
+		}); err != nil {
+			code := http.StatusInternalServerError
+			if errors.Is(err, commands.ErrInvalidPlayerName) {
+				code = http.StatusBadRequest
+			}
+			http.Error(w, err.Error(), code)
+			return
+		}
+
+		// Return 204 No Content.
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
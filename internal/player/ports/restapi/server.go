@@ -0,0 +1,59 @@
+package restapi
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/dmitrymomot/go-smart-monolith/internal/player/service"
+	"github.com/dmitrymomot/go-smart-monolith/pkg/auth"
+	"github.com/dmitrymomot/go-smart-monolith/pkg/contracts/userapi"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// NewServer creates a new HTTP server.
+// It can be used as a standalone server or as a part of a bigger server.
+// See cmd/api/main.go for an example.
+// The callers are authenticated by the user service, see userapi.Authenticator.
+// If users is nil, no caller can be authenticated, so the player names can't be changed.
+func NewServer(svc service.Service, users userapi.Authenticator) http.Handler {
+	r := chi.NewRouter()
+
+	// Mount all endpoints here.
+	r.Get("/{userID}", getPlayerEndpointHandler(svc))
+	r.With(authMiddleware(users)).Put("/{userID}", renamePlayerEndpointHandler(svc))
+
+	return r
+}
+
+// authMiddleware authenticates the caller by the bearer token, the same as the user service REST API,
+// and puts the principal into the request context. The callers without a valid token are rejected.
+func authMiddleware(users userapi.Authenticator) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			header := r.Header.Get("Authorization")
+			if header == "" {
+				http.Error(w, auth.ErrUnauthenticated.Error(), http.StatusUnauthorized)
+				return
+			}
+			token, ok := strings.CutPrefix(header, "Bearer ")
+			if !ok || token == "" {
+				http.Error(w, "invalid authorization header", http.StatusUnauthorized)
+				return
+			}
+			if users == nil {
+				http.Error(w, "authentication is not configured", http.StatusUnauthorized)
+				return
+			}
+
+			principal, err := users.Authenticate(r.Context(), token)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusUnauthorized)
+				return
+			}
+
+			ctx := auth.WithPrincipal(r.Context(), principal)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
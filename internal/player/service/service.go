@@ -0,0 +1,66 @@
+package service
+
+import (
+	"context"
+
+	"github.com/dmitrymomot/go-smart-monolith/internal/player/adapters/messagebus"
+	"github.com/dmitrymomot/go-smart-monolith/internal/player/adapters/storage"
+	"github.com/dmitrymomot/go-smart-monolith/internal/player/app/commands"
+	"github.com/dmitrymomot/go-smart-monolith/internal/player/app/common"
+	"github.com/dmitrymomot/go-smart-monolith/internal/player/app/decorators/events"
+	"github.com/dmitrymomot/go-smart-monolith/internal/player/app/decorators/logger"
+	"github.com/dmitrymomot/go-smart-monolith/internal/player/app/queries"
+)
+
+type (
+	// Service is a player service facade.
+	// It's just a collection of the query and command handlers with the service configuration.
+	Service struct {
+		GetPlayer    common.QueryHandler[queries.GetPlayerQuery, queries.Player]
+		RenamePlayer common.CommandHandler[commands.RenamePlayerCommand]
+	}
+
+	// Config holds the player service configuration.
+	// See pkg/config for the supported struct tags.
+	Config struct{}
+
+	// low-level abstraction for the storage.
+	storageService interface {
+		Get(ctx context.Context, key string) (interface{}, error)
+		Set(ctx context.Context, key string, value interface{}) error
+	}
+
+	// low-level abstraction for the logger.
+	loggerX interface {
+		Error(err error, kv ...interface{})
+	}
+
+	// low-level abstraction for the NATS client.
+	natsClient interface {
+		Publish(subject string, body []byte) error
+	}
+)
+
+// NewService returns a new app service instance.
+// It's just a factory function that creates a new app service instance.
+// It's a good place to apply all the decorators to the app service.
+func NewService(stor storageService, log loggerX, nc natsClient, cnf Config) Service {
+	// Init the player repository.
+	playerRepo := storage.New(stor)
+
+	// Init the message bus adapter.
+	messageBus := messagebus.NewEventSender(nc)
+
+	// Create the app instance with all the decorators applied.
+	return Service{
+		GetPlayer: common.ApplyQueryDecorators(
+			queries.GetPlayer(playerRepo),
+			logger.QueryErrorLogger[queries.GetPlayerQuery, queries.Player](log), // Logs the error if any.
+		),
+		RenamePlayer: common.ApplyCommandDecorators(
+			commands.RenamePlayer(playerRepo),
+			logger.CommandErrorLogger[commands.RenamePlayerCommand](log), // Logs the error if any.
+			events.EventSender[commands.RenamePlayerCommand](messageBus), // Sends the event to the message bus.
+		),
+	}
+}
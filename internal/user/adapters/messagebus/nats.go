@@ -1,6 +1,13 @@
 package messagebus
 
-import "encoding/json"
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+
+	"github.com/dmitrymomot/go-smart-monolith/pkg/mailer"
+)
 
 type (
 
@@ -9,6 +16,12 @@ type (
 		nc natsClient
 	}
 
+	// MailQueue is an adapter that queues the emails to be sent by the mailer,
+	// see mailer.Handler.
+	MailQueue struct {
+		nc natsClient
+	}
+
 	// natsClient is a client for the NATS messaging system.
 	// It is used to decouple the user service from the NATS messaging system.
 	// natsClient must be low-level implementation of the nats client, without
@@ -24,15 +37,39 @@ func NewEventSender(nc natsClient) *EventSender {
 }
 
 // Send sends an event.
+// Each event is published to its own subject, see EventSubject,
+// so the subscribers can pick the events they need.
 func (es *EventSender) PublishEvent(subject string, events ...interface{}) error {
 	for _, event := range events {
 		body, err := json.Marshal(event)
 		if err != nil {
 			return err
 		}
-		if err := es.nc.Publish(subject, body); err != nil {
+		if err := es.nc.Publish(EventSubject(subject, event), body); err != nil {
 			return err
 		}
 	}
 	return nil
 }
+
+// EventSubject returns the subject the event is published to:
+// the topic followed by the event type name without the "Event" suffix,
+// e.g. "user.events.UserCreated" for commands.UserCreatedEvent.
+func EventSubject(topic string, event interface{}) string {
+	name := reflect.TypeOf(event).Name()
+	return topic + "." + strings.TrimSuffix(name, "Event")
+}
+
+// NewMailQueue creates a new MailQueue.
+func NewMailQueue(nc natsClient) *MailQueue {
+	return &MailQueue{nc: nc}
+}
+
+// QueueEmail queues the email to be sent.
+func (mq *MailQueue) QueueEmail(ctx context.Context, msg mailer.Message) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return mq.nc.Publish(mailer.SendEmailSubject, body)
+}
@@ -0,0 +1,48 @@
+package players
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/dmitrymomot/go-smart-monolith/internal/user/domain"
+	"github.com/dmitrymomot/go-smart-monolith/pkg/contracts/playerapi"
+	"github.com/dmitrymomot/go-smart-monolith/pkg/dataloader"
+)
+
+type (
+	// Batcher is a players service adapter decorator that coalesces the concurrent
+	// GetPlayer calls into GetPlayers batch calls, like a DataLoader does.
+	// E.g. many concurrent GetUser requests make a single call to the players service.
+	Batcher struct {
+		batchClient
+		loader *dataloader.Loader[string, domain.Player]
+	}
+
+	// batchClient is a players service adapter with the batch API.
+	batchClient interface {
+		GetPlayer(ctx context.Context, userID string) (domain.Player, error)
+		GetPlayers(ctx context.Context, userIDs []string) (map[string]domain.Player, error)
+		HealthCheck(ctx context.Context) error
+	}
+)
+
+// NewBatcher is a factory function that creates a new batching decorator of the client.
+func NewBatcher(client batchClient, opts ...dataloader.Option) *Batcher {
+	return &Batcher{
+		batchClient: client,
+		loader:      dataloader.New(client.GetPlayers, opts...),
+	}
+}
+
+// GetPlayer gets a player by userID as a part of the current batch.
+func (b *Batcher) GetPlayer(ctx context.Context, userID string) (domain.Player, error) {
+	p, err := b.loader.Load(ctx, userID)
+	if err != nil {
+		if errors.Is(err, dataloader.ErrNotFound) {
+			return domain.Player{}, fmt.Errorf("failed to get player: %w", playerapi.ErrPlayerNotFound)
+		}
+		return domain.Player{}, err
+	}
+	return p, nil
+}
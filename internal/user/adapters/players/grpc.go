@@ -0,0 +1,157 @@
+package players
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	playerv1 "github.com/dmitrymomot/go-smart-monolith/api/player/v1"
+	"github.com/dmitrymomot/go-smart-monolith/internal/user/domain"
+	"github.com/dmitrymomot/go-smart-monolith/pkg/contracts/playerapi"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/resolver/manual"
+	"google.golang.org/grpc/status"
+)
+
+type (
+	// GRPC is a players service adapter that calls the players service over gRPC.
+	// A single client connection is shared by all the calls: it keeps one HTTP/2
+	// connection per endpoint and balances the calls across them (round robin).
+	// Failed calls are retried by the gRPC library according to the retry policy.
+	GRPC struct {
+		conn    *grpc.ClientConn
+		client  playerv1.PlayerServiceClient
+		health  healthpb.HealthClient
+		timeout time.Duration
+	}
+
+	// GRPCConfig is a configuration for the gRPC players service adapter.
+	GRPCConfig struct {
+		// Endpoints is a list of the players service instances, e.g. "players-1:9090".
+		Endpoints []string
+		// Timeout is applied to the calls if the context has no deadline.
+		Timeout time.Duration
+		// MaxAttempts is the max number of attempts per call including the first one.
+		// Only UNAVAILABLE errors are retried. Values less than 2 disable retries.
+		MaxAttempts int
+	}
+)
+
+// ErrNoEndpoints is returned when the gRPC adapter is created without endpoints.
+var ErrNoEndpoints = errors.New("players service endpoints are not configured")
+
+// resolverScheme is the scheme of the static endpoints resolver.
+const resolverScheme = "players"
+
+// NewGRPC is a factory function that creates a new gRPC player service adapter.
+// It doesn't wait for the connection to be established: the connection is
+// made lazily and is re-established in the background if it's lost.
+// Pass extra dial options to override the defaults, e.g. transport credentials.
+func NewGRPC(cnf GRPCConfig, opts ...grpc.DialOption) (*GRPC, error) {
+	if len(cnf.Endpoints) == 0 {
+		return nil, ErrNoEndpoints
+	}
+
+	// Resolve the static list of endpoints, so the calls are balanced across all of them.
+	r := manual.NewBuilderWithScheme(resolverScheme)
+	addrs := make([]resolver.Address, 0, len(cnf.Endpoints))
+	for _, e := range cnf.Endpoints {
+		addrs = append(addrs, resolver.Address{Addr: e})
+	}
+	r.InitialState(resolver.State{Addresses: addrs})
+
+	opts = append([]grpc.DialOption{
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithResolvers(r),
+		grpc.WithDefaultServiceConfig(serviceConfig(cnf.MaxAttempts)),
+	}, opts...)
+
+	conn, err := grpc.Dial(resolverScheme+":///"+playerv1.PlayerService_ServiceDesc.ServiceName, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial players service: %w", err)
+	}
+
+	return &GRPC{
+		conn:    conn,
+		client:  playerv1.NewPlayerServiceClient(conn),
+		health:  healthpb.NewHealthClient(conn),
+		timeout: cnf.Timeout,
+	}, nil
+}
+
+// GetPlayer gets a player by userID from the players gRPC service.
+func (p *GRPC) GetPlayer(ctx context.Context, userID string) (domain.Player, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	res, err := p.client.GetPlayer(ctx, &playerv1.GetPlayerRequest{UserId: userID})
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return domain.Player{}, fmt.Errorf("failed to get player: %w", playerapi.ErrPlayerNotFound)
+		}
+		return domain.Player{}, fmt.Errorf("failed to get player: %w", err)
+	}
+
+	// Map the player response to the domain model.
+	return domain.Player{
+		UserID:     res.GetPlayer().GetUserId(),
+		PlayerName: res.GetPlayer().GetPlayerName(),
+	}, nil
+}
+
+// HealthCheck checks the players service availability with the standard gRPC health service.
+// It's used by the health checks of the user service.
+func (p *GRPC) HealthCheck(ctx context.Context) error {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	res, err := p.health.Check(ctx, &healthpb.HealthCheckRequest{})
+	if err != nil {
+		return fmt.Errorf("players service is unavailable: %w", err)
+	}
+	if res.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+		return fmt.Errorf("players service is unhealthy: %s", res.GetStatus())
+	}
+
+	return nil
+}
+
+// Close closes the connections to the players service.
+func (p *GRPC) Close() error {
+	return p.conn.Close()
+}
+
+// withTimeout applies the default timeout if the context has no deadline.
+func (p *GRPC) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if _, ok := ctx.Deadline(); ok || p.timeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, p.timeout)
+}
+
+// serviceConfig returns the gRPC service config with the round robin load balancing
+// and the retry policy for the players service methods.
+func serviceConfig(maxAttempts int) string {
+	var retry string
+	if maxAttempts > 1 {
+		retry = fmt.Sprintf(`,"retryPolicy":{
+			"maxAttempts":%d,
+			"initialBackoff":"0.1s",
+			"maxBackoff":"1s",
+			"backoffMultiplier":2,
+			"retryableStatusCodes":["UNAVAILABLE"]
+		}`, maxAttempts)
+	}
+
+	return strings.Join(strings.Fields(fmt.Sprintf(`{
+		"loadBalancingConfig":[{"round_robin":{}}],
+		"methodConfig":[{"name":[{"service":%q}]%s}]
+	}`, playerv1.PlayerService_ServiceDesc.ServiceName, retry)), "")
+}
@@ -0,0 +1,145 @@
+package players_test
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	playerv1 "github.com/dmitrymomot/go-smart-monolith/api/player/v1"
+	"github.com/dmitrymomot/go-smart-monolith/internal/user/adapters/players"
+	"github.com/dmitrymomot/go-smart-monolith/pkg/contracts/playerapi"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// playerServer is a fake players gRPC service instance.
+type playerServer struct {
+	playerv1.UnimplementedPlayerServiceServer
+
+	mu          sync.Mutex
+	calls       int
+	failFirst   int // number of the first calls to fail with UNAVAILABLE
+	hasDeadline bool
+}
+
+func (s *playerServer) GetPlayer(ctx context.Context, req *playerv1.GetPlayerRequest) (*playerv1.GetPlayerResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.calls++
+	_, s.hasDeadline = ctx.Deadline()
+	if s.calls <= s.failFirst {
+		return nil, status.Error(codes.Unavailable, "try again")
+	}
+	if req.GetUserId() == "unknown" {
+		return nil, status.Error(codes.NotFound, "player not found")
+	}
+	return &playerv1.GetPlayerResponse{
+		Player: &playerv1.Player{UserId: req.GetUserId(), PlayerName: "player"},
+	}, nil
+}
+
+func (s *playerServer) callsCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls
+}
+
+// newClient starts the fake instances on bufconn listeners and returns the client
+// balancing across all of them.
+func newClient(t *testing.T, cnf players.GRPCConfig, servers ...*playerServer) *players.GRPC {
+	t.Helper()
+
+	listeners := make(map[string]*bufconn.Listener, len(servers))
+	for i, s := range servers {
+		ln := bufconn.Listen(1 << 20)
+		srv := grpc.NewServer()
+		playerv1.RegisterPlayerServiceServer(srv, s)
+		healthpb.RegisterHealthServer(srv, health.NewServer())
+		go func() { _ = srv.Serve(ln) }()
+		t.Cleanup(srv.Stop)
+
+		addr := string(rune('a' + i))
+		listeners[addr] = ln
+		cnf.Endpoints = append(cnf.Endpoints, addr)
+	}
+
+	c, err := players.NewGRPC(cnf, grpc.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+		return listeners[addr].DialContext(ctx)
+	}))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = c.Close() })
+
+	return c
+}
+
+func TestGRPC_GetPlayer(t *testing.T) {
+	s := &playerServer{}
+	c := newClient(t, players.GRPCConfig{Timeout: time.Second}, s)
+	ctx := context.Background()
+
+	p, err := c.GetPlayer(ctx, "user-1")
+	require.NoError(t, err)
+	require.Equal(t, "user-1", p.UserID)
+	require.Equal(t, "player", p.PlayerName)
+	require.True(t, s.hasDeadline, "default timeout must be applied")
+
+	_, err = c.GetPlayer(ctx, "unknown")
+	require.ErrorIs(t, err, playerapi.ErrPlayerNotFound)
+
+	require.NoError(t, c.HealthCheck(ctx))
+}
+
+func TestGRPC_Retry(t *testing.T) {
+	t.Run("retries unavailable", func(t *testing.T) {
+		s := &playerServer{failFirst: 2}
+		c := newClient(t, players.GRPCConfig{MaxAttempts: 3}, s)
+
+		_, err := c.GetPlayer(context.Background(), "user-1")
+		require.NoError(t, err)
+		require.Equal(t, 3, s.callsCount())
+	})
+
+	t.Run("gives up after max attempts", func(t *testing.T) {
+		s := &playerServer{failFirst: 5}
+		c := newClient(t, players.GRPCConfig{MaxAttempts: 2}, s)
+
+		_, err := c.GetPlayer(context.Background(), "user-1")
+		require.Equal(t, codes.Unavailable, status.Code(err))
+		require.Equal(t, 2, s.callsCount())
+	})
+
+	t.Run("not found is not retried", func(t *testing.T) {
+		s := &playerServer{}
+		c := newClient(t, players.GRPCConfig{MaxAttempts: 3}, s)
+
+		_, err := c.GetPlayer(context.Background(), "unknown")
+		require.ErrorIs(t, err, playerapi.ErrPlayerNotFound)
+		require.Equal(t, 1, s.callsCount())
+	})
+}
+
+func TestGRPC_LoadBalancing(t *testing.T) {
+	s1, s2 := &playerServer{}, &playerServer{}
+	c := newClient(t, players.GRPCConfig{}, s1, s2)
+
+	// Wait for both connections to be ready, round robin skips the connecting ones.
+	require.Eventually(t, func() bool {
+		if _, err := c.GetPlayer(context.Background(), "user-1"); err != nil {
+			return false
+		}
+		return s1.callsCount() > 0 && s2.callsCount() > 0
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestNewGRPC_NoEndpoints(t *testing.T) {
+	_, err := players.NewGRPC(players.GRPCConfig{})
+	require.ErrorIs(t, err, players.ErrNoEndpoints)
+}
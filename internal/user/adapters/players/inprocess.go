@@ -0,0 +1,83 @@
+package players
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/dmitrymomot/go-smart-monolith/internal/user/domain"
+	"github.com/dmitrymomot/go-smart-monolith/pkg/contracts/playerapi"
+)
+
+// InProcess is a players service adapter that calls the players module directly,
+// when it's built into the same binary. It avoids HTTP calls to itself in the monolith,
+// while the user service code stays the same for any deployment topology.
+type InProcess struct {
+	svc playerapi.Service
+}
+
+// NewInProcess is a factory function that creates a new in-process player service adapter.
+func NewInProcess(svc playerapi.Service) *InProcess {
+	return &InProcess{svc: svc}
+}
+
+// GetPlayer gets a player by userID from the players module.
+func (p *InProcess) GetPlayer(ctx context.Context, userID string) (domain.Player, error) {
+	player, err := p.svc.GetPlayer(ctx, userID)
+	if err != nil {
+		return domain.Player{}, fmt.Errorf("failed to get player: %w", err)
+	}
+
+	// Map the players service model to the domain model.
+	return domain.Player{
+		UserID:     player.UserID,
+		PlayerName: player.PlayerName,
+	}, nil
+}
+
+// GetPlayers gets the players of the given users from the players module in one call.
+// If the module has no batch API, the players are got one by one, which is cheap in-process.
+// The users without a player are not included in the result.
+func (p *InProcess) GetPlayers(ctx context.Context, userIDs []string) (map[string]domain.Player, error) {
+	var (
+		players map[string]playerapi.Player
+		err     error
+	)
+	if bs, ok := p.svc.(playerapi.BatchService); ok {
+		players, err = bs.GetPlayers(ctx, userIDs)
+	} else {
+		players, err = getPlayersOneByOne(ctx, p.svc, userIDs)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get players: %w", err)
+	}
+
+	res := make(map[string]domain.Player, len(players))
+	for id, player := range players {
+		res[id] = domain.Player{
+			UserID:     player.UserID,
+			PlayerName: player.PlayerName,
+		}
+	}
+	return res, nil
+}
+
+func getPlayersOneByOne(ctx context.Context, svc playerapi.Service, userIDs []string) (map[string]playerapi.Player, error) {
+	res := make(map[string]playerapi.Player, len(userIDs))
+	for _, id := range userIDs {
+		player, err := svc.GetPlayer(ctx, id)
+		if err != nil {
+			if errors.Is(err, playerapi.ErrPlayerNotFound) {
+				continue
+			}
+			return nil, err
+		}
+		res[id] = player
+	}
+	return res, nil
+}
+
+// HealthCheck always succeeds, since the players module is a part of the same process.
+func (p *InProcess) HealthCheck(ctx context.Context) error {
+	return nil
+}
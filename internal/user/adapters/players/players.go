@@ -3,10 +3,12 @@ package players
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 
 	"github.com/dmitrymomot/go-smart-monolith/internal/user/domain"
+	"github.com/dmitrymomot/go-smart-monolith/pkg/contracts/playerapi"
 )
 
 type (
@@ -51,8 +53,13 @@ func (p *Player) GetPlayer(ctx context.Context, userID string) (domain.Player, e
 		return domain.Player{}, fmt.Errorf("failed to get player: %w", err)
 	}
 
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusNotFound {
+		return domain.Player{}, fmt.Errorf("failed to get player: %w", playerapi.ErrPlayerNotFound)
+	}
 	if res.StatusCode != http.StatusOK {
-		return domain.Player{}, fmt.Errorf("failed to get player: %w", err)
+		return domain.Player{}, fmt.Errorf("failed to get player: unexpected status %s", res.Status)
 	}
 
 	var player PlayerResponse
@@ -68,3 +75,23 @@ func (p *Player) GetPlayer(ctx context.Context, userID string) (domain.Player, e
 		PlayerName: player.PlayerName,
 	}, nil
 }
+
+// HealthCheck checks the players service availability.
+// It's used by the health checks of the user service.
+func (p *Player) HealthCheck(ctx context.Context) error {
+	if p.config.Endpoint == "" {
+		return errors.New("players service endpoint is not configured")
+	}
+
+	res, err := p.httpClient.Get(p.config.Endpoint + "/healthz")
+	if err != nil {
+		return fmt.Errorf("players service is unavailable: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("players service is unhealthy: %s", res.Status)
+	}
+
+	return nil
+}
@@ -0,0 +1,169 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/dmitrymomot/go-smart-monolith/internal/user/domain"
+	kvstorage "github.com/dmitrymomot/go-smart-monolith/pkg/storage"
+)
+
+// apiKeyPrefix is the key prefix of the API keys.
+// The keys are "<prefix><user id>:<key id>", so the keys of a user are listed by a scan.
+const apiKeyPrefix = "user_api_key:"
+
+// apiKeyHashIndexPrefix is the key prefix of the API keys index by the key hash.
+// The index keys are "<prefix><key hash>", the values are the API key storage keys.
+const apiKeyHashIndexPrefix = "user_api_key_hash:"
+
+// StoreAPIKey stores the API key and indexes it by its hash.
+// The index of the previous hash is removed if the key is rotated,
+// and the revoked keys are not indexed, so they can't be found by the hash.
+// The stored keys are changed with UpdateAPIKey, so the concurrent changes are not lost.
+func (s *Storage) StoreAPIKey(ctx context.Context, key domain.APIKey) error {
+	prev, err := s.GetAPIKey(ctx, key.UserID, key.ID)
+	if err != nil && !errors.Is(err, domain.ErrAPIKeyNotFound) {
+		return err
+	}
+
+	if err := s.client.Set(ctx, apiKeyKey(key.UserID, key.ID), key); err != nil {
+		return err
+	}
+	return s.reindexAPIKey(ctx, prev, key)
+}
+
+// UpdateAPIKey applies fn to the stored API key and reindexes it by its hash, see StoreAPIKey.
+// The key is not changed if fn returns an error, e.g. domain.ErrAPIKeyRevoked
+// when the key has been revoked concurrently, if the storage client supports the atomic updates.
+func (s *Storage) UpdateAPIKey(ctx context.Context, userID, id string, fn func(k *domain.APIKey) error) (domain.APIKey, error) {
+	var prev, next domain.APIKey
+	update := func(v interface{}, ok bool) (interface{}, error) {
+		if !ok {
+			return nil, domain.ErrAPIKeyNotFound
+		}
+		prev = v.(domain.APIKey)
+		next = prev
+		if err := fn(&next); err != nil {
+			return nil, err
+		}
+		return next, nil
+	}
+
+	var err error
+	if u, ok := s.client.(updater); ok {
+		err = u.Update(ctx, apiKeyKey(userID, id), update)
+	} else {
+		var v interface{}
+		v, err = s.client.Get(ctx, apiKeyKey(userID, id))
+		if err != nil && !errors.Is(err, kvstorage.ErrNotFound) {
+			return domain.APIKey{}, err
+		}
+		if v, err = update(v, err == nil); err == nil {
+			err = s.client.Set(ctx, apiKeyKey(userID, id), v)
+		}
+	}
+	if err != nil {
+		return domain.APIKey{}, err
+	}
+	return next, s.reindexAPIKey(ctx, prev, next)
+}
+
+// reindexAPIKey moves the hash index from the previous version of the key to the next one.
+func (s *Storage) reindexAPIKey(ctx context.Context, prev, next domain.APIKey) error {
+	if prev.Hash != "" && (prev.Hash != next.Hash || next.IsRevoked()) {
+		if err := s.client.Delete(ctx, apiKeyHashIndexPrefix+prev.Hash); err != nil {
+			return err
+		}
+	}
+	if next.IsRevoked() {
+		return nil
+	}
+	return s.client.Set(ctx, apiKeyHashIndexPrefix+next.Hash, apiKeyKey(next.UserID, next.ID))
+}
+
+// GetAPIKey gets the API key of the user by ID.
+func (s *Storage) GetAPIKey(ctx context.Context, userID, id string) (domain.APIKey, error) {
+	v, err := s.client.Get(ctx, apiKeyKey(userID, id))
+	if err != nil {
+		if errors.Is(err, kvstorage.ErrNotFound) {
+			return domain.APIKey{}, domain.ErrAPIKeyNotFound
+		}
+		return domain.APIKey{}, err
+	}
+	return v.(domain.APIKey), nil
+}
+
+// GetAPIKeyByHash gets the API key by its hash.
+// It returns domain.ErrInvalidAPIKey if there is no active key with the hash.
+func (s *Storage) GetAPIKeyByHash(ctx context.Context, hash string) (domain.APIKey, error) {
+	v, err := s.client.Get(ctx, apiKeyHashIndexPrefix+hash)
+	if err != nil {
+		if errors.Is(err, kvstorage.ErrNotFound) {
+			return domain.APIKey{}, domain.ErrInvalidAPIKey
+		}
+		return domain.APIKey{}, err
+	}
+	v, err = s.client.Get(ctx, v.(string))
+	if err != nil {
+		if errors.Is(err, kvstorage.ErrNotFound) {
+			return domain.APIKey{}, domain.ErrInvalidAPIKey
+		}
+		return domain.APIKey{}, err
+	}
+
+	// The index may be stale if the key has been rotated concurrently.
+	key := v.(domain.APIKey)
+	if key.Hash != hash {
+		return domain.APIKey{}, domain.ErrInvalidAPIKey
+	}
+	return key, nil
+}
+
+// ListAPIKeys lists the API keys of the user, including the revoked ones.
+func (s *Storage) ListAPIKeys(ctx context.Context, userID string) ([]domain.APIKey, error) {
+	kvs, err := s.client.Scan(ctx, kvstorage.ScanOptions{Prefix: apiKeyPrefix + userID + ":"})
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]domain.APIKey, 0, len(kvs))
+	for _, kv := range kvs {
+		keys = append(keys, kv.Value.(domain.APIKey))
+	}
+	return keys, nil
+}
+
+// TouchAPIKey records when the API key was used.
+// Only the last used time is changed, so a concurrent revocation is not overwritten
+// if the storage client supports the atomic updates.
+func (s *Storage) TouchAPIKey(ctx context.Context, key domain.APIKey, usedAt time.Time) error {
+	touch := func(v interface{}, ok bool) (interface{}, error) {
+		if !ok {
+			return nil, domain.ErrAPIKeyNotFound
+		}
+		k := v.(domain.APIKey)
+		if usedAt.After(k.LastUsedAt) {
+			k.LastUsedAt = usedAt.UTC()
+		}
+		return k, nil
+	}
+
+	if u, ok := s.client.(updater); ok {
+		return u.Update(ctx, apiKeyKey(key.UserID, key.ID), touch)
+	}
+
+	v, err := s.client.Get(ctx, apiKeyKey(key.UserID, key.ID))
+	if err != nil && !errors.Is(err, kvstorage.ErrNotFound) {
+		return err
+	}
+	next, err := touch(v, err == nil)
+	if err != nil {
+		return err
+	}
+	return s.client.Set(ctx, apiKeyKey(key.UserID, key.ID), next)
+}
+
+func apiKeyKey(userID, id string) string {
+	return apiKeyPrefix + userID + ":" + id
+}
@@ -0,0 +1,95 @@
+package storage
+
+import (
+	"context"
+	"errors"
+
+	"github.com/dmitrymomot/go-smart-monolith/internal/user/domain"
+	kvstorage "github.com/dmitrymomot/go-smart-monolith/pkg/storage"
+)
+
+// identityIndexPrefix is the key prefix of the users index by the linked identities.
+// The keys are "<prefix><provider>:<subject>", the values are the user IDs.
+// The index is maintained by StoreUser and DeleteUser.
+const identityIndexPrefix = "user_identity:"
+
+// oidcLoginStatePrefix is the key prefix of the pending OIDC logins.
+// The keys are "<prefix><state hash>".
+const oidcLoginStatePrefix = "user_oidc_state:"
+
+// GetUserByIdentity gets the user linked to the identity provider account.
+// It returns domain.ErrUserNotFound if no user is linked to it.
+func (s *Storage) GetUserByIdentity(ctx context.Context, provider, subject string) (domain.User, error) {
+	v, err := s.client.Get(ctx, identityIndexKey(domain.Identity{Provider: provider, Subject: subject}))
+	if err != nil {
+		return domain.User{}, mapError(err)
+	}
+	user, err := s.GetUserByID(ctx, v.(string))
+	if err != nil {
+		return domain.User{}, err
+	}
+	// The index entry may be stale if the identity was unlinked concurrently.
+	if !user.HasIdentity(provider, subject) {
+		return domain.User{}, domain.ErrUserNotFound
+	}
+	return user, nil
+}
+
+// StoreOIDCLoginState stores the pending OIDC login by its state hash until it expires,
+// if the storage client supports the expiring keys.
+func (s *Storage) StoreOIDCLoginState(ctx context.Context, state domain.OIDCLoginState) error {
+	return s.setUntil(ctx, oidcLoginStatePrefix+state.Hash, state, state.ExpiresAt)
+}
+
+// TakeOIDCLoginState gets the pending OIDC login by its state hash and deletes it,
+// so it can't be completed again. Only one of the concurrent callers gets the login
+// if the storage client supports the atomic read-and-delete.
+// It returns domain.ErrInvalidOIDCState if the login doesn't exist.
+func (s *Storage) TakeOIDCLoginState(ctx context.Context, hash string) (domain.OIDCLoginState, error) {
+	v, err := s.take(ctx, oidcLoginStatePrefix+hash)
+	if err != nil {
+		if errors.Is(err, kvstorage.ErrNotFound) {
+			return domain.OIDCLoginState{}, domain.ErrInvalidOIDCState
+		}
+		return domain.OIDCLoginState{}, err
+	}
+	return v.(domain.OIDCLoginState), nil
+}
+
+// checkIdentities checks that the user identities are not linked to other users.
+func (s *Storage) checkIdentities(ctx context.Context, user domain.User) error {
+	for _, id := range user.Identities {
+		v, err := s.client.Get(ctx, identityIndexKey(id))
+		if errors.Is(err, kvstorage.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if v.(string) != user.ID {
+			return domain.ErrIdentityTaken
+		}
+	}
+	return nil
+}
+
+// updateIdentityIndex indexes the user identities and removes the unlinked ones.
+func (s *Storage) updateIdentityIndex(ctx context.Context, prev, user domain.User) error {
+	for _, id := range user.Identities {
+		if err := s.client.Set(ctx, identityIndexKey(id), user.ID); err != nil {
+			return err
+		}
+	}
+	for _, id := range prev.Identities {
+		if !user.HasIdentity(id.Provider, id.Subject) {
+			if err := s.client.Delete(ctx, identityIndexKey(id)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func identityIndexKey(id domain.Identity) string {
+	return identityIndexPrefix + id.Provider + ":" + id.Subject
+}
@@ -0,0 +1,75 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/dmitrymomot/go-smart-monolith/internal/user/domain"
+	kvstorage "github.com/dmitrymomot/go-smart-monolith/pkg/storage"
+)
+
+// loginAttemptsPrefix is the key prefix of the failed login attempts.
+// The keys are "<prefix><attempts key>", see domain.AccountAttemptsKey and domain.IPAttemptsKey.
+const loginAttemptsPrefix = "user_login_attempts:"
+
+// Optional atomic read-modify-write of the low-level storage client setting the key TTL,
+// e.g. WATCH/MULTI with SET ... EX in redis.
+type ttlUpdater interface {
+	UpdateWithTTL(ctx context.Context, key string, fn func(v interface{}, ok bool) (interface{}, time.Duration, error)) error
+}
+
+// GetLoginAttempts gets the failed login attempts by the key.
+// The zero attempts are returned if there are none.
+func (s *Storage) GetLoginAttempts(ctx context.Context, key string) (domain.LoginAttempts, error) {
+	v, err := s.client.Get(ctx, loginAttemptsPrefix+key)
+	if err != nil {
+		if errors.Is(err, kvstorage.ErrNotFound) {
+			return domain.LoginAttempts{Key: key}, nil
+		}
+		return domain.LoginAttempts{}, err
+	}
+	return v.(domain.LoginAttempts), nil
+}
+
+// UpdateLoginAttempts applies fn to the login attempts of the key and stores them until they expire.
+// The concurrent attempts are not lost if the storage client supports the atomic updates.
+func (s *Storage) UpdateLoginAttempts(ctx context.Context, key string, fn func(a *domain.LoginAttempts)) (domain.LoginAttempts, error) {
+	var res domain.LoginAttempts
+	update := func(v interface{}, ok bool) (interface{}, time.Duration, error) {
+		res = domain.LoginAttempts{Key: key}
+		if ok {
+			res = v.(domain.LoginAttempts)
+		}
+		fn(&res)
+		// Zero TTL means no expiration, so the expired attempts, e.g. the refunded ones, expire at once.
+		ttl := time.Until(res.ExpiresAt)
+		if ttl <= 0 {
+			ttl = time.Nanosecond
+		}
+		return res, ttl, nil
+	}
+
+	if u, ok := s.client.(ttlUpdater); ok {
+		// res is set by update, so it's returned only after UpdateWithTTL is done.
+		err := u.UpdateWithTTL(ctx, loginAttemptsPrefix+key, update)
+		return res, err
+	}
+
+	v, err := s.client.Get(ctx, loginAttemptsPrefix+key)
+	if err != nil && !errors.Is(err, kvstorage.ErrNotFound) {
+		return domain.LoginAttempts{}, err
+	}
+	next, ttl, _ := update(v, err == nil)
+	if c, ok := s.client.(ttlSetter); ok {
+		err = c.SetWithTTL(ctx, loginAttemptsPrefix+key, next, ttl)
+	} else {
+		err = s.client.Set(ctx, loginAttemptsPrefix+key, next)
+	}
+	return res, err
+}
+
+// DeleteLoginAttempts forgets the failed login attempts of the key, so its login is unlocked.
+func (s *Storage) DeleteLoginAttempts(ctx context.Context, key string) error {
+	return s.client.Delete(ctx, loginAttemptsPrefix+key)
+}
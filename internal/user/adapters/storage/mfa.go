@@ -0,0 +1,59 @@
+package storage
+
+import (
+	"context"
+	"errors"
+
+	"github.com/dmitrymomot/go-smart-monolith/internal/user/domain"
+	kvstorage "github.com/dmitrymomot/go-smart-monolith/pkg/storage"
+)
+
+// mfaChallengePrefix is the key prefix of the login MFA challenges.
+// The keys are "<prefix><token hash>".
+const mfaChallengePrefix = "user_mfa_challenge:"
+
+// StoreMFAChallenge stores the login MFA challenge by its hash until it expires,
+// if the storage client supports the expiring keys.
+func (s *Storage) StoreMFAChallenge(ctx context.Context, challenge domain.MFAChallenge) error {
+	return s.setUntil(ctx, mfaChallengePrefix+challenge.Hash, challenge, challenge.ExpiresAt)
+}
+
+// UpdateMFAChallenge applies fn to the login MFA challenge and stores it, keeping its expiration.
+// The challenge is not changed if fn returns an error. The concurrent attempts are not lost
+// if the storage client supports the atomic updates.
+// It returns domain.ErrInvalidMFAChallenge if the challenge doesn't exist.
+func (s *Storage) UpdateMFAChallenge(ctx context.Context, hash string, fn func(c *domain.MFAChallenge) error) (domain.MFAChallenge, error) {
+	var res domain.MFAChallenge
+	update := func(v interface{}, ok bool) (interface{}, error) {
+		if !ok {
+			return nil, domain.ErrInvalidMFAChallenge
+		}
+		res = v.(domain.MFAChallenge)
+		if err := fn(&res); err != nil {
+			return nil, err
+		}
+		return res, nil
+	}
+
+	if u, ok := s.client.(updater); ok {
+		// res is set by update, so it's returned only after Update is done.
+		err := u.Update(ctx, mfaChallengePrefix+hash, update)
+		return res, err
+	}
+
+	v, err := s.client.Get(ctx, mfaChallengePrefix+hash)
+	if err != nil && !errors.Is(err, kvstorage.ErrNotFound) {
+		return domain.MFAChallenge{}, err
+	}
+	if _, err = update(v, err == nil); err != nil {
+		return domain.MFAChallenge{}, err
+	}
+	err = s.StoreMFAChallenge(ctx, res)
+	return res, err
+}
+
+// DeleteMFAChallenge deletes the login MFA challenge by its hash,
+// so it can't be used again.
+func (s *Storage) DeleteMFAChallenge(ctx context.Context, hash string) error {
+	return s.client.Delete(ctx, mfaChallengePrefix+hash)
+}
@@ -0,0 +1,34 @@
+package storage
+
+import (
+	"context"
+	"errors"
+
+	"github.com/dmitrymomot/go-smart-monolith/internal/user/domain"
+	kvstorage "github.com/dmitrymomot/go-smart-monolith/pkg/storage"
+)
+
+// passwordResetTokenPrefix is the key prefix of the password reset tokens.
+// The keys are "<prefix><token hash>".
+const passwordResetTokenPrefix = "user_password_reset_token:"
+
+// StorePasswordResetToken stores the password reset token by its hash until it expires,
+// if the storage client supports the expiring keys.
+func (s *Storage) StorePasswordResetToken(ctx context.Context, token domain.PasswordResetToken) error {
+	return s.setUntil(ctx, passwordResetTokenPrefix+token.Hash, token, token.ExpiresAt)
+}
+
+// TakePasswordResetToken gets the password reset token by its hash and deletes it,
+// so it can't be used again. Only one of the concurrent callers gets the token
+// if the storage client supports the atomic read-and-delete.
+// It returns domain.ErrInvalidPasswordResetToken if the token doesn't exist.
+func (s *Storage) TakePasswordResetToken(ctx context.Context, hash string) (domain.PasswordResetToken, error) {
+	v, err := s.take(ctx, passwordResetTokenPrefix+hash)
+	if err != nil {
+		if errors.Is(err, kvstorage.ErrNotFound) {
+			return domain.PasswordResetToken{}, domain.ErrInvalidPasswordResetToken
+		}
+		return domain.PasswordResetToken{}, err
+	}
+	return v.(domain.PasswordResetToken), nil
+}
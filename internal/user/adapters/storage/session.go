@@ -0,0 +1,109 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/dmitrymomot/go-smart-monolith/internal/user/domain"
+	kvstorage "github.com/dmitrymomot/go-smart-monolith/pkg/storage"
+)
+
+// sessionPrefix is the key prefix of the user sessions.
+// The keys are "<prefix><user id>:<session id>", so the sessions of a user are listed by a scan.
+const sessionPrefix = "user_session:"
+
+// Optional expiring keys of the low-level storage client, e.g. SET ... EX in redis.
+type ttlSetter interface {
+	SetWithTTL(ctx context.Context, key string, value interface{}, ttl time.Duration) error
+}
+
+// StoreSession stores the session until it expires, if the storage client supports the expiring keys.
+// Otherwise the expired sessions are kept until they are deleted, the callers must check the expiration.
+func (s *Storage) StoreSession(ctx context.Context, session domain.Session) error {
+	key := sessionKey(session.UserID, session.ID)
+	if c, ok := s.client.(ttlSetter); ok {
+		return c.SetWithTTL(ctx, key, session, time.Until(session.ExpiresAt))
+	}
+	return s.client.Set(ctx, key, session)
+}
+
+// GetSession gets the session of the user by ID.
+func (s *Storage) GetSession(ctx context.Context, userID, id string) (domain.Session, error) {
+	v, err := s.client.Get(ctx, sessionKey(userID, id))
+	if err != nil {
+		if errors.Is(err, kvstorage.ErrNotFound) {
+			return domain.Session{}, domain.ErrSessionNotFound
+		}
+		return domain.Session{}, err
+	}
+	return v.(domain.Session), nil
+}
+
+// ListSessions lists the stored sessions of the user.
+func (s *Storage) ListSessions(ctx context.Context, userID string) ([]domain.Session, error) {
+	kvs, err := s.client.Scan(ctx, kvstorage.ScanOptions{Prefix: sessionPrefix + userID + ":"})
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := make([]domain.Session, 0, len(kvs))
+	for _, kv := range kvs {
+		sessions = append(sessions, kv.Value.(domain.Session))
+	}
+	return sessions, nil
+}
+
+// TouchSession records when the session was last seen.
+// Only the last seen time is changed, so a concurrently revoked session is not stored again
+// if the storage client supports the atomic updates.
+func (s *Storage) TouchSession(ctx context.Context, session domain.Session, seenAt time.Time) error {
+	touch := func(v interface{}, ok bool) (interface{}, error) {
+		if !ok {
+			return nil, domain.ErrSessionNotFound
+		}
+		sess := v.(domain.Session)
+		if seenAt.After(sess.LastSeenAt) {
+			sess.LastSeenAt = seenAt.UTC()
+		}
+		return sess, nil
+	}
+
+	key := sessionKey(session.UserID, session.ID)
+	if u, ok := s.client.(updater); ok {
+		return u.Update(ctx, key, touch)
+	}
+
+	v, err := s.client.Get(ctx, key)
+	if err != nil && !errors.Is(err, kvstorage.ErrNotFound) {
+		return err
+	}
+	next, err := touch(v, err == nil)
+	if err != nil {
+		return err
+	}
+	return s.StoreSession(ctx, next.(domain.Session))
+}
+
+// DeleteSession deletes the session of the user, so its access tokens stop working.
+func (s *Storage) DeleteSession(ctx context.Context, userID, id string) error {
+	return s.client.Delete(ctx, sessionKey(userID, id))
+}
+
+// DeleteSessions deletes all the sessions of the user.
+func (s *Storage) DeleteSessions(ctx context.Context, userID string) error {
+	sessions, err := s.ListSessions(ctx, userID)
+	if err != nil {
+		return err
+	}
+	for _, sess := range sessions {
+		if err := s.DeleteSession(ctx, userID, sess.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func sessionKey(userID, id string) string {
+	return sessionPrefix + userID + ":" + id
+}
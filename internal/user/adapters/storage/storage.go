@@ -2,8 +2,15 @@ package storage
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
 
 	"github.com/dmitrymomot/go-smart-monolith/internal/user/domain"
+	kvstorage "github.com/dmitrymomot/go-smart-monolith/pkg/storage"
 )
 
 type (
@@ -17,9 +24,59 @@ type (
 	storageClient interface {
 		Get(ctx context.Context, key string) (interface{}, error)
 		Set(ctx context.Context, key string, value interface{}) error
+		Scan(ctx context.Context, opts kvstorage.ScanOptions) ([]kvstorage.KV, error)
+		Delete(ctx context.Context, key string) error
+	}
+
+	// cursor is the position in the users list.
+	// It's encoded to an opaque string, so the clients don't depend on its format.
+	cursor struct {
+		Key  string `json:"k"`
+		Desc bool   `json:"d,omitempty"`
+	}
+
+	// Optional bulk read of the low-level storage client, e.g. MGET in redis.
+	multiGetter interface {
+		GetMulti(ctx context.Context, keys []string) (map[string]interface{}, error)
+	}
+
+	// Optional atomic read-modify-write of the low-level storage client,
+	// e.g. WATCH/MULTI in redis or SELECT ... FOR UPDATE in pg.
+	updater interface {
+		Update(ctx context.Context, key string, fn func(v interface{}, ok bool) (interface{}, error)) error
+	}
+
+	// Optional atomic read-and-delete of the low-level storage client, e.g. GETDEL in redis.
+	getDeleter interface {
+		GetDelete(ctx context.Context, key string) (interface{}, error)
 	}
 )
 
+// userPrefix is the key prefix of the users stored by ID: "<prefix><id>".
+const userPrefix = "user:"
+
+// emailPrefix is the key prefix of the users email index: "<prefix><email>".
+// The values are the user IDs, the index is the claim of the email by the user.
+// The users have their own prefixes, so the caller-supplied emails and IDs
+// can't resolve to the other records of the shared storage, or to each other.
+const emailPrefix = "user_email:"
+
+// errUnexpectedValue is returned when a user key holds a value of another type,
+// e.g. written by another service sharing the storage.
+var errUnexpectedValue = errors.New("unexpected value type")
+
+// createdAtIndexPrefix is the key prefix of the users index sorted by the creation time.
+// The index keys are "<prefix><created_at>:<id>", so the users created at the same time
+// are sorted by ID. The values are the user IDs.
+const createdAtIndexPrefix = "user_created_at:"
+
+// deletedAtIndexPrefix is the key prefix of the soft deleted users index sorted by the deletion time.
+// It's used to find the users to be purged. The values are the user IDs.
+const deletedAtIndexPrefix = "user_deleted_at:"
+
+// createdAtLayout is a fixed-width time layout, so the formatted times are sorted lexicographically.
+const createdAtLayout = "2006-01-02T15:04:05.000000000Z"
+
 // New is a factory function that creates a new storage service adapter.
 func New(client storageClient) *Storage {
 	return &Storage{
@@ -29,24 +86,421 @@ func New(client storageClient) *Storage {
 
 // GetUserByID gets a user by ID.
 func (s *Storage) GetUserByID(ctx context.Context, id string) (domain.User, error) {
-	v, err := s.client.Get(ctx, id)
+	v, err := s.client.Get(ctx, userKey(id))
 	if err != nil {
-		return domain.User{}, err
+		return domain.User{}, mapError(err)
 	}
-	return v.(domain.User), nil
+	return toUser(v)
+}
+
+// GetUsersByIDs gets the users by IDs in one call if the storage client supports it.
+// The missing users are not included in the result.
+func (s *Storage) GetUsersByIDs(ctx context.Context, ids []string) (map[string]domain.User, error) {
+	res := make(map[string]domain.User, len(ids))
+
+	if mg, ok := s.client.(multiGetter); ok {
+		keys := make([]string, 0, len(ids))
+		for _, id := range ids {
+			keys = append(keys, userKey(id))
+		}
+		values, err := mg.GetMulti(ctx, keys)
+		if err != nil {
+			return nil, err
+		}
+		for key, v := range values {
+			u, err := toUser(v)
+			if err != nil {
+				return nil, err
+			}
+			res[strings.TrimPrefix(key, userPrefix)] = u
+		}
+		return res, nil
+	}
+
+	for _, id := range ids {
+		u, err := s.GetUserByID(ctx, id)
+		if err != nil {
+			if errors.Is(err, domain.ErrUserNotFound) {
+				continue
+			}
+			return nil, err
+		}
+		res[id] = u
+	}
+	return res, nil
 }
 
 // GetUserByEmail gets a user by email.
-// It's just an example of a different method. Don't pay attention to implementation.
 func (s *Storage) GetUserByEmail(ctx context.Context, email string) (domain.User, error) {
-	v, err := s.client.Get(ctx, email)
+	id, err := s.emailOwner(ctx, email)
+	if err != nil {
+		return domain.User{}, mapError(err)
+	}
+	u, err := s.GetUserByID(ctx, id)
 	if err != nil {
 		return domain.User{}, err
 	}
-	return v.(domain.User), nil
+	// The email is claimed before the user is stored, so the claim of the store
+	// in progress or failed doesn't resolve to the user.
+	if u.Email != email {
+		return domain.User{}, domain.ErrUserNotFound
+	}
+	return u, nil
+}
+
+// ListUsers lists the users matching the filter, starting from the filter cursor.
+// It returns the cursor of the next page, or an empty string if it's the last page.
+func (s *Storage) ListUsers(ctx context.Context, filter domain.ListUsersFilter) ([]domain.User, string, error) {
+	opts := kvstorage.ScanOptions{
+		Prefix:  createdAtIndexPrefix,
+		Reverse: filter.Desc,
+		Limit:   filter.Limit + 1, // One more to know if there is the next page.
+	}
+	if !filter.CreatedFrom.IsZero() {
+		opts.Start = createdAtIndexPrefix + filter.CreatedFrom.UTC().Format(createdAtLayout)
+	}
+	if !filter.CreatedTo.IsZero() {
+		opts.End = createdAtIndexPrefix + filter.CreatedTo.UTC().Format(createdAtLayout)
+	}
+	if filter.Cursor != "" {
+		c, err := decodeCursor(filter.Cursor)
+		if err != nil || c.Desc != filter.Desc || !strings.HasPrefix(c.Key, createdAtIndexPrefix) {
+			return nil, "", domain.ErrInvalidCursor
+		}
+		// Continue right after the last key of the previous page.
+		if filter.Desc {
+			opts.End = c.Key
+		} else {
+			opts.Start = c.Key + "\x00"
+		}
+	}
+
+	// Scan the index until the page is full, since the email filter may skip some users.
+	var (
+		users []domain.User
+		keys  []string
+	)
+	for len(users) <= filter.Limit {
+		kvs, err := s.client.Scan(ctx, opts)
+		if err != nil {
+			return nil, "", err
+		}
+		if len(kvs) == 0 {
+			break
+		}
+
+		ids := make([]string, 0, len(kvs))
+		for _, kv := range kvs {
+			ids = append(ids, kv.Value.(string))
+		}
+		found, err := s.GetUsersByIDs(ctx, ids)
+		if err != nil {
+			return nil, "", err
+		}
+
+		for _, kv := range kvs {
+			u, ok := found[kv.Value.(string)]
+			if !ok || u.IsDeleted() || !strings.HasPrefix(u.Email, filter.EmailPrefix) {
+				continue
+			}
+			users = append(users, u)
+			keys = append(keys, kv.Key)
+		}
+
+		if len(kvs) < opts.Limit {
+			break
+		}
+		last := kvs[len(kvs)-1].Key
+		if filter.Desc {
+			opts.End = last
+		} else {
+			opts.Start = last + "\x00"
+		}
+	}
+
+	if len(users) <= filter.Limit {
+		return users, "", nil
+	}
+
+	users = users[:filter.Limit]
+	return users, encodeCursor(cursor{Key: keys[filter.Limit-1], Desc: filter.Desc}), nil
+}
+
+// ListDeletedUsers lists up to limit users soft deleted before the given time,
+// the earliest deleted first.
+func (s *Storage) ListDeletedUsers(ctx context.Context, before time.Time, limit int) ([]domain.User, error) {
+	kvs, err := s.client.Scan(ctx, kvstorage.ScanOptions{
+		Prefix: deletedAtIndexPrefix,
+		End:    deletedAtIndexPrefix + before.UTC().Format(createdAtLayout),
+		Limit:  limit,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	users := make([]domain.User, 0, len(kvs))
+	for _, kv := range kvs {
+		u, err := s.GetUserByID(ctx, kv.Value.(string))
+		if err != nil {
+			if errors.Is(err, domain.ErrUserNotFound) {
+				continue
+			}
+			return nil, err
+		}
+		users = append(users, u)
+	}
+	return users, nil
 }
 
 // StoreUser stores a user.
+// The user is stored by ID and indexed by email, so it can be found by both,
+// and is added to the creation time index to be listed, and by its linked identities.
+// If the user is updated, the email and the deletion indexes are kept consistent:
+// the old email is released and the user is (un)listed for purging.
+//
+// The email is claimed before the user is stored, atomically if the storage client
+// supports it, so only one of the concurrent signups with the same email succeeds,
+// the others get domain.ErrEmailTaken.
+//
+// The user is stored only if its version matches the stored one,
+// otherwise domain.ErrConcurrentModification is returned.
+// The stored version is incremented, so the user must be read again to be updated again.
 func (s *Storage) StoreUser(ctx context.Context, user domain.User) error {
-	return s.client.Set(ctx, user.Email, user)
+	// The identities must not belong to another user.
+	if err := s.checkIdentities(ctx, user); err != nil {
+		return err
+	}
+
+	claimed, err := s.claimEmail(ctx, user)
+	if err != nil {
+		return err
+	}
+	prev, err := s.swapUser(ctx, user)
+	if err != nil {
+		if claimed {
+			_ = s.releaseEmail(ctx, user.Email, user.ID)
+		}
+		return err
+	}
+	user.Version++
+
+	if err := s.client.Set(ctx, createdAtIndexKey(user), user.ID); err != nil {
+		return err
+	}
+	if err := s.updateIdentityIndex(ctx, prev, user); err != nil {
+		return err
+	}
+
+	if prev.Email != "" && prev.Email != user.Email {
+		if err := s.releaseEmail(ctx, prev.Email, user.ID); err != nil {
+			return err
+		}
+	}
+	if prev.IsDeleted() && !prev.DeletedAt.Equal(user.DeletedAt) {
+		if err := s.client.Delete(ctx, deletedAtIndexKey(prev)); err != nil {
+			return err
+		}
+	}
+	if user.IsDeleted() {
+		return s.client.Set(ctx, deletedAtIndexKey(user), user.ID)
+	}
+	return nil
+}
+
+// DeleteUser deletes the user and all its index entries permanently.
+// The user is deleted only if its version matches the stored one,
+// so a user restored meanwhile is not purged.
+func (s *Storage) DeleteUser(ctx context.Context, user domain.User) error {
+	if _, err := s.swapUser(ctx, user); err != nil {
+		return err
+	}
+
+	if err := s.releaseEmail(ctx, user.Email, user.ID); err != nil {
+		return err
+	}
+	keys := []string{createdAtIndexKey(user), userKey(user.ID)}
+	if user.IsDeleted() {
+		keys = append(keys, deletedAtIndexKey(user))
+	}
+	for _, id := range user.Identities {
+		keys = append(keys, identityIndexKey(id))
+	}
+	for _, key := range keys {
+		if err := s.client.Delete(ctx, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// claimEmail points the email index to the user, unless the email belongs to another user.
+// It returns true if the email is newly claimed, so the claim is released if the user is not stored.
+// The claim is atomic if the storage client supports it, otherwise it's best effort.
+func (s *Storage) claimEmail(ctx context.Context, user domain.User) (bool, error) {
+	owner, err := s.emailOwner(ctx, user.Email)
+	if err != nil && !errors.Is(err, kvstorage.ErrNotFound) {
+		return false, err
+	}
+	if owner == user.ID {
+		return false, nil
+	}
+	if owner != "" {
+		// The claim of the user that is not stored, e.g. the store failed in the middle,
+		// or that has another email now is stale, so it's taken over.
+		other, err := s.GetUserByID(ctx, owner)
+		if err == nil && other.Email == user.Email {
+			return false, domain.ErrEmailTaken
+		}
+		if err != nil && !errors.Is(err, domain.ErrUserNotFound) {
+			return false, err
+		}
+	}
+
+	// The email is claimed only if the owner is the same as checked above.
+	claim := func(v interface{}, ok bool) (interface{}, error) {
+		if id, _ := v.(string); ok && id != owner {
+			return nil, domain.ErrEmailTaken
+		}
+		return user.ID, nil
+	}
+	if u, ok := s.client.(updater); ok {
+		err := u.Update(ctx, emailKey(user.Email), claim)
+		return err == nil, err
+	}
+	err = s.client.Set(ctx, emailKey(user.Email), user.ID)
+	return err == nil, err
+}
+
+// releaseEmail deletes the email index if the email is claimed by the user,
+// so the claim of another user is not released.
+func (s *Storage) releaseEmail(ctx context.Context, email, userID string) error {
+	owner, err := s.emailOwner(ctx, email)
+	if errors.Is(err, kvstorage.ErrNotFound) || (err == nil && owner != userID) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return s.client.Delete(ctx, emailKey(email))
+}
+
+// emailOwner returns the ID of the user that claimed the email.
+func (s *Storage) emailOwner(ctx context.Context, email string) (string, error) {
+	v, err := s.client.Get(ctx, emailKey(email))
+	if err != nil {
+		return "", err
+	}
+	id, ok := v.(string)
+	if !ok {
+		return "", fmt.Errorf("%w %T, want string", errUnexpectedValue, v)
+	}
+	return id, nil
+}
+
+// swapUser stores the user by ID with the incremented version,
+// if the stored version is the same as the user one. It returns the previous version of the user,
+// or the zero user if it's a new one.
+// The swap is atomic if the storage client supports it, otherwise it's best effort.
+func (s *Storage) swapUser(ctx context.Context, user domain.User) (domain.User, error) {
+	var prev domain.User
+	swap := func(v interface{}, ok bool) (interface{}, error) {
+		if ok {
+			var err error
+			if prev, err = toUser(v); err != nil {
+				return nil, err
+			}
+		}
+		if prev.Version != user.Version {
+			return nil, domain.ErrConcurrentModification
+		}
+		next := user
+		next.Version++
+		return next, nil
+	}
+
+	if u, ok := s.client.(updater); ok {
+		err := u.Update(ctx, userKey(user.ID), swap)
+		return prev, err
+	}
+
+	v, err := s.client.Get(ctx, userKey(user.ID))
+	if err != nil && !errors.Is(err, kvstorage.ErrNotFound) {
+		return domain.User{}, err
+	}
+	next, err := swap(v, err == nil)
+	if err != nil {
+		return domain.User{}, err
+	}
+	err = s.client.Set(ctx, userKey(user.ID), next)
+	return prev, err
+}
+
+// take gets the value of the key and deletes the key, atomically if the storage client supports it.
+// It returns kvstorage.ErrNotFound if the key doesn't exist.
+func (s *Storage) take(ctx context.Context, key string) (interface{}, error) {
+	if c, ok := s.client.(getDeleter); ok {
+		return c.GetDelete(ctx, key)
+	}
+
+	v, err := s.client.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	return v, s.client.Delete(ctx, key)
+}
+
+// setUntil sets the value of the key until expiresAt, if the storage client supports the expiring keys.
+// Otherwise the value is kept until it's deleted, the callers must check the expiration.
+func (s *Storage) setUntil(ctx context.Context, key string, value interface{}, expiresAt time.Time) error {
+	if c, ok := s.client.(ttlSetter); ok {
+		return c.SetWithTTL(ctx, key, value, time.Until(expiresAt))
+	}
+	return s.client.Set(ctx, key, value)
+}
+
+func userKey(id string) string {
+	return userPrefix + id
+}
+
+func emailKey(email string) string {
+	return emailPrefix + email
+}
+
+func createdAtIndexKey(user domain.User) string {
+	return createdAtIndexPrefix + user.CreatedAt.UTC().Format(createdAtLayout) + ":" + user.ID
+}
+
+func deletedAtIndexKey(user domain.User) string {
+	return deletedAtIndexPrefix + user.DeletedAt.UTC().Format(createdAtLayout) + ":" + user.ID
+}
+
+func encodeCursor(c cursor) string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeCursor(s string) (cursor, error) {
+	var c cursor
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, err
+	}
+	return c, json.Unmarshal(b, &c)
+}
+
+// toUser returns the stored user, or an error if the value is not a user.
+func toUser(v interface{}) (domain.User, error) {
+	u, ok := v.(domain.User)
+	if !ok {
+		return domain.User{}, fmt.Errorf("%w %T, want domain.User", errUnexpectedValue, v)
+	}
+	return u, nil
+}
+
+// mapError maps the low-level storage errors to the domain errors.
+func mapError(err error) error {
+	if errors.Is(err, kvstorage.ErrNotFound) {
+		return fmt.Errorf("%w: %v", domain.ErrUserNotFound, err)
+	}
+	return err
 }
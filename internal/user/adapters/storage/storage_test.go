@@ -0,0 +1,546 @@
+package storage_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dmitrymomot/go-smart-monolith/internal/user/adapters/storage"
+	"github.com/dmitrymomot/go-smart-monolith/internal/user/domain"
+	kvstorage "github.com/dmitrymomot/go-smart-monolith/pkg/storage"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStorage_ListUsers(t *testing.T) {
+	ctx := context.Background()
+	repo := storage.New(kvstorage.New())
+
+	// Users created at the same time are sorted by ID.
+	base := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	var all []domain.User
+	for i := 0; i < 7; i++ {
+		u := domain.User{
+			ID:        fmt.Sprintf("id-%d", i),
+			Email:     fmt.Sprintf("user%d@mail.dev", i),
+			CreatedAt: base.Add(time.Duration(i/2) * time.Hour),
+		}
+		if i%2 == 1 {
+			u.Email = fmt.Sprintf("admin%d@mail.dev", i)
+		}
+		require.NoError(t, repo.StoreUser(ctx, u))
+		all = append(all, u)
+	}
+
+	// listAll lists all the pages and returns the user IDs.
+	listAll := func(t *testing.T, filter domain.ListUsersFilter) ([]string, int) {
+		var (
+			ids   []string
+			pages int
+		)
+		for {
+			users, next, err := repo.ListUsers(ctx, filter)
+			require.NoError(t, err)
+			require.LessOrEqual(t, len(users), filter.Limit)
+			pages++
+			for _, u := range users {
+				ids = append(ids, u.ID)
+			}
+			if next == "" {
+				return ids, pages
+			}
+			filter.Cursor = next
+		}
+	}
+
+	t.Run("all pages", func(t *testing.T) {
+		ids, pages := listAll(t, domain.ListUsersFilter{Limit: 3})
+		require.Equal(t, []string{"id-0", "id-1", "id-2", "id-3", "id-4", "id-5", "id-6"}, ids)
+		require.Equal(t, 3, pages)
+	})
+
+	t.Run("desc", func(t *testing.T) {
+		ids, _ := listAll(t, domain.ListUsersFilter{Limit: 2, Desc: true})
+		require.Equal(t, []string{"id-6", "id-5", "id-4", "id-3", "id-2", "id-1", "id-0"}, ids)
+	})
+
+	t.Run("email prefix", func(t *testing.T) {
+		ids, pages := listAll(t, domain.ListUsersFilter{Limit: 2, EmailPrefix: "admin"})
+		require.Equal(t, []string{"id-1", "id-3", "id-5"}, ids)
+		require.Equal(t, 2, pages)
+	})
+
+	t.Run("created range", func(t *testing.T) {
+		ids, _ := listAll(t, domain.ListUsersFilter{
+			Limit:       10,
+			CreatedFrom: base.Add(time.Hour),
+			CreatedTo:   base.Add(3 * time.Hour),
+		})
+		require.Equal(t, []string{"id-2", "id-3", "id-4", "id-5"}, ids)
+	})
+
+	t.Run("exact page has no next cursor", func(t *testing.T) {
+		users, next, err := repo.ListUsers(ctx, domain.ListUsersFilter{Limit: len(all)})
+		require.NoError(t, err)
+		require.Len(t, users, len(all))
+		require.Empty(t, next)
+	})
+
+	t.Run("invalid cursor", func(t *testing.T) {
+		_, next, err := repo.ListUsers(ctx, domain.ListUsersFilter{Limit: 2})
+		require.NoError(t, err)
+
+		// The cursor is bound to the sort order.
+		_, _, err = repo.ListUsers(ctx, domain.ListUsersFilter{Limit: 2, Cursor: next, Desc: true})
+		require.ErrorIs(t, err, domain.ErrInvalidCursor)
+
+		_, _, err = repo.ListUsers(ctx, domain.ListUsersFilter{Limit: 2, Cursor: "garbage"})
+		require.ErrorIs(t, err, domain.ErrInvalidCursor)
+	})
+}
+
+func TestStorage_StoreUser_Indexes(t *testing.T) {
+	ctx := context.Background()
+	kv := kvstorage.New()
+	repo := storage.New(kv)
+
+	user := domain.NewUser("old@mail.dev", "")
+	require.NoError(t, repo.StoreUser(ctx, user))
+
+	// reload reads the stored version of the user to update it again.
+	reload := func(t *testing.T) {
+		t.Helper()
+		var err error
+		user, err = repo.GetUserByID(ctx, user.ID)
+		require.NoError(t, err)
+	}
+
+	t.Run("email change releases the old email", func(t *testing.T) {
+		reload(t)
+		user.Email = "new@mail.dev"
+		require.NoError(t, repo.StoreUser(ctx, user))
+
+		_, err := repo.GetUserByEmail(ctx, "old@mail.dev")
+		require.ErrorIs(t, err, domain.ErrUserNotFound)
+		got, err := repo.GetUserByEmail(ctx, "new@mail.dev")
+		require.NoError(t, err)
+		require.Equal(t, user.ID, got.ID)
+	})
+
+	t.Run("email of another user", func(t *testing.T) {
+		other := domain.NewUser("new@mail.dev", "")
+		require.ErrorIs(t, repo.StoreUser(ctx, other), domain.ErrEmailTaken)
+	})
+
+	t.Run("soft delete and purge", func(t *testing.T) {
+		reload(t)
+		user.DeletedAt = time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+		require.NoError(t, repo.StoreUser(ctx, user))
+
+		// The deleted users are not listed.
+		users, _, err := repo.ListUsers(ctx, domain.ListUsersFilter{Limit: 10})
+		require.NoError(t, err)
+		require.Empty(t, users)
+
+		deleted, err := repo.ListDeletedUsers(ctx, user.DeletedAt.Add(time.Second), 10)
+		require.NoError(t, err)
+		require.Len(t, deleted, 1)
+		deleted, err = repo.ListDeletedUsers(ctx, user.DeletedAt, 10)
+		require.NoError(t, err)
+		require.Empty(t, deleted, "deleted after the cutoff")
+
+		reload(t)
+		require.NoError(t, repo.DeleteUser(ctx, user))
+		_, err = repo.GetUserByID(ctx, user.ID)
+		require.ErrorIs(t, err, domain.ErrUserNotFound)
+
+		// Nothing is left in the storage.
+		kvs, err := kv.Scan(ctx, kvstorage.ScanOptions{})
+		require.NoError(t, err)
+		require.Empty(t, kvs)
+	})
+}
+
+func TestStorage_StoreUser_EmailClaim(t *testing.T) {
+	ctx := context.Background()
+	kv := kvstorage.New()
+	repo := storage.New(kv)
+
+	t.Run("concurrent signups", func(t *testing.T) {
+		const n = 20
+		var (
+			wg   sync.WaitGroup
+			errs = make(chan error, n)
+		)
+		for i := 0; i < n; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				errs <- repo.StoreUser(ctx, domain.NewUser("race@mail.dev", ""))
+			}()
+		}
+		wg.Wait()
+		close(errs)
+
+		stored := 0
+		for err := range errs {
+			if err == nil {
+				stored++
+				continue
+			}
+			require.ErrorIs(t, err, domain.ErrEmailTaken)
+		}
+		require.Equal(t, 1, stored, "only one signup gets the email")
+
+		users, _, err := repo.ListUsers(ctx, domain.ListUsersFilter{Limit: n})
+		require.NoError(t, err)
+		require.Len(t, users, 1)
+	})
+
+	t.Run("failed store releases the claim", func(t *testing.T) {
+		user := domain.NewUser("conflict@mail.dev", "")
+		require.NoError(t, repo.StoreUser(ctx, user))
+
+		// The stale version of the user can't take another email.
+		user.Email = "released@mail.dev"
+		require.ErrorIs(t, repo.StoreUser(ctx, user), domain.ErrConcurrentModification)
+
+		other := domain.NewUser("released@mail.dev", "")
+		require.NoError(t, repo.StoreUser(ctx, other))
+	})
+
+	t.Run("stale claim is taken over", func(t *testing.T) {
+		// The claim of the user whose store failed in the middle.
+		require.NoError(t, kv.Set(ctx, "user_email:stale@mail.dev", "gone"))
+		_, err := repo.GetUserByEmail(ctx, "stale@mail.dev")
+		require.ErrorIs(t, err, domain.ErrUserNotFound)
+
+		user := domain.NewUser("stale@mail.dev", "")
+		require.NoError(t, repo.StoreUser(ctx, user))
+		got, err := repo.GetUserByEmail(ctx, "stale@mail.dev")
+		require.NoError(t, err)
+		require.Equal(t, user.ID, got.ID)
+	})
+}
+
+func TestStorage_StoreUser_Version(t *testing.T) {
+	ctx := context.Background()
+	repo := storage.New(kvstorage.New())
+
+	user := domain.NewUser("test@mail.dev", "")
+	require.NoError(t, repo.StoreUser(ctx, user))
+
+	stored, err := repo.GetUserByID(ctx, user.ID)
+	require.NoError(t, err)
+	require.EqualValues(t, 1, stored.Version)
+
+	// The same user can't be created twice.
+	require.ErrorIs(t, repo.StoreUser(ctx, user), domain.ErrConcurrentModification)
+
+	// Two concurrent changes of the same version: the second one is rejected.
+	first, second := stored, stored
+	first.DisplayName = "first"
+	second.DisplayName = "second"
+	require.NoError(t, repo.StoreUser(ctx, first))
+	require.ErrorIs(t, repo.StoreUser(ctx, second), domain.ErrConcurrentModification)
+	require.ErrorIs(t, repo.DeleteUser(ctx, second), domain.ErrConcurrentModification)
+
+	stored, err = repo.GetUserByID(ctx, user.ID)
+	require.NoError(t, err)
+	require.Equal(t, "first", stored.DisplayName)
+	require.EqualValues(t, 2, stored.Version)
+}
+
+func TestStorage_APIKeys(t *testing.T) {
+	ctx := context.Background()
+	repo := storage.New(kvstorage.New())
+	now := time.Date(2023, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	user := domain.NewUser("test@mail.dev", "")
+	key, apiKey, err := domain.NewAPIKey(user, "ci", []domain.Permission{domain.PermissionReadUsers}, time.Time{}, now)
+	require.NoError(t, err)
+	require.NoError(t, repo.StoreAPIKey(ctx, apiKey))
+
+	found, err := repo.GetAPIKeyByHash(ctx, domain.HashAPIKey(key))
+	require.NoError(t, err)
+	require.Equal(t, apiKey, found)
+
+	// The rotated key can't be found by the previous hash.
+	var rotated string
+	apiKey, err = repo.UpdateAPIKey(ctx, user.ID, apiKey.ID, func(k *domain.APIKey) (err error) {
+		rotated, err = k.Rotate()
+		return err
+	})
+	require.NoError(t, err)
+	_, err = repo.GetAPIKeyByHash(ctx, domain.HashAPIKey(key))
+	require.ErrorIs(t, err, domain.ErrInvalidAPIKey)
+	_, err = repo.UpdateAPIKey(ctx, user.ID, "other", func(k *domain.APIKey) error { return nil })
+	require.ErrorIs(t, err, domain.ErrAPIKeyNotFound)
+
+	// The last used time is recorded.
+	require.NoError(t, repo.TouchAPIKey(ctx, apiKey, now.Add(time.Hour)))
+	found, err = repo.GetAPIKeyByHash(ctx, domain.HashAPIKey(rotated))
+	require.NoError(t, err)
+	require.Equal(t, now.Add(time.Hour), found.LastUsedAt)
+
+	// The revoked key is listed, but can't be found by the hash.
+	_, err = repo.UpdateAPIKey(ctx, user.ID, apiKey.ID, func(k *domain.APIKey) error {
+		k.Revoke(now)
+		return nil
+	})
+	require.NoError(t, err)
+	_, err = repo.GetAPIKeyByHash(ctx, domain.HashAPIKey(rotated))
+	require.ErrorIs(t, err, domain.ErrInvalidAPIKey)
+
+	// The key revoked in between is not changed by the update checking it.
+	_, err = repo.UpdateAPIKey(ctx, user.ID, apiKey.ID, func(k *domain.APIKey) error {
+		if err := k.Check(now); err != nil {
+			return err
+		}
+		_, err := k.Rotate()
+		return err
+	})
+	require.ErrorIs(t, err, domain.ErrAPIKeyRevoked)
+
+	keys, err := repo.ListAPIKeys(ctx, user.ID)
+	require.NoError(t, err)
+	require.Len(t, keys, 1)
+	require.True(t, keys[0].IsRevoked())
+
+	keys, err = repo.ListAPIKeys(ctx, "other")
+	require.NoError(t, err)
+	require.Empty(t, keys)
+}
+
+func TestStorage_Identities(t *testing.T) {
+	ctx := context.Background()
+	kv := kvstorage.New()
+	repo := storage.New(kv)
+	now := time.Date(2023, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	user := domain.NewUser("test@mail.dev", "")
+	user.LinkIdentity("google", "subject-1", now)
+	require.NoError(t, repo.StoreUser(ctx, user))
+
+	found, err := repo.GetUserByIdentity(ctx, "google", "subject-1")
+	require.NoError(t, err)
+	require.Equal(t, user.ID, found.ID)
+	_, err = repo.GetUserByIdentity(ctx, "github", "subject-1")
+	require.ErrorIs(t, err, domain.ErrUserNotFound)
+
+	// The identity can't be linked to another user.
+	other := domain.NewUser("other@mail.dev", "")
+	other.LinkIdentity("google", "subject-1", now)
+	require.ErrorIs(t, repo.StoreUser(ctx, other), domain.ErrIdentityTaken)
+
+	// The unlinked identity is removed from the index.
+	found.Identities = nil
+	require.NoError(t, repo.StoreUser(ctx, found))
+	_, err = repo.GetUserByIdentity(ctx, "google", "subject-1")
+	require.ErrorIs(t, err, domain.ErrUserNotFound)
+
+	// The purged user releases its identities.
+	found, err = repo.GetUserByID(ctx, user.ID)
+	require.NoError(t, err)
+	found.LinkIdentity("github", "42", now)
+	require.NoError(t, repo.StoreUser(ctx, found))
+	found, err = repo.GetUserByID(ctx, user.ID)
+	require.NoError(t, err)
+	require.NoError(t, repo.DeleteUser(ctx, found))
+	kvs, err := kv.Scan(ctx, kvstorage.ScanOptions{})
+	require.NoError(t, err)
+	require.Empty(t, kvs)
+}
+
+func TestStorage_Sessions(t *testing.T) {
+	ctx := context.Background()
+	repo := storage.New(kvstorage.New())
+	// The sessions expire by the storage TTL, so the real time is used.
+	now := time.Now()
+
+	user := domain.NewUser("test@mail.dev", "")
+	client := domain.SessionClient{Device: "Chrome on Windows", IP: "127.0.0.1", UserAgent: "Mozilla/5.0"}
+	session := domain.NewSession(user, client, time.Hour, now)
+	require.NoError(t, repo.StoreSession(ctx, session))
+	expiring := domain.NewSession(user, client, 50*time.Millisecond, now)
+	require.NoError(t, repo.StoreSession(ctx, expiring))
+	require.NoError(t, repo.StoreSession(ctx, domain.NewSession(domain.NewUser("other@mail.dev", ""), client, time.Hour, now)))
+
+	found, err := repo.GetSession(ctx, user.ID, session.ID)
+	require.NoError(t, err)
+	require.Equal(t, session, found)
+	sessions, err := repo.ListSessions(ctx, user.ID)
+	require.NoError(t, err)
+	require.Len(t, sessions, 2)
+
+	// The expired session is gone.
+	time.Sleep(100 * time.Millisecond)
+	_, err = repo.GetSession(ctx, user.ID, expiring.ID)
+	require.ErrorIs(t, err, domain.ErrSessionNotFound)
+	sessions, err = repo.ListSessions(ctx, user.ID)
+	require.NoError(t, err)
+	require.Equal(t, []domain.Session{session}, sessions)
+
+	// The last seen time is recorded.
+	require.NoError(t, repo.TouchSession(ctx, session, now.Add(time.Minute)))
+	found, err = repo.GetSession(ctx, user.ID, session.ID)
+	require.NoError(t, err)
+	require.Equal(t, now.Add(time.Minute).UTC(), found.LastSeenAt)
+
+	// The deleted session is not resurrected by touching it.
+	require.NoError(t, repo.DeleteSessions(ctx, user.ID))
+	require.ErrorIs(t, repo.TouchSession(ctx, session, now.Add(2*time.Minute)), domain.ErrSessionNotFound)
+	sessions, err = repo.ListSessions(ctx, user.ID)
+	require.NoError(t, err)
+	require.Empty(t, sessions)
+}
+
+func TestStorage_PasswordResetTokens(t *testing.T) {
+	ctx := context.Background()
+	repo := storage.New(kvstorage.New())
+
+	user := domain.NewUser("test@mail.dev", "")
+	_, token, err := domain.NewPasswordResetToken(user, time.Hour, time.Now())
+	require.NoError(t, err)
+	require.NoError(t, repo.StorePasswordResetToken(ctx, token))
+
+	// The token is taken only once.
+	found, err := repo.TakePasswordResetToken(ctx, token.Hash)
+	require.NoError(t, err)
+	require.Equal(t, token, found)
+	_, err = repo.TakePasswordResetToken(ctx, token.Hash)
+	require.ErrorIs(t, err, domain.ErrInvalidPasswordResetToken)
+
+	// The expired token is gone.
+	_, expired, err := domain.NewPasswordResetToken(user, -time.Second, time.Now())
+	require.NoError(t, err)
+	require.NoError(t, repo.StorePasswordResetToken(ctx, expired))
+	_, err = repo.TakePasswordResetToken(ctx, expired.Hash)
+	require.ErrorIs(t, err, domain.ErrInvalidPasswordResetToken)
+}
+
+func TestStorage_VerificationTokens(t *testing.T) {
+	ctx := context.Background()
+	repo := storage.New(kvstorage.New())
+
+	user := domain.NewUser("test@mail.dev", "")
+	_, token, err := domain.NewVerificationToken(user, time.Hour, time.Now())
+	require.NoError(t, err)
+	require.NoError(t, repo.StoreVerificationToken(ctx, token))
+
+	// The token is taken only once.
+	found, err := repo.TakeVerificationToken(ctx, token.Hash)
+	require.NoError(t, err)
+	require.Equal(t, token, found)
+	_, err = repo.TakeVerificationToken(ctx, token.Hash)
+	require.ErrorIs(t, err, domain.ErrInvalidVerificationToken)
+
+	// The expired token is gone.
+	_, expired, err := domain.NewVerificationToken(user, -time.Second, time.Now())
+	require.NoError(t, err)
+	require.NoError(t, repo.StoreVerificationToken(ctx, expired))
+	_, err = repo.TakeVerificationToken(ctx, expired.Hash)
+	require.ErrorIs(t, err, domain.ErrInvalidVerificationToken)
+}
+
+func TestStorage_OIDCLoginStates(t *testing.T) {
+	ctx := context.Background()
+	repo := storage.New(kvstorage.New())
+
+	_, login, err := domain.NewOIDCLoginState("test", time.Minute, time.Now())
+	require.NoError(t, err)
+	require.NoError(t, repo.StoreOIDCLoginState(ctx, login))
+
+	// The login is taken only once.
+	found, err := repo.TakeOIDCLoginState(ctx, login.Hash)
+	require.NoError(t, err)
+	require.Equal(t, login, found)
+	_, err = repo.TakeOIDCLoginState(ctx, login.Hash)
+	require.ErrorIs(t, err, domain.ErrInvalidOIDCState)
+
+	// The expired login is gone.
+	_, expired, err := domain.NewOIDCLoginState("test", -time.Second, time.Now())
+	require.NoError(t, err)
+	require.NoError(t, repo.StoreOIDCLoginState(ctx, expired))
+	_, err = repo.TakeOIDCLoginState(ctx, expired.Hash)
+	require.ErrorIs(t, err, domain.ErrInvalidOIDCState)
+}
+
+func TestStorage_MFAChallenges(t *testing.T) {
+	ctx := context.Background()
+	repo := storage.New(kvstorage.New())
+
+	user := domain.NewUser("test@mail.dev", "")
+	_, challenge, err := domain.NewMFAChallenge(user, time.Minute, time.Now())
+	require.NoError(t, err)
+	require.NoError(t, repo.StoreMFAChallenge(ctx, challenge))
+
+	// The concurrent attempts are not lost.
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := repo.UpdateMFAChallenge(ctx, challenge.Hash, func(c *domain.MFAChallenge) error {
+				c.Attempts++
+				return nil
+			})
+			require.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	// The challenge is not changed on error.
+	errStop := errors.New("stop")
+	_, err = repo.UpdateMFAChallenge(ctx, challenge.Hash, func(c *domain.MFAChallenge) error {
+		c.Attempts++
+		return errStop
+	})
+	require.ErrorIs(t, err, errStop)
+	found, err := repo.UpdateMFAChallenge(ctx, challenge.Hash, func(c *domain.MFAChallenge) error { return nil })
+	require.NoError(t, err)
+	require.Equal(t, 10, found.Attempts)
+
+	// The deleted and expired challenges are gone.
+	require.NoError(t, repo.DeleteMFAChallenge(ctx, challenge.Hash))
+	_, err = repo.UpdateMFAChallenge(ctx, challenge.Hash, func(c *domain.MFAChallenge) error { return nil })
+	require.ErrorIs(t, err, domain.ErrInvalidMFAChallenge)
+	_, expired, err := domain.NewMFAChallenge(user, -time.Second, time.Now())
+	require.NoError(t, err)
+	require.NoError(t, repo.StoreMFAChallenge(ctx, expired))
+	_, err = repo.UpdateMFAChallenge(ctx, expired.Hash, func(c *domain.MFAChallenge) error { return nil })
+	require.ErrorIs(t, err, domain.ErrInvalidMFAChallenge)
+}
+
+func TestStorage_Keyspace(t *testing.T) {
+	ctx := context.Background()
+	client := kvstorage.New()
+	repo := storage.New(client)
+
+	u := domain.User{ID: "id-1", Email: "user@mail.dev", CreatedAt: time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)}
+	require.NoError(t, repo.StoreUser(ctx, u))
+
+	// The emails and IDs don't resolve to the other keys of the shared storage.
+	require.NoError(t, client.Set(ctx, "player:id-1", "not a user"))
+	_, err := repo.GetUserByEmail(ctx, "player:id-1")
+	require.ErrorIs(t, err, domain.ErrUserNotFound)
+	_, err = repo.GetUserByEmail(ctx, u.ID)
+	require.ErrorIs(t, err, domain.ErrUserNotFound)
+	_, err = repo.GetUserByID(ctx, u.Email)
+	require.ErrorIs(t, err, domain.ErrUserNotFound)
+
+	// The values of another type are errors, not panics.
+	require.NoError(t, client.Set(ctx, "user:id-2", "not a user"))
+	_, err = repo.GetUserByID(ctx, "id-2")
+	require.Error(t, err)
+	_, err = repo.GetUsersByIDs(ctx, []string{"id-1", "id-2"})
+	require.Error(t, err)
+	require.Error(t, repo.StoreUser(ctx, domain.User{ID: "id-2", Email: "other@mail.dev"}))
+
+	found, err := repo.GetUsersByIDs(ctx, []string{"id-1", "missing"})
+	require.NoError(t, err)
+	require.Equal(t, map[string]domain.User{"id-1": {ID: "id-1", Email: u.Email, CreatedAt: u.CreatedAt, Version: 1}}, found)
+}
@@ -0,0 +1,34 @@
+package storage
+
+import (
+	"context"
+	"errors"
+
+	"github.com/dmitrymomot/go-smart-monolith/internal/user/domain"
+	kvstorage "github.com/dmitrymomot/go-smart-monolith/pkg/storage"
+)
+
+// verificationTokenPrefix is the key prefix of the email verification tokens.
+// The keys are "<prefix><token hash>".
+const verificationTokenPrefix = "user_verification_token:"
+
+// StoreVerificationToken stores the email verification token by its hash until it expires,
+// if the storage client supports the expiring keys.
+func (s *Storage) StoreVerificationToken(ctx context.Context, token domain.VerificationToken) error {
+	return s.setUntil(ctx, verificationTokenPrefix+token.Hash, token, token.ExpiresAt)
+}
+
+// TakeVerificationToken gets the email verification token by its hash and deletes it,
+// so it can't be used again. Only one of the concurrent callers gets the token
+// if the storage client supports the atomic read-and-delete.
+// It returns domain.ErrInvalidVerificationToken if the token doesn't exist.
+func (s *Storage) TakeVerificationToken(ctx context.Context, hash string) (domain.VerificationToken, error) {
+	v, err := s.take(ctx, verificationTokenPrefix+hash)
+	if err != nil {
+		if errors.Is(err, kvstorage.ErrNotFound) {
+			return domain.VerificationToken{}, domain.ErrInvalidVerificationToken
+		}
+		return domain.VerificationToken{}, err
+	}
+	return v.(domain.VerificationToken), nil
+}
@@ -0,0 +1,46 @@
+package commands
+
+import (
+	"strings"
+
+	"github.com/dmitrymomot/go-smart-monolith/internal/user/domain"
+)
+
+type (
+	// AdminEmails are the emails of the users granted the admin role, so the first admins
+	// can be set up by the config. The role is granted and stored once the user proves
+	// the email ownership: by the verification link, see VerifyEmail, or by the identity
+	// provider that verified the email, see CompleteOIDCLogin. Signing up with the email
+	// or changing to it is not enough, since the email verification may be disabled.
+	AdminEmails []string
+
+	// UserRoleGrantedEvent represents the event body for UserRoleGranted.
+	UserRoleGrantedEvent struct {
+		ID   string      `json:"id"`
+		Role domain.Role `json:"role"`
+	}
+)
+
+// Contains reports whether the email is an admin one, the case is ignored.
+func (a AdminEmails) Contains(email string) bool {
+	for _, e := range a {
+		if strings.EqualFold(strings.TrimSpace(e), email) {
+			return true
+		}
+	}
+	return false
+}
+
+// grantAdmin grants the admin role to the user with the proven admin email.
+// It returns the event if the role is granted, the caller stores the user.
+func (a AdminEmails) grantAdmin(user *domain.User) []interface{} {
+	if !a.Contains(user.Email) || !user.GrantRole(domain.RoleAdmin) {
+		return nil
+	}
+	return []interface{}{UserRoleGrantedEvent{ID: user.ID, Role: domain.RoleAdmin}}
+}
+
+// pendingAdmin reports whether the user has the admin email, but hasn't proven it yet.
+func (a AdminEmails) pendingAdmin(user domain.User) bool {
+	return a.Contains(user.Email) && !user.HasRole(domain.RoleAdmin)
+}
@@ -0,0 +1,190 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/dmitrymomot/go-smart-monolith/internal/user/domain"
+)
+
+// ErrInvalidAPIKeyTTL is returned when the API key lifetime is negative or longer than allowed.
+var ErrInvalidAPIKeyTTL = errors.New("invalid api key ttl")
+
+type (
+	// CreateAPIKeyCommand represents the request body for CreateAPIKey.
+	CreateAPIKeyCommand struct {
+		UserID string   `json:"user_id"`
+		Name   string   `json:"name"`
+		Scopes []string `json:"scopes"`
+		// TTL is how long the key is valid. Zero means the default TTL, see APIKeyOptions.
+		TTL time.Duration `json:"ttl"`
+	}
+
+	// RotateAPIKeyCommand represents the request body for RotateAPIKey.
+	RotateAPIKeyCommand struct {
+		UserID string `json:"user_id"`
+		KeyID  string `json:"key_id"`
+	}
+
+	// RevokeAPIKeyCommand represents the request body for RevokeAPIKey.
+	RevokeAPIKeyCommand struct {
+		UserID string `json:"user_id"`
+		KeyID  string `json:"key_id"`
+	}
+
+	// APIKeyCreatedEvent represents the event body for APIKeyCreated.
+	// The key is returned to the caller, but never published.
+	APIKeyCreatedEvent struct {
+		ID        string    `json:"id"`
+		KeyID     string    `json:"key_id"`
+		Name      string    `json:"name"`
+		Scopes    []string  `json:"scopes"`
+		ExpiresAt time.Time `json:"expires_at"`
+		Key       string    `json:"-"`
+	}
+
+	// APIKeyRotatedEvent represents the event body for APIKeyRotated.
+	// The new key is returned to the caller, but never published.
+	APIKeyRotatedEvent struct {
+		ID    string `json:"id"`
+		KeyID string `json:"key_id"`
+		Key   string `json:"-"`
+	}
+
+	// APIKeyRevokedEvent represents the event body for APIKeyRevoked.
+	APIKeyRevokedEvent struct {
+		ID    string `json:"id"`
+		KeyID string `json:"key_id"`
+	}
+
+	// APIKeyOptions defines the API keys lifetime.
+	APIKeyOptions struct {
+		// DefaultTTL is the lifetime of the keys created without the TTL.
+		DefaultTTL time.Duration
+		// MaxTTL is the max lifetime of the keys.
+		MaxTTL time.Duration
+	}
+
+	// apiKeyRepository represents the repository interface for the API key commands.
+	apiKeyRepository interface {
+		updateUserRepository
+		GetAPIKey(ctx context.Context, userID, id string) (domain.APIKey, error)
+		StoreAPIKey(ctx context.Context, key domain.APIKey) error
+		UpdateAPIKey(ctx context.Context, userID, id string, fn func(k *domain.APIKey) error) (domain.APIKey, error)
+	}
+)
+
+// OwnerID returns the ID of the user the command is applied to.
+func (c CreateAPIKeyCommand) OwnerID() string { return c.UserID }
+
+// OwnerID returns the ID of the user the command is applied to.
+func (c RotateAPIKeyCommand) OwnerID() string { return c.UserID }
+
+// OwnerID returns the ID of the user the command is applied to.
+func (c RevokeAPIKeyCommand) OwnerID() string { return c.UserID }
+
+// CreateAPIKey issues a new API key of the user.
+// The key is returned only once, only its hash is stored.
+func CreateAPIKey(repo apiKeyRepository, opts APIKeyOptions, now func() time.Time) func(ctx context.Context, cmd CreateAPIKeyCommand) ([]interface{}, error) {
+	return func(ctx context.Context, cmd CreateAPIKeyCommand) ([]interface{}, error) {
+		ttl := cmd.TTL
+		if ttl == 0 {
+			ttl = opts.DefaultTTL
+		}
+		if ttl < 0 || ttl > opts.MaxTTL {
+			return nil, ErrInvalidAPIKeyTTL
+		}
+		scopes := make([]domain.Permission, 0, len(cmd.Scopes))
+		for _, s := range cmd.Scopes {
+			scopes = append(scopes, domain.Permission(s))
+		}
+
+		user, err := getActiveUser(ctx, repo, cmd.UserID, 0)
+		if err != nil {
+			return nil, err
+		}
+		key, apiKey, err := domain.NewAPIKey(user, cmd.Name, scopes, now().Add(ttl), now())
+		if err != nil {
+			return nil, err
+		}
+		if err := repo.StoreAPIKey(ctx, apiKey); err != nil {
+			return nil, fmt.Errorf("failed to store api key: %w", err)
+		}
+
+		return []interface{}{
+			APIKeyCreatedEvent{
+				ID:        user.ID,
+				KeyID:     apiKey.ID,
+				Name:      apiKey.Name,
+				Scopes:    cmd.Scopes,
+				ExpiresAt: apiKey.ExpiresAt,
+				Key:       key,
+			},
+		}, nil
+	}
+}
+
+// RotateAPIKey replaces the API key with a new one keeping its scopes and expiration.
+// The previous key stops working at once. The key revoked concurrently is not rotated.
+func RotateAPIKey(repo apiKeyRepository, now func() time.Time) func(ctx context.Context, cmd RotateAPIKeyCommand) ([]interface{}, error) {
+	return func(ctx context.Context, cmd RotateAPIKeyCommand) ([]interface{}, error) {
+		if _, err := getActiveUser(ctx, repo, cmd.UserID, 0); err != nil {
+			return nil, err
+		}
+
+		var key string
+		apiKey, err := repo.UpdateAPIKey(ctx, cmd.UserID, cmd.KeyID, func(k *domain.APIKey) error {
+			if err := k.Check(now()); err != nil {
+				return err
+			}
+			var err error
+			key, err = k.Rotate()
+			return err
+		})
+		if err != nil {
+			if errors.Is(err, domain.ErrAPIKeyNotFound) || errors.Is(err, domain.ErrAPIKeyRevoked) || errors.Is(err, domain.ErrAPIKeyExpired) {
+				return nil, err
+			}
+			return nil, fmt.Errorf("failed to rotate api key: %w", err)
+		}
+
+		return []interface{}{
+			APIKeyRotatedEvent{
+				ID:    cmd.UserID,
+				KeyID: apiKey.ID,
+				Key:   key,
+			},
+		}, nil
+	}
+}
+
+// RevokeAPIKey revokes the API key, so it stops working at once.
+// The revoked key is kept to be listed. Revoking it again is a no-op.
+func RevokeAPIKey(repo apiKeyRepository, now func() time.Time) func(ctx context.Context, cmd RevokeAPIKeyCommand) ([]interface{}, error) {
+	return func(ctx context.Context, cmd RevokeAPIKeyCommand) ([]interface{}, error) {
+		var revoked bool
+		apiKey, err := repo.UpdateAPIKey(ctx, cmd.UserID, cmd.KeyID, func(k *domain.APIKey) error {
+			revoked = k.IsRevoked()
+			k.Revoke(now())
+			return nil
+		})
+		if err != nil {
+			if errors.Is(err, domain.ErrAPIKeyNotFound) {
+				return nil, err
+			}
+			return nil, fmt.Errorf("failed to revoke api key: %w", err)
+		}
+		if revoked {
+			return nil, nil
+		}
+
+		return []interface{}{
+			APIKeyRevokedEvent{
+				ID:    cmd.UserID,
+				KeyID: apiKey.ID,
+			},
+		}, nil
+	}
+}
@@ -0,0 +1,183 @@
+package commands_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dmitrymomot/go-smart-monolith/internal/user/app/commands"
+	"github.com/dmitrymomot/go-smart-monolith/internal/user/domain"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// apiKeyRepository is a mock implementation of the apiKeyRepository interface.
+type apiKeyRepository struct {
+	updateUserRepository
+}
+
+// GetAPIKey is a mock implementation of the GetAPIKey method.
+func (m *apiKeyRepository) GetAPIKey(ctx context.Context, userID, id string) (domain.APIKey, error) {
+	args := m.Called(ctx, userID, id)
+	return args.Get(0).(domain.APIKey), args.Error(1)
+}
+
+// StoreAPIKey is a mock implementation of the StoreAPIKey method.
+func (m *apiKeyRepository) StoreAPIKey(ctx context.Context, key domain.APIKey) error {
+	args := m.Called(ctx, key)
+	return args.Error(0)
+}
+
+// UpdateAPIKey is a mock implementation of the UpdateAPIKey method.
+// fn is applied to the key returned by GetAPIKey.
+func (m *apiKeyRepository) UpdateAPIKey(ctx context.Context, userID, id string, fn func(k *domain.APIKey) error) (domain.APIKey, error) {
+	key, err := m.GetAPIKey(ctx, userID, id)
+	if err != nil {
+		return domain.APIKey{}, err
+	}
+	if err := fn(&key); err != nil {
+		return domain.APIKey{}, err
+	}
+	args := m.Called(ctx, key)
+	return key, args.Error(0)
+}
+
+func TestCreateAPIKey(t *testing.T) {
+	now := time.Date(2023, 1, 1, 12, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+	opts := commands.APIKeyOptions{DefaultTTL: 24 * time.Hour, MaxTTL: 48 * time.Hour}
+	user := newUser(t, "password")
+
+	t.Run("success", func(t *testing.T) {
+		var stored domain.APIKey
+		repo := &apiKeyRepository{}
+		repo.On("GetUserByID", mock.Anything, user.ID).Return(user, nil)
+		repo.On("StoreAPIKey", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+			stored = args.Get(1).(domain.APIKey)
+		}).Return(nil)
+
+		events, err := commands.CreateAPIKey(repo, opts, clock)(context.Background(), commands.CreateAPIKeyCommand{
+			UserID: user.ID,
+			Name:   "ci",
+			Scopes: []string{"users:read"},
+		})
+		require.NoError(t, err)
+		require.Len(t, events, 1)
+		created := events[0].(commands.APIKeyCreatedEvent)
+		require.Equal(t, now.Add(opts.DefaultTTL), created.ExpiresAt)
+		require.True(t, domain.IsAPIKey(created.Key))
+
+		// Only the key hash is stored.
+		require.Equal(t, created.KeyID, stored.ID)
+		require.Equal(t, domain.HashAPIKey(created.Key), stored.Hash)
+		require.True(t, strings.HasPrefix(created.Key, stored.Hint))
+		require.Equal(t, []domain.Permission{domain.PermissionReadUsers}, stored.Scopes)
+	})
+
+	for name, tc := range map[string]struct {
+		cmd commands.CreateAPIKeyCommand
+		err error
+	}{
+		"too long ttl":  {cmd: commands.CreateAPIKeyCommand{Name: "ci", Scopes: []string{"users:read"}, TTL: 72 * time.Hour}, err: commands.ErrInvalidAPIKeyTTL},
+		"no scopes":     {cmd: commands.CreateAPIKeyCommand{Name: "ci"}, err: domain.ErrInvalidAPIKeyScopes},
+		"unknown scope": {cmd: commands.CreateAPIKeyCommand{Name: "ci", Scopes: []string{"users:root"}}, err: domain.ErrInvalidAPIKeyScopes},
+		"no name":       {cmd: commands.CreateAPIKeyCommand{Name: " ", Scopes: []string{"users:read"}}, err: domain.ErrInvalidAPIKeyName},
+	} {
+		t.Run(name, func(t *testing.T) {
+			repo := &apiKeyRepository{}
+			repo.On("GetUserByID", mock.Anything, user.ID).Return(user, nil)
+
+			tc.cmd.UserID = user.ID
+			_, err := commands.CreateAPIKey(repo, opts, clock)(context.Background(), tc.cmd)
+			require.ErrorIs(t, err, tc.err)
+			repo.AssertNotCalled(t, "StoreAPIKey", mock.Anything, mock.Anything)
+		})
+	}
+}
+
+func TestRotateAndRevokeAPIKey(t *testing.T) {
+	now := time.Date(2023, 1, 1, 12, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+	user := newUser(t, "password")
+	key, apiKey, err := domain.NewAPIKey(user, "ci", []domain.Permission{domain.PermissionReadUsers}, now.Add(time.Hour), now)
+	require.NoError(t, err)
+
+	t.Run("rotate", func(t *testing.T) {
+		var stored domain.APIKey
+		repo := &apiKeyRepository{}
+		repo.On("GetUserByID", mock.Anything, user.ID).Return(user, nil)
+		repo.On("GetAPIKey", mock.Anything, user.ID, apiKey.ID).Return(apiKey, nil)
+		repo.On("UpdateAPIKey", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+			stored = args.Get(1).(domain.APIKey)
+		}).Return(nil)
+
+		events, err := commands.RotateAPIKey(repo, clock)(context.Background(), commands.RotateAPIKeyCommand{
+			UserID: user.ID,
+			KeyID:  apiKey.ID,
+		})
+		require.NoError(t, err)
+		require.Len(t, events, 1)
+		rotated := events[0].(commands.APIKeyRotatedEvent)
+		require.NotEqual(t, key, rotated.Key)
+		require.Equal(t, domain.HashAPIKey(rotated.Key), stored.Hash)
+		require.Equal(t, apiKey.ExpiresAt, stored.ExpiresAt, "the expiration is kept")
+	})
+
+	t.Run("rotate expired", func(t *testing.T) {
+		repo := &apiKeyRepository{}
+		repo.On("GetUserByID", mock.Anything, user.ID).Return(user, nil)
+		repo.On("GetAPIKey", mock.Anything, user.ID, apiKey.ID).Return(apiKey, nil)
+
+		later := func() time.Time { return apiKey.ExpiresAt }
+		_, err := commands.RotateAPIKey(repo, later)(context.Background(), commands.RotateAPIKeyCommand{
+			UserID: user.ID,
+			KeyID:  apiKey.ID,
+		})
+		require.ErrorIs(t, err, domain.ErrAPIKeyExpired)
+		repo.AssertNotCalled(t, "UpdateAPIKey", mock.Anything, mock.Anything)
+	})
+
+	t.Run("rotate revoked", func(t *testing.T) {
+		revoked := apiKey
+		revoked.Revoke(now)
+		repo := &apiKeyRepository{}
+		repo.On("GetUserByID", mock.Anything, user.ID).Return(user, nil)
+		repo.On("GetAPIKey", mock.Anything, user.ID, apiKey.ID).Return(revoked, nil)
+
+		_, err := commands.RotateAPIKey(repo, clock)(context.Background(), commands.RotateAPIKeyCommand{
+			UserID: user.ID,
+			KeyID:  apiKey.ID,
+		})
+		require.ErrorIs(t, err, domain.ErrAPIKeyRevoked)
+		repo.AssertNotCalled(t, "UpdateAPIKey", mock.Anything, mock.Anything)
+	})
+
+	t.Run("revoke", func(t *testing.T) {
+		repo := &apiKeyRepository{}
+		repo.On("GetAPIKey", mock.Anything, user.ID, apiKey.ID).Return(apiKey, nil).Once()
+		repo.On("UpdateAPIKey", mock.Anything, mock.MatchedBy(func(k domain.APIKey) bool {
+			return k.RevokedAt.Equal(now)
+		})).Return(nil)
+
+		events, err := commands.RevokeAPIKey(repo, clock)(context.Background(), commands.RevokeAPIKeyCommand{
+			UserID: user.ID,
+			KeyID:  apiKey.ID,
+		})
+		require.NoError(t, err)
+		require.Equal(t, []interface{}{commands.APIKeyRevokedEvent{ID: user.ID, KeyID: apiKey.ID}}, events)
+
+		// Revoking again is a no-op.
+		revoked := apiKey
+		revoked.Revoke(now)
+		repo.On("GetAPIKey", mock.Anything, user.ID, apiKey.ID).Return(revoked, nil).Once()
+		events, err = commands.RevokeAPIKey(repo, clock)(context.Background(), commands.RevokeAPIKeyCommand{
+			UserID: user.ID,
+			KeyID:  apiKey.ID,
+		})
+		require.NoError(t, err)
+		require.Empty(t, events)
+		repo.AssertExpectations(t)
+	})
+}
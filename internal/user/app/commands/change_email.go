@@ -0,0 +1,78 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/dmitrymomot/go-smart-monolith/internal/user/domain"
+)
+
+type (
+	// ChangeEmailCommand represents the request body for ChangeEmail.
+	ChangeEmailCommand struct {
+		UserID string `json:"user_id"`
+		Email  string `json:"email"`
+		// ExpectedVersion is the user version the change is based on, see domain.User.Version.
+		// Zero skips the check.
+		ExpectedVersion int64 `json:"expected_version"`
+	}
+
+	// UserEmailChangedEvent represents the event body for UserEmailChanged.
+	UserEmailChangedEvent struct {
+		ID       string `json:"id"`
+		OldEmail string `json:"old_email"`
+		NewEmail string `json:"new_email"`
+	}
+
+	// changeEmailRepository represents the repository interface for ChangeEmail.
+	changeEmailRepository interface {
+		updateUserRepository
+		GetUserByEmail(ctx context.Context, email string) (domain.User, error)
+	}
+)
+
+// OwnerID returns the ID of the user the command is applied to.
+func (c ChangeEmailCommand) OwnerID() string { return c.UserID }
+
+// ChangeEmail changes the user email.
+// The new email must be verified again if the email verification is required.
+// The old email is released by the repository, so it can be used by another user.
+func ChangeEmail(repo changeEmailRepository, flags featureFlags) func(ctx context.Context, cmd ChangeEmailCommand) ([]interface{}, error) {
+	return func(ctx context.Context, cmd ChangeEmailCommand) ([]interface{}, error) {
+		cmd.Email = domain.NormalizeEmail(cmd.Email)
+		if err := domain.ValidateEmail(cmd.Email); err != nil {
+			return nil, err
+		}
+
+		user, err := getActiveUser(ctx, repo, cmd.UserID, cmd.ExpectedVersion)
+		if err != nil {
+			return nil, err
+		}
+		if user.Email == cmd.Email {
+			return nil, nil
+		}
+
+		// Check if the email is already taken.
+		if _, err := repo.GetUserByEmail(ctx, cmd.Email); err == nil {
+			return nil, domain.ErrEmailTaken
+		} else if !errors.Is(err, domain.ErrUserNotFound) {
+			return nil, fmt.Errorf("failed to change email: %w", err)
+		}
+
+		oldEmail := user.Email
+		user.Email = cmd.Email
+		user.EmailVerified = !flags.Enabled(ctx, FlagRequireEmailVerification)
+		if err := repo.StoreUser(ctx, user); err != nil {
+			return nil, fmt.Errorf("failed to change email: %w", err)
+		}
+
+		return []interface{}{
+			UserEmailChangedEvent{
+				ID:       user.ID,
+				OldEmail: oldEmail,
+				NewEmail: user.Email,
+			},
+		}, nil
+	}
+}
@@ -0,0 +1,59 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/dmitrymomot/go-smart-monolith/internal/user/domain"
+)
+
+type (
+	// ChangePasswordCommand represents the request body for ChangePassword.
+	ChangePasswordCommand struct {
+		UserID      string `json:"user_id"`
+		OldPassword string `json:"old_password"`
+		NewPassword string `json:"new_password"`
+		// ExpectedVersion is the user version the change is based on, see domain.User.Version.
+		// Zero skips the check.
+		ExpectedVersion int64 `json:"expected_version"`
+	}
+
+	// UserPasswordChangedEvent represents the event body for UserPasswordChanged.
+	// Note: it never contains the password or its hash.
+	UserPasswordChangedEvent struct {
+		ID string `json:"id"`
+	}
+)
+
+// OwnerID returns the ID of the user the command is applied to.
+func (c ChangePasswordCommand) OwnerID() string { return c.UserID }
+
+// ChangePassword changes the user password, if the old password matches.
+func ChangePassword(repo updateUserRepository) func(ctx context.Context, cmd ChangePasswordCommand) ([]interface{}, error) {
+	return func(ctx context.Context, cmd ChangePasswordCommand) ([]interface{}, error) {
+		if err := domain.ValidatePassword(cmd.NewPassword); err != nil {
+			return nil, err
+		}
+
+		user, err := getActiveUser(ctx, repo, cmd.UserID, cmd.ExpectedVersion)
+		if err != nil {
+			return nil, err
+		}
+		if !user.CheckPassword(cmd.OldPassword) {
+			return nil, domain.ErrInvalidPassword
+		}
+
+		hash, err := domain.HashPassword(cmd.NewPassword)
+		if err != nil {
+			return nil, fmt.Errorf("failed to change password: %w", err)
+		}
+		user.PasswordHash = hash
+		if err := repo.StoreUser(ctx, user); err != nil {
+			return nil, fmt.Errorf("failed to change password: %w", err)
+		}
+
+		return []interface{}{
+			UserPasswordChangedEvent{ID: user.ID},
+		}, nil
+	}
+}
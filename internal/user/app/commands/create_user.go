@@ -8,6 +8,10 @@ import (
 	"github.com/dmitrymomot/go-smart-monolith/internal/user/domain"
 )
 
+// FlagRequireEmailVerification is a feature flag that requires new users
+// to verify their email. Otherwise the email is considered verified on signup.
+const FlagRequireEmailVerification = "require_email_verification"
+
 // ErrUserAlreadyExists is returned when the user already exists.
 var (
 	ErrUserAlreadyExists  = errors.New("user already exists")
@@ -19,6 +23,10 @@ type (
 	CreateUserCommand struct {
 		Email    string `json:"email"`
 		Password string `json:"password"`
+		// Identity is the identity provider account the user signs up with, see CompleteOIDCLogin.
+		// Such a user has no password and its email is verified by the provider.
+		// It's never decoded from the request body.
+		Identity *domain.Identity `json:"-"`
 	}
 
 	// UserCreatedEvent represents the event body for UserCreated.
@@ -32,23 +40,53 @@ type (
 		GetUserByEmail(ctx context.Context, email string) (domain.User, error)
 		StoreUser(ctx context.Context, user domain.User) error
 	}
+
+	// featureFlags represents the feature flags provider for CreateUser.
+	featureFlags interface {
+		Enabled(ctx context.Context, flag string) bool
+	}
 )
 
 // CreateUser creates a new user.
 func CreateUser(
 	repo createUserRepository,
-	flag bool,
+	flags featureFlags,
 ) func(ctx context.Context, cmd CreateUserCommand) ([]interface{}, error) {
 	return func(ctx context.Context, cmd CreateUserCommand) ([]interface{}, error) {
+		email := domain.NormalizeEmail(cmd.Email)
+		if err := domain.ValidateEmail(email); err != nil {
+			return nil, err
+		}
+		if cmd.Identity == nil {
+			if err := domain.ValidatePassword(cmd.Password); err != nil {
+				return nil, err
+			}
+		}
+
 		// Check if the email is already taken.
-		if _, err := repo.GetUserByEmail(ctx, cmd.Email); err == nil {
+		if _, err := repo.GetUserByEmail(ctx, email); err == nil {
 			return nil, ErrUserAlreadyExists
 		}
 
 		// Create the user.
-		user := domain.NewUser(cmd.Email, cmd.Password)
+		// The identity provider users have no password, nothing matches the empty hash.
+		var hash string
+		if cmd.Identity == nil {
+			var err error
+			if hash, err = domain.HashPassword(cmd.Password); err != nil {
+				return nil, fmt.Errorf("%w: %v", ErrFailedToCreateUser, err)
+			}
+		}
+		user := domain.NewUser(email, hash)
+		user.EmailVerified = !flags.Enabled(ctx, FlagRequireEmailVerification)
+		if cmd.Identity != nil {
+			// The provider has verified the email.
+			user.EmailVerified = true
+			user.LinkIdentity(cmd.Identity.Provider, cmd.Identity.Subject, user.CreatedAt)
+		}
 		if err := repo.StoreUser(ctx, user); err != nil {
-			return nil, fmt.Errorf("%w: %v", ErrFailedToCreateUser, err)
+			// The email may be taken meanwhile, see domain.ErrEmailTaken.
+			return nil, fmt.Errorf("%w: %w", ErrFailedToCreateUser, err)
 		}
 
 		// Return the event.
@@ -7,6 +7,7 @@ import (
 
 	"github.com/dmitrymomot/go-smart-monolith/internal/user/app/commands"
 	"github.com/dmitrymomot/go-smart-monolith/internal/user/domain"
+	"github.com/dmitrymomot/go-smart-monolith/pkg/featureflag"
 
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
@@ -47,7 +48,7 @@ func TestCreateUser(t *testing.T) {
 		repo.On("StoreUser", mock.Anything, mock.Anything).Return(nil)
 
 		// Create the command.
-		cmd := commands.CreateUser(repo, true)
+		cmd := commands.CreateUser(repo, featureflag.NewStatic())
 
 		// Call the method under test.
 		events, err := cmd(context.Background(), commands.CreateUserCommand{
@@ -62,6 +63,52 @@ func TestCreateUser(t *testing.T) {
 		repo.AssertExpectations(t)
 	})
 
+	// Email verification is required by the feature flag.
+	t.Run("require_email_verification", func(t *testing.T) {
+		// Create the repository mock and set the expectations.
+		repo := &createUserRepository{}
+		repo.On("GetUserByEmail", mock.Anything, email).Return(domain.User{}, errors.New("not found"))
+		repo.On("StoreUser", mock.Anything, mock.MatchedBy(func(u domain.User) bool {
+			return !u.EmailVerified
+		})).Return(nil)
+
+		// Create the command with the flag enabled.
+		cmd := commands.CreateUser(repo, featureflag.NewStatic(commands.FlagRequireEmailVerification))
+
+		// Call the method under test.
+		_, err := cmd(context.Background(), commands.CreateUserCommand{
+			Email:    email,
+			Password: password,
+		})
+		require.NoError(t, err)
+
+		// Assert the expectations.
+		repo.AssertExpectations(t)
+	})
+
+	// Signup with the identity provider account.
+	t.Run("identity", func(t *testing.T) {
+		// Create the repository mock and set the expectations.
+		repo := &createUserRepository{}
+		repo.On("GetUserByEmail", mock.Anything, email).Return(domain.User{}, errors.New("not found"))
+		repo.On("StoreUser", mock.Anything, mock.MatchedBy(func(u domain.User) bool {
+			return u.EmailVerified && u.PasswordHash == "" && !u.CheckPassword("") && u.HasIdentity("google", "subject-1")
+		})).Return(nil)
+
+		// Create the command with the flag enabled: the provider has verified the email.
+		cmd := commands.CreateUser(repo, featureflag.NewStatic(commands.FlagRequireEmailVerification))
+
+		// Call the method under test.
+		_, err := cmd(context.Background(), commands.CreateUserCommand{
+			Email:    email,
+			Identity: &domain.Identity{Provider: "google", Subject: "subject-1"},
+		})
+		require.NoError(t, err)
+
+		// Assert the expectations.
+		repo.AssertExpectations(t)
+	})
+
 	// Email is already taken.
 	t.Run("email_taken", func(t *testing.T) {
 		// Create the repository mock and set the expectations.
@@ -70,7 +117,7 @@ func TestCreateUser(t *testing.T) {
 		repo.On("GetUserByEmail", mock.Anything, email).Return(user, nil)
 
 		// Create the command.
-		cmd := commands.CreateUser(repo, true)
+		cmd := commands.CreateUser(repo, featureflag.NewStatic())
 
 		// Call the method under test.
 		events, err := cmd(context.Background(), commands.CreateUserCommand{
@@ -85,6 +132,45 @@ func TestCreateUser(t *testing.T) {
 		repo.AssertExpectations(t)
 	})
 
+	// The email and the password are validated before the repository is called.
+	t.Run("invalid", func(t *testing.T) {
+		cmd := commands.CreateUser(&createUserRepository{}, featureflag.NewStatic())
+
+		_, err := cmd(context.Background(), commands.CreateUserCommand{Email: "not-an-email", Password: password})
+		require.ErrorIs(t, err, domain.ErrInvalidEmail)
+		_, err = cmd(context.Background(), commands.CreateUserCommand{Email: email, Password: "short"})
+		require.ErrorIs(t, err, domain.ErrWeakPassword)
+	})
+
+	// The email is normalized, so it's found whatever the case.
+	t.Run("normalized_email", func(t *testing.T) {
+		repo := &createUserRepository{}
+		repo.On("GetUserByEmail", mock.Anything, email).Return(domain.User{}, domain.ErrUserNotFound)
+		repo.On("StoreUser", mock.Anything, mock.MatchedBy(func(u domain.User) bool {
+			return u.Email == email
+		})).Return(nil)
+
+		cmd := commands.CreateUser(repo, featureflag.NewStatic())
+		_, err := cmd(context.Background(), commands.CreateUserCommand{Email: " Test@Mail.dev ", Password: password})
+		require.NoError(t, err)
+
+		repo.AssertExpectations(t)
+	})
+
+	// The email is taken meanwhile by another signup.
+	t.Run("email_taken_on_store", func(t *testing.T) {
+		repo := &createUserRepository{}
+		repo.On("GetUserByEmail", mock.Anything, email).Return(domain.User{}, domain.ErrUserNotFound)
+		repo.On("StoreUser", mock.Anything, mock.Anything).Return(domain.ErrEmailTaken)
+
+		cmd := commands.CreateUser(repo, featureflag.NewStatic())
+		_, err := cmd(context.Background(), commands.CreateUserCommand{Email: email, Password: password})
+		require.ErrorIs(t, err, commands.ErrFailedToCreateUser)
+		require.ErrorIs(t, err, domain.ErrEmailTaken)
+
+		repo.AssertExpectations(t)
+	})
+
 	// Failed to create user.
 	t.Run("failed_to_create_user", func(t *testing.T) {
 		// Create the repository mock and set the expectations.
@@ -93,7 +179,7 @@ func TestCreateUser(t *testing.T) {
 		repo.On("StoreUser", mock.Anything, mock.Anything).Return(errors.New("failed to create user"))
 
 		// Create the command.
-		cmd := commands.CreateUser(repo, true)
+		cmd := commands.CreateUser(repo, featureflag.NewStatic())
 
 		// Call the method under test.
 		events, err := cmd(context.Background(), commands.CreateUserCommand{
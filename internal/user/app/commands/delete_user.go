@@ -0,0 +1,150 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/dmitrymomot/go-smart-monolith/internal/user/domain"
+)
+
+var (
+	// ErrUserNotDeleted is returned when restoring a user that isn't deleted.
+	ErrUserNotDeleted = errors.New("user is not deleted")
+	// ErrRestoreWindowExpired is returned when restoring a user after the restore window.
+	ErrRestoreWindowExpired = errors.New("restore window expired")
+)
+
+// purgeBatchSize is the max number of users purged by a single PurgeDeletedUsers call.
+const purgeBatchSize = 100
+
+type (
+	// DeleteUserCommand represents the request body for DeleteUser.
+	DeleteUserCommand struct {
+		UserID string `json:"user_id"`
+		// ExpectedVersion is the user version the change is based on, see domain.User.Version.
+		// Zero skips the check.
+		ExpectedVersion int64 `json:"expected_version"`
+	}
+
+	// RestoreUserCommand represents the request body for RestoreUser.
+	RestoreUserCommand struct {
+		UserID string `json:"user_id"`
+		// ExpectedVersion is the user version the change is based on, see domain.User.Version.
+		// Zero skips the check.
+		ExpectedVersion int64 `json:"expected_version"`
+	}
+
+	// PurgeDeletedUsersCommand is a system command that permanently deletes
+	// the users whose restore window is expired. It's run by a background job.
+	PurgeDeletedUsersCommand struct{}
+
+	// UserDeletedEvent represents the event body for UserDeleted.
+	UserDeletedEvent struct {
+		ID string `json:"id"`
+		// PurgeAfter is the end of the restore window.
+		PurgeAfter time.Time `json:"purge_after"`
+	}
+
+	// UserRestoredEvent represents the event body for UserRestored.
+	UserRestoredEvent struct {
+		ID string `json:"id"`
+	}
+
+	// UserPurgedEvent represents the event body for UserPurged.
+	// The subscribers must delete all the data of the user.
+	UserPurgedEvent struct {
+		ID string `json:"id"`
+	}
+
+	// purgeUsersRepository represents the repository interface for PurgeDeletedUsers.
+	purgeUsersRepository interface {
+		ListDeletedUsers(ctx context.Context, before time.Time, limit int) ([]domain.User, error)
+		DeleteUser(ctx context.Context, user domain.User) error
+	}
+)
+
+// OwnerID returns the ID of the user the command is applied to.
+func (c DeleteUserCommand) OwnerID() string { return c.UserID }
+
+// OwnerID returns the ID of the user the command is applied to.
+func (c RestoreUserCommand) OwnerID() string { return c.UserID }
+
+// DeleteUser soft deletes the user. The user can be restored within the restore window,
+// then it's permanently deleted by PurgeDeletedUsers.
+func DeleteUser(repo updateUserRepository, restoreWindow time.Duration, now func() time.Time) func(ctx context.Context, cmd DeleteUserCommand) ([]interface{}, error) {
+	return func(ctx context.Context, cmd DeleteUserCommand) ([]interface{}, error) {
+		user, err := getActiveUser(ctx, repo, cmd.UserID, cmd.ExpectedVersion)
+		if err != nil {
+			return nil, err
+		}
+
+		user.DeletedAt = now().UTC()
+		if err := repo.StoreUser(ctx, user); err != nil {
+			return nil, fmt.Errorf("failed to delete user: %w", err)
+		}
+
+		return []interface{}{
+			UserDeletedEvent{
+				ID:         user.ID,
+				PurgeAfter: user.DeletedAt.Add(restoreWindow),
+			},
+		}, nil
+	}
+}
+
+// RestoreUser restores the soft deleted user within the restore window.
+func RestoreUser(repo updateUserRepository, restoreWindow time.Duration, now func() time.Time) func(ctx context.Context, cmd RestoreUserCommand) ([]interface{}, error) {
+	return func(ctx context.Context, cmd RestoreUserCommand) ([]interface{}, error) {
+		user, err := repo.GetUserByID(ctx, cmd.UserID)
+		if err != nil {
+			return nil, err
+		}
+		if !user.IsDeleted() {
+			return nil, ErrUserNotDeleted
+		}
+		if err := checkVersion(user, cmd.ExpectedVersion); err != nil {
+			return nil, err
+		}
+		if now().After(user.DeletedAt.Add(restoreWindow)) {
+			return nil, ErrRestoreWindowExpired
+		}
+
+		user.DeletedAt = time.Time{}
+		if err := repo.StoreUser(ctx, user); err != nil {
+			return nil, fmt.Errorf("failed to restore user: %w", err)
+		}
+
+		return []interface{}{
+			UserRestoredEvent{ID: user.ID},
+		}, nil
+	}
+}
+
+// PurgeDeletedUsers permanently deletes the users whose restore window is expired.
+// It purges up to purgeBatchSize users per call, the rest are purged by the next calls.
+func PurgeDeletedUsers(repo purgeUsersRepository, restoreWindow time.Duration, now func() time.Time) func(ctx context.Context, cmd PurgeDeletedUsersCommand) ([]interface{}, error) {
+	return func(ctx context.Context, cmd PurgeDeletedUsersCommand) ([]interface{}, error) {
+		users, err := repo.ListDeletedUsers(ctx, now().Add(-restoreWindow), purgeBatchSize)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list deleted users: %w", err)
+		}
+
+		// The failed users are left in the index to be purged by the next call.
+		// The events of the purged users are returned with the error, so they are still published.
+		var (
+			events []interface{}
+			errs   []error
+		)
+		for _, u := range users {
+			if err := repo.DeleteUser(ctx, u); err != nil {
+				errs = append(errs, fmt.Errorf("failed to purge user %s: %w", u.ID, err))
+				continue
+			}
+			events = append(events, UserPurgedEvent{ID: u.ID})
+		}
+
+		return events, errors.Join(errs...)
+	}
+}
@@ -0,0 +1,107 @@
+package commands_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/dmitrymomot/go-smart-monolith/internal/user/app/commands"
+	"github.com/dmitrymomot/go-smart-monolith/internal/user/domain"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// purgeUsersRepository is a mock implementation of the purgeUsersRepository interface.
+type purgeUsersRepository struct {
+	mock.Mock
+}
+
+// ListDeletedUsers is a mock implementation of the ListDeletedUsers method.
+func (m *purgeUsersRepository) ListDeletedUsers(ctx context.Context, before time.Time, limit int) ([]domain.User, error) {
+	args := m.Called(ctx, before, limit)
+	return args.Get(0).([]domain.User), args.Error(1)
+}
+
+// DeleteUser is a mock implementation of the DeleteUser method.
+func (m *purgeUsersRepository) DeleteUser(ctx context.Context, user domain.User) error {
+	args := m.Called(ctx, user)
+	return args.Error(0)
+}
+
+func TestDeleteAndRestoreUser(t *testing.T) {
+	const window = time.Hour
+	now := time.Date(2023, 1, 1, 12, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+
+	user := domain.NewUser("test@mail.dev", "")
+	deleted := user
+	deleted.DeletedAt = now
+
+	t.Run("delete", func(t *testing.T) {
+		repo := &updateUserRepository{}
+		repo.On("GetUserByID", mock.Anything, user.ID).Return(user, nil)
+		repo.On("StoreUser", mock.Anything, deleted).Return(nil)
+
+		events, err := commands.DeleteUser(repo, window, clock)(context.Background(), commands.DeleteUserCommand{UserID: user.ID})
+		require.NoError(t, err)
+		require.Equal(t, []interface{}{
+			commands.UserDeletedEvent{ID: user.ID, PurgeAfter: now.Add(window)},
+		}, events)
+		repo.AssertExpectations(t)
+	})
+
+	t.Run("restore", func(t *testing.T) {
+		repo := &updateUserRepository{}
+		repo.On("GetUserByID", mock.Anything, user.ID).Return(deleted, nil)
+		repo.On("StoreUser", mock.Anything, user).Return(nil)
+
+		events, err := commands.RestoreUser(repo, window, clock)(context.Background(), commands.RestoreUserCommand{UserID: user.ID})
+		require.NoError(t, err)
+		require.Equal(t, []interface{}{commands.UserRestoredEvent{ID: user.ID}}, events)
+		repo.AssertExpectations(t)
+	})
+
+	t.Run("restore after window", func(t *testing.T) {
+		repo := &updateUserRepository{}
+		repo.On("GetUserByID", mock.Anything, user.ID).Return(deleted, nil)
+
+		later := func() time.Time { return now.Add(window + time.Second) }
+		_, err := commands.RestoreUser(repo, window, later)(context.Background(), commands.RestoreUserCommand{UserID: user.ID})
+		require.ErrorIs(t, err, commands.ErrRestoreWindowExpired)
+	})
+
+	t.Run("restore active user", func(t *testing.T) {
+		repo := &updateUserRepository{}
+		repo.On("GetUserByID", mock.Anything, user.ID).Return(user, nil)
+
+		_, err := commands.RestoreUser(repo, window, clock)(context.Background(), commands.RestoreUserCommand{UserID: user.ID})
+		require.ErrorIs(t, err, commands.ErrUserNotDeleted)
+	})
+}
+
+func TestPurgeDeletedUsers(t *testing.T) {
+	const window = time.Hour
+	now := time.Date(2023, 1, 1, 12, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+
+	u1 := domain.NewUser("u1@mail.dev", "")
+	u2 := domain.NewUser("u2@mail.dev", "")
+	u3 := domain.NewUser("u3@mail.dev", "")
+
+	repo := &purgeUsersRepository{}
+	repo.On("ListDeletedUsers", mock.Anything, now.Add(-window), mock.Anything).Return([]domain.User{u1, u2, u3}, nil)
+	repo.On("DeleteUser", mock.Anything, u1).Return(nil)
+	repo.On("DeleteUser", mock.Anything, u2).Return(errors.New("storage is down"))
+	repo.On("DeleteUser", mock.Anything, u3).Return(nil)
+
+	// A failed user doesn't stop purging the others, their events are returned with the error.
+	events, err := commands.PurgeDeletedUsers(repo, window, clock)(context.Background(), commands.PurgeDeletedUsersCommand{})
+	require.ErrorContains(t, err, "storage is down")
+	require.Equal(t, []interface{}{
+		commands.UserPurgedEvent{ID: u1.ID},
+		commands.UserPurgedEvent{ID: u3.ID},
+	}, events)
+	repo.AssertExpectations(t)
+}
@@ -0,0 +1,58 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/dmitrymomot/go-smart-monolith/internal/user/domain"
+)
+
+type (
+	// UnlockAccountCommand represents the request body for UnlockAccount.
+	UnlockAccountCommand struct {
+		UserID string `json:"user_id"`
+	}
+
+	// AccountUnlockedEvent represents the event body for AccountUnlocked.
+	AccountUnlockedEvent struct {
+		ID string `json:"id"`
+	}
+
+	// unlockAccountRepository represents the repository interface for UnlockAccount.
+	unlockAccountRepository interface {
+		GetUserByID(ctx context.Context, id string) (domain.User, error)
+		DeleteLoginAttempts(ctx context.Context, key string) error
+	}
+)
+
+// LoginEmail returns the email of the account the login is attempted to, see decorators/lockout.
+func (c LoginCommand) LoginEmail() string { return c.Email }
+
+// LoginIP returns the IP the login is attempted from, see decorators/lockout.
+func (c LoginCommand) LoginIP() string { return c.Client.IP }
+
+// LoginEmail returns no email: the challenge is issued after the password is checked,
+// and the challenge itself is revoked after a few wrong codes, see domain.MaxMFAChallengeAttempts.
+func (c LoginMFACommand) LoginEmail() string { return "" }
+
+// LoginIP returns the IP the login is attempted from, see decorators/lockout.
+func (c LoginMFACommand) LoginIP() string { return c.Client.IP }
+
+// UnlockAccount unlocks the login of the user locked after too many failed attempts,
+// e.g. by the support staff after the user has proven the identity.
+// The locks of the IPs are not changed.
+func UnlockAccount(repo unlockAccountRepository) func(ctx context.Context, cmd UnlockAccountCommand) ([]interface{}, error) {
+	return func(ctx context.Context, cmd UnlockAccountCommand) ([]interface{}, error) {
+		user, err := repo.GetUserByID(ctx, cmd.UserID)
+		if err != nil {
+			return nil, err
+		}
+		if err := repo.DeleteLoginAttempts(ctx, domain.AccountAttemptsKey(user.Email)); err != nil {
+			return nil, fmt.Errorf("failed to unlock account: %w", err)
+		}
+
+		return []interface{}{
+			AccountUnlockedEvent{ID: user.ID},
+		}, nil
+	}
+}
@@ -0,0 +1,47 @@
+package commands_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/dmitrymomot/go-smart-monolith/internal/user/app/commands"
+	"github.com/dmitrymomot/go-smart-monolith/internal/user/domain"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// unlockAccountRepository is a mock implementation of the unlockAccountRepository interface.
+type unlockAccountRepository struct {
+	updateUserRepository
+}
+
+// DeleteLoginAttempts is a mock implementation of the DeleteLoginAttempts method.
+func (m *unlockAccountRepository) DeleteLoginAttempts(ctx context.Context, key string) error {
+	args := m.Called(ctx, key)
+	return args.Error(0)
+}
+
+func TestUnlockAccount(t *testing.T) {
+	user := newUser(t, "password")
+	user.Email = "Test@mail.dev"
+
+	t.Run("success", func(t *testing.T) {
+		repo := &unlockAccountRepository{}
+		repo.On("GetUserByID", mock.Anything, user.ID).Return(user, nil)
+		repo.On("DeleteLoginAttempts", mock.Anything, "account:test@mail.dev").Return(nil)
+
+		events, err := commands.UnlockAccount(repo)(context.Background(), commands.UnlockAccountCommand{UserID: user.ID})
+		require.NoError(t, err)
+		require.Equal(t, []interface{}{commands.AccountUnlockedEvent{ID: user.ID}}, events)
+		repo.AssertExpectations(t)
+	})
+
+	t.Run("unknown user", func(t *testing.T) {
+		repo := &unlockAccountRepository{}
+		repo.On("GetUserByID", mock.Anything, "unknown").Return(domain.User{}, domain.ErrUserNotFound)
+
+		_, err := commands.UnlockAccount(repo)(context.Background(), commands.UnlockAccountCommand{UserID: "unknown"})
+		require.ErrorIs(t, err, domain.ErrUserNotFound)
+	})
+}
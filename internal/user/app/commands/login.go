@@ -0,0 +1,208 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/dmitrymomot/go-smart-monolith/internal/user/domain"
+)
+
+type (
+	// LoginCommand represents the request body for Login.
+	LoginCommand struct {
+		Email    string `json:"email"`
+		Password string `json:"password"`
+		// Client is the client the user logs in from, it's recorded in the session.
+		Client domain.SessionClient `json:"-"`
+	}
+
+	// LoginMFACommand represents the request body for LoginMFA.
+	LoginMFACommand struct {
+		ChallengeToken string `json:"challenge_token"`
+		// Code is a TOTP code or a recovery code.
+		Code string `json:"code"`
+		// Client is the client the user logs in from, it's recorded in the session.
+		Client domain.SessionClient `json:"-"`
+	}
+
+	// UserLoggedInEvent represents the event body for UserLoggedIn.
+	// The access token is returned to the caller, but never published.
+	UserLoggedInEvent struct {
+		ID          string    `json:"id"`
+		SessionID   string    `json:"session_id"`
+		MFA         bool      `json:"mfa"`
+		AccessToken string    `json:"-"`
+		ExpiresAt   time.Time `json:"expires_at"`
+	}
+
+	// MFAChallengeIssuedEvent represents the event body for MFAChallengeIssued.
+	// The password is checked, the challenge token is exchanged for the access token with the second factor.
+	// The challenge token is returned to the caller, but never published.
+	MFAChallengeIssuedEvent struct {
+		ID             string    `json:"id"`
+		ChallengeToken string    `json:"-"`
+		ExpiresAt      time.Time `json:"expires_at"`
+	}
+
+	// LoginOptions defines the login tokens.
+	LoginOptions struct {
+		// AccessTokenTTL is how long the access token and its session are valid.
+		AccessTokenTTL time.Duration
+		// MFAChallengeTTL is how long the user has to enter the second factor.
+		MFAChallengeTTL time.Duration
+	}
+
+	// loginRepository represents the repository interface for the login commands.
+	loginRepository interface {
+		updateUserRepository
+		GetUserByEmail(ctx context.Context, email string) (domain.User, error)
+		StoreMFAChallenge(ctx context.Context, challenge domain.MFAChallenge) error
+		UpdateMFAChallenge(ctx context.Context, hash string, fn func(c *domain.MFAChallenge) error) (domain.MFAChallenge, error)
+		DeleteMFAChallenge(ctx context.Context, hash string) error
+		StoreSession(ctx context.Context, session domain.Session) error
+	}
+
+	// tokenIssuer issues the access tokens bound to the sessions, see pkg/auth.
+	tokenIssuer interface {
+		IssueSession(subject, sessionID string, ttl time.Duration) (string, error)
+	}
+)
+
+// Login checks the user password and issues the access token.
+// If the user has MFA enabled, the MFA challenge is issued instead, see LoginMFA.
+func Login(repo loginRepository, tokens tokenIssuer, opts LoginOptions, now func() time.Time) func(ctx context.Context, cmd LoginCommand) ([]interface{}, error) {
+	return func(ctx context.Context, cmd LoginCommand) ([]interface{}, error) {
+		// The invalid email is the same as the unknown one, so the response doesn't tell them apart.
+		email := domain.NormalizeEmail(cmd.Email)
+		if err := domain.ValidateEmail(email); err != nil {
+			domain.SimulatePasswordCheck(cmd.Password)
+			return nil, domain.ErrInvalidCredentials
+		}
+
+		user, err := repo.GetUserByEmail(ctx, email)
+		if err != nil && !errors.Is(err, domain.ErrUserNotFound) {
+			return nil, fmt.Errorf("failed to login: %w", err)
+		}
+		if err != nil || user.IsDeleted() {
+			domain.SimulatePasswordCheck(cmd.Password)
+			return nil, domain.ErrInvalidCredentials
+		}
+		if !user.CheckPassword(cmd.Password) {
+			return nil, domain.ErrInvalidCredentials
+		}
+
+		return completeLogin(ctx, repo, tokens, opts, user, cmd.Client, now())
+	}
+}
+
+// completeLogin starts the session of the user whose identity is proven and issues its access token,
+// or issues the MFA challenge if the user has MFA enabled.
+func completeLogin(ctx context.Context, repo loginRepository, tokens tokenIssuer, opts LoginOptions, user domain.User, client domain.SessionClient, now time.Time) ([]interface{}, error) {
+	if !user.MFA.Enabled {
+		e, err := startSession(ctx, repo, tokens, user, client, false, opts.AccessTokenTTL, now)
+		if err != nil {
+			return nil, err
+		}
+		return []interface{}{e}, nil
+	}
+
+	token, challenge, err := domain.NewMFAChallenge(user, opts.MFAChallengeTTL, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to issue mfa challenge: %w", err)
+	}
+	if err := repo.StoreMFAChallenge(ctx, challenge); err != nil {
+		return nil, fmt.Errorf("failed to store mfa challenge: %w", err)
+	}
+
+	return []interface{}{
+		MFAChallengeIssuedEvent{
+			ID:             user.ID,
+			ChallengeToken: token,
+			ExpiresAt:      challenge.ExpiresAt,
+		},
+	}, nil
+}
+
+// LoginMFA checks the second factor of the MFA challenge and issues the access token.
+// The challenge is revoked after MaxMFAChallengeAttempts wrong codes.
+func LoginMFA(repo loginRepository, tokens tokenIssuer, opts LoginOptions, now func() time.Time) func(ctx context.Context, cmd LoginMFACommand) ([]interface{}, error) {
+	return func(ctx context.Context, cmd LoginMFACommand) ([]interface{}, error) {
+		// The attempt is counted before the code is checked,
+		// so the concurrent guesses can't exceed MaxMFAChallengeAttempts.
+		hash := domain.HashMFAChallengeToken(cmd.ChallengeToken)
+		challenge, err := repo.UpdateMFAChallenge(ctx, hash, func(c *domain.MFAChallenge) error {
+			if c.IsExpired(now()) {
+				return domain.ErrMFAChallengeExpired
+			}
+			if c.Attempts >= domain.MaxMFAChallengeAttempts {
+				return domain.ErrInvalidMFAChallenge
+			}
+			c.Attempts++
+			return nil
+		})
+		if errors.Is(err, domain.ErrMFAChallengeExpired) {
+			// The expired challenge is useless, it's deleted on the best effort basis.
+			_ = repo.DeleteMFAChallenge(ctx, hash)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		user, err := getActiveUser(ctx, repo, challenge.UserID, 0)
+		if err != nil {
+			return nil, err
+		}
+		if err := user.VerifyMFACode(cmd.Code, now()); err != nil {
+			if challenge.Attempts >= domain.MaxMFAChallengeAttempts {
+				_ = repo.DeleteMFAChallenge(ctx, hash)
+			}
+			return nil, err
+		}
+
+		// The used code is stored, so it can't be used again.
+		// A concurrent login with the same code fails with domain.ErrConcurrentModification.
+		if err := repo.StoreUser(ctx, user); err != nil {
+			return nil, fmt.Errorf("failed to login: %w", err)
+		}
+		if err := repo.DeleteMFAChallenge(ctx, hash); err != nil {
+			return nil, fmt.Errorf("failed to delete mfa challenge: %w", err)
+		}
+
+		e, err := startSession(ctx, repo, tokens, user, cmd.Client, true, opts.AccessTokenTTL, now())
+		if err != nil {
+			return nil, err
+		}
+		return []interface{}{e}, nil
+	}
+}
+
+// startSession stores a new session of the user and issues the access token bound to it.
+// The session expires together with the token.
+func startSession(
+	ctx context.Context,
+	repo loginRepository,
+	tokens tokenIssuer,
+	user domain.User,
+	client domain.SessionClient,
+	mfa bool,
+	ttl time.Duration,
+	now time.Time,
+) (UserLoggedInEvent, error) {
+	session := domain.NewSession(user, client, ttl, now)
+	token, err := tokens.IssueSession(user.ID, session.ID, ttl)
+	if err != nil {
+		return UserLoggedInEvent{}, fmt.Errorf("failed to issue access token: %w", err)
+	}
+	if err := repo.StoreSession(ctx, session); err != nil {
+		return UserLoggedInEvent{}, fmt.Errorf("failed to store session: %w", err)
+	}
+	return UserLoggedInEvent{
+		ID:          user.ID,
+		SessionID:   session.ID,
+		MFA:         mfa,
+		AccessToken: token,
+		ExpiresAt:   now.Add(ttl),
+	}, nil
+}
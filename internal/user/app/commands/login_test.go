@@ -0,0 +1,289 @@
+package commands_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dmitrymomot/go-smart-monolith/internal/user/app/commands"
+	"github.com/dmitrymomot/go-smart-monolith/internal/user/domain"
+	"github.com/dmitrymomot/go-smart-monolith/pkg/totp"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// loginRepository is a mock implementation of the loginRepository interface.
+type loginRepository struct {
+	updateUserRepository
+}
+
+// StoreMFAChallenge is a mock implementation of the StoreMFAChallenge method.
+func (m *loginRepository) StoreMFAChallenge(ctx context.Context, challenge domain.MFAChallenge) error {
+	args := m.Called(ctx, challenge)
+	return args.Error(0)
+}
+
+// UpdateMFAChallenge is a mock implementation of the UpdateMFAChallenge method.
+// fn is applied to the returned challenge.
+func (m *loginRepository) UpdateMFAChallenge(ctx context.Context, hash string, fn func(c *domain.MFAChallenge) error) (domain.MFAChallenge, error) {
+	args := m.Called(ctx, hash)
+	challenge := args.Get(0).(domain.MFAChallenge)
+	if err := args.Error(1); err != nil {
+		return domain.MFAChallenge{}, err
+	}
+	if err := fn(&challenge); err != nil {
+		return domain.MFAChallenge{}, err
+	}
+	return challenge, nil
+}
+
+// DeleteMFAChallenge is a mock implementation of the DeleteMFAChallenge method.
+func (m *loginRepository) DeleteMFAChallenge(ctx context.Context, hash string) error {
+	args := m.Called(ctx, hash)
+	return args.Error(0)
+}
+
+// StoreSession is a mock implementation of the StoreSession method.
+func (m *loginRepository) StoreSession(ctx context.Context, session domain.Session) error {
+	args := m.Called(ctx, session)
+	return args.Error(0)
+}
+
+// tokenIssuer is a mock implementation of the tokenIssuer interface.
+type tokenIssuer struct {
+	mock.Mock
+}
+
+// IssueSession is a mock implementation of the IssueSession method.
+func (m *tokenIssuer) IssueSession(subject, sessionID string, ttl time.Duration) (string, error) {
+	args := m.Called(subject, sessionID, ttl)
+	return args.String(0), args.Error(1)
+}
+
+// expectSession sets up the repository and the issuer to start a session of the user,
+// and returns the stored session once it's started.
+func expectSession(repo *loginRepository, tokens *tokenIssuer, user domain.User, ttl time.Duration) *domain.Session {
+	session := &domain.Session{}
+	repo.On("StoreSession", mock.Anything, mock.MatchedBy(func(s domain.Session) bool {
+		return s.UserID == user.ID
+	})).Run(func(args mock.Arguments) {
+		*session = args.Get(1).(domain.Session)
+	}).Return(nil).Once()
+	tokens.On("IssueSession", user.ID, mock.Anything, ttl).Return("access-token", nil).Once()
+	return session
+}
+
+func TestLogin(t *testing.T) {
+	now := time.Date(2023, 1, 1, 12, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+	opts := commands.LoginOptions{AccessTokenTTL: time.Hour, MFAChallengeTTL: 5 * time.Minute}
+	user := newUser(t, "password")
+
+	t.Run("success", func(t *testing.T) {
+		repo := &loginRepository{}
+		repo.On("GetUserByEmail", mock.Anything, user.Email).Return(user, nil)
+		tokens := &tokenIssuer{}
+		session := expectSession(repo, tokens, user, opts.AccessTokenTTL)
+		client := domain.SessionClient{Device: "Chrome on Windows", IP: "127.0.0.1", UserAgent: "Mozilla/5.0"}
+
+		events, err := commands.Login(repo, tokens, opts, clock)(context.Background(), commands.LoginCommand{
+			Email:    user.Email,
+			Password: "password",
+			Client:   client,
+		})
+		require.NoError(t, err)
+		require.Equal(t, []interface{}{
+			commands.UserLoggedInEvent{ID: user.ID, SessionID: session.ID, AccessToken: "access-token", ExpiresAt: now.Add(opts.AccessTokenTTL)},
+		}, events)
+
+		// The token is bound to the session of the client, which expires with the token.
+		tokens.AssertCalled(t, "IssueSession", user.ID, session.ID, opts.AccessTokenTTL)
+		require.Equal(t, domain.Session{
+			ID:            session.ID,
+			UserID:        user.ID,
+			SessionClient: client,
+			CreatedAt:     now,
+			LastSeenAt:    now,
+			ExpiresAt:     now.Add(opts.AccessTokenTTL),
+		}, *session)
+	})
+
+	t.Run("wrong password", func(t *testing.T) {
+		repo := &loginRepository{}
+		repo.On("GetUserByEmail", mock.Anything, user.Email).Return(user, nil)
+
+		_, err := commands.Login(repo, &tokenIssuer{}, opts, clock)(context.Background(), commands.LoginCommand{
+			Email:    user.Email,
+			Password: "wrong",
+		})
+		require.ErrorIs(t, err, domain.ErrInvalidCredentials)
+	})
+
+	t.Run("unknown email", func(t *testing.T) {
+		repo := &loginRepository{}
+		repo.On("GetUserByEmail", mock.Anything, "unknown@mail.dev").Return(domain.User{}, domain.ErrUserNotFound)
+
+		_, err := commands.Login(repo, &tokenIssuer{}, opts, clock)(context.Background(), commands.LoginCommand{
+			Email:    "unknown@mail.dev",
+			Password: "password",
+		})
+		require.ErrorIs(t, err, domain.ErrInvalidCredentials, "the same error as for the wrong password")
+	})
+
+	t.Run("invalid email", func(t *testing.T) {
+		repo := &loginRepository{}
+
+		_, err := commands.Login(repo, &tokenIssuer{}, opts, clock)(context.Background(), commands.LoginCommand{
+			Email:    "not an email",
+			Password: "password",
+		})
+		require.ErrorIs(t, err, domain.ErrInvalidCredentials, "the same error as for the unknown email")
+		repo.AssertNotCalled(t, "GetUserByEmail", mock.Anything, mock.Anything)
+	})
+
+	t.Run("normalized email", func(t *testing.T) {
+		repo := &loginRepository{}
+		repo.On("GetUserByEmail", mock.Anything, user.Email).Return(user, nil)
+		tokens := &tokenIssuer{}
+		expectSession(repo, tokens, user, opts.AccessTokenTTL)
+
+		_, err := commands.Login(repo, tokens, opts, clock)(context.Background(), commands.LoginCommand{
+			Email:    " " + strings.ToUpper(user.Email),
+			Password: "password",
+		})
+		require.NoError(t, err)
+	})
+
+	t.Run("mfa enabled", func(t *testing.T) {
+		user, _, _ := newMFAUser(t, now)
+		var stored domain.MFAChallenge
+		repo := &loginRepository{}
+		repo.On("GetUserByEmail", mock.Anything, user.Email).Return(user, nil)
+		repo.On("StoreMFAChallenge", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+			stored = args.Get(1).(domain.MFAChallenge)
+		}).Return(nil)
+
+		events, err := commands.Login(repo, &tokenIssuer{}, opts, clock)(context.Background(), commands.LoginCommand{
+			Email:    user.Email,
+			Password: "password",
+		})
+		require.NoError(t, err)
+		require.Len(t, events, 1)
+		issued := events[0].(commands.MFAChallengeIssuedEvent)
+		require.Equal(t, now.Add(opts.MFAChallengeTTL), issued.ExpiresAt)
+
+		// Only the token hash is stored.
+		require.Equal(t, domain.MFAChallenge{
+			Hash:      domain.HashMFAChallengeToken(issued.ChallengeToken),
+			UserID:    user.ID,
+			ExpiresAt: issued.ExpiresAt,
+		}, stored)
+	})
+}
+
+func TestLoginMFA(t *testing.T) {
+	now := time.Date(2023, 1, 1, 12, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+	opts := commands.LoginOptions{AccessTokenTTL: time.Hour, MFAChallengeTTL: 5 * time.Minute}
+	user, secret, codes := newMFAUser(t, now)
+	token, challenge, err := domain.NewMFAChallenge(user, opts.MFAChallengeTTL, now)
+	require.NoError(t, err)
+	code, err := totp.Code(secret, now)
+	require.NoError(t, err)
+
+	for name, code := range map[string]string{"totp code": code, "recovery code": codes[0]} {
+		t.Run(name, func(t *testing.T) {
+			repo := &loginRepository{}
+			repo.On("UpdateMFAChallenge", mock.Anything, challenge.Hash).Return(challenge, nil)
+			repo.On("GetUserByID", mock.Anything, user.ID).Return(user, nil)
+			// The used code is stored, so it can't be used again.
+			repo.On("StoreUser", mock.Anything, mock.MatchedBy(func(u domain.User) bool {
+				return u.VerifyMFACode(code, now) != nil
+			})).Return(nil)
+			repo.On("DeleteMFAChallenge", mock.Anything, challenge.Hash).Return(nil)
+			tokens := &tokenIssuer{}
+			session := expectSession(repo, tokens, user, opts.AccessTokenTTL)
+
+			events, err := commands.LoginMFA(repo, tokens, opts, clock)(context.Background(), commands.LoginMFACommand{
+				ChallengeToken: token,
+				Code:           code,
+			})
+			require.NoError(t, err)
+			require.Equal(t, []interface{}{
+				commands.UserLoggedInEvent{ID: user.ID, SessionID: session.ID, MFA: true, AccessToken: "access-token", ExpiresAt: now.Add(opts.AccessTokenTTL)},
+			}, events)
+			repo.AssertExpectations(t)
+		})
+	}
+
+	t.Run("wrong code", func(t *testing.T) {
+		repo := &loginRepository{}
+		repo.On("UpdateMFAChallenge", mock.Anything, challenge.Hash).Return(challenge, nil)
+		repo.On("GetUserByID", mock.Anything, user.ID).Return(user, nil)
+
+		_, err := commands.LoginMFA(repo, &tokenIssuer{}, opts, clock)(context.Background(), commands.LoginMFACommand{
+			ChallengeToken: token,
+			Code:           "000000",
+		})
+		require.ErrorIs(t, err, domain.ErrInvalidMFACode)
+		repo.AssertExpectations(t)
+		repo.AssertNotCalled(t, "DeleteMFAChallenge", mock.Anything, mock.Anything)
+	})
+
+	t.Run("too many attempts", func(t *testing.T) {
+		challenge := challenge
+		challenge.Attempts = domain.MaxMFAChallengeAttempts - 1
+		repo := &loginRepository{}
+		repo.On("UpdateMFAChallenge", mock.Anything, challenge.Hash).Return(challenge, nil)
+		repo.On("GetUserByID", mock.Anything, user.ID).Return(user, nil)
+		repo.On("DeleteMFAChallenge", mock.Anything, challenge.Hash).Return(nil)
+
+		_, err := commands.LoginMFA(repo, &tokenIssuer{}, opts, clock)(context.Background(), commands.LoginMFACommand{
+			ChallengeToken: token,
+			Code:           "000000",
+		})
+		require.ErrorIs(t, err, domain.ErrInvalidMFACode)
+		repo.AssertExpectations(t)
+	})
+
+	t.Run("no attempts left", func(t *testing.T) {
+		challenge := challenge
+		challenge.Attempts = domain.MaxMFAChallengeAttempts
+		repo := &loginRepository{}
+		repo.On("UpdateMFAChallenge", mock.Anything, challenge.Hash).Return(challenge, nil)
+
+		// Even the right code is rejected: the attempts are used up by the concurrent guesses.
+		_, err := commands.LoginMFA(repo, &tokenIssuer{}, opts, clock)(context.Background(), commands.LoginMFACommand{
+			ChallengeToken: token,
+			Code:           code,
+		})
+		require.ErrorIs(t, err, domain.ErrInvalidMFAChallenge)
+		repo.AssertNotCalled(t, "GetUserByID", mock.Anything, mock.Anything)
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		repo := &loginRepository{}
+		repo.On("UpdateMFAChallenge", mock.Anything, challenge.Hash).Return(challenge, nil)
+		repo.On("DeleteMFAChallenge", mock.Anything, challenge.Hash).Return(nil)
+
+		later := func() time.Time { return challenge.ExpiresAt }
+		_, err := commands.LoginMFA(repo, &tokenIssuer{}, opts, later)(context.Background(), commands.LoginMFACommand{
+			ChallengeToken: token,
+			Code:           code,
+		})
+		require.ErrorIs(t, err, domain.ErrMFAChallengeExpired)
+	})
+
+	t.Run("unknown challenge", func(t *testing.T) {
+		repo := &loginRepository{}
+		repo.On("UpdateMFAChallenge", mock.Anything, mock.Anything).Return(domain.MFAChallenge{}, domain.ErrInvalidMFAChallenge)
+
+		_, err := commands.LoginMFA(repo, &tokenIssuer{}, opts, clock)(context.Background(), commands.LoginMFACommand{
+			ChallengeToken: "unknown",
+			Code:           code,
+		})
+		require.ErrorIs(t, err, domain.ErrInvalidMFAChallenge)
+	})
+}
@@ -0,0 +1,174 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/dmitrymomot/go-smart-monolith/pkg/totp"
+)
+
+type (
+	// EnrollMFACommand represents the request body for EnrollMFA.
+	EnrollMFACommand struct {
+		UserID string `json:"user_id"`
+	}
+
+	// ConfirmMFACommand represents the request body for ConfirmMFA.
+	ConfirmMFACommand struct {
+		UserID string `json:"user_id"`
+		// Code is the TOTP code of the enrolled secret.
+		Code string `json:"code"`
+	}
+
+	// DisableMFACommand represents the request body for DisableMFA.
+	DisableMFACommand struct {
+		UserID string `json:"user_id"`
+		// Code is a TOTP code or a recovery code.
+		Code string `json:"code"`
+	}
+
+	// RegenerateRecoveryCodesCommand represents the request body for RegenerateRecoveryCodes.
+	RegenerateRecoveryCodesCommand struct {
+		UserID string `json:"user_id"`
+		// Code is a TOTP code.
+		Code string `json:"code"`
+	}
+
+	// MFAEnrollmentStartedEvent represents the event body for MFAEnrollmentStarted.
+	// The secret is returned to the caller, but never published.
+	MFAEnrollmentStartedEvent struct {
+		ID     string `json:"id"`
+		Secret string `json:"-"`
+		// URI is the otpauth:// URI of the secret to be shown as a QR code.
+		URI string `json:"-"`
+	}
+
+	// MFAEnabledEvent represents the event body for MFAEnabled.
+	// The recovery codes are returned to the caller, but never published.
+	MFAEnabledEvent struct {
+		ID            string   `json:"id"`
+		RecoveryCodes []string `json:"-"`
+	}
+
+	// MFADisabledEvent represents the event body for MFADisabled.
+	MFADisabledEvent struct {
+		ID string `json:"id"`
+	}
+
+	// RecoveryCodesRegeneratedEvent represents the event body for RecoveryCodesRegenerated.
+	// The recovery codes are returned to the caller, but never published.
+	RecoveryCodesRegeneratedEvent struct {
+		ID            string   `json:"id"`
+		RecoveryCodes []string `json:"-"`
+	}
+)
+
+// OwnerID returns the ID of the user the command is applied to.
+func (c EnrollMFACommand) OwnerID() string { return c.UserID }
+
+// OwnerID returns the ID of the user the command is applied to.
+func (c ConfirmMFACommand) OwnerID() string { return c.UserID }
+
+// OwnerID returns the ID of the user the command is applied to.
+func (c DisableMFACommand) OwnerID() string { return c.UserID }
+
+// OwnerID returns the ID of the user the command is applied to.
+func (c RegenerateRecoveryCodesCommand) OwnerID() string { return c.UserID }
+
+// EnrollMFA generates a new TOTP secret to be added to the authenticator app.
+// MFA is not enabled until the secret is confirmed, see ConfirmMFA.
+// The issuer is the name the authenticator app shows the secret under.
+func EnrollMFA(repo updateUserRepository, issuer string) func(ctx context.Context, cmd EnrollMFACommand) ([]interface{}, error) {
+	return func(ctx context.Context, cmd EnrollMFACommand) ([]interface{}, error) {
+		user, err := getActiveUser(ctx, repo, cmd.UserID, 0)
+		if err != nil {
+			return nil, err
+		}
+		secret, err := user.StartMFAEnrollment()
+		if err != nil {
+			return nil, err
+		}
+		if err := repo.StoreUser(ctx, user); err != nil {
+			return nil, fmt.Errorf("failed to enroll mfa: %w", err)
+		}
+
+		return []interface{}{
+			MFAEnrollmentStartedEvent{
+				ID:     user.ID,
+				Secret: secret,
+				URI:    totp.URI(issuer, user.Email, secret),
+			},
+		}, nil
+	}
+}
+
+// ConfirmMFA enables MFA if the code of the enrolled secret is valid.
+// The recovery codes are generated to login without the authenticator app.
+func ConfirmMFA(repo updateUserRepository, now func() time.Time) func(ctx context.Context, cmd ConfirmMFACommand) ([]interface{}, error) {
+	return func(ctx context.Context, cmd ConfirmMFACommand) ([]interface{}, error) {
+		user, err := getActiveUser(ctx, repo, cmd.UserID, 0)
+		if err != nil {
+			return nil, err
+		}
+		codes, err := user.ConfirmMFA(cmd.Code, now())
+		if err != nil {
+			return nil, err
+		}
+		if err := repo.StoreUser(ctx, user); err != nil {
+			return nil, fmt.Errorf("failed to confirm mfa: %w", err)
+		}
+
+		return []interface{}{
+			MFAEnabledEvent{
+				ID:            user.ID,
+				RecoveryCodes: codes,
+			},
+		}, nil
+	}
+}
+
+// DisableMFA disables MFA if the TOTP or recovery code is valid.
+func DisableMFA(repo updateUserRepository, now func() time.Time) func(ctx context.Context, cmd DisableMFACommand) ([]interface{}, error) {
+	return func(ctx context.Context, cmd DisableMFACommand) ([]interface{}, error) {
+		user, err := getActiveUser(ctx, repo, cmd.UserID, 0)
+		if err != nil {
+			return nil, err
+		}
+		if err := user.DisableMFA(cmd.Code, now()); err != nil {
+			return nil, err
+		}
+		if err := repo.StoreUser(ctx, user); err != nil {
+			return nil, fmt.Errorf("failed to disable mfa: %w", err)
+		}
+
+		return []interface{}{
+			MFADisabledEvent{ID: user.ID},
+		}, nil
+	}
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes if the TOTP code is valid.
+// The previous recovery codes can't be used anymore.
+func RegenerateRecoveryCodes(repo updateUserRepository, now func() time.Time) func(ctx context.Context, cmd RegenerateRecoveryCodesCommand) ([]interface{}, error) {
+	return func(ctx context.Context, cmd RegenerateRecoveryCodesCommand) ([]interface{}, error) {
+		user, err := getActiveUser(ctx, repo, cmd.UserID, 0)
+		if err != nil {
+			return nil, err
+		}
+		codes, err := user.RegenerateRecoveryCodes(cmd.Code, now())
+		if err != nil {
+			return nil, err
+		}
+		if err := repo.StoreUser(ctx, user); err != nil {
+			return nil, fmt.Errorf("failed to regenerate recovery codes: %w", err)
+		}
+
+		return []interface{}{
+			RecoveryCodesRegeneratedEvent{
+				ID:            user.ID,
+				RecoveryCodes: codes,
+			},
+		}, nil
+	}
+}
@@ -0,0 +1,180 @@
+package commands_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dmitrymomot/go-smart-monolith/internal/user/app/commands"
+	"github.com/dmitrymomot/go-smart-monolith/internal/user/domain"
+	"github.com/dmitrymomot/go-smart-monolith/pkg/totp"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// newMFAUser returns the user with MFA enabled, its TOTP secret and recovery codes.
+func newMFAUser(t *testing.T, now time.Time) (domain.User, string, []string) {
+	t.Helper()
+	user := newUser(t, "password")
+	secret, err := user.StartMFAEnrollment()
+	require.NoError(t, err)
+	// The code of the previous step, so the current one can be used in the test.
+	code, err := totp.Code(secret, now.Add(-totp.Period))
+	require.NoError(t, err)
+	codes, err := user.ConfirmMFA(code, now)
+	require.NoError(t, err)
+	return user, secret, codes
+}
+
+func TestEnrollAndConfirmMFA(t *testing.T) {
+	now := time.Date(2023, 1, 1, 12, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+	user := newUser(t, "password")
+
+	// Enroll: the pending secret is stored, MFA is not enabled yet.
+	repo := &updateUserRepository{}
+	repo.On("GetUserByID", mock.Anything, user.ID).Return(user, nil).Once()
+	repo.On("StoreUser", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		user = args.Get(1).(domain.User)
+	}).Return(nil).Once()
+
+	events, err := commands.EnrollMFA(repo, "app")(context.Background(), commands.EnrollMFACommand{UserID: user.ID})
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	started := events[0].(commands.MFAEnrollmentStartedEvent)
+	require.Equal(t, user.MFA.PendingTOTPSecret, started.Secret)
+	require.Contains(t, started.URI, "otpauth://totp/")
+	require.False(t, user.MFA.Enabled)
+
+	t.Run("wrong code", func(t *testing.T) {
+		repo := &updateUserRepository{}
+		repo.On("GetUserByID", mock.Anything, user.ID).Return(user, nil)
+
+		_, err := commands.ConfirmMFA(repo, clock)(context.Background(), commands.ConfirmMFACommand{
+			UserID: user.ID,
+			Code:   "000000",
+		})
+		require.ErrorIs(t, err, domain.ErrInvalidMFACode)
+		repo.AssertNotCalled(t, "StoreUser", mock.Anything, mock.Anything)
+	})
+
+	t.Run("not enrolled", func(t *testing.T) {
+		repo := &updateUserRepository{}
+		repo.On("GetUserByID", mock.Anything, user.ID).Return(newUser(t, "password"), nil)
+
+		_, err := commands.ConfirmMFA(repo, clock)(context.Background(), commands.ConfirmMFACommand{UserID: user.ID})
+		require.ErrorIs(t, err, domain.ErrMFANotEnrolled)
+	})
+
+	// Confirm: MFA is enabled, only the hashes of the recovery codes are stored.
+	code, err := totp.Code(started.Secret, now)
+	require.NoError(t, err)
+	repo.On("GetUserByID", mock.Anything, user.ID).Return(user, nil).Once()
+	repo.On("StoreUser", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		user = args.Get(1).(domain.User)
+	}).Return(nil).Once()
+
+	events, err = commands.ConfirmMFA(repo, clock)(context.Background(), commands.ConfirmMFACommand{
+		UserID: user.ID,
+		Code:   code,
+	})
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	enabled := events[0].(commands.MFAEnabledEvent)
+	require.Len(t, enabled.RecoveryCodes, domain.RecoveryCodesCount)
+	require.True(t, user.MFA.Enabled)
+	require.Empty(t, user.MFA.PendingTOTPSecret)
+	require.NotContains(t, user.MFA.RecoveryCodes, enabled.RecoveryCodes[0])
+
+	t.Run("already enabled", func(t *testing.T) {
+		repo := &updateUserRepository{}
+		repo.On("GetUserByID", mock.Anything, user.ID).Return(user, nil)
+
+		_, err := commands.EnrollMFA(repo, "app")(context.Background(), commands.EnrollMFACommand{UserID: user.ID})
+		require.ErrorIs(t, err, domain.ErrMFAAlreadyEnabled)
+	})
+}
+
+func TestDisableMFA(t *testing.T) {
+	now := time.Date(2023, 1, 1, 12, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+	user, secret, codes := newMFAUser(t, now)
+
+	t.Run("recovery code", func(t *testing.T) {
+		repo := &updateUserRepository{}
+		repo.On("GetUserByID", mock.Anything, user.ID).Return(user, nil)
+		repo.On("StoreUser", mock.Anything, mock.MatchedBy(func(u domain.User) bool {
+			return !u.MFA.Enabled && u.MFA.TOTPSecret == "" && len(u.MFA.RecoveryCodes) == 0
+		})).Return(nil)
+
+		events, err := commands.DisableMFA(repo, clock)(context.Background(), commands.DisableMFACommand{
+			UserID: user.ID,
+			Code:   codes[0],
+		})
+		require.NoError(t, err)
+		require.Equal(t, []interface{}{commands.MFADisabledEvent{ID: user.ID}}, events)
+		repo.AssertExpectations(t)
+	})
+
+	t.Run("replayed totp code", func(t *testing.T) {
+		code, err := totp.Code(secret, now.Add(-totp.Period))
+		require.NoError(t, err)
+		repo := &updateUserRepository{}
+		repo.On("GetUserByID", mock.Anything, user.ID).Return(user, nil)
+
+		_, err = commands.DisableMFA(repo, clock)(context.Background(), commands.DisableMFACommand{
+			UserID: user.ID,
+			Code:   code,
+		})
+		require.ErrorIs(t, err, domain.ErrInvalidMFACode)
+	})
+
+	t.Run("not enabled", func(t *testing.T) {
+		repo := &updateUserRepository{}
+		repo.On("GetUserByID", mock.Anything, user.ID).Return(newUser(t, "password"), nil)
+
+		_, err := commands.DisableMFA(repo, clock)(context.Background(), commands.DisableMFACommand{UserID: user.ID})
+		require.ErrorIs(t, err, domain.ErrMFANotEnabled)
+	})
+}
+
+func TestRegenerateRecoveryCodes(t *testing.T) {
+	now := time.Date(2023, 1, 1, 12, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+	user, secret, codes := newMFAUser(t, now)
+
+	t.Run("recovery code is not accepted", func(t *testing.T) {
+		repo := &updateUserRepository{}
+		repo.On("GetUserByID", mock.Anything, user.ID).Return(user, nil)
+
+		_, err := commands.RegenerateRecoveryCodes(repo, clock)(context.Background(), commands.RegenerateRecoveryCodesCommand{
+			UserID: user.ID,
+			Code:   codes[0],
+		})
+		require.ErrorIs(t, err, domain.ErrInvalidMFACode)
+	})
+
+	code, err := totp.Code(secret, now)
+	require.NoError(t, err)
+	var stored domain.User
+	repo := &updateUserRepository{}
+	repo.On("GetUserByID", mock.Anything, user.ID).Return(user, nil)
+	repo.On("StoreUser", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		stored = args.Get(1).(domain.User)
+	}).Return(nil)
+
+	events, err := commands.RegenerateRecoveryCodes(repo, clock)(context.Background(), commands.RegenerateRecoveryCodesCommand{
+		UserID: user.ID,
+		Code:   code,
+	})
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	regenerated := events[0].(commands.RecoveryCodesRegeneratedEvent)
+	require.Len(t, regenerated.RecoveryCodes, domain.RecoveryCodesCount)
+
+	// The previous codes can't be used anymore, the new ones can.
+	require.ErrorIs(t, stored.VerifyMFACode(codes[0], now), domain.ErrInvalidMFACode)
+	require.NoError(t, stored.VerifyMFACode(regenerated.RecoveryCodes[0], now))
+	require.ErrorIs(t, stored.VerifyMFACode(regenerated.RecoveryCodes[0], now), domain.ErrInvalidMFACode, "the recovery code is single-use")
+}
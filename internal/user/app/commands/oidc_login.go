@@ -0,0 +1,184 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/dmitrymomot/go-smart-monolith/internal/user/domain"
+	"github.com/dmitrymomot/go-smart-monolith/pkg/oidc"
+)
+
+type (
+	// StartOIDCLoginCommand represents the request for StartOIDCLogin.
+	StartOIDCLoginCommand struct {
+		Provider string `json:"provider"`
+	}
+
+	// CompleteOIDCLoginCommand represents the provider callback for CompleteOIDCLogin.
+	CompleteOIDCLoginCommand struct {
+		Provider string `json:"provider"`
+		State    string `json:"state"`
+		Code     string `json:"code"`
+		// Client is the client the user logs in from, it's recorded in the session.
+		Client domain.SessionClient `json:"-"`
+	}
+
+	// OIDCLoginStartedEvent represents the event body for OIDCLoginStarted.
+	// The user is redirected to the provider authorization URL, the state comes back with the callback.
+	// They are returned to the caller, but never published.
+	OIDCLoginStartedEvent struct {
+		Provider  string    `json:"provider"`
+		AuthURL   string    `json:"-"`
+		State     string    `json:"-"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+
+	// OIDCOptions defines the OIDC login.
+	OIDCOptions struct {
+		// StateTTL is how long the user has to authorize at the provider.
+		StateTTL time.Duration
+	}
+
+	// IdentityProviders are the OpenID Connect providers the users can log in with, by their names.
+	IdentityProviders map[string]identityProvider
+
+	// identityProvider is the OpenID Connect provider client, see pkg/oidc.
+	identityProvider interface {
+		AuthCodeURL(ctx context.Context, state, nonce, codeVerifier string) (string, error)
+		Authenticate(ctx context.Context, code, codeVerifier, nonce string) (oidc.IDToken, error)
+	}
+
+	// oidcLoginRepository represents the repository interface for the OIDC login commands.
+	oidcLoginRepository interface {
+		loginRepository
+		GetUserByIdentity(ctx context.Context, provider, subject string) (domain.User, error)
+		StoreOIDCLoginState(ctx context.Context, state domain.OIDCLoginState) error
+		TakeOIDCLoginState(ctx context.Context, hash string) (domain.OIDCLoginState, error)
+	}
+)
+
+// StartOIDCLogin starts the login at the identity provider: the authorization code flow with PKCE.
+// The state, the nonce and the code verifier are kept until the callback, see CompleteOIDCLogin.
+func StartOIDCLogin(repo oidcLoginRepository, providers IdentityProviders, opts OIDCOptions, now func() time.Time) func(ctx context.Context, cmd StartOIDCLoginCommand) ([]interface{}, error) {
+	return func(ctx context.Context, cmd StartOIDCLoginCommand) ([]interface{}, error) {
+		provider, ok := providers[cmd.Provider]
+		if !ok {
+			return nil, domain.ErrUnknownIdentityProvider
+		}
+
+		state, login, err := domain.NewOIDCLoginState(cmd.Provider, opts.StateTTL, now())
+		if err != nil {
+			return nil, fmt.Errorf("failed to start oidc login: %w", err)
+		}
+		authURL, err := provider.AuthCodeURL(ctx, state, login.Nonce, login.CodeVerifier)
+		if err != nil {
+			return nil, fmt.Errorf("failed to start oidc login: %w", err)
+		}
+		if err := repo.StoreOIDCLoginState(ctx, login); err != nil {
+			return nil, fmt.Errorf("failed to store oidc login state: %w", err)
+		}
+
+		return []interface{}{
+			OIDCLoginStartedEvent{
+				Provider:  cmd.Provider,
+				AuthURL:   authURL,
+				State:     state,
+				ExpiresAt: login.ExpiresAt,
+			},
+		}, nil
+	}
+}
+
+// CompleteOIDCLogin exchanges the authorization code for the verified identity and logs the user in,
+// the same as Login: the MFA challenge is issued if the user has MFA enabled.
+//
+// The user is found by the linked identity. On the first login the user is created by createUser,
+// if the provider has verified the email. The existing user with the same email is not linked
+// automatically: the provider doesn't prove the user owns the account here.
+// The provider proves the email it has verified though, so the user with an admin email
+// is granted the admin role, see AdminEmails.
+func CompleteOIDCLogin(
+	repo oidcLoginRepository,
+	providers IdentityProviders,
+	createUser func(ctx context.Context, cmd CreateUserCommand) ([]interface{}, error),
+	tokens tokenIssuer,
+	opts LoginOptions,
+	admins AdminEmails,
+	now func() time.Time,
+) func(ctx context.Context, cmd CompleteOIDCLoginCommand) ([]interface{}, error) {
+	return func(ctx context.Context, cmd CompleteOIDCLoginCommand) ([]interface{}, error) {
+		provider, ok := providers[cmd.Provider]
+		if !ok {
+			return nil, domain.ErrUnknownIdentityProvider
+		}
+
+		// The state is single-use, it's taken before the code is exchanged,
+		// so the concurrent callbacks with the same state can't both complete the login.
+		login, err := repo.TakeOIDCLoginState(ctx, domain.HashOIDCState(cmd.State))
+		if err != nil {
+			return nil, err
+		}
+		if login.Provider != cmd.Provider {
+			return nil, domain.ErrInvalidOIDCState
+		}
+		if login.IsExpired(now()) {
+			return nil, domain.ErrOIDCStateExpired
+		}
+
+		id, err := provider.Authenticate(ctx, cmd.Code, login.CodeVerifier, login.Nonce)
+		if err != nil {
+			return nil, fmt.Errorf("failed to authenticate at %s: %w", cmd.Provider, err)
+		}
+
+		user, err := repo.GetUserByIdentity(ctx, cmd.Provider, id.Subject)
+		if errors.Is(err, domain.ErrUserNotFound) {
+			user, err = signUp(ctx, repo, createUser, cmd.Provider, id)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if user.IsDeleted() {
+			return nil, domain.ErrInvalidCredentials
+		}
+
+		var granted []interface{}
+		if id.EmailVerified && domain.NormalizeEmail(id.Email) == user.Email {
+			if granted = admins.grantAdmin(&user); len(granted) > 0 {
+				if err := repo.StoreUser(ctx, user); err != nil {
+					return nil, fmt.Errorf("failed to grant admin role: %w", err)
+				}
+			}
+		}
+
+		e, err := completeLogin(ctx, repo, tokens, opts, user, cmd.Client, now())
+		if err != nil {
+			return nil, err
+		}
+		return append(granted, e...), nil
+	}
+}
+
+// signUp creates the user of the identity on the first login.
+// The UserCreatedEvent is sent by createUser, so it's not returned again.
+func signUp(
+	ctx context.Context,
+	repo oidcLoginRepository,
+	createUser func(ctx context.Context, cmd CreateUserCommand) ([]interface{}, error),
+	provider string,
+	id oidc.IDToken,
+) (domain.User, error) {
+	if id.Email == "" || !id.EmailVerified {
+		return domain.User{}, domain.ErrIdentityEmailNotVerified
+	}
+
+	_, err := createUser(ctx, CreateUserCommand{
+		Email:    id.Email,
+		Identity: &domain.Identity{Provider: provider, Subject: id.Subject},
+	})
+	if err != nil {
+		return domain.User{}, err
+	}
+	return repo.GetUserByIdentity(ctx, provider, id.Subject)
+}
@@ -0,0 +1,245 @@
+package commands_test
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/dmitrymomot/go-smart-monolith/internal/user/app/commands"
+	"github.com/dmitrymomot/go-smart-monolith/internal/user/domain"
+	"github.com/dmitrymomot/go-smart-monolith/pkg/oidc"
+	"github.com/dmitrymomot/go-smart-monolith/pkg/oidc/oidctest"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// oidcLoginRepository is a mock implementation of the oidcLoginRepository interface.
+type oidcLoginRepository struct {
+	loginRepository
+}
+
+// GetUserByIdentity is a mock implementation of the GetUserByIdentity method.
+func (m *oidcLoginRepository) GetUserByIdentity(ctx context.Context, provider, subject string) (domain.User, error) {
+	args := m.Called(ctx, provider, subject)
+	return args.Get(0).(domain.User), args.Error(1)
+}
+
+// StoreOIDCLoginState is a mock implementation of the StoreOIDCLoginState method.
+func (m *oidcLoginRepository) StoreOIDCLoginState(ctx context.Context, state domain.OIDCLoginState) error {
+	args := m.Called(ctx, state)
+	return args.Error(0)
+}
+
+// TakeOIDCLoginState is a mock implementation of the TakeOIDCLoginState method.
+func (m *oidcLoginRepository) TakeOIDCLoginState(ctx context.Context, hash string) (domain.OIDCLoginState, error) {
+	args := m.Called(ctx, hash)
+	return args.Get(0).(domain.OIDCLoginState), args.Error(1)
+}
+
+func TestOIDCLogin(t *testing.T) {
+	now := time.Date(2023, 1, 1, 12, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+	loginOpts := commands.LoginOptions{AccessTokenTTL: time.Hour, MFAChallengeTTL: 5 * time.Minute}
+	oidcOpts := commands.OIDCOptions{StateTTL: 10 * time.Minute}
+
+	idp := oidctest.NewProvider(t)
+	providers := commands.IdentityProviders{
+		"test": oidc.NewProvider(idp.Config("http://localhost:8080/users/oidc/test/callback"), nil),
+	}
+	identity := oidctest.Identity{Subject: "subject-1", Email: "test@mail.dev", EmailVerified: true}
+
+	// start starts the login and authorizes it at the provider as the identity.
+	// It returns the stored login state and the callback command.
+	start := func(t *testing.T, identity oidctest.Identity) (domain.OIDCLoginState, commands.CompleteOIDCLoginCommand) {
+		t.Helper()
+		var login domain.OIDCLoginState
+		repo := &oidcLoginRepository{}
+		repo.On("StoreOIDCLoginState", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+			login = args.Get(1).(domain.OIDCLoginState)
+		}).Return(nil)
+
+		events, err := commands.StartOIDCLogin(repo, providers, oidcOpts, clock)(context.Background(), commands.StartOIDCLoginCommand{Provider: "test"})
+		require.NoError(t, err)
+		require.Len(t, events, 1)
+		started := events[0].(commands.OIDCLoginStartedEvent)
+		require.Equal(t, now.Add(oidcOpts.StateTTL), started.ExpiresAt)
+		// Only the state hash is stored.
+		require.Equal(t, domain.HashOIDCState(started.State), login.Hash)
+
+		idp.SignIn(identity)
+		return login, authorizeAt(t, started.AuthURL)
+	}
+
+	t.Run("first login creates the user", func(t *testing.T) {
+		login, cmd := start(t, identity)
+		user := domain.NewUser(identity.Email, "")
+		user.LinkIdentity("test", identity.Subject, now)
+
+		repo := &oidcLoginRepository{}
+		repo.On("TakeOIDCLoginState", mock.Anything, login.Hash).Return(login, nil)
+		repo.On("GetUserByIdentity", mock.Anything, "test", identity.Subject).Return(domain.User{}, domain.ErrUserNotFound).Once()
+		repo.On("GetUserByIdentity", mock.Anything, "test", identity.Subject).Return(user, nil).Once()
+		tokens := &tokenIssuer{}
+		session := expectSession(&repo.loginRepository, tokens, user, loginOpts.AccessTokenTTL)
+
+		var created commands.CreateUserCommand
+		createUser := func(ctx context.Context, cmd commands.CreateUserCommand) ([]interface{}, error) {
+			created = cmd
+			return nil, nil
+		}
+
+		events, err := commands.CompleteOIDCLogin(repo, providers, createUser, tokens, loginOpts, nil, clock)(context.Background(), cmd)
+		require.NoError(t, err)
+		require.Equal(t, []interface{}{
+			commands.UserLoggedInEvent{ID: user.ID, SessionID: session.ID, AccessToken: "access-token", ExpiresAt: now.Add(loginOpts.AccessTokenTTL)},
+		}, events)
+		require.Equal(t, commands.CreateUserCommand{
+			Email:    identity.Email,
+			Identity: &domain.Identity{Provider: "test", Subject: identity.Subject},
+		}, created)
+		repo.AssertExpectations(t)
+	})
+
+	t.Run("linked user with mfa", func(t *testing.T) {
+		login, cmd := start(t, identity)
+		user, _, _ := newMFAUser(t, now)
+		user.LinkIdentity("test", identity.Subject, now)
+
+		repo := &oidcLoginRepository{}
+		repo.On("TakeOIDCLoginState", mock.Anything, login.Hash).Return(login, nil)
+		repo.On("GetUserByIdentity", mock.Anything, "test", identity.Subject).Return(user, nil)
+		repo.On("StoreMFAChallenge", mock.Anything, mock.Anything).Return(nil)
+
+		events, err := commands.CompleteOIDCLogin(repo, providers, nil, &tokenIssuer{}, loginOpts, nil, clock)(context.Background(), cmd)
+		require.NoError(t, err)
+		require.Len(t, events, 1)
+		require.IsType(t, commands.MFAChallengeIssuedEvent{}, events[0], "the provider is not the second factor")
+	})
+
+	t.Run("admin email", func(t *testing.T) {
+		login, cmd := start(t, identity)
+		user := domain.NewUser(identity.Email, "")
+		user.LinkIdentity("test", identity.Subject, now)
+
+		repo := &oidcLoginRepository{}
+		repo.On("TakeOIDCLoginState", mock.Anything, login.Hash).Return(login, nil)
+		repo.On("GetUserByIdentity", mock.Anything, "test", identity.Subject).Return(user, nil)
+		repo.On("StoreUser", mock.Anything, mock.MatchedBy(func(u domain.User) bool {
+			return u.HasRole(domain.RoleAdmin)
+		})).Return(nil)
+		tokens := &tokenIssuer{}
+		expectSession(&repo.loginRepository, tokens, user, loginOpts.AccessTokenTTL)
+
+		// The provider has verified the admin email.
+		admins := commands.AdminEmails{identity.Email}
+		events, err := commands.CompleteOIDCLogin(repo, providers, nil, tokens, loginOpts, admins, clock)(context.Background(), cmd)
+		require.NoError(t, err)
+		require.Len(t, events, 2)
+		require.Equal(t, commands.UserRoleGrantedEvent{ID: user.ID, Role: domain.RoleAdmin}, events[0])
+		repo.AssertExpectations(t)
+	})
+
+	t.Run("unverified email", func(t *testing.T) {
+		unverified := identity
+		unverified.EmailVerified = false
+		login, cmd := start(t, unverified)
+
+		repo := &oidcLoginRepository{}
+		repo.On("TakeOIDCLoginState", mock.Anything, login.Hash).Return(login, nil)
+		repo.On("GetUserByIdentity", mock.Anything, "test", identity.Subject).Return(domain.User{}, domain.ErrUserNotFound)
+
+		_, err := commands.CompleteOIDCLogin(repo, providers, nil, &tokenIssuer{}, loginOpts, nil, clock)(context.Background(), cmd)
+		require.ErrorIs(t, err, domain.ErrIdentityEmailNotVerified)
+	})
+
+	t.Run("email of another user", func(t *testing.T) {
+		login, cmd := start(t, identity)
+
+		repo := &oidcLoginRepository{}
+		repo.On("TakeOIDCLoginState", mock.Anything, login.Hash).Return(login, nil)
+		repo.On("GetUserByIdentity", mock.Anything, "test", identity.Subject).Return(domain.User{}, domain.ErrUserNotFound)
+		createUser := func(ctx context.Context, cmd commands.CreateUserCommand) ([]interface{}, error) {
+			return nil, commands.ErrUserAlreadyExists
+		}
+
+		_, err := commands.CompleteOIDCLogin(repo, providers, createUser, &tokenIssuer{}, loginOpts, nil, clock)(context.Background(), cmd)
+		require.ErrorIs(t, err, commands.ErrUserAlreadyExists, "the account is not linked automatically")
+	})
+
+	t.Run("invalid state", func(t *testing.T) {
+		login, cmd := start(t, identity)
+		expired := login
+		expired.ExpiresAt = now
+
+		tests := map[string]struct {
+			login domain.OIDCLoginState
+			err   error
+			cmd   func(cmd commands.CompleteOIDCLoginCommand) commands.CompleteOIDCLoginCommand
+		}{
+			"used": {
+				err: domain.ErrInvalidOIDCState,
+			},
+			"expired": {
+				login: expired,
+				err:   domain.ErrOIDCStateExpired,
+			},
+			"another provider": {
+				login: domain.OIDCLoginState{Hash: login.Hash, Provider: "other", ExpiresAt: login.ExpiresAt},
+				err:   domain.ErrInvalidOIDCState,
+			},
+			"unknown provider": {
+				err: domain.ErrUnknownIdentityProvider,
+				cmd: func(cmd commands.CompleteOIDCLoginCommand) commands.CompleteOIDCLoginCommand {
+					cmd.Provider = "unknown"
+					return cmd
+				},
+			},
+		}
+		for name, tt := range tests {
+			t.Run(name, func(t *testing.T) {
+				repo := &oidcLoginRepository{}
+				if tt.login.Hash == "" {
+					repo.On("TakeOIDCLoginState", mock.Anything, login.Hash).Return(domain.OIDCLoginState{}, domain.ErrInvalidOIDCState)
+				} else {
+					repo.On("TakeOIDCLoginState", mock.Anything, login.Hash).Return(tt.login, nil)
+				}
+				cmd := cmd
+				if tt.cmd != nil {
+					cmd = tt.cmd(cmd)
+				}
+
+				_, err := commands.CompleteOIDCLogin(repo, providers, nil, &tokenIssuer{}, loginOpts, nil, clock)(context.Background(), cmd)
+				require.ErrorIs(t, err, tt.err)
+			})
+		}
+	})
+
+	t.Run("unknown provider", func(t *testing.T) {
+		_, err := commands.StartOIDCLogin(&oidcLoginRepository{}, providers, oidcOpts, clock)(context.Background(), commands.StartOIDCLoginCommand{Provider: "unknown"})
+		require.ErrorIs(t, err, domain.ErrUnknownIdentityProvider)
+	})
+}
+
+// authorizeAt follows the authorization URL as the user would,
+// and returns the callback the provider redirects back with.
+func authorizeAt(t *testing.T, authURL string) commands.CompleteOIDCLoginCommand {
+	t.Helper()
+	client := &http.Client{
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+	resp, err := client.Get(authURL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusFound, resp.StatusCode)
+
+	callback, err := url.Parse(resp.Header.Get("Location"))
+	require.NoError(t, err)
+	return commands.CompleteOIDCLoginCommand{
+		Provider: "test",
+		State:    callback.Query().Get("state"),
+		Code:     callback.Query().Get("code"),
+	}
+}
@@ -0,0 +1,154 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/dmitrymomot/go-smart-monolith/internal/user/domain"
+	"github.com/dmitrymomot/go-smart-monolith/pkg/mailer"
+)
+
+type (
+	// RequestPasswordResetCommand represents the request body for RequestPasswordReset.
+	RequestPasswordResetCommand struct {
+		Email string `json:"email"`
+	}
+
+	// ResetPasswordCommand represents the request body for ResetPassword.
+	ResetPasswordCommand struct {
+		Token       string `json:"token"`
+		NewPassword string `json:"new_password"`
+	}
+
+	// PasswordResetRequestedEvent represents the event body for PasswordResetRequested.
+	// Note: it never contains the token.
+	PasswordResetRequestedEvent struct {
+		ID        string    `json:"id"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+
+	// PasswordResetEvent represents the event body for PasswordReset.
+	// All the user sessions started before the reset are revoked.
+	PasswordResetEvent struct {
+		ID string `json:"id"`
+	}
+
+	// PasswordResetOptions defines the password reset emails.
+	PasswordResetOptions struct {
+		// TTL is how long the password reset link is valid.
+		TTL time.Duration
+		// URL is the page the password reset link leads to, the token is added as the "token" query parameter.
+		// The page is expected to call POST /users/password/reset with the token and the new password.
+		URL string
+		// From is the sender of the password reset emails.
+		From string
+	}
+
+	// passwordResetRepository represents the repository interface for the password reset commands.
+	passwordResetRepository interface {
+		updateUserRepository
+		GetUserByEmail(ctx context.Context, email string) (domain.User, error)
+		StorePasswordResetToken(ctx context.Context, token domain.PasswordResetToken) error
+		TakePasswordResetToken(ctx context.Context, hash string) (domain.PasswordResetToken, error)
+		DeleteSessions(ctx context.Context, userID string) error
+	}
+)
+
+// RequestPasswordReset issues a password reset token and queues the email with the reset link.
+// It succeeds even if there is no user with the email or the email is invalid,
+// so the callers can't find out which emails exist.
+func RequestPasswordReset(repo passwordResetRepository, mails mailQueue, opts PasswordResetOptions, now func() time.Time) func(ctx context.Context, cmd RequestPasswordResetCommand) ([]interface{}, error) {
+	return func(ctx context.Context, cmd RequestPasswordResetCommand) ([]interface{}, error) {
+		email := domain.NormalizeEmail(cmd.Email)
+		if err := domain.ValidateEmail(email); err != nil {
+			return nil, nil
+		}
+
+		user, err := repo.GetUserByEmail(ctx, email)
+		if err != nil {
+			if errors.Is(err, domain.ErrUserNotFound) {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("failed to request password reset: %w", err)
+		}
+		if user.IsDeleted() {
+			return nil, nil
+		}
+
+		token, record, err := domain.NewPasswordResetToken(user, opts.TTL, now())
+		if err != nil {
+			return nil, fmt.Errorf("failed to issue password reset token: %w", err)
+		}
+		if err := repo.StorePasswordResetToken(ctx, record); err != nil {
+			return nil, fmt.Errorf("failed to store password reset token: %w", err)
+		}
+
+		link, err := tokenLink(opts.URL, token)
+		if err != nil {
+			return nil, err
+		}
+		if err := mails.QueueEmail(ctx, mailer.Message{
+			From:    opts.From,
+			To:      []string{user.Email},
+			Subject: "Reset your password",
+			Body: fmt.Sprintf("Reset your password by following the link:\n\n%s\n\nThe link expires at %s. "+
+				"If you didn't request the password reset, ignore this email.\n",
+				link, record.ExpiresAt.Format(time.RFC1123)),
+		}); err != nil {
+			return nil, fmt.Errorf("failed to queue password reset email: %w", err)
+		}
+
+		return []interface{}{
+			PasswordResetRequestedEvent{
+				ID:        user.ID,
+				ExpiresAt: record.ExpiresAt,
+			},
+		}, nil
+	}
+}
+
+// ResetPassword sets the new password by the token sent to the user email.
+// The token can be used only once. All the user sessions are revoked,
+// so whoever knew the old password is signed out.
+func ResetPassword(repo passwordResetRepository, now func() time.Time) func(ctx context.Context, cmd ResetPasswordCommand) ([]interface{}, error) {
+	return func(ctx context.Context, cmd ResetPasswordCommand) ([]interface{}, error) {
+		if err := domain.ValidatePassword(cmd.NewPassword); err != nil {
+			return nil, err
+		}
+
+		// The token is taken before the password is changed, so it can't be used twice,
+		// even concurrently or if the password change fails and the user has to request a new one.
+		token, err := repo.TakePasswordResetToken(ctx, domain.HashPasswordResetToken(cmd.Token))
+		if err != nil {
+			return nil, err
+		}
+		if token.IsExpired(now()) {
+			return nil, domain.ErrPasswordResetTokenExpired
+		}
+
+		user, err := getActiveUser(ctx, repo, token.UserID, 0)
+		if err != nil {
+			return nil, err
+		}
+		passwordHash, err := domain.HashPassword(cmd.NewPassword)
+		if err != nil {
+			return nil, fmt.Errorf("failed to reset password: %w", err)
+		}
+		user.PasswordHash = passwordHash
+		user.RevokeSessions(now())
+		if err := repo.StoreUser(ctx, user); err != nil {
+			return nil, fmt.Errorf("failed to reset password: %w", err)
+		}
+		// The sessions started within the second of the revocation are not revoked by it,
+		// see domain.User.IsSessionRevoked, so they are deleted too.
+		if err := repo.DeleteSessions(ctx, user.ID); err != nil {
+			return nil, fmt.Errorf("failed to delete sessions: %w", err)
+		}
+
+		return []interface{}{
+			PasswordResetEvent{ID: user.ID},
+		}, nil
+	}
+}
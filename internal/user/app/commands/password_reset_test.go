@@ -0,0 +1,182 @@
+package commands_test
+
+import (
+	"context"
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/dmitrymomot/go-smart-monolith/internal/user/app/commands"
+	"github.com/dmitrymomot/go-smart-monolith/internal/user/domain"
+	"github.com/dmitrymomot/go-smart-monolith/pkg/mailer"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// passwordResetRepository is a mock implementation of the passwordResetRepository interface.
+type passwordResetRepository struct {
+	updateUserRepository
+}
+
+// StorePasswordResetToken is a mock implementation of the StorePasswordResetToken method.
+func (m *passwordResetRepository) StorePasswordResetToken(ctx context.Context, token domain.PasswordResetToken) error {
+	args := m.Called(ctx, token)
+	return args.Error(0)
+}
+
+// TakePasswordResetToken is a mock implementation of the TakePasswordResetToken method.
+func (m *passwordResetRepository) TakePasswordResetToken(ctx context.Context, hash string) (domain.PasswordResetToken, error) {
+	args := m.Called(ctx, hash)
+	return args.Get(0).(domain.PasswordResetToken), args.Error(1)
+}
+
+// DeleteSessions is a mock implementation of the DeleteSessions method.
+func (m *passwordResetRepository) DeleteSessions(ctx context.Context, userID string) error {
+	args := m.Called(ctx, userID)
+	return args.Error(0)
+}
+
+func TestRequestPasswordReset(t *testing.T) {
+	now := time.Date(2023, 1, 1, 12, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+	opts := commands.PasswordResetOptions{
+		TTL:  15 * time.Minute,
+		URL:  "https://app.dev/reset-password",
+		From: "no-reply@app.dev",
+	}
+	user := domain.NewUser("test@mail.dev", "")
+
+	t.Run("existing user", func(t *testing.T) {
+		var stored domain.PasswordResetToken
+		repo := &passwordResetRepository{}
+		repo.On("GetUserByEmail", mock.Anything, user.Email).Return(user, nil)
+		repo.On("StorePasswordResetToken", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+			stored = args.Get(1).(domain.PasswordResetToken)
+		}).Return(nil)
+
+		var sent mailer.Message
+		mails := &mailQueue{}
+		mails.On("QueueEmail", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+			sent = args.Get(1).(mailer.Message)
+		}).Return(nil)
+
+		events, err := commands.RequestPasswordReset(repo, mails, opts, clock)(context.Background(), commands.RequestPasswordResetCommand{
+			Email: user.Email,
+		})
+		require.NoError(t, err)
+		require.Equal(t, []interface{}{
+			commands.PasswordResetRequestedEvent{ID: user.ID, ExpiresAt: now.Add(opts.TTL)},
+		}, events)
+
+		// The email has the link with the token, only its hash is stored.
+		require.Equal(t, []string{user.Email}, sent.To)
+		link, err := url.Parse(regexp.MustCompile(`https://\S+`).FindString(sent.Body))
+		require.NoError(t, err)
+		token := link.Query().Get("token")
+		require.Equal(t, domain.PasswordResetToken{
+			Hash:      domain.HashPasswordResetToken(token),
+			UserID:    user.ID,
+			ExpiresAt: now.Add(opts.TTL),
+		}, stored)
+	})
+
+	t.Run("unknown email", func(t *testing.T) {
+		repo := &passwordResetRepository{}
+		repo.On("GetUserByEmail", mock.Anything, "unknown@mail.dev").Return(domain.User{}, domain.ErrUserNotFound)
+		mails := &mailQueue{}
+
+		// The result is the same as for the existing user, but nothing is sent.
+		_, err := commands.RequestPasswordReset(repo, mails, opts, clock)(context.Background(), commands.RequestPasswordResetCommand{
+			Email: "unknown@mail.dev",
+		})
+		require.NoError(t, err)
+		mails.AssertNotCalled(t, "QueueEmail", mock.Anything, mock.Anything)
+	})
+
+	t.Run("invalid email", func(t *testing.T) {
+		repo := &passwordResetRepository{}
+		mails := &mailQueue{}
+
+		// The same result as for the unknown email, the repository is not even called.
+		events, err := commands.RequestPasswordReset(repo, mails, opts, clock)(context.Background(), commands.RequestPasswordResetCommand{
+			Email: "not an email",
+		})
+		require.NoError(t, err)
+		require.Empty(t, events)
+		repo.AssertNotCalled(t, "GetUserByEmail", mock.Anything, mock.Anything)
+	})
+
+	t.Run("normalized email", func(t *testing.T) {
+		repo := &passwordResetRepository{}
+		repo.On("GetUserByEmail", mock.Anything, user.Email).Return(user, nil)
+		repo.On("StorePasswordResetToken", mock.Anything, mock.Anything).Return(nil)
+		mails := &mailQueue{}
+		mails.On("QueueEmail", mock.Anything, mock.Anything).Return(nil)
+
+		_, err := commands.RequestPasswordReset(repo, mails, opts, clock)(context.Background(), commands.RequestPasswordResetCommand{
+			Email: " Test@Mail.dev",
+		})
+		require.NoError(t, err)
+		repo.AssertExpectations(t)
+	})
+}
+
+func TestResetPassword(t *testing.T) {
+	now := time.Date(2023, 1, 1, 12, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+	user := newUser(t, "old password")
+	token, record, err := domain.NewPasswordResetToken(user, time.Minute, now)
+	require.NoError(t, err)
+
+	t.Run("success", func(t *testing.T) {
+		repo := &passwordResetRepository{}
+		repo.On("TakePasswordResetToken", mock.Anything, record.Hash).Return(record, nil)
+		repo.On("GetUserByID", mock.Anything, user.ID).Return(user, nil)
+		repo.On("StoreUser", mock.Anything, mock.MatchedBy(func(u domain.User) bool {
+			return u.CheckPassword("new password") && u.SessionsRevokedAt.Equal(now)
+		})).Return(nil)
+		repo.On("DeleteSessions", mock.Anything, user.ID).Return(nil)
+
+		events, err := commands.ResetPassword(repo, clock)(context.Background(), commands.ResetPasswordCommand{
+			Token:       token,
+			NewPassword: "new password",
+		})
+		require.NoError(t, err)
+		require.Equal(t, []interface{}{commands.PasswordResetEvent{ID: user.ID}}, events)
+		repo.AssertExpectations(t)
+	})
+
+	t.Run("used token", func(t *testing.T) {
+		repo := &passwordResetRepository{}
+		repo.On("TakePasswordResetToken", mock.Anything, record.Hash).Return(domain.PasswordResetToken{}, domain.ErrInvalidPasswordResetToken)
+
+		_, err := commands.ResetPassword(repo, clock)(context.Background(), commands.ResetPasswordCommand{
+			Token:       token,
+			NewPassword: "new password",
+		})
+		require.ErrorIs(t, err, domain.ErrInvalidPasswordResetToken)
+	})
+
+	t.Run("expired token", func(t *testing.T) {
+		repo := &passwordResetRepository{}
+		repo.On("TakePasswordResetToken", mock.Anything, record.Hash).Return(record, nil)
+
+		later := func() time.Time { return now.Add(time.Minute) }
+		_, err := commands.ResetPassword(repo, later)(context.Background(), commands.ResetPasswordCommand{
+			Token:       token,
+			NewPassword: "new password",
+		})
+		require.ErrorIs(t, err, domain.ErrPasswordResetTokenExpired)
+		repo.AssertNotCalled(t, "StoreUser", mock.Anything, mock.Anything)
+	})
+
+	t.Run("weak password", func(t *testing.T) {
+		_, err := commands.ResetPassword(&passwordResetRepository{}, clock)(context.Background(), commands.ResetPasswordCommand{
+			Token:       token,
+			NewPassword: "short",
+		})
+		require.ErrorIs(t, err, domain.ErrWeakPassword)
+	})
+}
@@ -0,0 +1,95 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/dmitrymomot/go-smart-monolith/internal/user/domain"
+)
+
+type (
+	// RevokeSessionCommand represents the request body for RevokeSession.
+	RevokeSessionCommand struct {
+		UserID    string `json:"user_id"`
+		SessionID string `json:"session_id"`
+	}
+
+	// RevokeSessionsCommand represents the request body for RevokeSessions.
+	RevokeSessionsCommand struct {
+		UserID string `json:"user_id"`
+	}
+
+	// SessionRevokedEvent represents the event body for SessionRevoked.
+	SessionRevokedEvent struct {
+		ID        string `json:"id"`
+		SessionID string `json:"session_id"`
+	}
+
+	// SessionsRevokedEvent represents the event body for SessionsRevoked.
+	// All the user sessions started before RevokedAt are revoked.
+	SessionsRevokedEvent struct {
+		ID        string    `json:"id"`
+		RevokedAt time.Time `json:"revoked_at"`
+	}
+
+	// sessionRepository represents the repository interface for the session commands.
+	sessionRepository interface {
+		updateUserRepository
+		GetSession(ctx context.Context, userID, id string) (domain.Session, error)
+		DeleteSession(ctx context.Context, userID, id string) error
+		DeleteSessions(ctx context.Context, userID string) error
+	}
+)
+
+// OwnerID returns the ID of the user the command is applied to.
+func (c RevokeSessionCommand) OwnerID() string { return c.UserID }
+
+// OwnerID returns the ID of the user the command is applied to.
+func (c RevokeSessionsCommand) OwnerID() string { return c.UserID }
+
+// RevokeSession revokes the session of the user, so its access token stops working at once.
+func RevokeSession(repo sessionRepository) func(ctx context.Context, cmd RevokeSessionCommand) ([]interface{}, error) {
+	return func(ctx context.Context, cmd RevokeSessionCommand) ([]interface{}, error) {
+		if _, err := repo.GetSession(ctx, cmd.UserID, cmd.SessionID); err != nil {
+			return nil, err
+		}
+		if err := repo.DeleteSession(ctx, cmd.UserID, cmd.SessionID); err != nil {
+			return nil, fmt.Errorf("failed to revoke session: %w", err)
+		}
+
+		return []interface{}{
+			SessionRevokedEvent{
+				ID:        cmd.UserID,
+				SessionID: cmd.SessionID,
+			},
+		}, nil
+	}
+}
+
+// RevokeSessions revokes all the sessions of the user, e.g. when the account is compromised.
+// The revocation is stored with the user first, so the access tokens without a stored session
+// stop working too, even if deleting the sessions fails.
+func RevokeSessions(repo sessionRepository, now func() time.Time) func(ctx context.Context, cmd RevokeSessionsCommand) ([]interface{}, error) {
+	return func(ctx context.Context, cmd RevokeSessionsCommand) ([]interface{}, error) {
+		user, err := getActiveUser(ctx, repo, cmd.UserID, 0)
+		if err != nil {
+			return nil, err
+		}
+
+		user.RevokeSessions(now())
+		if err := repo.StoreUser(ctx, user); err != nil {
+			return nil, fmt.Errorf("failed to revoke sessions: %w", err)
+		}
+		if err := repo.DeleteSessions(ctx, user.ID); err != nil {
+			return nil, fmt.Errorf("failed to delete sessions: %w", err)
+		}
+
+		return []interface{}{
+			SessionsRevokedEvent{
+				ID:        user.ID,
+				RevokedAt: user.SessionsRevokedAt,
+			},
+		}, nil
+	}
+}
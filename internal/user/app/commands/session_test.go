@@ -0,0 +1,101 @@
+package commands_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dmitrymomot/go-smart-monolith/internal/user/app/commands"
+	"github.com/dmitrymomot/go-smart-monolith/internal/user/domain"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// sessionRepository is a mock implementation of the sessionRepository interface.
+type sessionRepository struct {
+	updateUserRepository
+}
+
+// GetSession is a mock implementation of the GetSession method.
+func (m *sessionRepository) GetSession(ctx context.Context, userID, id string) (domain.Session, error) {
+	args := m.Called(ctx, userID, id)
+	return args.Get(0).(domain.Session), args.Error(1)
+}
+
+// DeleteSession is a mock implementation of the DeleteSession method.
+func (m *sessionRepository) DeleteSession(ctx context.Context, userID, id string) error {
+	args := m.Called(ctx, userID, id)
+	return args.Error(0)
+}
+
+// DeleteSessions is a mock implementation of the DeleteSessions method.
+func (m *sessionRepository) DeleteSessions(ctx context.Context, userID string) error {
+	args := m.Called(ctx, userID)
+	return args.Error(0)
+}
+
+func TestRevokeSession(t *testing.T) {
+	now := time.Date(2023, 1, 1, 12, 0, 0, 0, time.UTC)
+	user := newUser(t, "password")
+	session := domain.NewSession(user, domain.SessionClient{}, time.Hour, now)
+
+	t.Run("success", func(t *testing.T) {
+		repo := &sessionRepository{}
+		repo.On("GetSession", mock.Anything, user.ID, session.ID).Return(session, nil)
+		repo.On("DeleteSession", mock.Anything, user.ID, session.ID).Return(nil)
+
+		events, err := commands.RevokeSession(repo)(context.Background(), commands.RevokeSessionCommand{
+			UserID:    user.ID,
+			SessionID: session.ID,
+		})
+		require.NoError(t, err)
+		require.Equal(t, []interface{}{
+			commands.SessionRevokedEvent{ID: user.ID, SessionID: session.ID},
+		}, events)
+		repo.AssertExpectations(t)
+	})
+
+	t.Run("unknown session", func(t *testing.T) {
+		repo := &sessionRepository{}
+		repo.On("GetSession", mock.Anything, user.ID, "unknown").Return(domain.Session{}, domain.ErrSessionNotFound)
+
+		_, err := commands.RevokeSession(repo)(context.Background(), commands.RevokeSessionCommand{
+			UserID:    user.ID,
+			SessionID: "unknown",
+		})
+		require.ErrorIs(t, err, domain.ErrSessionNotFound)
+	})
+}
+
+func TestRevokeSessions(t *testing.T) {
+	now := time.Date(2023, 1, 1, 12, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+	user := newUser(t, "password")
+
+	t.Run("success", func(t *testing.T) {
+		repo := &sessionRepository{}
+		repo.On("GetUserByID", mock.Anything, user.ID).Return(user, nil)
+		repo.On("StoreUser", mock.Anything, mock.MatchedBy(func(u domain.User) bool {
+			return u.SessionsRevokedAt.Equal(now)
+		})).Return(nil)
+		repo.On("DeleteSessions", mock.Anything, user.ID).Return(nil)
+
+		events, err := commands.RevokeSessions(repo, clock)(context.Background(), commands.RevokeSessionsCommand{UserID: user.ID})
+		require.NoError(t, err)
+		require.Equal(t, []interface{}{
+			commands.SessionsRevokedEvent{ID: user.ID, RevokedAt: now},
+		}, events)
+		repo.AssertExpectations(t)
+	})
+
+	t.Run("deleted user", func(t *testing.T) {
+		deleted := user
+		deleted.DeletedAt = now
+		repo := &sessionRepository{}
+		repo.On("GetUserByID", mock.Anything, user.ID).Return(deleted, nil)
+
+		_, err := commands.RevokeSessions(repo, clock)(context.Background(), commands.RevokeSessionsCommand{UserID: user.ID})
+		require.ErrorIs(t, err, domain.ErrUserNotFound)
+	})
+}
@@ -0,0 +1,89 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/dmitrymomot/go-smart-monolith/internal/user/domain"
+)
+
+type (
+	// UpdateProfileCommand represents the request body for UpdateProfile.
+	UpdateProfileCommand struct {
+		UserID      string `json:"user_id"`
+		DisplayName string `json:"display_name"`
+		// ExpectedVersion is the user version the change is based on, see domain.User.Version.
+		// Zero skips the check.
+		ExpectedVersion int64 `json:"expected_version"`
+	}
+
+	// UserProfileUpdatedEvent represents the event body for UserProfileUpdated.
+	UserProfileUpdatedEvent struct {
+		ID          string `json:"id"`
+		DisplayName string `json:"display_name"`
+	}
+
+	// updateUserRepository represents the repository interface
+	// for the commands updating an existing user.
+	updateUserRepository interface {
+		GetUserByID(ctx context.Context, id string) (domain.User, error)
+		StoreUser(ctx context.Context, user domain.User) error
+	}
+)
+
+// OwnerID returns the ID of the user the command is applied to.
+func (c UpdateProfileCommand) OwnerID() string { return c.UserID }
+
+// UpdateProfile updates the user profile.
+// No event is emitted if nothing is changed.
+func UpdateProfile(repo updateUserRepository) func(ctx context.Context, cmd UpdateProfileCommand) ([]interface{}, error) {
+	return func(ctx context.Context, cmd UpdateProfileCommand) ([]interface{}, error) {
+		if err := domain.ValidateDisplayName(cmd.DisplayName); err != nil {
+			return nil, err
+		}
+
+		user, err := getActiveUser(ctx, repo, cmd.UserID, cmd.ExpectedVersion)
+		if err != nil {
+			return nil, err
+		}
+		if user.DisplayName == cmd.DisplayName {
+			return nil, nil
+		}
+
+		user.DisplayName = cmd.DisplayName
+		if err := repo.StoreUser(ctx, user); err != nil {
+			return nil, fmt.Errorf("failed to update profile: %w", err)
+		}
+
+		return []interface{}{
+			UserProfileUpdatedEvent{
+				ID:          user.ID,
+				DisplayName: user.DisplayName,
+			},
+		}, nil
+	}
+}
+
+// getActiveUser gets the user by ID, the soft deleted users are not found.
+// It fails with domain.ErrConcurrentModification if the user version
+// doesn't match the expected one, see checkVersion.
+func getActiveUser(ctx context.Context, repo updateUserRepository, id string, version int64) (domain.User, error) {
+	user, err := repo.GetUserByID(ctx, id)
+	if err != nil {
+		return domain.User{}, err
+	}
+	if user.IsDeleted() {
+		return domain.User{}, domain.ErrUserNotFound
+	}
+	return user, checkVersion(user, version)
+}
+
+// checkVersion checks that the user wasn't changed since the client had read it.
+// The repository guards only the changes between the read and the store in the handler,
+// this check extends the guard to the client's read. Zero version skips the check.
+func checkVersion(user domain.User, version int64) error {
+	if version != 0 && user.Version != version {
+		return domain.ErrConcurrentModification
+	}
+	return nil
+}
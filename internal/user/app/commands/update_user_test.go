@@ -0,0 +1,220 @@
+package commands_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/dmitrymomot/go-smart-monolith/internal/user/app/commands"
+	"github.com/dmitrymomot/go-smart-monolith/internal/user/domain"
+	"github.com/dmitrymomot/go-smart-monolith/pkg/featureflag"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// updateUserRepository is a mock implementation of the repository
+// used by the commands updating an existing user.
+type updateUserRepository struct {
+	mock.Mock
+}
+
+// GetUserByID is a mock implementation of the GetUserByID method.
+func (m *updateUserRepository) GetUserByID(ctx context.Context, id string) (domain.User, error) {
+	args := m.Called(ctx, id)
+	return args.Get(0).(domain.User), args.Error(1)
+}
+
+// GetUserByEmail is a mock implementation of the GetUserByEmail method.
+func (m *updateUserRepository) GetUserByEmail(ctx context.Context, email string) (domain.User, error) {
+	args := m.Called(ctx, email)
+	return args.Get(0).(domain.User), args.Error(1)
+}
+
+// StoreUser is a mock implementation of the StoreUser method.
+func (m *updateUserRepository) StoreUser(ctx context.Context, user domain.User) error {
+	args := m.Called(ctx, user)
+	return args.Error(0)
+}
+
+func newUser(t *testing.T, password string) domain.User {
+	t.Helper()
+	hash, err := domain.HashPassword(password)
+	require.NoError(t, err)
+	return domain.NewUser("test@mail.dev", hash)
+}
+
+func TestUpdateProfile(t *testing.T) {
+	user := newUser(t, "password")
+
+	t.Run("success", func(t *testing.T) {
+		repo := &updateUserRepository{}
+		repo.On("GetUserByID", mock.Anything, user.ID).Return(user, nil)
+		repo.On("StoreUser", mock.Anything, mock.MatchedBy(func(u domain.User) bool {
+			return u.ID == user.ID && u.DisplayName == "John"
+		})).Return(nil)
+
+		events, err := commands.UpdateProfile(repo)(context.Background(), commands.UpdateProfileCommand{
+			UserID:      user.ID,
+			DisplayName: "John",
+		})
+		require.NoError(t, err)
+		require.Equal(t, []interface{}{
+			commands.UserProfileUpdatedEvent{ID: user.ID, DisplayName: "John"},
+		}, events)
+		repo.AssertExpectations(t)
+	})
+
+	t.Run("unchanged", func(t *testing.T) {
+		repo := &updateUserRepository{}
+		repo.On("GetUserByID", mock.Anything, user.ID).Return(user, nil)
+
+		events, err := commands.UpdateProfile(repo)(context.Background(), commands.UpdateProfileCommand{
+			UserID: user.ID,
+		})
+		require.NoError(t, err)
+		require.Empty(t, events)
+		repo.AssertNotCalled(t, "StoreUser", mock.Anything, mock.Anything)
+	})
+
+	t.Run("deleted user", func(t *testing.T) {
+		deleted := user
+		deleted.DeletedAt = deleted.CreatedAt
+		repo := &updateUserRepository{}
+		repo.On("GetUserByID", mock.Anything, user.ID).Return(deleted, nil)
+
+		_, err := commands.UpdateProfile(repo)(context.Background(), commands.UpdateProfileCommand{
+			UserID:      user.ID,
+			DisplayName: "John",
+		})
+		require.ErrorIs(t, err, domain.ErrUserNotFound)
+	})
+}
+
+func TestChangeEmail(t *testing.T) {
+	user := newUser(t, "password")
+	user.EmailVerified = true
+
+	t.Run("success", func(t *testing.T) {
+		repo := &updateUserRepository{}
+		repo.On("GetUserByID", mock.Anything, user.ID).Return(user, nil)
+		repo.On("GetUserByEmail", mock.Anything, "new@mail.dev").Return(domain.User{}, domain.ErrUserNotFound)
+		repo.On("StoreUser", mock.Anything, mock.MatchedBy(func(u domain.User) bool {
+			// The new email must be verified again.
+			return u.Email == "new@mail.dev" && !u.EmailVerified
+		})).Return(nil)
+
+		flags := featureflag.NewStatic(commands.FlagRequireEmailVerification)
+		events, err := commands.ChangeEmail(repo, flags)(context.Background(), commands.ChangeEmailCommand{
+			UserID: user.ID,
+			Email:  "new@mail.dev",
+		})
+		require.NoError(t, err)
+		require.Equal(t, []interface{}{
+			commands.UserEmailChangedEvent{ID: user.ID, OldEmail: user.Email, NewEmail: "new@mail.dev"},
+		}, events)
+		repo.AssertExpectations(t)
+	})
+
+	t.Run("email taken", func(t *testing.T) {
+		repo := &updateUserRepository{}
+		repo.On("GetUserByID", mock.Anything, user.ID).Return(user, nil)
+		repo.On("GetUserByEmail", mock.Anything, "taken@mail.dev").Return(domain.NewUser("taken@mail.dev", ""), nil)
+
+		_, err := commands.ChangeEmail(repo, featureflag.NewStatic())(context.Background(), commands.ChangeEmailCommand{
+			UserID: user.ID,
+			Email:  "taken@mail.dev",
+		})
+		require.ErrorIs(t, err, domain.ErrEmailTaken)
+	})
+
+	t.Run("invalid email", func(t *testing.T) {
+		_, err := commands.ChangeEmail(&updateUserRepository{}, featureflag.NewStatic())(context.Background(), commands.ChangeEmailCommand{
+			UserID: user.ID,
+			Email:  "invalid",
+		})
+		require.ErrorIs(t, err, domain.ErrInvalidEmail)
+	})
+
+	t.Run("same email in another case", func(t *testing.T) {
+		repo := &updateUserRepository{}
+		repo.On("GetUserByID", mock.Anything, user.ID).Return(user, nil)
+
+		events, err := commands.ChangeEmail(repo, featureflag.NewStatic())(context.Background(), commands.ChangeEmailCommand{
+			UserID: user.ID,
+			Email:  strings.ToUpper(user.Email),
+		})
+		require.NoError(t, err)
+		require.Empty(t, events, "the email is not changed")
+		repo.AssertNotCalled(t, "StoreUser", mock.Anything, mock.Anything)
+	})
+}
+
+func TestChangePassword(t *testing.T) {
+	user := newUser(t, "old password")
+
+	t.Run("success", func(t *testing.T) {
+		repo := &updateUserRepository{}
+		repo.On("GetUserByID", mock.Anything, user.ID).Return(user, nil)
+		repo.On("StoreUser", mock.Anything, mock.MatchedBy(func(u domain.User) bool {
+			return u.CheckPassword("new password") && !u.CheckPassword("old password")
+		})).Return(nil)
+
+		events, err := commands.ChangePassword(repo)(context.Background(), commands.ChangePasswordCommand{
+			UserID:      user.ID,
+			OldPassword: "old password",
+			NewPassword: "new password",
+		})
+		require.NoError(t, err)
+		require.Equal(t, []interface{}{commands.UserPasswordChangedEvent{ID: user.ID}}, events)
+		repo.AssertExpectations(t)
+	})
+
+	t.Run("wrong old password", func(t *testing.T) {
+		repo := &updateUserRepository{}
+		repo.On("GetUserByID", mock.Anything, user.ID).Return(user, nil)
+
+		_, err := commands.ChangePassword(repo)(context.Background(), commands.ChangePasswordCommand{
+			UserID:      user.ID,
+			OldPassword: "wrong password",
+			NewPassword: "new password",
+		})
+		require.ErrorIs(t, err, domain.ErrInvalidPassword)
+		repo.AssertNotCalled(t, "StoreUser", mock.Anything, mock.Anything)
+	})
+
+	t.Run("weak new password", func(t *testing.T) {
+		_, err := commands.ChangePassword(&updateUserRepository{})(context.Background(), commands.ChangePasswordCommand{
+			UserID:      user.ID,
+			OldPassword: "old password",
+			NewPassword: "short",
+		})
+		require.ErrorIs(t, err, domain.ErrWeakPassword)
+	})
+}
+
+func TestUpdateProfile_Version(t *testing.T) {
+	user := newUser(t, "password")
+	user.Version = 2
+
+	repo := &updateUserRepository{}
+	repo.On("GetUserByID", mock.Anything, user.ID).Return(user, nil)
+
+	// The client read the previous version of the user.
+	_, err := commands.UpdateProfile(repo)(context.Background(), commands.UpdateProfileCommand{
+		UserID:          user.ID,
+		DisplayName:     "John",
+		ExpectedVersion: 1,
+	})
+	require.ErrorIs(t, err, domain.ErrConcurrentModification)
+	repo.AssertNotCalled(t, "StoreUser", mock.Anything, mock.Anything)
+
+	// The user was changed between the read and the store in the handler.
+	repo.On("StoreUser", mock.Anything, mock.Anything).Return(domain.ErrConcurrentModification)
+	_, err = commands.UpdateProfile(repo)(context.Background(), commands.UpdateProfileCommand{
+		UserID:          user.ID,
+		DisplayName:     "John",
+		ExpectedVersion: 2,
+	})
+	require.ErrorIs(t, err, domain.ErrConcurrentModification)
+}
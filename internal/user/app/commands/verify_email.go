@@ -0,0 +1,160 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/dmitrymomot/go-smart-monolith/internal/user/domain"
+	"github.com/dmitrymomot/go-smart-monolith/pkg/mailer"
+)
+
+type (
+	// RequestEmailVerificationCommand is a system command that sends
+	// the verification link to the user email. It's run on UserCreated and UserEmailChanged events.
+	RequestEmailVerificationCommand struct {
+		UserID string `json:"user_id"`
+	}
+
+	// VerifyEmailCommand represents the request body for VerifyEmail.
+	VerifyEmailCommand struct {
+		Token string `json:"token"`
+	}
+
+	// EmailVerificationRequestedEvent represents the event body for EmailVerificationRequested.
+	// Note: it never contains the token.
+	EmailVerificationRequestedEvent struct {
+		ID        string    `json:"id"`
+		Email     string    `json:"email"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+
+	// UserEmailVerifiedEvent represents the event body for UserEmailVerified.
+	UserEmailVerifiedEvent struct {
+		ID    string `json:"id"`
+		Email string `json:"email"`
+	}
+
+	// EmailVerificationOptions defines the verification emails.
+	EmailVerificationOptions struct {
+		// TTL is how long the verification link is valid.
+		TTL time.Duration
+		// URL is the page the verification link leads to, the token is added as the "token" query parameter.
+		// The page is expected to call POST /users/verify with the token.
+		URL string
+		// From is the sender of the verification emails.
+		From string
+	}
+
+	// verificationRepository represents the repository interface for the email verification commands.
+	verificationRepository interface {
+		updateUserRepository
+		StoreVerificationToken(ctx context.Context, token domain.VerificationToken) error
+		TakeVerificationToken(ctx context.Context, hash string) (domain.VerificationToken, error)
+	}
+
+	// mailQueue queues the emails to be sent, see adapters/messagebus.
+	mailQueue interface {
+		QueueEmail(ctx context.Context, msg mailer.Message) error
+	}
+)
+
+// RequestEmailVerification issues a verification token and queues the email with the verification link.
+// No email is sent if the user email is already verified, e.g. the verification is not required,
+// unless it's an admin email not proven yet, see AdminEmails.
+func RequestEmailVerification(repo verificationRepository, mails mailQueue, opts EmailVerificationOptions, admins AdminEmails, now func() time.Time) func(ctx context.Context, cmd RequestEmailVerificationCommand) ([]interface{}, error) {
+	return func(ctx context.Context, cmd RequestEmailVerificationCommand) ([]interface{}, error) {
+		user, err := getActiveUser(ctx, repo, cmd.UserID, 0)
+		if err != nil {
+			return nil, err
+		}
+		if user.EmailVerified && !admins.pendingAdmin(user) {
+			return nil, nil
+		}
+
+		token, record, err := domain.NewVerificationToken(user, opts.TTL, now())
+		if err != nil {
+			return nil, fmt.Errorf("failed to issue verification token: %w", err)
+		}
+		if err := repo.StoreVerificationToken(ctx, record); err != nil {
+			return nil, fmt.Errorf("failed to store verification token: %w", err)
+		}
+
+		link, err := tokenLink(opts.URL, token)
+		if err != nil {
+			return nil, err
+		}
+		if err := mails.QueueEmail(ctx, mailer.Message{
+			From:    opts.From,
+			To:      []string{user.Email},
+			Subject: "Confirm your email",
+			Body: fmt.Sprintf("Confirm your email by following the link:\n\n%s\n\nThe link expires at %s.\n",
+				link, record.ExpiresAt.Format(time.RFC1123)),
+		}); err != nil {
+			return nil, fmt.Errorf("failed to queue verification email: %w", err)
+		}
+
+		return []interface{}{
+			EmailVerificationRequestedEvent{
+				ID:        user.ID,
+				Email:     user.Email,
+				ExpiresAt: record.ExpiresAt,
+			},
+		}, nil
+	}
+}
+
+// VerifyEmail marks the user email verified by the token sent to it.
+// The token proves the email ownership, so the user with an admin email is granted the admin role.
+// The token can be used only once.
+func VerifyEmail(repo verificationRepository, admins AdminEmails, now func() time.Time) func(ctx context.Context, cmd VerifyEmailCommand) ([]interface{}, error) {
+	return func(ctx context.Context, cmd VerifyEmailCommand) ([]interface{}, error) {
+		// The token is taken before the email is verified, so it can't be used twice, even concurrently.
+		// If the verification fails, the user has to request a new one.
+		token, err := repo.TakeVerificationToken(ctx, domain.HashVerificationToken(cmd.Token))
+		if err != nil {
+			return nil, err
+		}
+		if token.IsExpired(now()) {
+			return nil, domain.ErrVerificationTokenExpired
+		}
+
+		user, err := getActiveUser(ctx, repo, token.UserID, 0)
+		if err != nil {
+			return nil, err
+		}
+		// The token was sent to the old email, it doesn't prove the new one.
+		if user.Email != token.Email {
+			return nil, domain.ErrInvalidVerificationToken
+		}
+
+		var events []interface{}
+		if !user.EmailVerified {
+			user.EmailVerified = true
+			events = append(events, UserEmailVerifiedEvent{
+				ID:    user.ID,
+				Email: user.Email,
+			})
+		}
+		events = append(events, admins.grantAdmin(&user)...)
+		if len(events) > 0 {
+			if err := repo.StoreUser(ctx, user); err != nil {
+				return nil, fmt.Errorf("failed to verify email: %w", err)
+			}
+		}
+		return events, nil
+	}
+}
+
+// tokenLink adds the token sent by email to the page URL.
+func tokenLink(page, token string) (string, error) {
+	u, err := url.Parse(page)
+	if err != nil {
+		return "", fmt.Errorf("invalid url %q: %w", page, err)
+	}
+	q := u.Query()
+	q.Set("token", token)
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
@@ -0,0 +1,210 @@
+package commands_test
+
+import (
+	"context"
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/dmitrymomot/go-smart-monolith/internal/user/app/commands"
+	"github.com/dmitrymomot/go-smart-monolith/internal/user/domain"
+	"github.com/dmitrymomot/go-smart-monolith/pkg/mailer"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// verificationRepository is a mock implementation of the verificationRepository interface.
+type verificationRepository struct {
+	updateUserRepository
+}
+
+// StoreVerificationToken is a mock implementation of the StoreVerificationToken method.
+func (m *verificationRepository) StoreVerificationToken(ctx context.Context, token domain.VerificationToken) error {
+	args := m.Called(ctx, token)
+	return args.Error(0)
+}
+
+// TakeVerificationToken is a mock implementation of the TakeVerificationToken method.
+func (m *verificationRepository) TakeVerificationToken(ctx context.Context, hash string) (domain.VerificationToken, error) {
+	args := m.Called(ctx, hash)
+	return args.Get(0).(domain.VerificationToken), args.Error(1)
+}
+
+// mailQueue is a mock implementation of the mailQueue interface.
+type mailQueue struct {
+	mock.Mock
+}
+
+// QueueEmail is a mock implementation of the QueueEmail method.
+func (m *mailQueue) QueueEmail(ctx context.Context, msg mailer.Message) error {
+	args := m.Called(ctx, msg)
+	return args.Error(0)
+}
+
+func TestRequestEmailVerification(t *testing.T) {
+	now := time.Date(2023, 1, 1, 12, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+	opts := commands.EmailVerificationOptions{
+		TTL:  time.Hour,
+		URL:  "https://app.dev/verify-email?lang=en",
+		From: "no-reply@app.dev",
+	}
+	user := domain.NewUser("test@mail.dev", "")
+
+	t.Run("unverified email", func(t *testing.T) {
+		var stored domain.VerificationToken
+		repo := &verificationRepository{}
+		repo.On("GetUserByID", mock.Anything, user.ID).Return(user, nil)
+		repo.On("StoreVerificationToken", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+			stored = args.Get(1).(domain.VerificationToken)
+		}).Return(nil)
+
+		var sent mailer.Message
+		mails := &mailQueue{}
+		mails.On("QueueEmail", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+			sent = args.Get(1).(mailer.Message)
+		}).Return(nil)
+
+		events, err := commands.RequestEmailVerification(repo, mails, opts, nil, clock)(context.Background(), commands.RequestEmailVerificationCommand{
+			UserID: user.ID,
+		})
+		require.NoError(t, err)
+		require.Equal(t, []interface{}{
+			commands.EmailVerificationRequestedEvent{ID: user.ID, Email: user.Email, ExpiresAt: now.Add(time.Hour)},
+		}, events)
+
+		// The email has the link with the token, only its hash is stored.
+		require.Equal(t, opts.From, sent.From)
+		require.Equal(t, []string{user.Email}, sent.To)
+		link, err := url.Parse(regexp.MustCompile(`https://\S+`).FindString(sent.Body))
+		require.NoError(t, err)
+		require.Equal(t, "en", link.Query().Get("lang"))
+		token := link.Query().Get("token")
+		require.NotEmpty(t, token)
+		require.Equal(t, domain.VerificationToken{
+			Hash:      domain.HashVerificationToken(token),
+			UserID:    user.ID,
+			Email:     user.Email,
+			ExpiresAt: now.Add(time.Hour),
+		}, stored)
+	})
+
+	t.Run("verified email", func(t *testing.T) {
+		verified := user
+		verified.EmailVerified = true
+		repo := &verificationRepository{}
+		repo.On("GetUserByID", mock.Anything, user.ID).Return(verified, nil)
+		mails := &mailQueue{}
+
+		events, err := commands.RequestEmailVerification(repo, mails, opts, nil, clock)(context.Background(), commands.RequestEmailVerificationCommand{
+			UserID: user.ID,
+		})
+		require.NoError(t, err)
+		require.Empty(t, events)
+		mails.AssertNotCalled(t, "QueueEmail", mock.Anything, mock.Anything)
+	})
+
+	t.Run("admin email", func(t *testing.T) {
+		// The email is verified on signup, but the admin must prove it anyway.
+		verified := user
+		verified.EmailVerified = true
+		repo := &verificationRepository{}
+		repo.On("GetUserByID", mock.Anything, user.ID).Return(verified, nil)
+		repo.On("StoreVerificationToken", mock.Anything, mock.Anything).Return(nil)
+		mails := &mailQueue{}
+		mails.On("QueueEmail", mock.Anything, mock.Anything).Return(nil)
+
+		admins := commands.AdminEmails{"Test@mail.dev"}
+		events, err := commands.RequestEmailVerification(repo, mails, opts, admins, clock)(context.Background(), commands.RequestEmailVerificationCommand{
+			UserID: user.ID,
+		})
+		require.NoError(t, err)
+		require.Len(t, events, 1)
+		mails.AssertExpectations(t)
+
+		// The proven admin is not asked again.
+		verified.Roles = append(verified.Roles, domain.RoleAdmin)
+		repo = &verificationRepository{}
+		repo.On("GetUserByID", mock.Anything, user.ID).Return(verified, nil)
+		events, err = commands.RequestEmailVerification(repo, &mailQueue{}, opts, admins, clock)(context.Background(), commands.RequestEmailVerificationCommand{
+			UserID: user.ID,
+		})
+		require.NoError(t, err)
+		require.Empty(t, events)
+	})
+}
+
+func TestVerifyEmail(t *testing.T) {
+	now := time.Date(2023, 1, 1, 12, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+	user := domain.NewUser("test@mail.dev", "")
+	token, record, err := domain.NewVerificationToken(user, time.Hour, now)
+	require.NoError(t, err)
+
+	t.Run("success", func(t *testing.T) {
+		repo := &verificationRepository{}
+		repo.On("TakeVerificationToken", mock.Anything, record.Hash).Return(record, nil)
+		repo.On("GetUserByID", mock.Anything, user.ID).Return(user, nil)
+		repo.On("StoreUser", mock.Anything, mock.MatchedBy(func(u domain.User) bool {
+			return u.ID == user.ID && u.EmailVerified
+		})).Return(nil)
+
+		events, err := commands.VerifyEmail(repo, nil, clock)(context.Background(), commands.VerifyEmailCommand{Token: token})
+		require.NoError(t, err)
+		require.Equal(t, []interface{}{
+			commands.UserEmailVerifiedEvent{ID: user.ID, Email: user.Email},
+		}, events)
+		repo.AssertExpectations(t)
+	})
+
+	t.Run("admin email", func(t *testing.T) {
+		verified := user
+		verified.EmailVerified = true
+		repo := &verificationRepository{}
+		repo.On("TakeVerificationToken", mock.Anything, record.Hash).Return(record, nil)
+		repo.On("GetUserByID", mock.Anything, user.ID).Return(verified, nil)
+		repo.On("StoreUser", mock.Anything, mock.MatchedBy(func(u domain.User) bool {
+			return u.HasRole(domain.RoleAdmin)
+		})).Return(nil)
+
+		// The token proves the ownership of the admin email.
+		events, err := commands.VerifyEmail(repo, commands.AdminEmails{user.Email}, clock)(context.Background(), commands.VerifyEmailCommand{Token: token})
+		require.NoError(t, err)
+		require.Equal(t, []interface{}{
+			commands.UserRoleGrantedEvent{ID: user.ID, Role: domain.RoleAdmin},
+		}, events)
+		repo.AssertExpectations(t)
+	})
+
+	t.Run("unknown token", func(t *testing.T) {
+		repo := &verificationRepository{}
+		repo.On("TakeVerificationToken", mock.Anything, mock.Anything).Return(domain.VerificationToken{}, domain.ErrInvalidVerificationToken)
+
+		_, err := commands.VerifyEmail(repo, nil, clock)(context.Background(), commands.VerifyEmailCommand{Token: "unknown"})
+		require.ErrorIs(t, err, domain.ErrInvalidVerificationToken)
+	})
+
+	t.Run("expired token", func(t *testing.T) {
+		repo := &verificationRepository{}
+		repo.On("TakeVerificationToken", mock.Anything, record.Hash).Return(record, nil)
+
+		later := func() time.Time { return now.Add(time.Hour) }
+		_, err := commands.VerifyEmail(repo, nil, later)(context.Background(), commands.VerifyEmailCommand{Token: token})
+		require.ErrorIs(t, err, domain.ErrVerificationTokenExpired)
+		repo.AssertExpectations(t)
+	})
+
+	t.Run("email changed", func(t *testing.T) {
+		changed := user
+		changed.Email = "new@mail.dev"
+		repo := &verificationRepository{}
+		repo.On("TakeVerificationToken", mock.Anything, record.Hash).Return(record, nil)
+		repo.On("GetUserByID", mock.Anything, user.ID).Return(changed, nil)
+
+		_, err := commands.VerifyEmail(repo, nil, clock)(context.Background(), commands.VerifyEmailCommand{Token: token})
+		require.ErrorIs(t, err, domain.ErrInvalidVerificationToken)
+		repo.AssertNotCalled(t, "StoreUser", mock.Anything, mock.Anything)
+	})
+}
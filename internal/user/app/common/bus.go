@@ -0,0 +1,92 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+)
+
+var (
+	// ErrCommandHandlerNotFound is returned when no handler is registered for the command type.
+	ErrCommandHandlerNotFound = errors.New("command handler not found")
+	// ErrDuplicateCommandHandler is returned when a handler is already registered for the command type.
+	ErrDuplicateCommandHandler = errors.New("command handler already registered")
+)
+
+// CommandBus dispatches the commands to the handlers registered by the command type,
+// so the generic ports, e.g. the message bus or a CLI, don't need to know each handler.
+// The global middlewares are the command decorators of any command, e.g.
+// logger.CommandErrorLogger[interface{}], they wrap every handler once it's registered.
+type CommandBus struct {
+	mu          sync.RWMutex
+	handlers    map[reflect.Type]CommandHandler[interface{}]
+	chains      map[reflect.Type]CommandHandler[interface{}] // the handlers wrapped by the middlewares
+	middlewares []CommandDecorator[interface{}]
+}
+
+// NewCommandBus creates a new command bus with the global middlewares,
+// the first one wraps the handler first, same as in ApplyCommandDecorators.
+func NewCommandBus(middlewares ...CommandDecorator[interface{}]) *CommandBus {
+	return &CommandBus{
+		handlers:    make(map[reflect.Type]CommandHandler[interface{}]),
+		chains:      make(map[reflect.Type]CommandHandler[interface{}]),
+		middlewares: middlewares,
+	}
+}
+
+// Use appends the global middlewares, they wrap the handlers after the previous ones.
+// The registered handlers are wrapped again, so it's cheaper to call it before registering them.
+func (b *CommandBus) Use(middlewares ...CommandDecorator[interface{}]) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.middlewares = append(b.middlewares, middlewares...)
+	for t, handler := range b.handlers {
+		b.chains[t] = ApplyCommandDecorators(handler, b.middlewares...)
+	}
+}
+
+// RegisterCommand registers the handler of the commands of type Cmd.
+// Only one handler can be registered for a command type.
+// It's a function, not a method, since the methods can't have type parameters.
+func RegisterCommand[Cmd any](b *CommandBus, handler CommandHandler[Cmd]) error {
+	t := reflect.TypeOf((*Cmd)(nil)).Elem()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.handlers[t]; ok {
+		return fmt.Errorf("%w: %s", ErrDuplicateCommandHandler, t)
+	}
+	b.handlers[t] = func(ctx context.Context, cmd interface{}) ([]interface{}, error) {
+		return handler(ctx, cmd.(Cmd))
+	}
+	b.chains[t] = ApplyCommandDecorators(b.handlers[t], b.middlewares...)
+	return nil
+}
+
+// Send dispatches the command to the handler registered for its type, through the global middlewares.
+// The command is dispatched by its exact type, so pass it by value if its handler takes a value.
+func (b *CommandBus) Send(ctx context.Context, cmd interface{}) ([]interface{}, error) {
+	b.mu.RLock()
+	handler, ok := b.chains[reflect.TypeOf(cmd)]
+	b.mu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("%w: %T", ErrCommandHandlerNotFound, cmd)
+	}
+	return handler(ctx, cmd)
+}
+
+// Commands returns the sorted type names of the registered commands, e.g. "commands.CreateUserCommand".
+func (b *CommandBus) Commands() []string {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	names := make([]string, 0, len(b.handlers))
+	for t := range b.handlers {
+		names = append(names, t.String())
+	}
+	sort.Strings(names)
+	return names
+}
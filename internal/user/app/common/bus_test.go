@@ -0,0 +1,69 @@
+package common_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/dmitrymomot/go-smart-monolith/internal/user/app/common"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCommandBus(t *testing.T) {
+	t.Parallel()
+
+	type CreateCommand struct{ Val string }
+	type DeleteCommand struct{ Val string }
+	type UnknownCommand struct{}
+
+	// trace records the command passing the global middlewares, wraps counts the wrapped handlers.
+	var trace []string
+	wraps := 0
+	middleware := func(name string) common.CommandDecorator[interface{}] {
+		return func(next common.CommandHandler[interface{}]) common.CommandHandler[interface{}] {
+			wraps++
+			return func(ctx context.Context, cmd interface{}) ([]interface{}, error) {
+				trace = append(trace, name)
+				return next(ctx, cmd)
+			}
+		}
+	}
+
+	bus := common.NewCommandBus(middleware("inner"))
+	bus.Use(middleware("outer"))
+	require.NoError(t, common.RegisterCommand(bus, func(ctx context.Context, cmd CreateCommand) ([]interface{}, error) {
+		return []interface{}{"created:" + cmd.Val}, nil
+	}))
+	require.NoError(t, common.RegisterCommand(bus, common.CommandHandler[DeleteCommand](func(ctx context.Context, cmd DeleteCommand) ([]interface{}, error) {
+		return []interface{}{"deleted:" + cmd.Val}, nil
+	})))
+
+	e, err := bus.Send(context.Background(), CreateCommand{Val: "a"})
+	require.NoError(t, err)
+	require.Equal(t, []interface{}{"created:a"}, e)
+	require.Equal(t, []string{"outer", "inner"}, trace)
+
+	e, err = bus.Send(context.Background(), DeleteCommand{Val: "b"})
+	require.NoError(t, err)
+	require.Equal(t, []interface{}{"deleted:b"}, e)
+	require.Equal(t, 4, wraps, "the handlers are wrapped once, on registration")
+
+	// The middlewares added later wrap the registered handlers too.
+	bus.Use(middleware("last"))
+	trace = nil
+	_, err = bus.Send(context.Background(), CreateCommand{Val: "a"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"last", "outer", "inner"}, trace)
+
+	_, err = bus.Send(context.Background(), UnknownCommand{})
+	require.ErrorIs(t, err, common.ErrCommandHandlerNotFound)
+	_, err = bus.Send(context.Background(), &CreateCommand{Val: "a"})
+	require.ErrorIs(t, err, common.ErrCommandHandlerNotFound, "the commands are dispatched by the exact type")
+
+	err = common.RegisterCommand(bus, func(ctx context.Context, cmd CreateCommand) ([]interface{}, error) {
+		return nil, nil
+	})
+	require.ErrorIs(t, err, common.ErrDuplicateCommandHandler)
+
+	require.Equal(t, []string{"common_test.CreateCommand", "common_test.DeleteCommand"}, bus.Commands())
+}
@@ -0,0 +1,45 @@
+package authz
+
+import (
+	"context"
+
+	"github.com/dmitrymomot/go-smart-monolith/internal/user/app/common"
+	"github.com/dmitrymomot/go-smart-monolith/pkg/auth"
+)
+
+// owned is a command or query applied to a resource owned by a user.
+type owned interface {
+	OwnerID() string
+}
+
+// OwnerOnly is a decorator that allows the command to be executed only by the owner
+// of the resource. The caller is read from the context, see pkg/auth.
+// So the command handlers don't need to care about the authorization.
+func OwnerOnly[Cmd owned]() common.CommandDecorator[Cmd] {
+	return func(next common.CommandHandler[Cmd]) common.CommandHandler[Cmd] {
+		return func(ctx context.Context, cmd Cmd) ([]interface{}, error) {
+			if err := authorize(ctx, Rule{Owner: true}, cmd); err != nil {
+				return nil, err
+			}
+			return next(ctx, cmd)
+		}
+	}
+}
+
+// authorize checks the caller from the context against the rule.
+func authorize(ctx context.Context, rule Rule, v interface{}) error {
+	p, ok := auth.PrincipalFromContext(ctx)
+	if !ok {
+		return auth.ErrUnauthenticated
+	}
+	if rule.Permission == "" && !rule.Owner {
+		return nil
+	}
+	if rule.Permission != "" && p.HasPermission(string(rule.Permission)) {
+		return nil
+	}
+	if o, ok := v.(owned); ok && rule.Owner && p.UserID != "" && p.UserID == o.OwnerID() {
+		return nil
+	}
+	return auth.ErrForbidden
+}
@@ -0,0 +1,84 @@
+package authz
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/dmitrymomot/go-smart-monolith/internal/user/app/common"
+	"github.com/dmitrymomot/go-smart-monolith/internal/user/domain"
+	"github.com/dmitrymomot/go-smart-monolith/pkg/auth"
+)
+
+// Rule defines which callers are allowed to execute a command or query.
+// The rule without the permission and the owner allows any authenticated caller.
+type Rule struct {
+	// Permission allows the callers having it, see domain.Role.
+	Permission domain.Permission
+	// Owner allows the owner of the resource, the command or query must have the OwnerID method.
+	Owner bool
+}
+
+// Policy is a registry of the authorization rules by the command and query types.
+// It's filled once when the service is built, so it's not safe for concurrent registration.
+type Policy struct {
+	rules map[reflect.Type]Rule
+}
+
+// NewPolicy returns an empty policy: all the commands and queries are forbidden
+// until their rules are registered.
+func NewPolicy() *Policy {
+	return &Policy{rules: make(map[reflect.Type]Rule)}
+}
+
+// Register sets the rule of the command or query type T.
+// It panics if the rule allows the owner but T has no OwnerID method,
+// since it's a programming error the owner would be never allowed with.
+func Register[T any](p *Policy, rule Rule) *Policy {
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	if rule.Owner && !t.Implements(reflect.TypeOf((*owned)(nil)).Elem()) {
+		panic(fmt.Sprintf("authz: %s has no OwnerID method", t))
+	}
+	p.rules[t] = rule
+	return p
+}
+
+// Authorize checks that the caller from the context is allowed to execute the command or query.
+// The types without a registered rule are forbidden.
+func (p *Policy) Authorize(ctx context.Context, v interface{}) error {
+	rule, ok := p.rules[reflect.TypeOf(v)]
+	if !ok {
+		if _, ok := auth.PrincipalFromContext(ctx); !ok {
+			return auth.ErrUnauthenticated
+		}
+		return auth.ErrForbidden
+	}
+	return authorize(ctx, rule, v)
+}
+
+// Command is a decorator that allows the command to be executed only by the callers
+// the policy rule of the command type allows.
+func Command[Cmd any](policy *Policy) common.CommandDecorator[Cmd] {
+	return func(next common.CommandHandler[Cmd]) common.CommandHandler[Cmd] {
+		return func(ctx context.Context, cmd Cmd) ([]interface{}, error) {
+			if err := policy.Authorize(ctx, cmd); err != nil {
+				return nil, err
+			}
+			return next(ctx, cmd)
+		}
+	}
+}
+
+// Query is a decorator that allows the query to be executed only by the callers
+// the policy rule of the query type allows.
+func Query[Qry any, Rsp any](policy *Policy) common.QueryDecorator[Qry, Rsp] {
+	return func(next common.QueryHandler[Qry, Rsp]) common.QueryHandler[Qry, Rsp] {
+		return func(ctx context.Context, qry Qry) (Rsp, error) {
+			if err := policy.Authorize(ctx, qry); err != nil {
+				var empty Rsp
+				return empty, err
+			}
+			return next(ctx, qry)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package authz_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/dmitrymomot/go-smart-monolith/internal/user/app/common"
+	"github.com/dmitrymomot/go-smart-monolith/internal/user/app/decorators/authz"
+	"github.com/dmitrymomot/go-smart-monolith/internal/user/domain"
+	"github.com/dmitrymomot/go-smart-monolith/pkg/auth"
+
+	"github.com/stretchr/testify/require"
+)
+
+type (
+	ownedQuery        struct{ UserID string }
+	publicQuery       struct{}
+	unregisteredQuery struct{}
+)
+
+func (q ownedQuery) OwnerID() string { return q.UserID }
+
+func TestPolicy(t *testing.T) {
+	policy := authz.NewPolicy()
+	authz.Register[ownedQuery](policy, authz.Rule{Owner: true, Permission: domain.PermissionReadUsers})
+	authz.Register[publicQuery](policy, authz.Rule{})
+
+	handler := common.ApplyQueryDecorators(
+		func(ctx context.Context, q ownedQuery) (string, error) { return "ok", nil },
+		authz.Query[ownedQuery, string](policy),
+	)
+
+	user := auth.WithPrincipal(context.Background(), auth.Principal{UserID: "1"})
+	admin := auth.WithPrincipal(context.Background(), auth.Principal{
+		UserID:      "2",
+		Permissions: []string{string(domain.PermissionReadUsers)},
+	})
+
+	for name, tc := range map[string]struct {
+		ctx context.Context
+		qry ownedQuery
+		err error
+	}{
+		"anonymous":  {ctx: context.Background(), qry: ownedQuery{UserID: "1"}, err: auth.ErrUnauthenticated},
+		"owner":      {ctx: user, qry: ownedQuery{UserID: "1"}},
+		"not owner":  {ctx: user, qry: ownedQuery{UserID: "2"}, err: auth.ErrForbidden},
+		"permission": {ctx: admin, qry: ownedQuery{UserID: "1"}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			res, err := handler(tc.ctx, tc.qry)
+			require.ErrorIs(t, err, tc.err)
+			if tc.err == nil {
+				require.Equal(t, "ok", res)
+			}
+		})
+	}
+
+	t.Run("any authenticated caller", func(t *testing.T) {
+		require.NoError(t, policy.Authorize(user, publicQuery{}))
+		require.ErrorIs(t, policy.Authorize(context.Background(), publicQuery{}), auth.ErrUnauthenticated)
+	})
+
+	t.Run("unregistered", func(t *testing.T) {
+		require.ErrorIs(t, policy.Authorize(admin, unregisteredQuery{}), auth.ErrForbidden)
+	})
+
+	t.Run("owner rule without owner", func(t *testing.T) {
+		require.Panics(t, func() {
+			authz.Register[publicQuery](policy, authz.Rule{Owner: true})
+		})
+	})
+}
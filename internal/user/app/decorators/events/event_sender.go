@@ -14,19 +14,22 @@ type natsClient interface {
 	PublishEvent(subject string, events ...interface{}) error
 }
 
+// Topic is the message bus topic of the user service events.
+// Each event is published to its own subject under the topic, see adapters/messagebus.
+const Topic = "user.events"
+
 // EventSender is a decoration function that sends an event,
 // after the command handler has been executed.
+// The events are sent even if the handler returns an error along with them,
+// e.g. a batch command that failed after some changes were applied.
 func EventSender[Cmd any](nc natsClient) common.CommandDecorator[Cmd] {
 	return func(next common.CommandHandler[Cmd]) common.CommandHandler[Cmd] {
 		return func(ctx context.Context, cmd Cmd) ([]interface{}, error) {
 			e, err := next(ctx, cmd)
-			if err != nil {
-				return nil, err
-			}
 
 			// Publish the event.
 			if len(e) > 0 {
-				if err := nc.PublishEvent("events_topic_name", e...); err != nil {
+				if err := nc.PublishEvent(Topic, e...); err != nil {
 					// log error, but do not return it
 					// because the command handler has already been executed
 					// and the error has already been returned.
@@ -35,7 +38,7 @@ func EventSender[Cmd any](nc natsClient) common.CommandDecorator[Cmd] {
 				}
 			}
 
-			return e, nil
+			return e, err
 		}
 	}
 }
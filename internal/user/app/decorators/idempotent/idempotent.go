@@ -0,0 +1,77 @@
+// Package idempotent executes the retried commands once, whatever port they come from.
+package idempotent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/dmitrymomot/go-smart-monolith/internal/user/app/common"
+	"github.com/dmitrymomot/go-smart-monolith/pkg/idempotency"
+)
+
+type (
+	// Options defines how long the commands are deduplicated.
+	Options struct {
+		// TTL is how long the events of the executed command are returned to the retries.
+		TTL time.Duration
+		// Timeout is how long the command in progress holds its key at most,
+		// so the retries are not blocked forever if it crashed.
+		Timeout time.Duration
+	}
+
+	// recordStore keeps the idempotency records, see idempotency.Store.
+	recordStore interface {
+		Begin(ctx context.Context, key, fingerprint string, timeout time.Duration) (idempotency.Record, bool, error)
+		Complete(ctx context.Context, key, fingerprint string, result interface{}, ttl time.Duration) error
+		Release(ctx context.Context, key string) error
+	}
+)
+
+// Command is a decorator that executes the command once per idempotency key in the context,
+// see idempotency.WithKey: the ports put the key of the request or of the message there.
+// The retries get the events of the first execution, the retry of the command still in progress
+// fails with idempotency.ErrInProgress, and the key reused for another command fails with
+// idempotency.ErrKeyReused. The failed commands are not stored, so they can be retried.
+// The commands without the key are executed as is.
+// Apply it last, so the events are not sent again on the replay.
+func Command[Cmd any](store recordStore, opts Options) common.CommandDecorator[Cmd] {
+	return func(next common.CommandHandler[Cmd]) common.CommandHandler[Cmd] {
+		return func(ctx context.Context, cmd Cmd) ([]interface{}, error) {
+			key, ok := idempotency.KeyFromContext(ctx)
+			if !ok {
+				return next(ctx, cmd)
+			}
+
+			// The keys are scoped by the command, so the same message may run several commands.
+			key = fmt.Sprintf("cmd:%T:%s", cmd, key)
+			body, err := json.Marshal(cmd)
+			if err != nil {
+				return nil, fmt.Errorf("failed to fingerprint command: %w", err)
+			}
+			fingerprint := idempotency.Fingerprint(body)
+
+			rec, begun, err := store.Begin(ctx, key, fingerprint, opts.Timeout)
+			if err != nil {
+				return nil, err
+			}
+			if !begun {
+				e, _ := rec.Result.([]interface{})
+				return e, nil
+			}
+
+			e, err := next(ctx, cmd)
+
+			// The store errors are not returned: the command is already executed,
+			// and the key is released by the timeout anyway.
+			ctx = context.WithoutCancel(ctx)
+			if err != nil {
+				_ = store.Release(ctx, key)
+				return e, err
+			}
+			_ = store.Complete(ctx, key, fingerprint, e, opts.TTL)
+			return e, nil
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package idempotent_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/dmitrymomot/go-smart-monolith/internal/user/app/common"
+	"github.com/dmitrymomot/go-smart-monolith/internal/user/app/decorators/idempotent"
+	"github.com/dmitrymomot/go-smart-monolith/pkg/idempotency"
+	"github.com/dmitrymomot/go-smart-monolith/pkg/storage"
+
+	"github.com/stretchr/testify/require"
+)
+
+type sendEmailCommand struct {
+	UserID string
+	Fail   bool
+}
+
+type otherCommand struct {
+	UserID string
+}
+
+func TestCommand(t *testing.T) {
+	store := idempotency.NewStore(storage.New(), time.Now)
+	opts := idempotent.Options{TTL: time.Hour, Timeout: time.Minute}
+
+	calls := 0
+	send := common.ApplyCommandDecorators(
+		func(ctx context.Context, cmd sendEmailCommand) ([]interface{}, error) {
+			calls++
+			if cmd.Fail {
+				return nil, errors.New("mail queue is down")
+			}
+			return []interface{}{calls}, nil
+		},
+		idempotent.Command[sendEmailCommand](store, opts),
+	)
+	other := common.ApplyCommandDecorators(
+		func(ctx context.Context, cmd otherCommand) ([]interface{}, error) {
+			return []interface{}{"other"}, nil
+		},
+		idempotent.Command[otherCommand](store, opts),
+	)
+	ctx := idempotency.WithKey(context.Background(), "UserCreated:u1")
+
+	t.Run("replay", func(t *testing.T) {
+		e, err := send(ctx, sendEmailCommand{UserID: "u1"})
+		require.NoError(t, err)
+		require.Equal(t, []interface{}{1}, e)
+
+		e, err = send(ctx, sendEmailCommand{UserID: "u1"})
+		require.NoError(t, err)
+		require.Equal(t, []interface{}{1}, e, "the events of the first execution")
+		require.Equal(t, 1, calls)
+
+		_, err = send(ctx, sendEmailCommand{UserID: "u2"})
+		require.ErrorIs(t, err, idempotency.ErrKeyReused)
+
+		// The commands have their own keys.
+		e, err = other(ctx, otherCommand{UserID: "u2"})
+		require.NoError(t, err)
+		require.Equal(t, []interface{}{"other"}, e)
+	})
+
+	t.Run("no key", func(t *testing.T) {
+		calls = 0
+		for i := 0; i < 2; i++ {
+			_, err := send(context.Background(), sendEmailCommand{UserID: "u1"})
+			require.NoError(t, err)
+		}
+		require.Equal(t, 2, calls)
+	})
+
+	t.Run("failures are retried", func(t *testing.T) {
+		calls = 0
+		ctx := idempotency.WithKey(context.Background(), "UserCreated:u3")
+		for i := 0; i < 2; i++ {
+			_, err := send(ctx, sendEmailCommand{UserID: "u3", Fail: true})
+			require.EqualError(t, err, "mail queue is down")
+		}
+		require.Equal(t, 2, calls)
+	})
+}
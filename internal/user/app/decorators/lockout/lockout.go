@@ -0,0 +1,142 @@
+// Package lockout protects the login commands against the password guessing.
+package lockout
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/dmitrymomot/go-smart-monolith/internal/user/app/common"
+	"github.com/dmitrymomot/go-smart-monolith/internal/user/domain"
+)
+
+type (
+	// Attempt is a login command guarded by the lockout.
+	Attempt interface {
+		// LoginEmail returns the email of the account the login is attempted to, if known.
+		LoginEmail() string
+		// LoginIP returns the IP the login is attempted from, if known.
+		LoginIP() string
+	}
+
+	// Options defines the lockout policies of the accounts and of the IPs.
+	// The IPs are allowed more failures: many users may log in from the same NAT.
+	Options struct {
+		Account domain.LockoutPolicy
+		IP      domain.LockoutPolicy
+	}
+
+	// AccountLockedEvent represents the event body for AccountLocked.
+	// The account is locked even if there is no user with the email,
+	// so the lockout doesn't tell which emails exist.
+	AccountLockedEvent struct {
+		Email       string    `json:"email"`
+		IP          string    `json:"ip"`
+		LockedUntil time.Time `json:"locked_until"`
+	}
+
+	// attemptsRepository represents the repository of the failed login attempts.
+	attemptsRepository interface {
+		UpdateLoginAttempts(ctx context.Context, key string, fn func(a *domain.LoginAttempts)) (domain.LoginAttempts, error)
+		DeleteLoginAttempts(ctx context.Context, key string) error
+	}
+)
+
+// Guard is a decorator that locks the login after too many failed attempts
+// to the same account or from the same IP, for longer with each lock, see domain.LockoutPolicy.
+// The attempt is reserved before the credentials are checked, so the concurrent attempts can't
+// get past the policy: the locked login fails with domain.ErrAccountLocked without checking them.
+// The attempt is refunded unless it fails, and the successful login resets the failed attempts of the account.
+// It's applied to the commands, so all the ports are protected the same way.
+func Guard[Cmd Attempt](repo attemptsRepository, opts Options, now func() time.Time) common.CommandDecorator[Cmd] {
+	return func(next common.CommandHandler[Cmd]) common.CommandHandler[Cmd] {
+		return func(ctx context.Context, cmd Cmd) ([]interface{}, error) {
+			keys := attemptKeys(cmd, opts)
+			for i, k := range keys {
+				var reserved bool
+				if _, err := repo.UpdateLoginAttempts(ctx, k.key, func(a *domain.LoginAttempts) {
+					reserved = a.Reserve(k.policy, now())
+				}); err != nil {
+					refund(ctx, repo, keys[:i])
+					return nil, fmt.Errorf("failed to record login attempt: %w", err)
+				}
+				if !reserved {
+					refund(ctx, repo, keys[:i])
+					return nil, domain.ErrAccountLocked
+				}
+			}
+
+			e, err := next(ctx, cmd)
+			if err == nil {
+				for _, k := range keys {
+					if k.account {
+						// The attempts are forgotten on the best effort basis, they expire anyway.
+						_ = repo.DeleteLoginAttempts(ctx, k.key)
+					} else {
+						refund(ctx, repo, []attemptKey{k})
+					}
+				}
+				return e, nil
+			}
+			if !isFailure(err) {
+				refund(ctx, repo, keys)
+				return e, err
+			}
+
+			for _, k := range keys {
+				var locked bool
+				a, uerr := repo.UpdateLoginAttempts(ctx, k.key, func(a *domain.LoginAttempts) {
+					locked = a.Fail(k.policy, now())
+				})
+				if uerr != nil {
+					return e, errors.Join(err, fmt.Errorf("failed to record login attempt: %w", uerr))
+				}
+				if locked && k.account {
+					e = append(e, AccountLockedEvent{
+						Email:       cmd.LoginEmail(),
+						IP:          cmd.LoginIP(),
+						LockedUntil: a.LockedUntil,
+					})
+				}
+			}
+			return e, err
+		}
+	}
+}
+
+// refund releases the reserved attempts on the best effort basis, they expire anyway.
+func refund(ctx context.Context, repo attemptsRepository, keys []attemptKey) {
+	for _, k := range keys {
+		_, _ = repo.UpdateLoginAttempts(ctx, k.key, func(a *domain.LoginAttempts) {
+			a.Refund()
+		})
+	}
+}
+
+// attemptKey is a login attempts key of the account or of the IP.
+type attemptKey struct {
+	key     string
+	account bool
+	policy  domain.LockoutPolicy
+}
+
+// attemptKeys returns the keys the attempt is tracked by.
+func attemptKeys(cmd Attempt, opts Options) []attemptKey {
+	var keys []attemptKey
+	if email := cmd.LoginEmail(); email != "" {
+		keys = append(keys, attemptKey{key: domain.AccountAttemptsKey(email), account: true, policy: opts.Account})
+	}
+	if ip := cmd.LoginIP(); ip != "" {
+		keys = append(keys, attemptKey{key: domain.IPAttemptsKey(ip), policy: opts.IP})
+	}
+	return keys
+}
+
+// isFailure reports whether the login failed because of the wrong credentials,
+// not because of an unrelated error.
+func isFailure(err error) bool {
+	return errors.Is(err, domain.ErrInvalidCredentials) ||
+		errors.Is(err, domain.ErrInvalidMFACode) ||
+		errors.Is(err, domain.ErrInvalidMFAChallenge)
+}
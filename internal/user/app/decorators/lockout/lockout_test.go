@@ -0,0 +1,176 @@
+package lockout_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dmitrymomot/go-smart-monolith/internal/user/adapters/storage"
+	"github.com/dmitrymomot/go-smart-monolith/internal/user/app/common"
+	"github.com/dmitrymomot/go-smart-monolith/internal/user/app/decorators/lockout"
+	"github.com/dmitrymomot/go-smart-monolith/internal/user/domain"
+	kvstorage "github.com/dmitrymomot/go-smart-monolith/pkg/storage"
+
+	"github.com/stretchr/testify/require"
+)
+
+type loginCommand struct {
+	Email    string
+	IP       string
+	Password string
+}
+
+func (c loginCommand) LoginEmail() string { return c.Email }
+func (c loginCommand) LoginIP() string    { return c.IP }
+
+func TestGuard(t *testing.T) {
+	opts := lockout.Options{
+		Account: domain.LockoutPolicy{MaxFailures: 3, Lockout: time.Minute, MaxLockout: 3 * time.Minute, Window: time.Hour},
+		IP:      domain.LockoutPolicy{MaxFailures: 5, Lockout: time.Minute, MaxLockout: time.Hour, Window: time.Hour},
+	}
+
+	// newLogin returns the guarded login accepting the "password" and the clock to move it.
+	newLogin := func() (common.CommandHandler[loginCommand], *int, func(time.Duration)) {
+		// The attempts expire by the storage TTL, so the clock starts at the real time.
+		now := time.Now()
+		calls := 0
+		handler := common.ApplyCommandDecorators(
+			func(ctx context.Context, cmd loginCommand) ([]interface{}, error) {
+				calls++
+				switch cmd.Password {
+				case "password":
+					return []interface{}{"logged in"}, nil
+				case "error":
+					return nil, errors.New("storage is down")
+				default:
+					return nil, domain.ErrInvalidCredentials
+				}
+			},
+			lockout.Guard[loginCommand](storage.New(kvstorage.New()), opts, func() time.Time { return now }),
+		)
+		return handler, &calls, func(d time.Duration) { now = now.Add(d) }
+	}
+	ctx := context.Background()
+	wrong := loginCommand{Email: "test@mail.dev", IP: "10.0.0.1", Password: "wrong"}
+	right := loginCommand{Email: "Test@mail.dev", IP: "10.0.0.2", Password: "password"}
+
+	t.Run("account lock", func(t *testing.T) {
+		login, calls, advance := newLogin()
+		for i := 0; i < 2; i++ {
+			e, err := login(ctx, wrong)
+			require.ErrorIs(t, err, domain.ErrInvalidCredentials)
+			require.Empty(t, e)
+		}
+		e, err := login(ctx, wrong)
+		require.ErrorIs(t, err, domain.ErrInvalidCredentials)
+		require.Len(t, e, 1)
+		locked := e[0].(lockout.AccountLockedEvent)
+		require.Equal(t, wrong.Email, locked.Email)
+		require.Equal(t, wrong.IP, locked.IP)
+
+		// The credentials are not even checked, whatever the case of the email and the IP.
+		_, err = login(ctx, right)
+		require.ErrorIs(t, err, domain.ErrAccountLocked)
+		require.Equal(t, 3, *calls)
+
+		// The lock expires.
+		advance(time.Minute)
+		e, err = login(ctx, right)
+		require.NoError(t, err)
+		require.Equal(t, []interface{}{"logged in"}, e)
+	})
+
+	t.Run("exponential lock", func(t *testing.T) {
+		login, _, advance := newLogin()
+		for _, lock := range []time.Duration{time.Minute, 2 * time.Minute, 3 * time.Minute} {
+			var e []interface{}
+			for i := 0; i < 3; i++ {
+				e, _ = login(ctx, loginCommand{Email: wrong.Email, Password: "wrong"})
+			}
+			require.Len(t, e, 1)
+
+			advance(lock - time.Second)
+			_, err := login(ctx, right)
+			require.ErrorIs(t, err, domain.ErrAccountLocked, lock)
+			advance(time.Second)
+		}
+	})
+
+	t.Run("success resets the account", func(t *testing.T) {
+		login, _, _ := newLogin()
+		for i := 0; i < 5; i++ {
+			_, err := login(ctx, loginCommand{Email: wrong.Email, Password: "wrong"})
+			require.ErrorIs(t, err, domain.ErrInvalidCredentials)
+			_, err = login(ctx, right)
+			require.NoError(t, err)
+		}
+	})
+
+	t.Run("ip lock", func(t *testing.T) {
+		login, _, _ := newLogin()
+		for _, email := range []string{"a@mail.dev", "b@mail.dev", "c@mail.dev", "d@mail.dev", "e@mail.dev"} {
+			e, err := login(ctx, loginCommand{Email: email, IP: wrong.IP, Password: "wrong"})
+			require.ErrorIs(t, err, domain.ErrInvalidCredentials)
+			require.Empty(t, e, "the accounts are not locked")
+		}
+
+		_, err := login(ctx, loginCommand{Email: "f@mail.dev", IP: wrong.IP, Password: "password"})
+		require.ErrorIs(t, err, domain.ErrAccountLocked)
+		_, err = login(ctx, loginCommand{Email: "f@mail.dev", IP: "10.0.0.3", Password: "password"})
+		require.NoError(t, err, "other IPs are not locked")
+	})
+
+	t.Run("other errors are not failures", func(t *testing.T) {
+		login, _, _ := newLogin()
+		for i := 0; i < 5; i++ {
+			_, err := login(ctx, loginCommand{Email: wrong.Email, IP: wrong.IP, Password: "error"})
+			require.EqualError(t, err, "storage is down")
+		}
+		_, err := login(ctx, right)
+		require.NoError(t, err)
+	})
+
+	t.Run("concurrent attempts are reserved", func(t *testing.T) {
+		var checked atomic.Int32
+		release := make(chan struct{})
+		login := common.ApplyCommandDecorators(
+			func(ctx context.Context, cmd loginCommand) ([]interface{}, error) {
+				checked.Add(1)
+				<-release
+				return nil, domain.ErrInvalidCredentials
+			},
+			lockout.Guard[loginCommand](storage.New(kvstorage.New()), opts, time.Now),
+		)
+
+		// The attempts in progress count, so only MaxFailures of them check the credentials.
+		var wg sync.WaitGroup
+		errs := make(chan error, 10)
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := login(ctx, wrong)
+				errs <- err
+			}()
+		}
+		require.Eventually(t, func() bool { return len(errs) == 7 }, time.Second, time.Millisecond)
+		close(release)
+		wg.Wait()
+		close(errs)
+
+		var locked int
+		for err := range errs {
+			if errors.Is(err, domain.ErrAccountLocked) {
+				locked++
+			}
+		}
+		require.Equal(t, 7, locked)
+		require.EqualValues(t, 3, checked.Load())
+
+		_, err := login(ctx, right)
+		require.ErrorIs(t, err, domain.ErrAccountLocked)
+	})
+}
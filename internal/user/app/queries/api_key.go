@@ -0,0 +1,120 @@
+package queries
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/dmitrymomot/go-smart-monolith/internal/user/domain"
+	"github.com/dmitrymomot/go-smart-monolith/pkg/auth"
+)
+
+// apiKeyTouchInterval is how often the last used time of the API key is recorded,
+// so the key isn't written on every request.
+const apiKeyTouchInterval = time.Minute
+
+type (
+	// ListAPIKeysQuery represents the request body for ListAPIKeys.
+	ListAPIKeysQuery struct {
+		UserID string
+	}
+
+	// APIKey represents an API key in the ListAPIKeys response.
+	// The key itself is never returned after it's created.
+	APIKey struct {
+		ID         string
+		Name       string
+		Hint       string
+		Scopes     []string
+		ExpiresAt  time.Time
+		CreatedAt  time.Time
+		LastUsedAt time.Time
+		RevokedAt  time.Time
+	}
+
+	// AuthenticateAPIKeyQuery represents the request body for AuthenticateAPIKey.
+	AuthenticateAPIKeyQuery struct {
+		Key string
+	}
+
+	// listAPIKeysRepository represents the repository for ListAPIKeys.
+	listAPIKeysRepository interface {
+		ListAPIKeys(ctx context.Context, userID string) ([]domain.APIKey, error)
+	}
+
+	// authenticateAPIKeyRepository represents the repository for AuthenticateAPIKey.
+	authenticateAPIKeyRepository interface {
+		getUserRepository
+		GetAPIKeyByHash(ctx context.Context, hash string) (domain.APIKey, error)
+		TouchAPIKey(ctx context.Context, key domain.APIKey, usedAt time.Time) error
+	}
+)
+
+// OwnerID returns the ID of the user the query reads.
+func (q ListAPIKeysQuery) OwnerID() string { return q.UserID }
+
+// ListAPIKeys lists the API keys of the user, including the revoked and expired ones.
+func ListAPIKeys(repo listAPIKeysRepository) func(ctx context.Context, query ListAPIKeysQuery) ([]APIKey, error) {
+	return func(ctx context.Context, query ListAPIKeysQuery) ([]APIKey, error) {
+		keys, err := repo.ListAPIKeys(ctx, query.UserID)
+		if err != nil {
+			return nil, err
+		}
+
+		res := make([]APIKey, 0, len(keys))
+		for _, k := range keys {
+			scopes := make([]string, 0, len(k.Scopes))
+			for _, s := range k.Scopes {
+				scopes = append(scopes, string(s))
+			}
+			res = append(res, APIKey{
+				ID:         k.ID,
+				Name:       k.Name,
+				Hint:       k.Hint,
+				Scopes:     scopes,
+				ExpiresAt:  k.ExpiresAt,
+				CreatedAt:  k.CreatedAt,
+				LastUsedAt: k.LastUsedAt,
+				RevokedAt:  k.RevokedAt,
+			})
+		}
+		return res, nil
+	}
+}
+
+// AuthenticateAPIKey checks that the API key is active and its owner is an active user,
+// and returns the caller principal. The principal doesn't act as the owner: it has only
+// the key scopes the owner has the permissions for, see domain.APIKey.
+// The last used time of the key is recorded on the best effort basis.
+func AuthenticateAPIKey(repo authenticateAPIKeyRepository, now func() time.Time) func(ctx context.Context, query AuthenticateAPIKeyQuery) (auth.Principal, error) {
+	return func(ctx context.Context, query AuthenticateAPIKeyQuery) (auth.Principal, error) {
+		key, err := repo.GetAPIKeyByHash(ctx, domain.HashAPIKey(query.Key))
+		if err != nil {
+			return auth.Principal{}, err
+		}
+		if err := key.Check(now()); err != nil {
+			return auth.Principal{}, err
+		}
+
+		u, err := repo.GetUserByID(ctx, key.UserID)
+		if err != nil {
+			if errors.Is(err, domain.ErrUserNotFound) {
+				return auth.Principal{}, auth.ErrUnauthenticated
+			}
+			return auth.Principal{}, err
+		}
+		if u.IsDeleted() {
+			return auth.Principal{}, auth.ErrUnauthenticated
+		}
+
+		if now().Sub(key.LastUsedAt) >= apiKeyTouchInterval {
+			_ = repo.TouchAPIKey(ctx, key, now())
+		}
+
+		p := auth.Principal{APIKeyID: key.ID}
+		for _, perm := range key.Permissions(domain.PermissionsOf(u.Roles)) {
+			p.Permissions = append(p.Permissions, string(perm))
+		}
+		return p, nil
+	}
+}
@@ -0,0 +1,103 @@
+package queries_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dmitrymomot/go-smart-monolith/internal/user/app/queries"
+	"github.com/dmitrymomot/go-smart-monolith/internal/user/domain"
+	"github.com/dmitrymomot/go-smart-monolith/pkg/auth"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// mockAuthenticateAPIKeyRepository is a mock of the authenticateAPIKeyRepository interface.
+type mockAuthenticateAPIKeyRepository struct {
+	mockGetUserRepository
+}
+
+// GetAPIKeyByHash is a mock implementation of the GetAPIKeyByHash method.
+func (m *mockAuthenticateAPIKeyRepository) GetAPIKeyByHash(ctx context.Context, hash string) (domain.APIKey, error) {
+	args := m.Called(ctx, hash)
+	return args.Get(0).(domain.APIKey), args.Error(1)
+}
+
+// TouchAPIKey is a mock implementation of the TouchAPIKey method.
+func (m *mockAuthenticateAPIKeyRepository) TouchAPIKey(ctx context.Context, key domain.APIKey, usedAt time.Time) error {
+	args := m.Called(ctx, key, usedAt)
+	return args.Error(0)
+}
+
+func TestAuthenticateAPIKey(t *testing.T) {
+	now := time.Date(2023, 1, 1, 12, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+
+	admin := domain.NewUser("admin@mail.dev", "")
+	admin.Roles = append(admin.Roles, domain.RoleAdmin)
+	key, apiKey, err := domain.NewAPIKey(admin, "ci", []domain.Permission{domain.PermissionReadUsers, domain.PermissionDeleteUsers}, now.Add(time.Hour), now)
+	require.NoError(t, err)
+
+	t.Run("success", func(t *testing.T) {
+		repo := new(mockAuthenticateAPIKeyRepository)
+		repo.On("GetAPIKeyByHash", mock.Anything, apiKey.Hash).Return(apiKey, nil)
+		repo.On("GetUserByID", mock.Anything, admin.ID).Return(admin, nil)
+		repo.On("TouchAPIKey", mock.Anything, apiKey, now).Return(nil)
+
+		p, err := queries.AuthenticateAPIKey(repo, clock)(context.Background(), queries.AuthenticateAPIKeyQuery{Key: key})
+		require.NoError(t, err)
+		// The key doesn't act as its owner.
+		require.Equal(t, auth.Principal{
+			APIKeyID:    apiKey.ID,
+			Permissions: []string{"users:read", "users:delete"},
+		}, p)
+		repo.AssertExpectations(t)
+	})
+
+	t.Run("owner lost the permissions", func(t *testing.T) {
+		user := admin
+		user.Roles = []domain.Role{domain.RoleUser}
+		used := apiKey
+		used.LastUsedAt = now.Add(-time.Second)
+		repo := new(mockAuthenticateAPIKeyRepository)
+		repo.On("GetAPIKeyByHash", mock.Anything, apiKey.Hash).Return(used, nil)
+		repo.On("GetUserByID", mock.Anything, admin.ID).Return(user, nil)
+
+		p, err := queries.AuthenticateAPIKey(repo, clock)(context.Background(), queries.AuthenticateAPIKeyQuery{Key: key})
+		require.NoError(t, err)
+		require.Empty(t, p.Permissions)
+		// The key has been used recently, the last used time is not written again.
+		repo.AssertNotCalled(t, "TouchAPIKey", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("revoked", func(t *testing.T) {
+		revoked := apiKey
+		revoked.Revoke(now)
+		repo := new(mockAuthenticateAPIKeyRepository)
+		repo.On("GetAPIKeyByHash", mock.Anything, apiKey.Hash).Return(revoked, nil)
+
+		_, err := queries.AuthenticateAPIKey(repo, clock)(context.Background(), queries.AuthenticateAPIKeyQuery{Key: key})
+		require.ErrorIs(t, err, domain.ErrAPIKeyRevoked)
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		repo := new(mockAuthenticateAPIKeyRepository)
+		repo.On("GetAPIKeyByHash", mock.Anything, apiKey.Hash).Return(apiKey, nil)
+
+		later := func() time.Time { return apiKey.ExpiresAt }
+		_, err := queries.AuthenticateAPIKey(repo, later)(context.Background(), queries.AuthenticateAPIKeyQuery{Key: key})
+		require.ErrorIs(t, err, domain.ErrAPIKeyExpired)
+	})
+
+	t.Run("deleted owner", func(t *testing.T) {
+		deleted := admin
+		deleted.DeletedAt = now
+		repo := new(mockAuthenticateAPIKeyRepository)
+		repo.On("GetAPIKeyByHash", mock.Anything, apiKey.Hash).Return(apiKey, nil)
+		repo.On("GetUserByID", mock.Anything, admin.ID).Return(deleted, nil)
+
+		_, err := queries.AuthenticateAPIKey(repo, clock)(context.Background(), queries.AuthenticateAPIKeyQuery{Key: key})
+		require.ErrorIs(t, err, auth.ErrUnauthenticated)
+	})
+}
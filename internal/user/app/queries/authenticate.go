@@ -0,0 +1,75 @@
+package queries
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/dmitrymomot/go-smart-monolith/internal/user/domain"
+	"github.com/dmitrymomot/go-smart-monolith/pkg/auth"
+)
+
+type (
+	// AuthenticateQuery represents the request body for Authenticate.
+	// It's built of the verified access token claims.
+	AuthenticateQuery struct {
+		UserID string
+		// SessionID is the server-side session the token belongs to.
+		// It's empty for the tokens issued without a session, e.g. to the services.
+		SessionID string
+		// IssuedAt is when the session the token belongs to was started.
+		IssuedAt time.Time
+	}
+
+	// authenticateRepository represents the repository for Authenticate.
+	authenticateRepository interface {
+		getUserRepository
+		GetSession(ctx context.Context, userID, id string) (domain.Session, error)
+		TouchSession(ctx context.Context, session domain.Session, seenAt time.Time) error
+	}
+)
+
+// Authenticate checks that the verified access token still belongs to an active session
+// of an active user, and returns the caller principal with the user roles.
+// The token signature proves only that it was issued, not that it wasn't revoked since then.
+// The tokens without a session are revoked only with all the user sessions.
+// The last seen time of the session is recorded on the best effort basis.
+// The roles are the stored ones only, see commands.AdminEmails for how the admins are granted.
+func Authenticate(repo authenticateRepository, now func() time.Time) func(ctx context.Context, query AuthenticateQuery) (auth.Principal, error) {
+	return func(ctx context.Context, query AuthenticateQuery) (auth.Principal, error) {
+		u, err := repo.GetUserByID(ctx, query.UserID)
+		if err != nil {
+			if errors.Is(err, domain.ErrUserNotFound) {
+				return auth.Principal{}, auth.ErrUnauthenticated
+			}
+			return auth.Principal{}, err
+		}
+		if u.IsDeleted() {
+			return auth.Principal{}, auth.ErrUnauthenticated
+		}
+		if u.IsSessionRevoked(query.IssuedAt) {
+			return auth.Principal{}, domain.ErrSessionRevoked
+		}
+		if query.SessionID != "" {
+			s, err := repo.GetSession(ctx, u.ID, query.SessionID)
+			if errors.Is(err, domain.ErrSessionNotFound) || (err == nil && !s.IsActive(u, now())) {
+				return auth.Principal{}, domain.ErrSessionRevoked
+			}
+			if err != nil {
+				return auth.Principal{}, err
+			}
+			if now().Sub(s.LastSeenAt) >= sessionTouchInterval {
+				_ = repo.TouchSession(ctx, s, now())
+			}
+		}
+
+		p := auth.Principal{UserID: u.ID, SessionID: query.SessionID}
+		for _, r := range u.Roles {
+			p.Roles = append(p.Roles, string(r))
+		}
+		for _, perm := range domain.PermissionsOf(u.Roles) {
+			p.Permissions = append(p.Permissions, string(perm))
+		}
+		return p, nil
+	}
+}
@@ -0,0 +1,122 @@
+package queries_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dmitrymomot/go-smart-monolith/internal/user/app/queries"
+	"github.com/dmitrymomot/go-smart-monolith/internal/user/domain"
+	"github.com/dmitrymomot/go-smart-monolith/pkg/auth"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// mockAuthenticateRepository is a mock of the authenticateRepository interface.
+type mockAuthenticateRepository struct {
+	mockGetUserRepository
+}
+
+// GetSession is a mock implementation of the GetSession method.
+func (m *mockAuthenticateRepository) GetSession(ctx context.Context, userID, id string) (domain.Session, error) {
+	args := m.Called(ctx, userID, id)
+	return args.Get(0).(domain.Session), args.Error(1)
+}
+
+// TouchSession is a mock implementation of the TouchSession method.
+func (m *mockAuthenticateRepository) TouchSession(ctx context.Context, session domain.Session, seenAt time.Time) error {
+	args := m.Called(ctx, session, seenAt)
+	return args.Error(0)
+}
+
+func TestAuthenticate(t *testing.T) {
+	revokedAt := time.Date(2023, 1, 1, 12, 0, 0, 500, time.UTC)
+	clock := func() time.Time { return revokedAt }
+	user := domain.NewUser("test@mail.dev", "")
+	user.RevokeSessions(revokedAt)
+
+	repo := new(mockAuthenticateRepository)
+	repo.On("GetUserByID", mock.Anything, user.ID).Return(user, nil)
+	repo.On("GetUserByID", mock.Anything, "missing").Return(domain.User{}, domain.ErrUserNotFound)
+	handler := queries.Authenticate(repo, clock)
+
+	// The session started after the revocation, the tokens have seconds precision.
+	p, err := handler(context.Background(), queries.AuthenticateQuery{UserID: user.ID, IssuedAt: revokedAt.Truncate(time.Second)})
+	require.NoError(t, err)
+	require.Equal(t, auth.Principal{UserID: user.ID, Roles: []string{"user"}}, p)
+
+	// The session started before the revocation.
+	_, err = handler(context.Background(), queries.AuthenticateQuery{UserID: user.ID, IssuedAt: revokedAt.Add(-time.Second)})
+	require.ErrorIs(t, err, domain.ErrSessionRevoked)
+
+	// The user doesn't exist anymore.
+	_, err = handler(context.Background(), queries.AuthenticateQuery{UserID: "missing", IssuedAt: revokedAt})
+	require.ErrorIs(t, err, auth.ErrUnauthenticated)
+}
+
+func TestAuthenticate_Roles(t *testing.T) {
+	user := domain.NewUser("admin@mail.dev", "")
+	user.EmailVerified = true
+
+	repo := new(mockAuthenticateRepository)
+	repo.On("GetUserByID", mock.Anything, user.ID).Return(user, nil).Once()
+	handler := queries.Authenticate(repo, time.Now)
+
+	// Only the stored roles are granted, whatever the email.
+	p, err := handler(context.Background(), queries.AuthenticateQuery{UserID: user.ID})
+	require.NoError(t, err)
+	require.Equal(t, []string{"user"}, p.Roles)
+	require.False(t, p.HasPermission(string(domain.PermissionListUsers)))
+
+	user.Roles = append(user.Roles, domain.RoleAdmin)
+	repo.On("GetUserByID", mock.Anything, user.ID).Return(user, nil).Once()
+	p, err = handler(context.Background(), queries.AuthenticateQuery{UserID: user.ID})
+	require.NoError(t, err)
+	require.Equal(t, []string{"user", "admin"}, p.Roles)
+	require.True(t, p.HasPermission(string(domain.PermissionListUsers)))
+}
+
+func TestAuthenticate_Session(t *testing.T) {
+	now := time.Date(2023, 1, 1, 12, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+	user := domain.NewUser("test@mail.dev", "")
+	session := domain.NewSession(user, domain.SessionClient{}, time.Hour, now.Add(-30*time.Second))
+	query := queries.AuthenticateQuery{UserID: user.ID, SessionID: session.ID, IssuedAt: session.CreatedAt}
+
+	t.Run("active", func(t *testing.T) {
+		repo := new(mockAuthenticateRepository)
+		repo.On("GetUserByID", mock.Anything, user.ID).Return(user, nil)
+		repo.On("GetSession", mock.Anything, user.ID, session.ID).Return(session, nil)
+
+		p, err := queries.Authenticate(repo, clock)(context.Background(), query)
+		require.NoError(t, err)
+		require.Equal(t, session.ID, p.SessionID)
+		repo.AssertNotCalled(t, "TouchSession", mock.Anything, mock.Anything, mock.Anything)
+
+		// The last seen time is recorded once a minute.
+		later := now.Add(time.Minute)
+		repo.On("TouchSession", mock.Anything, session, later).Return(nil).Once()
+		_, err = queries.Authenticate(repo, func() time.Time { return later })(context.Background(), query)
+		require.NoError(t, err)
+		repo.AssertExpectations(t)
+	})
+
+	t.Run("revoked", func(t *testing.T) {
+		repo := new(mockAuthenticateRepository)
+		repo.On("GetUserByID", mock.Anything, user.ID).Return(user, nil)
+		repo.On("GetSession", mock.Anything, user.ID, session.ID).Return(domain.Session{}, domain.ErrSessionNotFound)
+
+		_, err := queries.Authenticate(repo, clock)(context.Background(), query)
+		require.ErrorIs(t, err, domain.ErrSessionRevoked)
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		repo := new(mockAuthenticateRepository)
+		repo.On("GetUserByID", mock.Anything, user.ID).Return(user, nil)
+		repo.On("GetSession", mock.Anything, user.ID, session.ID).Return(session, nil)
+
+		_, err := queries.Authenticate(repo, func() time.Time { return session.ExpiresAt })(context.Background(), query)
+		require.ErrorIs(t, err, domain.ErrSessionRevoked)
+	})
+}
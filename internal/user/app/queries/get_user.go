@@ -2,6 +2,7 @@ package queries
 
 import (
 	"context"
+	"time"
 
 	"github.com/dmitrymomot/go-smart-monolith/internal/user/domain"
 )
@@ -14,9 +15,13 @@ type (
 
 	// User represents the response body for GetUser.
 	User struct {
-		ID         string
-		Email      string
-		PlayerName string
+		ID          string
+		Email       string
+		PlayerName  string
+		DisplayName string
+		CreatedAt   time.Time
+		// Version is the user version to detect the concurrent changes, see domain.User.
+		Version int64
 	}
 
 	// getUserRepository represents the repository for GetUser.
@@ -30,6 +35,9 @@ type (
 	}
 )
 
+// OwnerID returns the ID of the user the query reads.
+func (q GetUserQuery) OwnerID() string { return q.ID }
+
 // GetUser gets a user.
 func GetUser(
 	repo getUserRepository,
@@ -40,6 +48,9 @@ func GetUser(
 		if err != nil {
 			return User{}, err
 		}
+		if u.IsDeleted() {
+			return User{}, domain.ErrUserNotFound
+		}
 
 		// Get additional data from the players service.
 		p, err := playersClient.GetPlayer(ctx, u.ID)
@@ -48,9 +59,12 @@ func GetUser(
 		}
 
 		return User{
-			ID:         u.ID,
-			Email:      u.Email,
-			PlayerName: p.PlayerName,
+			ID:          u.ID,
+			Email:       u.Email,
+			PlayerName:  p.PlayerName,
+			DisplayName: u.DisplayName,
+			CreatedAt:   u.CreatedAt,
+			Version:     u.Version,
 		}, nil
 	}
 }
@@ -62,6 +62,7 @@ func TestGetUser_Success(t *testing.T) {
 		ID:         user.ID,
 		Email:      email,
 		PlayerName: pname,
+		CreatedAt:  user.CreatedAt,
 	}, res)
 
 	// Verify mocks.
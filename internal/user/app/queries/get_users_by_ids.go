@@ -0,0 +1,173 @@
+package queries
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/dmitrymomot/go-smart-monolith/internal/user/domain"
+	"github.com/dmitrymomot/go-smart-monolith/pkg/contracts/playerapi"
+)
+
+// MaxUsersPerBatch is the max number of IDs GetUsersByIDs accepts.
+const MaxUsersPerBatch = 100
+
+// playersFanOutLimit is the max number of concurrent players service calls
+// when the players client has no batch API.
+const playersFanOutLimit = 8
+
+var (
+	// ErrNoUserIDs is returned when GetUsersByIDs is called without IDs.
+	ErrNoUserIDs = errors.New("no user IDs")
+	// ErrTooManyUserIDs is returned when GetUsersByIDs is called with too many IDs.
+	ErrTooManyUserIDs = fmt.Errorf("too many user IDs, max %d", MaxUsersPerBatch)
+)
+
+type (
+	// GetUsersByIDsQuery represents the request body for GetUsersByIDs.
+	GetUsersByIDsQuery struct {
+		IDs []string
+	}
+
+	// Users represents the response body for GetUsersByIDs.
+	// A batch query doesn't fail because of a single user:
+	// the users that couldn't be got are reported in Failures.
+	Users struct {
+		Users    []User
+		Failures []UserFailure
+	}
+
+	// UserFailure describes why the user couldn't be got.
+	UserFailure struct {
+		ID  string
+		Err error
+	}
+
+	// getUsersByIDsRepository represents the repository for GetUsersByIDs.
+	getUsersByIDsRepository interface {
+		GetUsersByIDs(ctx context.Context, ids []string) (map[string]domain.User, error)
+	}
+
+	// playersSvcBatchClient is an optional batch API of the players client.
+	playersSvcBatchClient interface {
+		GetPlayers(ctx context.Context, userIDs []string) (map[string]domain.Player, error)
+	}
+)
+
+// GetUsersByIDs gets the users by IDs in the order of the IDs.
+// The users are read from the repository in bulk and enriched with the player names
+// in one call if the players client supports it, or with the bounded concurrent calls otherwise.
+func GetUsersByIDs(
+	repo getUsersByIDsRepository,
+	playersClient playersSvcClient,
+) func(ctx context.Context, query GetUsersByIDsQuery) (Users, error) {
+	return func(ctx context.Context, query GetUsersByIDsQuery) (Users, error) {
+		ids := uniqueIDs(query.IDs)
+		if len(ids) == 0 {
+			return Users{}, ErrNoUserIDs
+		}
+		if len(ids) > MaxUsersPerBatch {
+			return Users{}, ErrTooManyUserIDs
+		}
+
+		found, err := repo.GetUsersByIDs(ctx, ids)
+		if err != nil {
+			return Users{}, err
+		}
+
+		res := Users{}
+		existing := make([]string, 0, len(found))
+		for _, id := range ids {
+			if u, ok := found[id]; ok && !u.IsDeleted() {
+				existing = append(existing, id)
+			} else {
+				res.Failures = append(res.Failures, UserFailure{ID: id, Err: domain.ErrUserNotFound})
+			}
+		}
+
+		// Get additional data from the players service.
+		players, playerErrs := getPlayers(ctx, playersClient, existing)
+
+		for _, id := range existing {
+			if err, ok := playerErrs[id]; ok {
+				res.Failures = append(res.Failures, UserFailure{ID: id, Err: err})
+				continue
+			}
+			u := found[id]
+			res.Users = append(res.Users, User{
+				ID:          u.ID,
+				Email:       u.Email,
+				PlayerName:  players[id].PlayerName,
+				DisplayName: u.DisplayName,
+				CreatedAt:   u.CreatedAt,
+			})
+		}
+
+		return res, nil
+	}
+}
+
+// getPlayers gets the players of the given users and the errors by user ID.
+func getPlayers(ctx context.Context, client playersSvcClient, ids []string) (map[string]domain.Player, map[string]error) {
+	errs := make(map[string]error)
+	if len(ids) == 0 {
+		return nil, errs
+	}
+
+	if bc, ok := client.(playersSvcBatchClient); ok {
+		players, err := bc.GetPlayers(ctx, ids)
+		for _, id := range ids {
+			if err != nil {
+				errs[id] = err
+			} else if _, ok := players[id]; !ok {
+				errs[id] = fmt.Errorf("failed to get player: %w", playerapi.ErrPlayerNotFound)
+			}
+		}
+		return players, errs
+	}
+
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		sem     = make(chan struct{}, playersFanOutLimit)
+		players = make(map[string]domain.Player, len(ids))
+	)
+	for _, id := range ids {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(id string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			p, err := client.GetPlayer(ctx, id)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs[id] = err
+				return
+			}
+			players[id] = p
+		}(id)
+	}
+	wg.Wait()
+
+	return players, errs
+}
+
+// uniqueIDs removes the empty and duplicated IDs keeping the order.
+func uniqueIDs(ids []string) []string {
+	seen := make(map[string]struct{}, len(ids))
+	res := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if _, ok := seen[id]; ok || id == "" {
+			continue
+		}
+		seen[id] = struct{}{}
+		res = append(res, id)
+	}
+	return res
+}
@@ -0,0 +1,115 @@
+package queries_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/dmitrymomot/go-smart-monolith/internal/user/app/queries"
+	"github.com/dmitrymomot/go-smart-monolith/internal/user/domain"
+	"github.com/dmitrymomot/go-smart-monolith/pkg/contracts/playerapi"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// mockGetUsersByIDsRepository is a mock of the getUsersByIDsRepository interface.
+type mockGetUsersByIDsRepository struct {
+	mock.Mock
+}
+
+// GetUsersByIDs provides a mock function with given fields: ids
+func (m *mockGetUsersByIDsRepository) GetUsersByIDs(ctx context.Context, ids []string) (map[string]domain.User, error) {
+	args := m.Called(ctx, ids)
+	return args.Get(0).(map[string]domain.User), args.Error(1)
+}
+
+// mockPlayersSvcBatchClient is a mock of the players client with the batch API.
+type mockPlayersSvcBatchClient struct {
+	mockPlayersSvcClient
+}
+
+// GetPlayers provides a mock function with given fields: userIDs
+func (m *mockPlayersSvcBatchClient) GetPlayers(ctx context.Context, userIDs []string) (map[string]domain.Player, error) {
+	args := m.Called(ctx, userIDs)
+	return args.Get(0).(map[string]domain.Player), args.Error(1)
+}
+
+func TestGetUsersByIDs(t *testing.T) {
+	// Prepare test data.
+	u1 := domain.NewUser("u1@mail.dev", "password")
+	u2 := domain.NewUser("u2@mail.dev", "password")
+	u3 := domain.NewUser("u3@mail.dev", "password")
+	ids := []string{u1.ID, "missing", u2.ID, u3.ID}
+
+	repo := new(mockGetUsersByIDsRepository)
+	repo.On("GetUsersByIDs", mock.Anything, ids).Return(map[string]domain.User{
+		u1.ID: u1,
+		u2.ID: u2,
+		u3.ID: u3,
+	}, nil)
+
+	expected := func(t *testing.T, res queries.Users) {
+		require.Equal(t, []queries.User{
+			{ID: u1.ID, Email: u1.Email, PlayerName: "p1", CreatedAt: u1.CreatedAt},
+			{ID: u3.ID, Email: u3.Email, PlayerName: "p3", CreatedAt: u3.CreatedAt},
+		}, res.Users)
+		require.Len(t, res.Failures, 2)
+		require.Equal(t, "missing", res.Failures[0].ID)
+		require.ErrorIs(t, res.Failures[0].Err, domain.ErrUserNotFound)
+		require.Equal(t, u2.ID, res.Failures[1].ID)
+		require.ErrorIs(t, res.Failures[1].Err, playerapi.ErrPlayerNotFound)
+	}
+
+	t.Run("batched players call", func(t *testing.T) {
+		playersClient := new(mockPlayersSvcBatchClient)
+		playersClient.On("GetPlayers", mock.Anything, []string{u1.ID, u2.ID, u3.ID}).Return(map[string]domain.Player{
+			u1.ID: domain.NewPlayer(u1.ID, "p1"),
+			u3.ID: domain.NewPlayer(u3.ID, "p3"),
+		}, nil)
+
+		res, err := queries.GetUsersByIDs(repo, playersClient)(context.Background(), queries.GetUsersByIDsQuery{
+			IDs: append(ids, u1.ID, ""), // Duplicated and empty IDs are skipped.
+		})
+		require.NoError(t, err)
+		expected(t, res)
+
+		playersClient.AssertExpectations(t)
+		playersClient.AssertNotCalled(t, "GetPlayer", mock.Anything, mock.Anything)
+	})
+
+	t.Run("fan-out players calls", func(t *testing.T) {
+		playersClient := new(mockPlayersSvcClient)
+		playersClient.On("GetPlayer", mock.Anything, u1.ID).Return(domain.NewPlayer(u1.ID, "p1"), nil)
+		playersClient.On("GetPlayer", mock.Anything, u2.ID).Return(domain.Player{}, playerapi.ErrPlayerNotFound)
+		playersClient.On("GetPlayer", mock.Anything, u3.ID).Return(domain.NewPlayer(u3.ID, "p3"), nil)
+
+		res, err := queries.GetUsersByIDs(repo, playersClient)(context.Background(), queries.GetUsersByIDsQuery{IDs: ids})
+		require.NoError(t, err)
+		expected(t, res)
+
+		playersClient.AssertExpectations(t)
+	})
+
+	repo.AssertExpectations(t)
+}
+
+func TestGetUsersByIDs_Errors(t *testing.T) {
+	repo := new(mockGetUsersByIDsRepository)
+	handler := queries.GetUsersByIDs(repo, new(mockPlayersSvcClient))
+
+	_, err := handler(context.Background(), queries.GetUsersByIDsQuery{})
+	require.ErrorIs(t, err, queries.ErrNoUserIDs)
+
+	tooMany := make([]string, queries.MaxUsersPerBatch+1)
+	for i := range tooMany {
+		tooMany[i] = string(rune('a' + i))
+	}
+	_, err = handler(context.Background(), queries.GetUsersByIDsQuery{IDs: tooMany})
+	require.ErrorIs(t, err, queries.ErrTooManyUserIDs)
+
+	// The repository errors fail the whole query.
+	repo.On("GetUsersByIDs", mock.Anything, []string{"1"}).Return(map[string]domain.User(nil), errors.New("storage is down"))
+	_, err = handler(context.Background(), queries.GetUsersByIDsQuery{IDs: []string{"1"}})
+	require.EqualError(t, err, "storage is down")
+}
@@ -0,0 +1,108 @@
+package queries
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/dmitrymomot/go-smart-monolith/internal/user/domain"
+)
+
+// Page size limits for ListUsers.
+const (
+	DefaultPageSize = 20
+	MaxPageSize     = 100
+)
+
+// ErrInvalidTimeRange is returned when the creation time range is empty.
+var ErrInvalidTimeRange = errors.New("created_from must be before created_to")
+
+type (
+	// ListUsersQuery represents the request body for ListUsers.
+	ListUsersQuery struct {
+		// Cursor is the NextCursor of the previous page. Empty means the first page.
+		Cursor string
+		// Limit is the page size. Zero means DefaultPageSize,
+		// values greater than MaxPageSize are capped.
+		Limit       int
+		EmailPrefix string
+		// CreatedFrom and CreatedTo limit the creation time: [from, to).
+		CreatedFrom time.Time
+		CreatedTo   time.Time
+		// Desc lists the newest users first.
+		Desc bool
+	}
+
+	// UsersPage represents the response body for ListUsers.
+	// The users are returned even if the player names couldn't be got,
+	// such users are reported in Failures.
+	UsersPage struct {
+		Users      []User
+		Failures   []UserFailure
+		NextCursor string
+	}
+
+	// listUsersRepository represents the repository for ListUsers.
+	listUsersRepository interface {
+		ListUsers(ctx context.Context, filter domain.ListUsersFilter) ([]domain.User, string, error)
+	}
+)
+
+// ListUsers lists the users page by page, sorted by the creation time.
+func ListUsers(
+	repo listUsersRepository,
+	playersClient playersSvcClient,
+) func(ctx context.Context, query ListUsersQuery) (UsersPage, error) {
+	return func(ctx context.Context, query ListUsersQuery) (UsersPage, error) {
+		if !query.CreatedFrom.IsZero() && !query.CreatedTo.IsZero() && !query.CreatedFrom.Before(query.CreatedTo) {
+			return UsersPage{}, ErrInvalidTimeRange
+		}
+
+		limit := query.Limit
+		if limit <= 0 {
+			limit = DefaultPageSize
+		}
+		if limit > MaxPageSize {
+			limit = MaxPageSize
+		}
+
+		users, next, err := repo.ListUsers(ctx, domain.ListUsersFilter{
+			EmailPrefix: query.EmailPrefix,
+			CreatedFrom: query.CreatedFrom,
+			CreatedTo:   query.CreatedTo,
+			Desc:        query.Desc,
+			Cursor:      query.Cursor,
+			Limit:       limit,
+		})
+		if err != nil {
+			return UsersPage{}, err
+		}
+
+		ids := make([]string, 0, len(users))
+		for _, u := range users {
+			ids = append(ids, u.ID)
+		}
+
+		// Get additional data from the players service.
+		players, playerErrs := getPlayers(ctx, playersClient, ids)
+
+		res := UsersPage{
+			Users:      make([]User, 0, len(users)),
+			NextCursor: next,
+		}
+		for _, u := range users {
+			if err, ok := playerErrs[u.ID]; ok {
+				res.Failures = append(res.Failures, UserFailure{ID: u.ID, Err: err})
+			}
+			res.Users = append(res.Users, User{
+				ID:          u.ID,
+				Email:       u.Email,
+				PlayerName:  players[u.ID].PlayerName,
+				DisplayName: u.DisplayName,
+				CreatedAt:   u.CreatedAt,
+			})
+		}
+
+		return res, nil
+	}
+}
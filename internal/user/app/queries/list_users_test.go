@@ -0,0 +1,81 @@
+package queries_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/dmitrymomot/go-smart-monolith/internal/user/app/queries"
+	"github.com/dmitrymomot/go-smart-monolith/internal/user/domain"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// mockListUsersRepository is a mock of the listUsersRepository interface.
+type mockListUsersRepository struct {
+	mock.Mock
+}
+
+// ListUsers provides a mock function with given fields: filter
+func (m *mockListUsersRepository) ListUsers(ctx context.Context, filter domain.ListUsersFilter) ([]domain.User, string, error) {
+	args := m.Called(ctx, filter)
+	return args.Get(0).([]domain.User), args.String(1), args.Error(2)
+}
+
+func TestListUsers(t *testing.T) {
+	u1 := domain.NewUser("u1@mail.dev", "password")
+	u2 := domain.NewUser("u2@mail.dev", "password")
+	from := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	repo := new(mockListUsersRepository)
+	repo.On("ListUsers", mock.Anything, domain.ListUsersFilter{
+		EmailPrefix: "u",
+		CreatedFrom: from,
+		Desc:        true,
+		Cursor:      "cursor",
+		Limit:       queries.DefaultPageSize,
+	}).Return([]domain.User{u1, u2}, "next", nil)
+
+	playersClient := new(mockPlayersSvcClient)
+	playersClient.On("GetPlayer", mock.Anything, u1.ID).Return(domain.NewPlayer(u1.ID, "p1"), nil)
+	playersClient.On("GetPlayer", mock.Anything, u2.ID).Return(domain.Player{}, errors.New("players service is down"))
+
+	res, err := queries.ListUsers(repo, playersClient)(context.Background(), queries.ListUsersQuery{
+		Cursor:      "cursor",
+		EmailPrefix: "u",
+		CreatedFrom: from,
+		Desc:        true,
+	})
+	require.NoError(t, err)
+	require.Equal(t, "next", res.NextCursor)
+
+	// The users are listed even if the player names couldn't be got.
+	require.Equal(t, []queries.User{
+		{ID: u1.ID, Email: u1.Email, PlayerName: "p1", CreatedAt: u1.CreatedAt},
+		{ID: u2.ID, Email: u2.Email, CreatedAt: u2.CreatedAt},
+	}, res.Users)
+	require.Len(t, res.Failures, 1)
+	require.Equal(t, u2.ID, res.Failures[0].ID)
+
+	repo.AssertExpectations(t)
+	playersClient.AssertExpectations(t)
+}
+
+func TestListUsers_Limit(t *testing.T) {
+	repo := new(mockListUsersRepository)
+	repo.On("ListUsers", mock.Anything, domain.ListUsersFilter{Limit: queries.MaxPageSize}).Return([]domain.User{}, "", nil)
+
+	handler := queries.ListUsers(repo, new(mockPlayersSvcClient))
+
+	// The page size is capped.
+	_, err := handler(context.Background(), queries.ListUsersQuery{Limit: queries.MaxPageSize + 1})
+	require.NoError(t, err)
+	repo.AssertExpectations(t)
+
+	// The creation time range must not be empty.
+	now := time.Now()
+	_, err = handler(context.Background(), queries.ListUsersQuery{CreatedFrom: now, CreatedTo: now})
+	require.ErrorIs(t, err, queries.ErrInvalidTimeRange)
+}
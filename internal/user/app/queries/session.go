@@ -0,0 +1,79 @@
+package queries
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/dmitrymomot/go-smart-monolith/internal/user/domain"
+)
+
+// sessionTouchInterval is how often the last seen time of the session is recorded,
+// so the session isn't written on every request.
+const sessionTouchInterval = time.Minute
+
+type (
+	// ListSessionsQuery represents the request body for ListSessions.
+	ListSessionsQuery struct {
+		UserID string
+		// CurrentSessionID is the session the caller is authenticated with, if any.
+		CurrentSessionID string
+	}
+
+	// Session represents a session in the ListSessions response.
+	Session struct {
+		ID         string
+		Device     string
+		IP         string
+		UserAgent  string
+		CreatedAt  time.Time
+		LastSeenAt time.Time
+		ExpiresAt  time.Time
+		// Current is set for the session of the caller.
+		Current bool
+	}
+
+	// listSessionsRepository represents the repository for ListSessions.
+	listSessionsRepository interface {
+		getUserRepository
+		ListSessions(ctx context.Context, userID string) ([]domain.Session, error)
+	}
+)
+
+// OwnerID returns the ID of the user the query reads.
+func (q ListSessionsQuery) OwnerID() string { return q.UserID }
+
+// ListSessions lists the active sessions of the user, the recently seen first.
+// The expired sessions and the sessions revoked with all the user sessions are not listed,
+// even if the repository still keeps them.
+func ListSessions(repo listSessionsRepository, now func() time.Time) func(ctx context.Context, query ListSessionsQuery) ([]Session, error) {
+	return func(ctx context.Context, query ListSessionsQuery) ([]Session, error) {
+		u, err := repo.GetUserByID(ctx, query.UserID)
+		if err != nil {
+			return nil, err
+		}
+		sessions, err := repo.ListSessions(ctx, query.UserID)
+		if err != nil {
+			return nil, err
+		}
+
+		res := make([]Session, 0, len(sessions))
+		for _, s := range sessions {
+			if !s.IsActive(u, now()) {
+				continue
+			}
+			res = append(res, Session{
+				ID:         s.ID,
+				Device:     s.Device,
+				IP:         s.IP,
+				UserAgent:  s.UserAgent,
+				CreatedAt:  s.CreatedAt,
+				LastSeenAt: s.LastSeenAt,
+				ExpiresAt:  s.ExpiresAt,
+				Current:    s.ID == query.CurrentSessionID,
+			})
+		}
+		sort.SliceStable(res, func(i, j int) bool { return res[i].LastSeenAt.After(res[j].LastSeenAt) })
+		return res, nil
+	}
+}
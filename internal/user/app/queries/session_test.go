@@ -0,0 +1,68 @@
+package queries_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dmitrymomot/go-smart-monolith/internal/user/app/queries"
+	"github.com/dmitrymomot/go-smart-monolith/internal/user/domain"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// mockListSessionsRepository is a mock of the listSessionsRepository interface.
+type mockListSessionsRepository struct {
+	mockGetUserRepository
+}
+
+// ListSessions is a mock implementation of the ListSessions method.
+func (m *mockListSessionsRepository) ListSessions(ctx context.Context, userID string) ([]domain.Session, error) {
+	args := m.Called(ctx, userID)
+	return args.Get(0).([]domain.Session), args.Error(1)
+}
+
+func TestListSessions(t *testing.T) {
+	now := time.Date(2023, 1, 1, 12, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+	user := domain.NewUser("test@mail.dev", "")
+	user.RevokeSessions(now.Add(-time.Hour))
+
+	client := domain.SessionClient{Device: "Chrome on Windows", IP: "127.0.0.1", UserAgent: "Mozilla/5.0"}
+	older := domain.NewSession(user, client, 2*time.Hour, now.Add(-time.Minute))
+	current := domain.NewSession(user, client, 2*time.Hour, now)
+	expired := domain.NewSession(user, client, time.Minute, now.Add(-time.Minute))
+	revoked := domain.NewSession(user, client, 2*time.Hour, now.Add(-2*time.Hour))
+
+	repo := new(mockListSessionsRepository)
+	repo.On("GetUserByID", mock.Anything, user.ID).Return(user, nil)
+	repo.On("ListSessions", mock.Anything, user.ID).Return([]domain.Session{older, expired, current, revoked}, nil)
+
+	res, err := queries.ListSessions(repo, clock)(context.Background(), queries.ListSessionsQuery{
+		UserID:           user.ID,
+		CurrentSessionID: current.ID,
+	})
+	require.NoError(t, err)
+	require.Equal(t, []queries.Session{
+		{
+			ID:         current.ID,
+			Device:     client.Device,
+			IP:         client.IP,
+			UserAgent:  client.UserAgent,
+			CreatedAt:  current.CreatedAt,
+			LastSeenAt: current.LastSeenAt,
+			ExpiresAt:  current.ExpiresAt,
+			Current:    true,
+		},
+		{
+			ID:         older.ID,
+			Device:     client.Device,
+			IP:         client.IP,
+			UserAgent:  client.UserAgent,
+			CreatedAt:  older.CreatedAt,
+			LastSeenAt: older.LastSeenAt,
+			ExpiresAt:  older.ExpiresAt,
+		},
+	}, res)
+}
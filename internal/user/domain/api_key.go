@@ -0,0 +1,160 @@
+package domain
+
+import (
+	"errors"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+// API key constraints.
+const (
+	// APIKeyPrefix is the prefix of the API keys, so they are told apart from the access tokens
+	// and found by the secret scanners.
+	APIKeyPrefix = "sk_"
+	// MaxAPIKeyNameLength is the max length of the API key name.
+	MaxAPIKeyNameLength = 64
+	// apiKeyHintLength is the number of the key characters after the prefix kept to tell the keys apart.
+	apiKeyHintLength = 6
+)
+
+var (
+	// ErrAPIKeyNotFound is returned when the user has no API key with the ID.
+	ErrAPIKeyNotFound = errors.New("api key not found")
+	// ErrInvalidAPIKey is returned when the API key doesn't exist or has been rotated.
+	ErrInvalidAPIKey = errors.New("invalid api key")
+	// ErrAPIKeyExpired is returned when the API key is expired.
+	ErrAPIKeyExpired = errors.New("api key expired")
+	// ErrAPIKeyRevoked is returned when the API key is revoked.
+	ErrAPIKeyRevoked = errors.New("api key revoked")
+	// ErrInvalidAPIKeyName is returned when the API key name is empty or too long.
+	ErrInvalidAPIKeyName = errors.New("invalid api key name")
+	// ErrInvalidAPIKeyScopes is returned when the API key has no scopes or an unknown one.
+	ErrInvalidAPIKeyScopes = errors.New("invalid api key scopes")
+)
+
+// APIKey is a long-lived key of the automated clients, e.g. CI jobs and partner integrations.
+// It's owned by a user, but it doesn't act as the user: its callers get only the key scopes
+// the owner has the permissions for. Only the key hash is stored, the same as VerificationToken.
+type APIKey struct {
+	ID     string `json:"id"`
+	UserID string `json:"user_id"`
+	Name   string `json:"name"`
+	// Hint is the beginning of the key to tell the keys apart, e.g. "sk_AbCdEf".
+	Hint   string       `json:"hint"`
+	Hash   string       `json:"hash"`
+	Scopes []Permission `json:"scopes"`
+	// ExpiresAt is when the key stops working. Zero means the key never expires.
+	ExpiresAt  time.Time `json:"expires_at"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	// RevokedAt is set when the key is revoked. Zero means the key is active.
+	RevokedAt time.Time `json:"revoked_at"`
+}
+
+// NewAPIKey issues a new API key of the user with the scopes.
+// It returns the key to be shown to the user once and its record to be stored.
+func NewAPIKey(user User, name string, scopes []Permission, expiresAt, now time.Time) (string, APIKey, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || utf8.RuneCountInString(name) > MaxAPIKeyNameLength {
+		return "", APIKey{}, ErrInvalidAPIKeyName
+	}
+	if err := ValidateScopes(scopes); err != nil {
+		return "", APIKey{}, err
+	}
+
+	k := APIKey{
+		ID:        uuid.New().String(),
+		UserID:    user.ID,
+		Name:      name,
+		Scopes:    scopes,
+		ExpiresAt: expiresAt.UTC(),
+		CreatedAt: now.UTC(),
+	}
+	key, err := k.Rotate()
+	if err != nil {
+		return "", APIKey{}, err
+	}
+	return key, k, nil
+}
+
+// HashAPIKey returns the hash the key is stored by.
+func HashAPIKey(key string) string {
+	return hashOneTimeToken(key)
+}
+
+// IsAPIKey reports whether the bearer token looks like an API key, not an access token.
+func IsAPIKey(token string) bool {
+	return strings.HasPrefix(token, APIKeyPrefix)
+}
+
+// ValidateScopes checks that the scopes are not empty and all of them are known permissions.
+func ValidateScopes(scopes []Permission) error {
+	if len(scopes) == 0 {
+		return ErrInvalidAPIKeyScopes
+	}
+	for _, s := range scopes {
+		if !s.IsValid() {
+			return ErrInvalidAPIKeyScopes
+		}
+	}
+	return nil
+}
+
+// Rotate replaces the key with a new one keeping the scopes and the expiration,
+// and returns the new key to be shown to the user once. The previous key stops working.
+func (k *APIKey) Rotate() (string, error) {
+	secret, _, err := newOneTimeToken()
+	if err != nil {
+		return "", err
+	}
+	key := APIKeyPrefix + secret
+	k.Hash = HashAPIKey(key)
+	k.Hint = key[:len(APIKeyPrefix)+apiKeyHintLength]
+	return key, nil
+}
+
+// Revoke revokes the key, so it stops working.
+func (k *APIKey) Revoke(now time.Time) {
+	if !k.IsRevoked() {
+		k.RevokedAt = now.UTC()
+	}
+}
+
+// IsRevoked reports whether the key is revoked.
+func (k APIKey) IsRevoked() bool {
+	return !k.RevokedAt.IsZero()
+}
+
+// IsExpired reports whether the key is expired at the given time.
+func (k APIKey) IsExpired(now time.Time) bool {
+	return !k.ExpiresAt.IsZero() && !now.Before(k.ExpiresAt)
+}
+
+// Check returns an error if the key can't be used at the given time.
+func (k APIKey) Check(now time.Time) error {
+	switch {
+	case k.IsRevoked():
+		return ErrAPIKeyRevoked
+	case k.IsExpired(now):
+		return ErrAPIKeyExpired
+	}
+	return nil
+}
+
+// Permissions returns the key scopes the owner has the permissions for,
+// so the key can't do more than its owner can now.
+func (k APIKey) Permissions(granted []Permission) []Permission {
+	var res []Permission
+	for _, s := range k.Scopes {
+		for _, p := range granted {
+			if s == p {
+				res = append(res, s)
+				break
+			}
+		}
+	}
+	return res
+}
@@ -0,0 +1,99 @@
+package domain
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	// ErrUnknownIdentityProvider is returned when the identity provider is not configured.
+	ErrUnknownIdentityProvider = errors.New("unknown identity provider")
+	// ErrInvalidOIDCState is returned when the OIDC login state doesn't exist,
+	// has been already used or was issued for another provider.
+	ErrInvalidOIDCState = errors.New("invalid oidc login state")
+	// ErrOIDCStateExpired is returned when the OIDC login took too long.
+	ErrOIDCStateExpired = errors.New("oidc login state expired")
+	// ErrIdentityEmailNotVerified is returned when the identity provider doesn't vouch for the email,
+	// so the new user can't be created with it.
+	ErrIdentityEmailNotVerified = errors.New("identity email is not verified")
+	// ErrIdentityTaken is returned when the provider account is linked to another user.
+	ErrIdentityTaken = errors.New("identity is linked to another user")
+)
+
+// Identity links the user to its account at an external identity provider.
+// The subject is the account ID, unique and never reassigned within the provider.
+type Identity struct {
+	Provider string    `json:"provider"`
+	Subject  string    `json:"subject"`
+	LinkedAt time.Time `json:"linked_at"`
+}
+
+// OIDCLoginState is the pending login at an OpenID Connect provider.
+// The state is sent to the provider and comes back with the callback,
+// only its hash is stored, the same as VerificationToken.
+// The nonce and the PKCE code verifier bind the provider response to this login.
+type OIDCLoginState struct {
+	Hash         string    `json:"hash"`
+	Provider     string    `json:"provider"`
+	Nonce        string    `json:"nonce"`
+	CodeVerifier string    `json:"code_verifier"`
+	ExpiresAt    time.Time `json:"expires_at"`
+}
+
+// NewOIDCLoginState starts a new login at the provider valid for ttl.
+// It returns the state to be sent to the provider and its record to be stored.
+func NewOIDCLoginState(provider string, ttl time.Duration, now time.Time) (string, OIDCLoginState, error) {
+	state, hash, err := newOneTimeToken()
+	if err != nil {
+		return "", OIDCLoginState{}, err
+	}
+	nonce, _, err := newOneTimeToken()
+	if err != nil {
+		return "", OIDCLoginState{}, err
+	}
+	// The token is 43 URL-safe characters: a valid PKCE code verifier.
+	verifier, _, err := newOneTimeToken()
+	if err != nil {
+		return "", OIDCLoginState{}, err
+	}
+
+	return state, OIDCLoginState{
+		Hash:         hash,
+		Provider:     provider,
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		ExpiresAt:    now.Add(ttl).UTC(),
+	}, nil
+}
+
+// HashOIDCState returns the hash the state is stored by.
+func HashOIDCState(state string) string {
+	return hashOneTimeToken(state)
+}
+
+// IsExpired reports whether the login state is expired at the given time.
+func (s OIDCLoginState) IsExpired(now time.Time) bool {
+	return !now.Before(s.ExpiresAt)
+}
+
+// HasIdentity reports whether the user is linked to the provider account.
+func (u User) HasIdentity(provider, subject string) bool {
+	for _, id := range u.Identities {
+		if id.Provider == provider && id.Subject == subject {
+			return true
+		}
+	}
+	return false
+}
+
+// LinkIdentity links the user to the provider account, if it's not linked yet.
+func (u *User) LinkIdentity(provider, subject string, now time.Time) {
+	if u.HasIdentity(provider, subject) {
+		return
+	}
+	u.Identities = append(u.Identities, Identity{
+		Provider: provider,
+		Subject:  subject,
+		LinkedAt: now.UTC(),
+	})
+}
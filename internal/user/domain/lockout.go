@@ -0,0 +1,116 @@
+package domain
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrAccountLocked is returned when the login is temporarily locked after too many failed attempts,
+// for the account or for the IP the attempts come from.
+var ErrAccountLocked = errors.New("too many failed login attempts, try again later")
+
+// Login attempts key prefixes, see AccountAttemptsKey and IPAttemptsKey.
+const (
+	accountAttemptsKeyPrefix = "account:"
+	ipAttemptsKeyPrefix      = "ip:"
+)
+
+// LockoutPolicy defines when the login is locked after the failed attempts and for how long.
+type LockoutPolicy struct {
+	// MaxFailures is the number of the failed attempts in a row the login is locked after.
+	MaxFailures int
+	// Lockout is how long the first lock lasts, each next lock lasts twice as long.
+	Lockout time.Duration
+	// MaxLockout is the max lock duration.
+	MaxLockout time.Duration
+	// Window is how long the failed attempts and the locks are remembered after the last one.
+	Window time.Duration
+}
+
+// LoginAttempts tracks the failed login attempts of an account or an IP, see LockoutPolicy.
+type LoginAttempts struct {
+	Key string `json:"key"`
+	// Failures is the number of the failed attempts since the last lock.
+	Failures int `json:"failures"`
+	// Locks is the number of the locks in the window, the next lock is longer with each one.
+	Locks       int       `json:"locks"`
+	LockedUntil time.Time `json:"locked_until"`
+	// ExpiresAt is when the attempts are forgotten.
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// AccountAttemptsKey returns the login attempts key of the account with the email.
+// The emails differing only in case share the key, so the lock can't be bypassed by the case.
+func AccountAttemptsKey(email string) string {
+	return accountAttemptsKeyPrefix + NormalizeEmail(email)
+}
+
+// IPAttemptsKey returns the login attempts key of the IP.
+func IPAttemptsKey(ip string) string {
+	return ipAttemptsKeyPrefix + ip
+}
+
+// IsLocked reports whether the login is locked at the given time.
+func (a LoginAttempts) IsLocked(now time.Time) bool {
+	return now.Before(a.LockedUntil)
+}
+
+// Reserve records an attempt before its credentials are checked, so the concurrent attempts
+// can't get past the policy. It reports false if the login is locked or MaxFailures attempts
+// have already failed or are in progress, unless MaxFailures is zero. The reserved attempt is then either failed, see Fail,
+// or refunded, see Refund.
+func (a *LoginAttempts) Reserve(policy LockoutPolicy, now time.Time) bool {
+	if !a.ExpiresAt.IsZero() && !now.Before(a.ExpiresAt) {
+		*a = LoginAttempts{Key: a.Key}
+	}
+	if a.IsLocked(now) || (policy.MaxFailures > 0 && a.Failures >= policy.MaxFailures) {
+		return false
+	}
+
+	a.Failures++
+	a.remember(policy, now)
+	return true
+}
+
+// Fail records that the reserved attempt has failed and locks the login if there were too many of them.
+// It reports whether the login has been locked by this attempt.
+func (a *LoginAttempts) Fail(policy LockoutPolicy, now time.Time) bool {
+	locked := a.Failures >= policy.MaxFailures
+	if locked {
+		a.LockedUntil = now.Add(policy.lockout(a.Locks)).UTC()
+		a.Locks++
+		a.Failures = 0
+	}
+	a.remember(policy, now)
+	return locked
+}
+
+// Refund releases the reserved attempt that hasn't failed.
+func (a *LoginAttempts) Refund() {
+	if a.Failures > 0 {
+		a.Failures--
+	}
+}
+
+// remember extends the attempts expiration: they are remembered for the policy window
+// after the last attempt or after the lock.
+func (a *LoginAttempts) remember(policy LockoutPolicy, now time.Time) {
+	forgetFrom := now
+	if a.LockedUntil.After(now) {
+		forgetFrom = a.LockedUntil
+	}
+	a.ExpiresAt = forgetFrom.Add(policy.Window).UTC()
+}
+
+// lockout returns the duration of the lock after the given number of the previous ones:
+// it doubles with each lock up to MaxLockout.
+func (p LockoutPolicy) lockout(locks int) time.Duration {
+	d := p.Lockout
+	for i := 0; i < locks && d < p.MaxLockout; i++ {
+		d *= 2
+	}
+	if d > p.MaxLockout {
+		d = p.MaxLockout
+	}
+	return d
+}
@@ -0,0 +1,214 @@
+package domain
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base32"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/dmitrymomot/go-smart-monolith/pkg/totp"
+)
+
+// MFA constraints.
+const (
+	// RecoveryCodesCount is the number of the recovery codes generated at once.
+	RecoveryCodesCount = 10
+	// MaxMFAChallengeAttempts is the number of the wrong codes after which the challenge is revoked,
+	// so the login has to be started over with the password.
+	MaxMFAChallengeAttempts = 5
+	// totpSkew is the number of the time steps before and after the current one the codes are accepted for.
+	totpSkew = 1
+	// recoveryCodeSize is the number of random bytes of a recovery code: 80 bits.
+	recoveryCodeSize = 10
+)
+
+var (
+	// ErrInvalidCredentials is returned when the email or the password is wrong.
+	// It doesn't tell which one, so the callers can't find out which emails exist.
+	ErrInvalidCredentials = errors.New("invalid email or password")
+	// ErrMFAAlreadyEnabled is returned when enrolling the user with MFA enabled.
+	ErrMFAAlreadyEnabled = errors.New("mfa is already enabled")
+	// ErrMFANotEnabled is returned when disabling MFA or regenerating the recovery codes of the user without MFA.
+	ErrMFANotEnabled = errors.New("mfa is not enabled")
+	// ErrMFANotEnrolled is returned when confirming MFA before the enrollment.
+	ErrMFANotEnrolled = errors.New("mfa enrollment is not started")
+	// ErrInvalidMFACode is returned when the TOTP or recovery code is wrong or already used.
+	ErrInvalidMFACode = errors.New("invalid mfa code")
+	// ErrInvalidMFAChallenge is returned when the login challenge doesn't exist or has been already used.
+	ErrInvalidMFAChallenge = errors.New("invalid mfa challenge")
+	// ErrMFAChallengeExpired is returned when the login challenge is expired.
+	ErrMFAChallengeExpired = errors.New("mfa challenge expired")
+)
+
+// recoveryCodeEncoding is the encoding of the recovery codes: lowercase base32 without the padding.
+var recoveryCodeEncoding = base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567").WithPadding(base32.NoPadding)
+
+// MFA holds the user two-factor authentication settings.
+type MFA struct {
+	Enabled bool `json:"enabled"`
+	// TOTPSecret is the secret of the confirmed authenticator app.
+	TOTPSecret string `json:"totp_secret"`
+	// PendingTOTPSecret is the secret of the enrollment to be confirmed with a code.
+	PendingTOTPSecret string `json:"pending_totp_secret"`
+	// LastTOTPStep is the time step of the last accepted code, the codes can't be reused.
+	LastTOTPStep int64 `json:"last_totp_step"`
+	// RecoveryCodes are the hashes of the unused recovery codes.
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// MFAChallenge is the second step of the login of the user with MFA enabled.
+// Its token is returned after the password is checked and exchanged for the access token
+// with a TOTP or recovery code. Only the token hash is stored, the same as VerificationToken.
+type MFAChallenge struct {
+	Hash      string    `json:"hash"`
+	UserID    string    `json:"user_id"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Attempts  int       `json:"attempts"`
+}
+
+// NewMFAChallenge issues a new login challenge of the user valid for ttl.
+// It returns the token to be sent to the user and its record to be stored.
+func NewMFAChallenge(user User, ttl time.Duration, now time.Time) (string, MFAChallenge, error) {
+	token, hash, err := newOneTimeToken()
+	if err != nil {
+		return "", MFAChallenge{}, err
+	}
+
+	return token, MFAChallenge{
+		Hash:      hash,
+		UserID:    user.ID,
+		ExpiresAt: now.Add(ttl).UTC(),
+	}, nil
+}
+
+// HashMFAChallengeToken returns the hash the challenge is stored by.
+func HashMFAChallengeToken(token string) string {
+	return hashOneTimeToken(token)
+}
+
+// IsExpired reports whether the challenge is expired at the given time.
+func (c MFAChallenge) IsExpired(now time.Time) bool {
+	return !now.Before(c.ExpiresAt)
+}
+
+// StartMFAEnrollment generates a new TOTP secret to be added to the authenticator app.
+// MFA is enabled once the secret is confirmed with a code, see ConfirmMFA.
+func (u *User) StartMFAEnrollment() (string, error) {
+	if u.MFA.Enabled {
+		return "", ErrMFAAlreadyEnabled
+	}
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return "", err
+	}
+	u.MFA.PendingTOTPSecret = secret
+	return secret, nil
+}
+
+// ConfirmMFA enables MFA if the code matches the pending secret,
+// and returns the recovery codes to be shown to the user once.
+func (u *User) ConfirmMFA(code string, now time.Time) ([]string, error) {
+	if u.MFA.Enabled {
+		return nil, ErrMFAAlreadyEnabled
+	}
+	if u.MFA.PendingTOTPSecret == "" {
+		return nil, ErrMFANotEnrolled
+	}
+	step, ok := totp.Validate(u.MFA.PendingTOTPSecret, code, now, totpSkew)
+	if !ok {
+		return nil, ErrInvalidMFACode
+	}
+
+	codes, err := u.regenerateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	u.MFA.Enabled = true
+	u.MFA.TOTPSecret = u.MFA.PendingTOTPSecret
+	u.MFA.PendingTOTPSecret = ""
+	u.MFA.LastTOTPStep = step
+	return codes, nil
+}
+
+// DisableMFA disables MFA if the TOTP or recovery code is valid.
+func (u *User) DisableMFA(code string, now time.Time) error {
+	if !u.MFA.Enabled {
+		return ErrMFANotEnabled
+	}
+	if err := u.VerifyMFACode(code, now); err != nil {
+		return err
+	}
+	u.MFA = MFA{}
+	return nil
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes if the TOTP code is valid,
+// and returns the new codes to be shown to the user once.
+// The recovery code is not accepted: the user must still have the authenticator app.
+func (u *User) RegenerateRecoveryCodes(code string, now time.Time) ([]string, error) {
+	if !u.MFA.Enabled {
+		return nil, ErrMFANotEnabled
+	}
+	if err := u.verifyTOTP(code, now); err != nil {
+		return nil, err
+	}
+	return u.regenerateRecoveryCodes()
+}
+
+// VerifyMFACode verifies the second factor: a TOTP code or a recovery code.
+// Each code is accepted only once, the used recovery code is removed.
+func (u *User) VerifyMFACode(code string, now time.Time) error {
+	if !u.MFA.Enabled {
+		return ErrMFANotEnabled
+	}
+	code = strings.TrimSpace(code)
+	if len(code) == totp.Digits {
+		return u.verifyTOTP(code, now)
+	}
+	return u.useRecoveryCode(code)
+}
+
+func (u *User) verifyTOTP(code string, now time.Time) error {
+	step, ok := totp.Validate(u.MFA.TOTPSecret, code, now, totpSkew)
+	if !ok || step <= u.MFA.LastTOTPStep {
+		return ErrInvalidMFACode
+	}
+	u.MFA.LastTOTPStep = step
+	return nil
+}
+
+func (u *User) useRecoveryCode(code string) error {
+	hash := hashOneTimeToken(normalizeRecoveryCode(code))
+	for i, h := range u.MFA.RecoveryCodes {
+		if subtle.ConstantTimeCompare([]byte(h), []byte(hash)) == 1 {
+			u.MFA.RecoveryCodes = append(u.MFA.RecoveryCodes[:i:i], u.MFA.RecoveryCodes[i+1:]...)
+			return nil
+		}
+	}
+	return ErrInvalidMFACode
+}
+
+func (u *User) regenerateRecoveryCodes() ([]string, error) {
+	codes := make([]string, 0, RecoveryCodesCount)
+	hashes := make([]string, 0, RecoveryCodesCount)
+	for i := 0; i < RecoveryCodesCount; i++ {
+		b := make([]byte, recoveryCodeSize)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		// Formatted as "xxxxxxxx-xxxxxxxx" to be easier to type.
+		s := recoveryCodeEncoding.EncodeToString(b)
+		codes = append(codes, s[:len(s)/2]+"-"+s[len(s)/2:])
+		hashes = append(hashes, hashOneTimeToken(s))
+	}
+	u.MFA.RecoveryCodes = hashes
+	return codes, nil
+}
+
+// normalizeRecoveryCode removes the formatting the user may have typed the code with.
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
@@ -0,0 +1,63 @@
+package domain
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	// ErrInvalidPasswordResetToken is returned when the password reset token doesn't exist
+	// or has been already used.
+	ErrInvalidPasswordResetToken = errors.New("invalid password reset token")
+	// ErrPasswordResetTokenExpired is returned when the password reset token is expired.
+	ErrPasswordResetTokenExpired = errors.New("password reset token expired")
+	// ErrSessionRevoked is returned when the access token was issued before
+	// the user sessions were revoked, e.g. by the password reset.
+	ErrSessionRevoked = errors.New("session revoked")
+)
+
+// PasswordResetToken is an issued password reset token.
+// Only the token hash is stored, the same as VerificationToken.
+type PasswordResetToken struct {
+	Hash      string    `json:"hash"`
+	UserID    string    `json:"user_id"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// NewPasswordResetToken issues a new password reset token of the user valid for ttl.
+// It returns the token to be sent to the user and its record to be stored.
+func NewPasswordResetToken(user User, ttl time.Duration, now time.Time) (string, PasswordResetToken, error) {
+	token, hash, err := newOneTimeToken()
+	if err != nil {
+		return "", PasswordResetToken{}, err
+	}
+
+	return token, PasswordResetToken{
+		Hash:      hash,
+		UserID:    user.ID,
+		ExpiresAt: now.Add(ttl).UTC(),
+	}, nil
+}
+
+// HashPasswordResetToken returns the hash the token is stored by.
+func HashPasswordResetToken(token string) string {
+	return hashOneTimeToken(token)
+}
+
+// IsExpired reports whether the token is expired at the given time.
+func (t PasswordResetToken) IsExpired(now time.Time) bool {
+	return !now.Before(t.ExpiresAt)
+}
+
+// RevokeSessions revokes all the user sessions started before now,
+// so the stolen access tokens can't be used anymore.
+func (u *User) RevokeSessions(now time.Time) {
+	u.SessionsRevokedAt = now.UTC()
+}
+
+// IsSessionRevoked reports whether the session started at the given time is revoked.
+// The access tokens have the seconds precision, so the revocation time is truncated
+// to seconds: the sessions started within the same second are not revoked.
+func (u User) IsSessionRevoked(startedAt time.Time) bool {
+	return startedAt.Before(u.SessionsRevokedAt.Truncate(time.Second))
+}
@@ -0,0 +1,95 @@
+package domain
+
+import "sort"
+
+// Role is a named set of permissions granted to a user.
+type Role string
+
+// Supported roles.
+const (
+	// RoleUser is the default role of the registered users.
+	// It grants no permissions: the users manage their own resources, see the ownership rules.
+	RoleUser Role = "user"
+	// RoleAdmin manages all the users.
+	RoleAdmin Role = "admin"
+	// RoleService is the role of the trusted internal services calling the user service.
+	RoleService Role = "service"
+)
+
+// Permission allows the caller to perform an action on any user, not only its own.
+type Permission string
+
+// Supported permissions.
+const (
+	// PermissionReadUsers allows to get any user.
+	PermissionReadUsers Permission = "users:read"
+	// PermissionListUsers allows to list all the users.
+	PermissionListUsers Permission = "users:list"
+	// PermissionDeleteUsers allows to delete and restore any user.
+	PermissionDeleteUsers Permission = "users:delete"
+	// PermissionRevokeSessions allows to revoke all the sessions of any user, e.g. by the support staff.
+	PermissionRevokeSessions Permission = "sessions:revoke"
+	// PermissionUnlockUsers allows to unlock the login of any user locked after the failed attempts.
+	PermissionUnlockUsers Permission = "users:unlock"
+)
+
+// rolePermissions maps the roles to the permissions they grant.
+var rolePermissions = map[Role][]Permission{
+	RoleUser:    nil,
+	RoleAdmin:   {PermissionReadUsers, PermissionListUsers, PermissionDeleteUsers, PermissionRevokeSessions, PermissionUnlockUsers},
+	RoleService: {PermissionReadUsers},
+}
+
+// Permissions returns the permissions the role grants.
+// Unknown roles grant no permissions.
+func (r Role) Permissions() []Permission {
+	return rolePermissions[r]
+}
+
+// PermissionsOf returns the sorted set of the permissions the roles grant together.
+func PermissionsOf(roles []Role) []Permission {
+	set := make(map[Permission]struct{})
+	for _, r := range roles {
+		for _, p := range r.Permissions() {
+			set[p] = struct{}{}
+		}
+	}
+
+	res := make([]Permission, 0, len(set))
+	for p := range set {
+		res = append(res, p)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i] < res[j] })
+	return res
+}
+
+// IsValid reports whether the permission is granted by any role.
+func (p Permission) IsValid() bool {
+	for _, perms := range rolePermissions {
+		for _, perm := range perms {
+			if perm == p {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// HasRole reports whether the user has the role.
+func (u User) HasRole(role Role) bool {
+	for _, r := range u.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// GrantRole adds the role to the user, it reports whether the user didn't have it.
+func (u *User) GrantRole(role Role) bool {
+	if u.HasRole(role) {
+		return false
+	}
+	u.Roles = append(u.Roles[:len(u.Roles):len(u.Roles)], role)
+	return true
+}
@@ -0,0 +1,70 @@
+package domain
+
+import (
+	"errors"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+// maxUserAgentLength is the max length of the stored user agent, the longer ones are truncated.
+const maxUserAgentLength = 512
+
+// ErrSessionNotFound is returned when the user has no active session with the ID.
+var ErrSessionNotFound = errors.New("session not found")
+
+// SessionClient describes the client the user logged in from.
+// It's provided by the transport layer, e.g. from the HTTP request headers.
+type SessionClient struct {
+	// Device is a human readable name of the device, e.g. "Chrome on Windows".
+	Device    string `json:"device"`
+	IP        string `json:"ip"`
+	UserAgent string `json:"user_agent"`
+}
+
+// Session is a server-side login session of the user.
+// The access tokens issued by the login carry the session ID, and stop working
+// as soon as the session is revoked, see RevokeSessions for revoking all of them at once.
+type Session struct {
+	ID     string `json:"id"`
+	UserID string `json:"user_id"`
+	SessionClient
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	// ExpiresAt is when the access token of the session expires, the session is useless after that.
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// NewSession starts a new session of the user from the client, valid for ttl.
+func NewSession(user User, client SessionClient, ttl time.Duration, now time.Time) Session {
+	client.UserAgent = truncate(client.UserAgent, maxUserAgentLength)
+	client.Device = truncate(client.Device, maxUserAgentLength)
+	return Session{
+		ID:            uuid.New().String(),
+		UserID:        user.ID,
+		SessionClient: client,
+		CreatedAt:     now.UTC(),
+		LastSeenAt:    now.UTC(),
+		ExpiresAt:     now.Add(ttl).UTC(),
+	}
+}
+
+// IsExpired reports whether the session is expired at the given time.
+func (s Session) IsExpired(now time.Time) bool {
+	return !now.Before(s.ExpiresAt)
+}
+
+// IsActive reports whether the session of the user is neither expired
+// nor revoked with all the user sessions at the given time.
+func (s Session) IsActive(user User, now time.Time) bool {
+	return !s.IsExpired(now) && !user.IsSessionRevoked(s.CreatedAt)
+}
+
+// truncate cuts s to at most n runes.
+func truncate(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n])
+}
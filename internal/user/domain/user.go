@@ -1,18 +1,159 @@
 package domain
 
-import "github.com/google/uuid"
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Profile constraints.
+const (
+	MinPasswordLength    = 8
+	MaxDisplayNameLength = 64
+)
+
+var (
+	// ErrUserNotFound is returned when the user doesn't exist.
+	ErrUserNotFound = errors.New("user not found")
+	// ErrInvalidCursor is returned when the list cursor is malformed
+	// or doesn't match the list parameters.
+	ErrInvalidCursor = errors.New("invalid cursor")
+	// ErrEmailTaken is returned when the email belongs to another user.
+	ErrEmailTaken = errors.New("email is already taken")
+	// ErrInvalidEmail is returned when the email is malformed.
+	ErrInvalidEmail = errors.New("invalid email")
+	// ErrInvalidPassword is returned when the password doesn't match.
+	ErrInvalidPassword = errors.New("invalid password")
+	// ErrWeakPassword is returned when the new password is too short.
+	ErrWeakPassword = errors.New("password is too short")
+	// ErrInvalidDisplayName is returned when the display name is too long.
+	ErrInvalidDisplayName = errors.New("display name is too long")
+	// ErrConcurrentModification is returned when the user was changed
+	// since it had been read, so the change would overwrite another one.
+	ErrConcurrentModification = errors.New("user was modified concurrently")
+)
 
 type User struct {
-	ID           string `json:"id"`
-	Email        string `json:"email"`
-	PasswordHash string `json:"password"`
+	ID            string    `json:"id"`
+	Email         string    `json:"email"`
+	PasswordHash  string    `json:"password"`
+	EmailVerified bool      `json:"email_verified"`
+	DisplayName   string    `json:"display_name"`
+	CreatedAt     time.Time `json:"created_at"`
+	// DeletedAt is set when the user is soft deleted. Zero means the user is active.
+	DeletedAt time.Time `json:"deleted_at"`
+	// Roles define what the user is allowed to do besides managing its own resources.
+	Roles []Role `json:"roles"`
+	// MFA is the two-factor authentication settings.
+	MFA MFA `json:"mfa"`
+	// Identities are the external identity provider accounts the user can log in with.
+	Identities []Identity `json:"identities"`
+	// SessionsRevokedAt is when all the user sessions were revoked, see RevokeSessions.
+	SessionsRevokedAt time.Time `json:"sessions_revoked_at"`
+	// Version is incremented by the repository on every store.
+	// The user is stored only if its version is still the same as when it was read.
+	// Zero means the user has never been stored.
+	Version int64 `json:"version"`
 }
 
-// NewUser creates a new user.
-func NewUser(email, password string) User {
+// ListUsersFilter defines which users to list and in which order.
+// The users are sorted by the creation time and then by ID,
+// so the order is stable even for the users created at the same time.
+type ListUsersFilter struct {
+	EmailPrefix string
+	// CreatedFrom is the inclusive lower bound of the creation time. Zero means no bound.
+	CreatedFrom time.Time
+	// CreatedTo is the exclusive upper bound of the creation time. Zero means no bound.
+	CreatedTo time.Time
+	// Desc lists the newest users first.
+	Desc bool
+	// Cursor is the opaque position to continue listing from, returned with the previous page.
+	Cursor string
+	Limit  int
+}
+
+// NewUser creates a new user with the password hash, see HashPassword.
+func NewUser(email, passwordHash string) User {
 	return User{
 		ID:           uuid.New().String(),
 		Email:        email,
-		PasswordHash: password,
+		PasswordHash: passwordHash,
+		Roles:        []Role{RoleUser},
+		CreatedAt:    time.Now().UTC(),
+	}
+}
+
+// IsDeleted reports whether the user is soft deleted.
+func (u User) IsDeleted() bool {
+	return !u.DeletedAt.IsZero()
+}
+
+// CheckPassword reports whether the password matches the user password hash.
+// The users created with an external identity have no password, nothing matches it.
+func (u User) CheckPassword(password string) bool {
+	if u.PasswordHash == "" {
+		SimulatePasswordCheck(password)
+		return false
+	}
+	return bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(password)) == nil
+}
+
+// dummyPasswordHash is the hash the passwords of the unknown users are checked against,
+// see SimulatePasswordCheck.
+var dummyPasswordHash = sync.OnceValue(func() string {
+	hash, _ := HashPassword("dummy password")
+	return hash
+})
+
+// SimulatePasswordCheck takes the same time as CheckPassword.
+// It's called when there is no user to check the password of,
+// so the response time doesn't reveal whether the user exists.
+func SimulatePasswordCheck(password string) {
+	User{PasswordHash: dummyPasswordHash()}.CheckPassword(password)
+}
+
+// HashPassword returns the hash of the password to be stored.
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// ValidatePassword validates the new password.
+func ValidatePassword(password string) error {
+	if utf8.RuneCountInString(password) < MinPasswordLength {
+		return ErrWeakPassword
+	}
+	return nil
+}
+
+// NormalizeEmail returns the email as it's stored and looked up,
+// so the emails differing only in case or surrounding spaces belong to the same user.
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// ValidateEmail validates the email.
+// It's a basic sanity check, the email is proved by the verification.
+func ValidateEmail(email string) error {
+	at := strings.LastIndex(email, "@")
+	if at < 1 || at == len(email)-1 || strings.ContainsAny(email, " \t\r\n") {
+		return ErrInvalidEmail
+	}
+	return nil
+}
+
+// ValidateDisplayName validates the display name.
+func ValidateDisplayName(name string) error {
+	if utf8.RuneCountInString(name) > MaxDisplayNameLength {
+		return ErrInvalidDisplayName
 	}
+	return nil
 }
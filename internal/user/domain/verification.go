@@ -0,0 +1,75 @@
+package domain
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"time"
+)
+
+// oneTimeTokenSize is the number of random bytes of the tokens sent by email.
+const oneTimeTokenSize = 32
+
+var (
+	// ErrInvalidVerificationToken is returned when the verification token doesn't exist,
+	// has been already used or was issued for another email.
+	ErrInvalidVerificationToken = errors.New("invalid verification token")
+	// ErrVerificationTokenExpired is returned when the verification token is expired.
+	ErrVerificationTokenExpired = errors.New("verification token expired")
+)
+
+// VerificationToken is an issued email verification token.
+// Only the token hash is stored, so the leaked storage doesn't leak the valid tokens.
+type VerificationToken struct {
+	Hash   string `json:"hash"`
+	UserID string `json:"user_id"`
+	// Email is the email the token was sent to.
+	// The token can't verify another email if the user has changed it since then.
+	Email     string    `json:"email"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// NewVerificationToken issues a new verification token of the user email valid for ttl.
+// It returns the token to be sent to the user and its record to be stored.
+func NewVerificationToken(user User, ttl time.Duration, now time.Time) (string, VerificationToken, error) {
+	token, hash, err := newOneTimeToken()
+	if err != nil {
+		return "", VerificationToken{}, err
+	}
+
+	return token, VerificationToken{
+		Hash:      hash,
+		UserID:    user.ID,
+		Email:     user.Email,
+		ExpiresAt: now.Add(ttl).UTC(),
+	}, nil
+}
+
+// HashVerificationToken returns the hash the token is stored by.
+func HashVerificationToken(token string) string {
+	return hashOneTimeToken(token)
+}
+
+// IsExpired reports whether the token is expired at the given time.
+func (t VerificationToken) IsExpired(now time.Time) bool {
+	return !now.Before(t.ExpiresAt)
+}
+
+// newOneTimeToken generates a random token to be sent to the user and its hash to be stored.
+func newOneTimeToken() (token, hash string, err error) {
+	b := make([]byte, oneTimeTokenSize)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token = base64.RawURLEncoding.EncodeToString(b)
+	return token, hashOneTimeToken(token), nil
+}
+
+// hashOneTimeToken returns the hash of the one-time token.
+// The token is random, so a fast hash is enough.
+func hashOneTimeToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
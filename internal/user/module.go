@@ -0,0 +1,164 @@
+package user
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/dmitrymomot/go-smart-monolith/internal/user/app/commands"
+	usergrpc "github.com/dmitrymomot/go-smart-monolith/internal/user/ports/grpc"
+	usermessagebus "github.com/dmitrymomot/go-smart-monolith/internal/user/ports/messagebus"
+	"github.com/dmitrymomot/go-smart-monolith/internal/user/ports/restapi"
+	"github.com/dmitrymomot/go-smart-monolith/internal/user/service"
+	"github.com/dmitrymomot/go-smart-monolith/pkg/auth"
+	"github.com/dmitrymomot/go-smart-monolith/pkg/contracts/playerapi"
+	"github.com/dmitrymomot/go-smart-monolith/pkg/contracts/userapi"
+	"github.com/dmitrymomot/go-smart-monolith/pkg/health"
+	"github.com/dmitrymomot/go-smart-monolith/pkg/idempotency"
+	"github.com/dmitrymomot/go-smart-monolith/pkg/mailer"
+	"github.com/dmitrymomot/go-smart-monolith/pkg/module"
+	"github.com/dmitrymomot/go-smart-monolith/pkg/ratelimit"
+
+	"github.com/go-chi/chi/v5"
+	"google.golang.org/grpc"
+)
+
+// Module is the user service module.
+// It plugs the user service into the monolith or a standalone binary.
+type Module struct {
+	cnf     service.Config
+	svc     service.Service
+	tokens  *auth.JWT
+	verify  usergrpc.TokenVerifier
+	limiter ratelimit.Limiter
+	dedup   *idempotency.Store
+	log     module.Logger
+	mailer  module.Mailer
+	closers []io.Closer
+}
+
+// NewModule creates a new user service module.
+func NewModule() *Module {
+	return &Module{}
+}
+
+// Name returns the module name.
+func (m *Module) Name() string {
+	return userapi.ModuleName
+}
+
+// Config returns the user service config to be populated by the registry.
+func (m *Module) Config() interface{} {
+	return &m.cnf
+}
+
+// Init builds the user service.
+// The players service is called in-process if the players module is built
+// into the same binary and the app transport allows it, otherwise over HTTP.
+func (m *Module) Init(deps module.Deps) error {
+	var local playerapi.Service
+	if deps.Transport == module.TransportInProcess && deps.Modules != nil {
+		if mod, ok := deps.Modules.Lookup(playerapi.ModuleName); ok {
+			local, _ = mod.(playerapi.Service)
+		}
+	}
+
+	playerClient, err := service.NewPlayersClient(m.cnf, local)
+	if err != nil {
+		return err
+	}
+	if c, ok := playerClient.(io.Closer); ok {
+		m.closers = append(m.closers, c)
+	}
+
+	m.svc = service.NewService(deps.Storage, deps.Logger, deps.NATS, deps.Flags, playerClient, m.cnf)
+	m.tokens = auth.NewJWT(m.cnf.JWTSecret)
+	m.verify = usergrpc.NewTokenVerifier(m.svc, m.tokens)
+	m.limiter = ratelimit.NewMemory(time.Now)
+	if m.cnf.RateLimit.Backend == service.RateLimitBackendStorage {
+		m.limiter = ratelimit.NewStore(deps.Storage, time.Now)
+	}
+	m.dedup = idempotency.NewStore(deps.Storage, time.Now)
+	m.log = deps.Logger
+	m.mailer = deps.Mailer
+	return nil
+}
+
+// Routes mounts the user service HTTP endpoints.
+func (m *Module) Routes(r chi.Router) {
+	r.Mount("/users", restapi.NewServer(m.svc, m.tokens, m.limiter, m.dedup, m.cnf))
+}
+
+// RegisterGRPC registers the user service gRPC port.
+func (m *Module) RegisterGRPC(s grpc.ServiceRegistrar) {
+	usergrpc.NewServer(m.svc).Register(s)
+}
+
+// GRPCInterceptors returns the user service gRPC interceptors.
+func (m *Module) GRPCInterceptors() []grpc.UnaryServerInterceptor {
+	return usergrpc.Interceptors(m.log, m.verify)
+}
+
+// Subscribers returns the user service message bus subscribers.
+// The user service sends its emails itself, until there is a dedicated mailer service.
+func (m *Module) Subscribers() []module.Subscriber {
+	return append(usermessagebus.Subscribers(m.svc), module.Subscriber{
+		Subject: mailer.SendEmailSubject,
+		Handler: mailer.Handler(m.mailer),
+	})
+}
+
+// Jobs returns the user service background jobs.
+func (m *Module) Jobs() []module.Job {
+	jobs := []module.Job{
+		{
+			// Permanently deletes the users whose restore window is expired.
+			Name: "purge_deleted_users",
+			Run: func(ctx context.Context) error {
+				ticker := time.NewTicker(m.cnf.PurgeInterval)
+				defer ticker.Stop()
+				for {
+					select {
+					case <-ctx.Done():
+						return ctx.Err()
+					case <-ticker.C:
+						// The errors are logged by the command decorator.
+						_, _ = m.svc.Commands.Send(ctx, commands.PurgeDeletedUsersCommand{})
+					}
+				}
+			},
+		},
+	}
+	if len(m.closers) > 0 {
+		jobs = append(jobs, module.Job{
+			// Closes the players service connections when the app is stopped.
+			Name: "players_client",
+			Run: func(ctx context.Context) error {
+				<-ctx.Done()
+				for _, c := range m.closers {
+					if err := c.Close(); err != nil {
+						m.log.Error(err, "closer", "players_client")
+					}
+				}
+				return ctx.Err()
+			},
+		})
+	}
+	return jobs
+}
+
+// HealthChecks returns the user service dependency probes.
+func (m *Module) HealthChecks() []health.Check {
+	return m.svc.HealthChecks
+}
+
+// Authenticate implements userapi.Authenticator for in-process calls.
+// It verifies the token the same way as the user service REST and gRPC APIs.
+func (m *Module) Authenticate(ctx context.Context, token string) (auth.Principal, error) {
+	ctx, err := m.verify(ctx, token)
+	if err != nil {
+		return auth.Principal{}, err
+	}
+	p, _ := auth.PrincipalFromContext(ctx)
+	return p, nil
+}
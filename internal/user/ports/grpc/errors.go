@@ -0,0 +1,49 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+
+	"github.com/dmitrymomot/go-smart-monolith/internal/user/app/commands"
+	"github.com/dmitrymomot/go-smart-monolith/internal/user/domain"
+	"github.com/dmitrymomot/go-smart-monolith/pkg/auth"
+	"github.com/dmitrymomot/go-smart-monolith/pkg/contracts/playerapi"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// toStatus maps the application errors to the gRPC status codes.
+// Unknown errors are reported as Internal without the details,
+// so the internals are not leaked to the clients.
+func toStatus(err error) error {
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+
+	switch {
+	case errors.Is(err, auth.ErrUnauthenticated):
+		return status.Error(codes.Unauthenticated, err.Error())
+	case errors.Is(err, auth.ErrForbidden):
+		return status.Error(codes.PermissionDenied, err.Error())
+	case errors.Is(err, domain.ErrUserNotFound),
+		errors.Is(err, playerapi.ErrPlayerNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, commands.ErrUserAlreadyExists),
+		errors.Is(err, domain.ErrEmailTaken):
+		return status.Error(codes.AlreadyExists, err.Error())
+	case errors.Is(err, domain.ErrInvalidEmail),
+		errors.Is(err, domain.ErrWeakPassword):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, domain.ErrConcurrentModification):
+		return status.Error(codes.Aborted, err.Error())
+	case errors.Is(err, domain.ErrAccountLocked):
+		return status.Error(codes.ResourceExhausted, err.Error())
+	case errors.Is(err, context.DeadlineExceeded):
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	case errors.Is(err, context.Canceled):
+		return status.Error(codes.Canceled, err.Error())
+	default:
+		return status.Error(codes.Internal, "internal error")
+	}
+}
@@ -0,0 +1,172 @@
+package grpc
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	userv1 "github.com/dmitrymomot/go-smart-monolith/api/user/v1"
+	"github.com/dmitrymomot/go-smart-monolith/internal/user/app/queries"
+	"github.com/dmitrymomot/go-smart-monolith/internal/user/domain"
+	"github.com/dmitrymomot/go-smart-monolith/internal/user/service"
+	"github.com/dmitrymomot/go-smart-monolith/pkg/auth"
+
+	"github.com/google/uuid"
+	grpclib "google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// RequestIDKey is the metadata key used to propagate the request ID.
+const RequestIDKey = "x-request-id"
+
+type (
+	// TokenVerifier verifies the bearer token and returns the context
+	// enriched with the caller identity.
+	TokenVerifier func(ctx context.Context, token string) (context.Context, error)
+
+	// tokenVerifier verifies the access tokens, see auth.JWT.
+	tokenVerifier interface {
+		Verify(token string) (auth.Claims, error)
+	}
+
+	// logger is a low-level abstraction for the logger.
+	logger interface {
+		Error(err error, kv ...interface{})
+	}
+
+	requestIDCtxKey struct{}
+)
+
+// Interceptors returns the user service interceptors in the order they should be chained:
+// tracing, logging and auth. They only apply to the user service methods,
+// so they are safe to be used on a shared gRPC server.
+func Interceptors(log logger, verify TokenVerifier) []grpclib.UnaryServerInterceptor {
+	return []grpclib.UnaryServerInterceptor{
+		TracingInterceptor(),
+		LoggingInterceptor(log),
+		AuthInterceptor(verify),
+	}
+}
+
+// RequestIDFromContext returns the request ID set by the tracing interceptor.
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDCtxKey{}).(string)
+	return id
+}
+
+// TracingInterceptor propagates the request ID from the incoming metadata
+// or generates a new one, and sends it back in the response header.
+func TracingInterceptor() grpclib.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpclib.UnaryServerInfo, handler grpclib.UnaryHandler) (interface{}, error) {
+		if !isUserServiceMethod(info.FullMethod) {
+			return handler(ctx, req)
+		}
+
+		id := firstMetadataValue(ctx, RequestIDKey)
+		if id == "" {
+			id = uuid.New().String()
+		}
+		_ = grpclib.SetHeader(ctx, metadata.Pairs(RequestIDKey, id))
+
+		return handler(context.WithValue(ctx, requestIDCtxKey{}, id), req)
+	}
+}
+
+// LoggingInterceptor logs failed calls with the method name, status code and duration.
+func LoggingInterceptor(log logger) grpclib.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpclib.UnaryServerInfo, handler grpclib.UnaryHandler) (interface{}, error) {
+		if !isUserServiceMethod(info.FullMethod) {
+			return handler(ctx, req)
+		}
+
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		if err != nil {
+			log.Error(err,
+				"grpc_method", info.FullMethod,
+				"grpc_code", status.Code(err).String(),
+				"duration", time.Since(start).String(),
+				"request_id", RequestIDFromContext(ctx),
+			)
+		}
+		return resp, err
+	}
+}
+
+// AuthInterceptor authenticates the caller by the bearer token in the "authorization" metadata,
+// the same as the REST API: the calls without a token are passed as anonymous, so the public
+// methods work, and the protected ones fail with auth.ErrUnauthenticated. The calls with an invalid
+// token are rejected. If verify is nil, no token can be verified, so all the callers are anonymous.
+func AuthInterceptor(verify TokenVerifier) grpclib.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpclib.UnaryServerInfo, handler grpclib.UnaryHandler) (interface{}, error) {
+		if !isUserServiceMethod(info.FullMethod) {
+			return handler(ctx, req)
+		}
+
+		header := firstMetadataValue(ctx, "authorization")
+		if header == "" {
+			return handler(ctx, req)
+		}
+		token, ok := strings.CutPrefix(header, "Bearer ")
+		if !ok || token == "" {
+			return nil, status.Error(codes.Unauthenticated, "invalid authorization header")
+		}
+		if verify == nil {
+			return nil, status.Error(codes.Unauthenticated, "authentication is not configured")
+		}
+
+		ctx, err := verify(ctx, token)
+		if err != nil {
+			return nil, status.Error(codes.Unauthenticated, err.Error())
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+// NewTokenVerifier returns the verifier of the access tokens and the API keys, see domain.APIKeyPrefix,
+// the same as the REST API: the caller gets the roles of its user or the scopes of its API key.
+// The internal services call the gRPC API with the API keys.
+func NewTokenVerifier(svc service.Service, tokens tokenVerifier) TokenVerifier {
+	return func(ctx context.Context, token string) (context.Context, error) {
+		var (
+			principal auth.Principal
+			err       error
+		)
+		if domain.IsAPIKey(token) {
+			principal, err = svc.AuthenticateAPIKey(ctx, queries.AuthenticateAPIKeyQuery{Key: token})
+		} else {
+			var claims auth.Claims
+			if claims, err = tokens.Verify(token); err != nil {
+				return nil, err
+			}
+			principal, err = svc.Authenticate(ctx, queries.AuthenticateQuery{
+				UserID:    claims.Subject,
+				SessionID: claims.SessionID,
+				IssuedAt:  time.Unix(claims.IssuedAt, 0),
+			})
+		}
+		if err != nil {
+			return nil, err
+		}
+		return auth.WithPrincipal(ctx, principal), nil
+	}
+}
+
+// isUserServiceMethod reports whether the method belongs to the user service.
+func isUserServiceMethod(fullMethod string) bool {
+	return strings.HasPrefix(fullMethod, "/"+userv1.UserService_ServiceDesc.ServiceName+"/")
+}
+
+func firstMetadataValue(ctx context.Context, key string) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+	if v := md.Get(key); len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
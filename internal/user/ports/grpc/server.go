@@ -0,0 +1,88 @@
+package grpc
+
+import (
+	"context"
+
+	userv1 "github.com/dmitrymomot/go-smart-monolith/api/user/v1"
+	"github.com/dmitrymomot/go-smart-monolith/internal/user/app/commands"
+	"github.com/dmitrymomot/go-smart-monolith/internal/user/app/queries"
+	"github.com/dmitrymomot/go-smart-monolith/internal/user/service"
+
+	grpclib "google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+)
+
+// Server is the gRPC port of the user service.
+// It calls the same command and query handlers as the REST API,
+// so the transport layer only maps requests, responses and errors.
+type Server struct {
+	userv1.UnimplementedUserServiceServer
+	svc service.Service
+}
+
+// NewServer creates a new gRPC port of the user service.
+// Use Register to add it to a shared gRPC server, e.g. the app one.
+func NewServer(svc service.Service) *Server {
+	return &Server{svc: svc}
+}
+
+// Register registers the user service on the given gRPC server.
+func (s *Server) Register(r grpclib.ServiceRegistrar) {
+	userv1.RegisterUserServiceServer(r, s)
+}
+
+// NewStandaloneServer creates a gRPC server with the user service,
+// interceptors, health and reflection services registered.
+// It can be used to serve the user service alone or in tests.
+func NewStandaloneServer(svc service.Service, log logger, verify TokenVerifier, opts ...grpclib.ServerOption) *grpclib.Server {
+	opts = append(opts, grpclib.ChainUnaryInterceptor(Interceptors(log, verify)...))
+	srv := grpclib.NewServer(opts...)
+
+	NewServer(svc).Register(srv)
+
+	hs := health.NewServer()
+	hs.SetServingStatus(userv1.UserService_ServiceDesc.ServiceName, healthpb.HealthCheckResponse_SERVING)
+	healthpb.RegisterHealthServer(srv, hs)
+	reflection.Register(srv)
+
+	return srv
+}
+
+// GetUser gets a user by ID.
+func (s *Server) GetUser(ctx context.Context, req *userv1.GetUserRequest) (*userv1.GetUserResponse, error) {
+	user, err := s.svc.GetUser(ctx, queries.GetUserQuery{
+		ID: req.GetId(),
+	})
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &userv1.GetUserResponse{
+		User: &userv1.User{
+			Id:         user.ID,
+			Email:      user.Email,
+			PlayerName: user.PlayerName,
+		},
+	}, nil
+}
+
+// CreateUser creates a new user.
+func (s *Server) CreateUser(ctx context.Context, req *userv1.CreateUserRequest) (*userv1.CreateUserResponse, error) {
+	events, err := s.svc.Commands.Send(ctx, commands.CreateUserCommand{
+		Email:    req.GetEmail(),
+		Password: req.GetPassword(),
+	})
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	resp := &userv1.CreateUserResponse{}
+	for _, e := range events {
+		if created, ok := e.(commands.UserCreatedEvent); ok {
+			resp.Id = created.ID
+		}
+	}
+	return resp, nil
+}
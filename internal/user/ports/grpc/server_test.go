@@ -0,0 +1,232 @@
+package grpc_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	userv1 "github.com/dmitrymomot/go-smart-monolith/api/user/v1"
+	"github.com/dmitrymomot/go-smart-monolith/internal/user/app/commands"
+	"github.com/dmitrymomot/go-smart-monolith/internal/user/domain"
+	usergrpc "github.com/dmitrymomot/go-smart-monolith/internal/user/ports/grpc"
+	"github.com/dmitrymomot/go-smart-monolith/internal/user/service"
+	"github.com/dmitrymomot/go-smart-monolith/pkg/auth"
+	"github.com/dmitrymomot/go-smart-monolith/pkg/contracts/playerapi"
+	"github.com/dmitrymomot/go-smart-monolith/pkg/featureflag"
+	"github.com/dmitrymomot/go-smart-monolith/pkg/logx"
+	"github.com/dmitrymomot/go-smart-monolith/pkg/nats"
+	"github.com/dmitrymomot/go-smart-monolith/pkg/storage"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// players is a fake in-process players service.
+type players map[string]string
+
+// GetPlayer returns the player by user ID.
+func (p players) GetPlayer(_ context.Context, userID string) (playerapi.Player, error) {
+	name, ok := p[userID]
+	if !ok {
+		return playerapi.Player{}, playerapi.ErrPlayerNotFound
+	}
+	return playerapi.Player{UserID: userID, PlayerName: name}, nil
+}
+
+func newClient(t *testing.T, pl players, verify usergrpc.TokenVerifier) (userv1.UserServiceClient, *grpc.ClientConn) {
+	t.Helper()
+
+	playerClient, err := service.NewPlayersClient(service.Config{}, pl)
+	require.NoError(t, err)
+	svc := service.NewService(storage.New(), logx.New(), nats.NewClient(), featureflag.NewStatic(), playerClient, service.Config{})
+
+	ln := bufconn.Listen(1 << 20)
+	srv := usergrpc.NewStandaloneServer(svc, logx.New(), verify)
+	go func() { _ = srv.Serve(ln) }()
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.DialContext(context.Background(), "bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return ln.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+
+	return userv1.NewUserServiceClient(conn), conn
+}
+
+func TestServer(t *testing.T) {
+	// The service calls with an API key allowed to read the users.
+	verify := func(ctx context.Context, token string) (context.Context, error) {
+		return auth.WithPrincipal(ctx, auth.Principal{
+			UserID:      "service",
+			Permissions: []string{string(domain.PermissionReadUsers)},
+		}), nil
+	}
+	pl := players{}
+	client, conn := newClient(t, pl, verify)
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer service-key")
+
+	var header metadata.MD
+	created, err := client.CreateUser(ctx, &userv1.CreateUserRequest{
+		Email:    "test@example.com",
+		Password: "secret-password",
+	}, grpc.Header(&header))
+	require.NoError(t, err)
+	require.NotEmpty(t, created.GetId())
+	require.NotEmpty(t, header.Get(usergrpc.RequestIDKey), "request ID must be sent back")
+
+	t.Run("get user", func(t *testing.T) {
+		pl[created.GetId()] = "player1"
+
+		resp, err := client.GetUser(ctx, &userv1.GetUserRequest{Id: created.GetId()})
+		require.NoError(t, err)
+		require.Equal(t, created.GetId(), resp.GetUser().GetId())
+		require.Equal(t, "test@example.com", resp.GetUser().GetEmail())
+		require.Equal(t, "player1", resp.GetUser().GetPlayerName())
+	})
+
+	t.Run("request id is propagated", func(t *testing.T) {
+		var header metadata.MD
+		ctx := metadata.AppendToOutgoingContext(ctx, usergrpc.RequestIDKey, "req-1")
+		_, err := client.GetUser(ctx, &userv1.GetUserRequest{Id: created.GetId()}, grpc.Header(&header))
+		require.NoError(t, err)
+		require.Equal(t, []string{"req-1"}, header.Get(usergrpc.RequestIDKey))
+	})
+
+	t.Run("user already exists", func(t *testing.T) {
+		_, err := client.CreateUser(ctx, &userv1.CreateUserRequest{
+			Email:    "test@example.com",
+			Password: "secret-password",
+		})
+		require.Equal(t, codes.AlreadyExists, status.Code(err))
+	})
+
+	t.Run("invalid argument", func(t *testing.T) {
+		_, err := client.CreateUser(ctx, &userv1.CreateUserRequest{
+			Email:    "other@example.com",
+			Password: "secret",
+		})
+		require.Equal(t, codes.InvalidArgument, status.Code(err))
+	})
+
+	t.Run("user not found", func(t *testing.T) {
+		_, err := client.GetUser(ctx, &userv1.GetUserRequest{Id: "unknown"})
+		require.Equal(t, codes.NotFound, status.Code(err))
+	})
+
+	t.Run("health", func(t *testing.T) {
+		resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{
+			Service: userv1.UserService_ServiceDesc.ServiceName,
+		})
+		require.NoError(t, err)
+		require.Equal(t, healthpb.HealthCheckResponse_SERVING, resp.GetStatus())
+	})
+}
+
+func TestServer_Auth(t *testing.T) {
+	verify := func(ctx context.Context, token string) (context.Context, error) {
+		if token != "valid" {
+			return nil, errors.New("invalid token")
+		}
+		return auth.WithPrincipal(ctx, auth.Principal{UserID: "1"}), nil
+	}
+	client, conn := newClient(t, players{}, verify)
+	ctx := context.Background()
+
+	t.Run("missing token", func(t *testing.T) {
+		_, err := client.GetUser(ctx, &userv1.GetUserRequest{Id: "1"})
+		require.Equal(t, codes.Unauthenticated, status.Code(err))
+
+		// The public methods are called anonymously.
+		_, err = client.CreateUser(ctx, &userv1.CreateUserRequest{
+			Email:    "test@example.com",
+			Password: "secret-password",
+		})
+		require.NoError(t, err)
+	})
+
+	t.Run("invalid token", func(t *testing.T) {
+		ctx := metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer invalid")
+		_, err := client.GetUser(ctx, &userv1.GetUserRequest{Id: "1"})
+		require.Equal(t, codes.Unauthenticated, status.Code(err))
+	})
+
+	t.Run("valid token", func(t *testing.T) {
+		ctx := metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer valid")
+		_, err := client.GetUser(ctx, &userv1.GetUserRequest{Id: "1"})
+		require.Equal(t, codes.NotFound, status.Code(err))
+	})
+
+	t.Run("not owner", func(t *testing.T) {
+		ctx := metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer valid")
+		_, err := client.GetUser(ctx, &userv1.GetUserRequest{Id: "2"})
+		require.Equal(t, codes.PermissionDenied, status.Code(err))
+	})
+
+	t.Run("health is not protected", func(t *testing.T) {
+		_, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{})
+		require.NoError(t, err)
+	})
+}
+
+func TestServer_NoVerifier(t *testing.T) {
+	client, _ := newClient(t, players{}, nil)
+	ctx := context.Background()
+
+	// No token can be verified, so the callers get no roles.
+	created, err := client.CreateUser(ctx, &userv1.CreateUserRequest{
+		Email:    "test@example.com",
+		Password: "secret-password",
+	})
+	require.NoError(t, err)
+	_, err = client.GetUser(ctx, &userv1.GetUserRequest{Id: created.GetId()})
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer token")
+	_, err = client.GetUser(ctx, &userv1.GetUserRequest{Id: created.GetId()})
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+func TestNewTokenVerifier(t *testing.T) {
+	secret := "0123456789abcdef0123456789abcdef"
+	playerClient, err := service.NewPlayersClient(service.Config{}, players{})
+	require.NoError(t, err)
+	svc := service.NewService(storage.New(), logx.New(), nats.NewClient(), featureflag.NewStatic(), playerClient, service.Config{JWTSecret: secret, AccessTokenTTL: time.Hour})
+	tokens := auth.NewJWT(secret)
+	verify := usergrpc.NewTokenVerifier(svc, tokens)
+	ctx := context.Background()
+
+	_, err = svc.CreateUser(ctx, commands.CreateUserCommand{Email: "test@example.com", Password: "secret-password"})
+	require.NoError(t, err)
+	events, err := svc.Login(ctx, commands.LoginCommand{Email: "test@example.com", Password: "secret-password"})
+	require.NoError(t, err)
+	login := events[0].(commands.UserLoggedInEvent)
+
+	t.Run("access token", func(t *testing.T) {
+		ctx, err := verify(ctx, login.AccessToken)
+		require.NoError(t, err)
+		p, ok := auth.PrincipalFromContext(ctx)
+		require.True(t, ok)
+		require.Equal(t, login.ID, p.UserID)
+	})
+
+	t.Run("invalid token", func(t *testing.T) {
+		_, err := verify(ctx, "invalid")
+		require.ErrorIs(t, err, auth.ErrInvalidToken)
+	})
+
+	t.Run("unknown api key", func(t *testing.T) {
+		_, err := verify(ctx, domain.APIKeyPrefix+"unknown")
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,53 @@
+package messagebus
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/dmitrymomot/go-smart-monolith/internal/user/adapters/messagebus"
+	"github.com/dmitrymomot/go-smart-monolith/internal/user/app/commands"
+	"github.com/dmitrymomot/go-smart-monolith/internal/user/app/decorators/events"
+	"github.com/dmitrymomot/go-smart-monolith/internal/user/service"
+	"github.com/dmitrymomot/go-smart-monolith/pkg/idempotency"
+	"github.com/dmitrymomot/go-smart-monolith/pkg/module"
+)
+
+// Subscribers returns the user service subscribers of its own events.
+// It's the message bus port: the events are handled the same way
+// the HTTP requests are handled by the REST API port.
+func Subscribers(svc service.Service) []module.Subscriber {
+	return []module.Subscriber{
+		{
+			// The new users verify their emails.
+			Subject: messagebus.EventSubject(events.Topic, commands.UserCreatedEvent{}),
+			Handler: func(ctx context.Context, body []byte) error {
+				var e commands.UserCreatedEvent
+				if err := json.Unmarshal(body, &e); err != nil {
+					return err
+				}
+				// A user is created once, so a redelivered event doesn't send another email.
+				// The email changes can't be told from the redeliveries: the same change may be made again.
+				ctx = idempotency.WithKey(ctx, "UserCreated:"+e.ID)
+				return requestEmailVerification(ctx, svc, e.ID)
+			},
+		},
+		{
+			// The changed emails are verified again.
+			Subject: messagebus.EventSubject(events.Topic, commands.UserEmailChangedEvent{}),
+			Handler: func(ctx context.Context, body []byte) error {
+				var e commands.UserEmailChangedEvent
+				if err := json.Unmarshal(body, &e); err != nil {
+					return err
+				}
+				return requestEmailVerification(ctx, svc, e.ID)
+			},
+		},
+	}
+}
+
+// requestEmailVerification sends the verification email to the user.
+// The command is dispatched by the command bus, so the port doesn't depend on the handler fields.
+func requestEmailVerification(ctx context.Context, svc service.Service, userID string) error {
+	_, err := svc.Commands.Send(ctx, commands.RequestEmailVerificationCommand{UserID: userID})
+	return err
+}
@@ -0,0 +1,157 @@
+package restapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/dmitrymomot/go-smart-monolith/internal/user/app/commands"
+	"github.com/dmitrymomot/go-smart-monolith/internal/user/app/queries"
+	"github.com/dmitrymomot/go-smart-monolith/internal/user/service"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// APIKeyResponse represents an API key in the ListAPIKeys response.
+// The key itself is returned only once, when it's created or rotated.
+type APIKeyResponse struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Hint       string     `json:"hint"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+// listAPIKeysEndpointHandler is a function that handles the HTTP request to list the user API keys.
+func listAPIKeysEndpointHandler(svc service.Service) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Execute the query.
+		keys, err := svc.ListAPIKeys(r.Context(), queries.ListAPIKeysQuery{
+			UserID: chi.URLParam(r, "id"),
+		})
+		if err != nil {
+			http.Error(w, err.Error(), errorStatus(err))
+			return
+		}
+
+		resp := struct {
+			APIKeys []APIKeyResponse `json:"api_keys"`
+		}{APIKeys: make([]APIKeyResponse, 0, len(keys))}
+		for _, k := range keys {
+			resp.APIKeys = append(resp.APIKeys, APIKeyResponse{
+				ID:         k.ID,
+				Name:       k.Name,
+				Hint:       k.Hint,
+				Scopes:     k.Scopes,
+				ExpiresAt:  k.ExpiresAt,
+				CreatedAt:  k.CreatedAt,
+				LastUsedAt: optionalTime(k.LastUsedAt),
+				RevokedAt:  optionalTime(k.RevokedAt),
+			})
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// createAPIKeyEndpointHandler is a function that handles the HTTP request to create an API key.
+// The response contains the key, it's shown only once.
+func createAPIKeyEndpointHandler(svc service.Service) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Parse the request body.
+		payload := struct {
+			Name   string   `json:"name"`
+			Scopes []string `json:"scopes"`
+			// TTLSeconds is how long the key is valid. Zero means the default TTL.
+			TTLSeconds int64 `json:"ttl_seconds"`
+		}{}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// Execute the command.
+		events, err := svc.Commands.Send(r.Context(), commands.CreateAPIKeyCommand{
+			UserID: chi.URLParam(r, "id"),
+			Name:   payload.Name,
+			Scopes: payload.Scopes,
+			TTL:    time.Duration(payload.TTLSeconds) * time.Second,
+		})
+		if err != nil {
+			http.Error(w, err.Error(), errorStatus(err))
+			return
+		}
+
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		for _, e := range events {
+			if created, ok := e.(commands.APIKeyCreatedEvent); ok {
+				_ = json.NewEncoder(w).Encode(struct {
+					ID        string    `json:"id"`
+					Key       string    `json:"key"`
+					Scopes    []string  `json:"scopes"`
+					ExpiresAt time.Time `json:"expires_at"`
+				}{ID: created.KeyID, Key: created.Key, Scopes: created.Scopes, ExpiresAt: created.ExpiresAt})
+			}
+		}
+	}
+}
+
+// rotateAPIKeyEndpointHandler is a function that handles the HTTP request to replace an API key.
+// The response contains the new key, the previous one stops working at once.
+func rotateAPIKeyEndpointHandler(svc service.Service) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Execute the command.
+		events, err := svc.Commands.Send(r.Context(), commands.RotateAPIKeyCommand{
+			UserID: chi.URLParam(r, "id"),
+			KeyID:  chi.URLParam(r, "key_id"),
+		})
+		if err != nil {
+			http.Error(w, err.Error(), errorStatus(err))
+			return
+		}
+
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("Content-Type", "application/json")
+		for _, e := range events {
+			if rotated, ok := e.(commands.APIKeyRotatedEvent); ok {
+				_ = json.NewEncoder(w).Encode(struct {
+					ID  string `json:"id"`
+					Key string `json:"key"`
+				}{ID: rotated.KeyID, Key: rotated.Key})
+			}
+		}
+	}
+}
+
+// revokeAPIKeyEndpointHandler is a function that handles the HTTP request to revoke an API key.
+func revokeAPIKeyEndpointHandler(svc service.Service) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Execute the command.
+		if _, err := svc.Commands.Send(r.Context(), commands.RevokeAPIKeyCommand{
+			UserID: chi.URLParam(r, "id"),
+			KeyID:  chi.URLParam(r, "key_id"),
+		}); err != nil {
+			http.Error(w, err.Error(), errorStatus(err))
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// optionalTime returns nil for the zero time, so it's omitted from the response.
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
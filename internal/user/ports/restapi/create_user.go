@@ -21,18 +21,25 @@ func createUserEndpointHandler(svc service.Service) func(w http.ResponseWriter,
 			return
 		}
 
-		// TODO: Validate the request payload....
-
-		// Execute the command.
-		if _, err := svc.CreateUser(r.Context(), commands.CreateUserCommand{
+		// Execute the command, it validates the email and the password.
+		events, err := svc.Commands.Send(r.Context(), commands.CreateUserCommand{
 			Email:    payload.Email,
 			Password: payload.Password,
-		}); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+		})
+		if err != nil {
+			http.Error(w, err.Error(), errorStatus(err))
 			return
 		}
 
-		// Return 201 Created.
+		// Return 201 Created with the new user ID taken from the event.
+		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusCreated)
+		for _, e := range events {
+			if created, ok := e.(commands.UserCreatedEvent); ok {
+				_ = json.NewEncoder(w).Encode(struct {
+					ID string `json:"id"`
+				}{ID: created.ID})
+			}
+		}
 	}
 }
@@ -0,0 +1,69 @@
+package restapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/dmitrymomot/go-smart-monolith/internal/user/app/commands"
+	"github.com/dmitrymomot/go-smart-monolith/internal/user/service"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// deleteUserEndpointHandler is a function that handles the HTTP request to delete a user.
+// The user is soft deleted: the response tells until when it can be restored.
+func deleteUserEndpointHandler(svc service.Service) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Check the precondition: the user must not be changed since the client read it.
+		version, ok := ifMatchVersion(r)
+		if !ok {
+			http.Error(w, "etag doesn't match", http.StatusPreconditionFailed)
+			return
+		}
+
+		// Execute the command.
+		events, err := svc.Commands.Send(r.Context(), commands.DeleteUserCommand{
+			UserID:          chi.URLParam(r, "id"),
+			ExpectedVersion: version,
+		})
+		if err != nil {
+			http.Error(w, err.Error(), errorStatus(err))
+			return
+		}
+
+		// Return 202 Accepted: the user is purged after the restore window.
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		for _, e := range events {
+			if deleted, ok := e.(commands.UserDeletedEvent); ok {
+				_ = json.NewEncoder(w).Encode(struct {
+					RestoreUntil time.Time `json:"restore_until"`
+				}{RestoreUntil: deleted.PurgeAfter})
+			}
+		}
+	}
+}
+
+// restoreUserEndpointHandler is a function that handles the HTTP request to restore a deleted user.
+func restoreUserEndpointHandler(svc service.Service) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Check the precondition: the user must not be changed since the client read it.
+		version, ok := ifMatchVersion(r)
+		if !ok {
+			http.Error(w, "etag doesn't match", http.StatusPreconditionFailed)
+			return
+		}
+
+		// Execute the command.
+		if _, err := svc.Commands.Send(r.Context(), commands.RestoreUserCommand{
+			UserID:          chi.URLParam(r, "id"),
+			ExpectedVersion: version,
+		}); err != nil {
+			http.Error(w, err.Error(), errorStatus(err))
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -2,10 +2,13 @@ package restapi
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
+	"time"
 
 	"github.com/dmitrymomot/go-smart-monolith/internal/user/app/queries"
 	"github.com/dmitrymomot/go-smart-monolith/internal/user/service"
+	"github.com/dmitrymomot/go-smart-monolith/pkg/auth"
 
 	"github.com/go-chi/chi/v5"
 )
@@ -14,9 +17,11 @@ import (
 // Note: you can't use the user entity directly as a response,
 // follow single responsibility principle and create a separate struct for the response.
 type UserResponse struct {
-	ID         string `json:"id"`
-	Email      string `json:"email"`
-	PlayerName string `json:"player_name"`
+	ID          string    `json:"id"`
+	Email       string    `json:"email"`
+	PlayerName  string    `json:"player_name"`
+	DisplayName string    `json:"display_name"`
+	CreatedAt   time.Time `json:"created_at"`
 }
 
 // getUserEndpointHandler is a function that handles the HTTP request to get a user.
@@ -30,17 +35,24 @@ func getUserEndpointHandler(svc service.Service) func(w http.ResponseWriter, r *
 			ID: id,
 		})
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusNotFound)
+			code := http.StatusNotFound
+			if errors.Is(err, auth.ErrUnauthenticated) || errors.Is(err, auth.ErrForbidden) {
+				code = errorStatus(err)
+			}
+			http.Error(w, err.Error(), code)
 			return
 		}
 
 		// Return the response.
+		w.Header().Set("ETag", formatETag(user.Version))
 		// Note: you can't pass the user directly to the response,
 		// follow single responsibility principle and create a separate struct for the response.
 		if err := json.NewEncoder(w).Encode(UserResponse{
-			ID:         user.ID,
-			Email:      user.Email,
-			PlayerName: user.PlayerName,
+			ID:          user.ID,
+			Email:       user.Email,
+			PlayerName:  user.PlayerName,
+			DisplayName: user.DisplayName,
+			CreatedAt:   user.CreatedAt,
 		}); err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
@@ -0,0 +1,170 @@
+package restapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dmitrymomot/go-smart-monolith/internal/user/app/queries"
+	"github.com/dmitrymomot/go-smart-monolith/internal/user/domain"
+	"github.com/dmitrymomot/go-smart-monolith/internal/user/service"
+	"github.com/dmitrymomot/go-smart-monolith/pkg/auth"
+)
+
+type (
+	// UsersResponse represents the response body for GetUsersByIDs and ListUsers.
+	// The users that couldn't be got or enriched are listed in Errors,
+	// so a single broken user doesn't fail the whole response.
+	UsersResponse struct {
+		Users      []UserResponse      `json:"users"`
+		Errors     []UserErrorResponse `json:"errors,omitempty"`
+		NextCursor string              `json:"next_cursor,omitempty"`
+	}
+
+	// UserErrorResponse describes why the user couldn't be got.
+	UserErrorResponse struct {
+		ID    string `json:"id"`
+		Error string `json:"error"`
+	}
+)
+
+// getUsersEndpointHandler is a function that handles the HTTP request to get users.
+// If the IDs are passed as a comma-separated list and/or repeated query parameter,
+// the users are got by IDs: GET /users?ids=1,2&ids=3
+// Otherwise the users are listed page by page:
+// GET /users?limit=20&email_prefix=john&created_from=2023-01-01T00:00:00Z&created_to=...&order=desc&cursor=...
+func getUsersEndpointHandler(svc service.Service) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var (
+			resp UsersResponse
+			err  error
+		)
+		if r.URL.Query().Has("ids") {
+			resp, err = getUsersByIDs(r, svc)
+		} else {
+			resp, err = listUsers(r, svc)
+		}
+		if err != nil {
+			code := http.StatusInternalServerError
+			var perr paramError
+			if errors.As(err, &perr) ||
+				errors.Is(err, queries.ErrNoUserIDs) ||
+				errors.Is(err, queries.ErrTooManyUserIDs) ||
+				errors.Is(err, queries.ErrInvalidTimeRange) ||
+				errors.Is(err, domain.ErrInvalidCursor) {
+				code = http.StatusBadRequest
+			}
+			if errors.Is(err, auth.ErrUnauthenticated) || errors.Is(err, auth.ErrForbidden) {
+				code = errorStatus(err)
+			}
+			http.Error(w, err.Error(), code)
+			return
+		}
+
+		// Return the response.
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// paramError is returned when a query parameter is malformed.
+type paramError struct {
+	name string
+	err  error
+}
+
+func (e paramError) Error() string {
+	return fmt.Sprintf("invalid %s parameter: %v", e.name, e.err)
+}
+
+func getUsersByIDs(r *http.Request, svc service.Service) (UsersResponse, error) {
+	// Parse the request parameters.
+	var ids []string
+	for _, v := range r.URL.Query()["ids"] {
+		ids = append(ids, strings.Split(v, ",")...)
+	}
+
+	// Execute the query.
+	res, err := svc.GetUsersByIDs(r.Context(), queries.GetUsersByIDsQuery{
+		IDs: ids,
+	})
+	if err != nil {
+		return UsersResponse{}, err
+	}
+
+	return newUsersResponse(res.Users, res.Failures, ""), nil
+}
+
+func listUsers(r *http.Request, svc service.Service) (UsersResponse, error) {
+	// Parse the request parameters.
+	params := r.URL.Query()
+	query := queries.ListUsersQuery{
+		Cursor:      params.Get("cursor"),
+		EmailPrefix: params.Get("email_prefix"),
+	}
+	if v := params.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 0 {
+			return UsersResponse{}, paramError{name: "limit", err: fmt.Errorf("must be a non-negative integer, got %q", v)}
+		}
+		query.Limit = limit
+	}
+	for name, dst := range map[string]*time.Time{
+		"created_from": &query.CreatedFrom,
+		"created_to":   &query.CreatedTo,
+	} {
+		if v := params.Get(name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return UsersResponse{}, paramError{name: name, err: err}
+			}
+			*dst = t
+		}
+	}
+	switch order := params.Get("order"); order {
+	case "", "asc":
+	case "desc":
+		query.Desc = true
+	default:
+		return UsersResponse{}, paramError{name: "order", err: fmt.Errorf(`must be "asc" or "desc", got %q`, order)}
+	}
+
+	// Execute the query.
+	res, err := svc.ListUsers(r.Context(), query)
+	if err != nil {
+		return UsersResponse{}, err
+	}
+
+	return newUsersResponse(res.Users, res.Failures, res.NextCursor), nil
+}
+
+// newUsersResponse maps the query results to the response.
+func newUsersResponse(users []queries.User, failures []queries.UserFailure, next string) UsersResponse {
+	resp := UsersResponse{
+		Users:      make([]UserResponse, 0, len(users)),
+		NextCursor: next,
+	}
+	for _, u := range users {
+		resp.Users = append(resp.Users, UserResponse{
+			ID:          u.ID,
+			Email:       u.Email,
+			PlayerName:  u.PlayerName,
+			DisplayName: u.DisplayName,
+			CreatedAt:   u.CreatedAt,
+		})
+	}
+	for _, f := range failures {
+		resp.Errors = append(resp.Errors, UserErrorResponse{
+			ID:    f.ID,
+			Error: f.Err.Error(),
+		})
+	}
+	return resp
+}
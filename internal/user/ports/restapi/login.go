@@ -0,0 +1,104 @@
+package restapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/dmitrymomot/go-smart-monolith/internal/user/app/commands"
+	"github.com/dmitrymomot/go-smart-monolith/internal/user/service"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// loginResponse is the response body of the login endpoints.
+// Either the access token is issued, or the second factor is required,
+// see loginMFAEndpointHandler.
+type loginResponse struct {
+	AccessToken    string `json:"access_token,omitempty"`
+	TokenType      string `json:"token_type,omitempty"`
+	ExpiresIn      int64  `json:"expires_in,omitempty"`
+	MFARequired    bool   `json:"mfa_required,omitempty"`
+	ChallengeToken string `json:"challenge_token,omitempty"`
+}
+
+// loginEndpointHandler is a function that handles the HTTP request to login by email and password.
+func loginEndpointHandler(svc service.Service) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Parse the request body.
+		payload := commands.LoginCommand{}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		payload.Client = sessionClient(r)
+
+		// Execute the command.
+		events, err := svc.Commands.Send(r.Context(), payload)
+		if err != nil {
+			http.Error(w, err.Error(), errorStatus(err))
+			return
+		}
+
+		writeLoginResponse(w, events)
+	}
+}
+
+// loginMFAEndpointHandler is a function that handles the HTTP request to complete the login
+// with the second factor: a TOTP code or a recovery code.
+func loginMFAEndpointHandler(svc service.Service) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Parse the request body.
+		payload := commands.LoginMFACommand{}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		payload.Client = sessionClient(r)
+
+		// Execute the command.
+		events, err := svc.Commands.Send(r.Context(), payload)
+		if err != nil {
+			http.Error(w, err.Error(), errorStatus(err))
+			return
+		}
+
+		writeLoginResponse(w, events)
+	}
+}
+
+// unlockAccountEndpointHandler is a function that handles the HTTP request to unlock the login
+// of the user locked after too many failed attempts.
+func unlockAccountEndpointHandler(svc service.Service) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Execute the command.
+		if _, err := svc.Commands.Send(r.Context(), commands.UnlockAccountCommand{
+			UserID: chi.URLParam(r, "id"),
+		}); err != nil {
+			http.Error(w, err.Error(), errorStatus(err))
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func writeLoginResponse(w http.ResponseWriter, events []interface{}) {
+	var res loginResponse
+	for _, e := range events {
+		switch e := e.(type) {
+		case commands.UserLoggedInEvent:
+			res.AccessToken = e.AccessToken
+			res.TokenType = "Bearer"
+			res.ExpiresIn = int64(time.Until(e.ExpiresAt).Seconds())
+		case commands.MFAChallengeIssuedEvent:
+			res.MFARequired = true
+			res.ChallengeToken = e.ChallengeToken
+		}
+	}
+
+	// The tokens must not be cached.
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(res)
+}
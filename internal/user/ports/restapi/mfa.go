@@ -0,0 +1,132 @@
+package restapi
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/dmitrymomot/go-smart-monolith/internal/user/app/commands"
+	"github.com/dmitrymomot/go-smart-monolith/internal/user/service"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// mfaCodePayload is the request body of the MFA endpoints.
+type mfaCodePayload struct {
+	Code string `json:"code"`
+}
+
+// enrollMFAEndpointHandler is a function that handles the HTTP request to start the MFA enrollment.
+// The response contains the TOTP secret to be added to the authenticator app.
+func enrollMFAEndpointHandler(svc service.Service) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Execute the command.
+		events, err := svc.Commands.Send(r.Context(), commands.EnrollMFACommand{
+			UserID: chi.URLParam(r, "id"),
+		})
+		if err != nil {
+			http.Error(w, err.Error(), errorStatus(err))
+			return
+		}
+
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("Content-Type", "application/json")
+		for _, e := range events {
+			if started, ok := e.(commands.MFAEnrollmentStartedEvent); ok {
+				_ = json.NewEncoder(w).Encode(struct {
+					Secret     string `json:"secret"`
+					OTPAuthURI string `json:"otpauth_uri"`
+				}{Secret: started.Secret, OTPAuthURI: started.URI})
+			}
+		}
+	}
+}
+
+// confirmMFAEndpointHandler is a function that handles the HTTP request to enable MFA
+// with the code of the enrolled secret. The response contains the recovery codes,
+// they are shown only once.
+func confirmMFAEndpointHandler(svc service.Service) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Parse the request body.
+		payload := mfaCodePayload{}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// Execute the command.
+		events, err := svc.Commands.Send(r.Context(), commands.ConfirmMFACommand{
+			UserID: chi.URLParam(r, "id"),
+			Code:   payload.Code,
+		})
+		if err != nil {
+			http.Error(w, err.Error(), errorStatus(err))
+			return
+		}
+
+		for _, e := range events {
+			if enabled, ok := e.(commands.MFAEnabledEvent); ok {
+				writeRecoveryCodes(w, enabled.RecoveryCodes)
+			}
+		}
+	}
+}
+
+// disableMFAEndpointHandler is a function that handles the HTTP request to disable MFA.
+func disableMFAEndpointHandler(svc service.Service) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Parse the request body.
+		payload := mfaCodePayload{}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// Execute the command.
+		if _, err := svc.Commands.Send(r.Context(), commands.DisableMFACommand{
+			UserID: chi.URLParam(r, "id"),
+			Code:   payload.Code,
+		}); err != nil {
+			http.Error(w, err.Error(), errorStatus(err))
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// regenerateRecoveryCodesEndpointHandler is a function that handles the HTTP request
+// to replace the recovery codes.
+func regenerateRecoveryCodesEndpointHandler(svc service.Service) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Parse the request body.
+		payload := mfaCodePayload{}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// Execute the command.
+		events, err := svc.Commands.Send(r.Context(), commands.RegenerateRecoveryCodesCommand{
+			UserID: chi.URLParam(r, "id"),
+			Code:   payload.Code,
+		})
+		if err != nil {
+			http.Error(w, err.Error(), errorStatus(err))
+			return
+		}
+
+		for _, e := range events {
+			if regenerated, ok := e.(commands.RecoveryCodesRegeneratedEvent); ok {
+				writeRecoveryCodes(w, regenerated.RecoveryCodes)
+			}
+		}
+	}
+}
+
+func writeRecoveryCodes(w http.ResponseWriter, codes []string) {
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}{RecoveryCodes: codes})
+}
@@ -0,0 +1,99 @@
+package restapi
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"time"
+
+	"github.com/dmitrymomot/go-smart-monolith/internal/user/app/commands"
+	"github.com/dmitrymomot/go-smart-monolith/internal/user/domain"
+	"github.com/dmitrymomot/go-smart-monolith/internal/user/service"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// oidcStateCookie binds the OIDC login to the browser it was started in,
+// so nobody can log the user in to the attacker's account with the attacker's callback.
+const oidcStateCookie = "oidc_state"
+
+// startOIDCLoginEndpointHandler is a function that handles the HTTP request to login with the identity provider.
+// It redirects the user to the provider.
+func startOIDCLoginEndpointHandler(svc service.Service) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Execute the command.
+		events, err := svc.Commands.Send(r.Context(), commands.StartOIDCLoginCommand{
+			Provider: chi.URLParam(r, "provider"),
+		})
+		if err != nil {
+			http.Error(w, err.Error(), errorStatus(err))
+			return
+		}
+
+		for _, e := range events {
+			if e, ok := e.(commands.OIDCLoginStartedEvent); ok {
+				http.SetCookie(w, &http.Cookie{
+					Name:  oidcStateCookie,
+					Value: e.State,
+					// The server doesn't know the path it's mounted at.
+					Path:     "/",
+					MaxAge:   int(time.Until(e.ExpiresAt).Seconds()),
+					Secure:   isHTTPS(r),
+					HttpOnly: true,
+					// The callback is a top-level navigation from the provider site.
+					SameSite: http.SameSiteLaxMode,
+				})
+				w.Header().Set("Cache-Control", "no-store")
+				http.Redirect(w, r, e.AuthURL, http.StatusFound)
+				return
+			}
+		}
+		http.Error(w, "login is not started", http.StatusInternalServerError)
+	}
+}
+
+// oidcCallbackEndpointHandler is a function that handles the identity provider redirect back
+// with the authorization code. The response is the same as of the login by password.
+func oidcCallbackEndpointHandler(svc service.Service) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		// The user has denied the authorization, or the provider has failed.
+		if e := q.Get("error"); e != "" {
+			http.Error(w, "identity provider error: "+e, http.StatusUnauthorized)
+			return
+		}
+
+		// The state must come back to the same browser.
+		cookie, err := r.Cookie(oidcStateCookie)
+		if err != nil || q.Get("state") == "" || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(q.Get("state"))) != 1 {
+			http.Error(w, domain.ErrInvalidOIDCState.Error(), http.StatusUnauthorized)
+			return
+		}
+		http.SetCookie(w, &http.Cookie{
+			Name:     oidcStateCookie,
+			Path:     "/",
+			MaxAge:   -1,
+			Secure:   isHTTPS(r),
+			HttpOnly: true,
+			SameSite: http.SameSiteLaxMode,
+		})
+
+		// Execute the command.
+		events, err := svc.Commands.Send(r.Context(), commands.CompleteOIDCLoginCommand{
+			Provider: chi.URLParam(r, "provider"),
+			State:    q.Get("state"),
+			Code:     q.Get("code"),
+			Client:   sessionClient(r),
+		})
+		if err != nil {
+			http.Error(w, err.Error(), errorStatus(err))
+			return
+		}
+
+		writeLoginResponse(w, events)
+	}
+}
+
+// isHTTPS reports whether the request came over HTTPS, directly or through the proxy.
+func isHTTPS(r *http.Request) bool {
+	return r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https"
+}
@@ -0,0 +1,62 @@
+package restapi
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/dmitrymomot/go-smart-monolith/internal/user/app/commands"
+	"github.com/dmitrymomot/go-smart-monolith/internal/user/service"
+)
+
+// forgotPasswordEndpointHandler is a function that handles the HTTP request to send the password reset link.
+// The response is the same whether the user exists or not, so it doesn't reveal the registered emails.
+func forgotPasswordEndpointHandler(svc service.Service) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Parse the request body.
+		payload := struct {
+			Email string `json:"email"`
+		}{}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// Execute the command.
+		if _, err := svc.Commands.Send(r.Context(), commands.RequestPasswordResetCommand{
+			Email: payload.Email,
+		}); err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		// Return 202 Accepted: the email is sent asynchronously, if the user exists.
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
+
+// resetPasswordEndpointHandler is a function that handles the HTTP request to set the new password
+// by the token from the password reset link.
+func resetPasswordEndpointHandler(svc service.Service) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Parse the request body.
+		payload := struct {
+			Token       string `json:"token"`
+			NewPassword string `json:"new_password"`
+		}{}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// Execute the command.
+		if _, err := svc.Commands.Send(r.Context(), commands.ResetPasswordCommand{
+			Token:       payload.Token,
+			NewPassword: payload.NewPassword,
+		}); err != nil {
+			http.Error(w, err.Error(), errorStatus(err))
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -1,34 +1,227 @@
 package restapi
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/dmitrymomot/go-smart-monolith/internal/user/app/commands"
+	"github.com/dmitrymomot/go-smart-monolith/internal/user/app/common"
+	"github.com/dmitrymomot/go-smart-monolith/internal/user/app/queries"
+	"github.com/dmitrymomot/go-smart-monolith/internal/user/domain"
 	"github.com/dmitrymomot/go-smart-monolith/internal/user/service"
+	"github.com/dmitrymomot/go-smart-monolith/pkg/auth"
+	"github.com/dmitrymomot/go-smart-monolith/pkg/idempotency"
+	"github.com/dmitrymomot/go-smart-monolith/pkg/oidc"
+	"github.com/dmitrymomot/go-smart-monolith/pkg/ratelimit"
+
 	"github.com/go-chi/chi/v5"
 )
 
+// tokenVerifier verifies the access tokens, see pkg/auth.
+type tokenVerifier interface {
+	Verify(token string) (auth.Claims, error)
+}
+
 // NewServer creates a new HTTP server.
 // It can be used as a standalone server or as a part of a bigger server.
 // See cmd/api/main.go for an example.
-func NewServer(svc service.Service) http.Handler {
+func NewServer(svc service.Service, tokens tokenVerifier, limiter ratelimit.Limiter, dedup *idempotency.Store, cnf service.Config) http.Handler {
+	limits := cnf.RateLimit
 	r := chi.NewRouter()
 	// Some more specific middlewares might need to be set on
 	// the routes in the user service.
 	// Don't place the same middlewares you setup in main() here,
 	// because they will be applied to all services and endpoints.
-	r.Use(jwtAuthMiddleware)
+	// The requests are limited per IP before the auth, so the floods don't get to it.
+	r.Use(ratelimit.Middleware(limiter, "users_ip", limits.IP, ratelimit.ByIP))
+	r.Use(authMiddleware(tokens, svc.Authenticate, svc.AuthenticateAPIKey))
+	// The caller is authenticated at this point, so it's limited by the principal.
+	r.Use(ratelimit.Middleware(limiter, "users", limits.Default, ratelimit.ByPrincipal))
+	// The public endpoints sending emails or checking the credentials are limited per IP on top of that,
+	// their limits are the last ones, so the responses get their headers.
+	r.Use(ratelimit.Routes(limiter, "users_route", limits.Routes, ratelimit.ByIP))
+	// The endpoints checking or issuing the credentials: the access tokens, the MFA secrets and the API keys.
+	// They are not deduplicated, so the credentials are never stored with the responses.
+	r.Post("/password/reset", resetPasswordEndpointHandler(svc))
+	r.Post("/login", loginEndpointHandler(svc))
+	r.Post("/login/mfa", loginMFAEndpointHandler(svc))
+	r.Post("/{id}/mfa", enrollMFAEndpointHandler(svc))
+	r.Post("/{id}/mfa/confirm", confirmMFAEndpointHandler(svc))
+	r.Post("/{id}/mfa/recovery-codes", regenerateRecoveryCodesEndpointHandler(svc))
+	r.Post("/{id}/api-keys", createAPIKeyEndpointHandler(svc))
+	r.Post("/{id}/api-keys/{key_id}/rotate", rotateAPIKeyEndpointHandler(svc))
+
+	r.Group(func(r chi.Router) {
+		// The retried requests with the Idempotency-Key header get the response of the first one.
+		r.Use(idempotency.Middleware(dedup, cnf.Idempotency.TTL, cnf.Idempotency.Timeout))
 
-	// Mount all endpoints here.
-	r.Post("/", createUserEndpointHandler(svc))
-	r.Get("/{id}", getUserEndpointHandler(svc))
+		// Mount all the other endpoints here.
+		r.Post("/", createUserEndpointHandler(svc))
+		r.Get("/", getUsersEndpointHandler(svc))
+		r.Post("/verify", verifyEmailEndpointHandler(svc))
+		r.Post("/password/forgot", forgotPasswordEndpointHandler(svc))
+		r.Get("/oidc/{provider}/login", startOIDCLoginEndpointHandler(svc))
+		r.Get("/oidc/{provider}/callback", oidcCallbackEndpointHandler(svc))
+		r.Get("/me/sessions", listSessionsEndpointHandler(svc))
+		r.Delete("/me/sessions/{session_id}", revokeSessionEndpointHandler(svc))
+		r.Get("/{id}", getUserEndpointHandler(svc))
+		r.Patch("/{id}", updateProfileEndpointHandler(svc))
+		r.Put("/{id}/email", changeEmailEndpointHandler(svc))
+		r.Put("/{id}/password", changePasswordEndpointHandler(svc))
+		r.Delete("/{id}", deleteUserEndpointHandler(svc))
+		r.Post("/{id}/restore", restoreUserEndpointHandler(svc))
+		r.Post("/{id}/unlock", unlockAccountEndpointHandler(svc))
+		r.Post("/{id}/mfa/disable", disableMFAEndpointHandler(svc))
+		r.Get("/{id}/api-keys", listAPIKeysEndpointHandler(svc))
+		r.Delete("/{id}/api-keys/{key_id}", revokeAPIKeyEndpointHandler(svc))
+		r.Delete("/{id}/sessions", revokeSessionsEndpointHandler(svc))
+	})
 
 	return r
 }
 
-// jwtAuthMiddleware is a middleware that checks if the request is authorized.
-// It's just an example of a middleware. Don't pay attention to implementation.
-func jwtAuthMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// TODO: Implement JWT auth here.
-	})
+// authMiddleware is a middleware that authenticates the caller by the bearer token:
+// an access token or an API key, see domain.APIKeyPrefix.
+// The requests without a token are passed as anonymous, so the public endpoints work,
+// and the protected commands fail with auth.ErrUnauthenticated.
+// The requests with an invalid token, a token of a revoked session or an inactive API key are rejected.
+func authMiddleware(
+	tokens tokenVerifier,
+	authenticate common.QueryHandler[queries.AuthenticateQuery, auth.Principal],
+	authenticateAPIKey common.QueryHandler[queries.AuthenticateAPIKeyQuery, auth.Principal],
+) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			header := r.Header.Get("Authorization")
+			if header == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			token, ok := strings.CutPrefix(header, "Bearer ")
+			if !ok {
+				http.Error(w, "invalid authorization header", http.StatusUnauthorized)
+				return
+			}
+
+			var (
+				principal auth.Principal
+				err       error
+			)
+			if domain.IsAPIKey(token) {
+				principal, err = authenticateAPIKey(r.Context(), queries.AuthenticateAPIKeyQuery{Key: token})
+				if errors.Is(err, domain.ErrAPIKeyExpired) || errors.Is(err, domain.ErrAPIKeyRevoked) {
+					// The key is not usable, whatever the reason.
+					err = fmt.Errorf("%w: %w", auth.ErrUnauthenticated, err)
+				}
+			} else {
+				var claims auth.Claims
+				claims, err = tokens.Verify(token)
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusUnauthorized)
+					return
+				}
+				principal, err = authenticate(r.Context(), queries.AuthenticateQuery{
+					UserID:    claims.Subject,
+					SessionID: claims.SessionID,
+					IssuedAt:  time.Unix(claims.IssuedAt, 0),
+				})
+			}
+			if err != nil {
+				http.Error(w, err.Error(), errorStatus(err))
+				return
+			}
+
+			ctx := auth.WithPrincipal(r.Context(), principal)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// errorStatus maps the application errors to the HTTP status codes.
+// Unknown errors are reported as 500.
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, auth.ErrUnauthenticated),
+		errors.Is(err, domain.ErrSessionRevoked),
+		errors.Is(err, domain.ErrInvalidCredentials),
+		errors.Is(err, domain.ErrInvalidMFAChallenge),
+		errors.Is(err, domain.ErrInvalidAPIKey),
+		errors.Is(err, domain.ErrInvalidOIDCState),
+		errors.Is(err, oidc.ErrExchange),
+		errors.Is(err, oidc.ErrInvalidIDToken):
+		return http.StatusUnauthorized
+	case errors.Is(err, auth.ErrForbidden),
+		errors.Is(err, domain.ErrIdentityEmailNotVerified):
+		return http.StatusForbidden
+	case errors.Is(err, domain.ErrUserNotFound),
+		errors.Is(err, domain.ErrAPIKeyNotFound),
+		errors.Is(err, domain.ErrSessionNotFound),
+		errors.Is(err, domain.ErrUnknownIdentityProvider):
+		return http.StatusNotFound
+	case errors.Is(err, domain.ErrEmailTaken),
+		errors.Is(err, commands.ErrUserAlreadyExists),
+		errors.Is(err, commands.ErrUserNotDeleted),
+		errors.Is(err, domain.ErrMFAAlreadyEnabled),
+		errors.Is(err, domain.ErrMFANotEnabled),
+		errors.Is(err, domain.ErrMFANotEnrolled),
+		errors.Is(err, domain.ErrAPIKeyRevoked),
+		errors.Is(err, domain.ErrIdentityTaken):
+		return http.StatusConflict
+	case errors.Is(err, commands.ErrRestoreWindowExpired),
+		errors.Is(err, domain.ErrVerificationTokenExpired),
+		errors.Is(err, domain.ErrPasswordResetTokenExpired),
+		errors.Is(err, domain.ErrMFAChallengeExpired),
+		errors.Is(err, domain.ErrAPIKeyExpired),
+		errors.Is(err, domain.ErrOIDCStateExpired):
+		return http.StatusGone
+	case errors.Is(err, domain.ErrConcurrentModification):
+		return http.StatusPreconditionFailed
+	case errors.Is(err, domain.ErrAccountLocked):
+		return http.StatusTooManyRequests
+	case errors.Is(err, oidc.ErrDiscovery):
+		return http.StatusBadGateway
+	case errors.Is(err, domain.ErrInvalidEmail),
+		errors.Is(err, domain.ErrInvalidPassword),
+		errors.Is(err, domain.ErrWeakPassword),
+		errors.Is(err, domain.ErrInvalidDisplayName),
+		errors.Is(err, domain.ErrInvalidVerificationToken),
+		errors.Is(err, domain.ErrInvalidPasswordResetToken),
+		errors.Is(err, domain.ErrInvalidMFACode),
+		errors.Is(err, domain.ErrInvalidAPIKeyName),
+		errors.Is(err, domain.ErrInvalidAPIKeyScopes),
+		errors.Is(err, commands.ErrInvalidAPIKeyTTL):
+		return http.StatusUnprocessableEntity
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// formatETag formats the user version as a strong entity tag.
+func formatETag(version int64) string {
+	return strconv.Quote(strconv.FormatInt(version, 10))
+}
+
+// ifMatchVersion returns the user version from the If-Match header,
+// or zero if the header is missing or "*", so the version isn't checked.
+// Only a single strong entity tag returned by GET /{id} is supported,
+// any other tag can't match the user and fails the request with 412.
+func ifMatchVersion(r *http.Request) (int64, bool) {
+	header := strings.TrimSpace(r.Header.Get("If-Match"))
+	if header == "" || header == "*" {
+		return 0, true
+	}
+	tag, err := strconv.Unquote(header)
+	if err != nil {
+		return 0, false
+	}
+	version, err := strconv.ParseInt(tag, 10, 64)
+	if err != nil || version <= 0 {
+		return 0, false
+	}
+	return version, true
 }
@@ -0,0 +1,185 @@
+package restapi
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dmitrymomot/go-smart-monolith/internal/user/app/commands"
+	"github.com/dmitrymomot/go-smart-monolith/internal/user/app/queries"
+	"github.com/dmitrymomot/go-smart-monolith/internal/user/domain"
+	"github.com/dmitrymomot/go-smart-monolith/internal/user/service"
+	"github.com/dmitrymomot/go-smart-monolith/pkg/auth"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// SessionResponse represents a session in the ListSessions response.
+type SessionResponse struct {
+	ID         string    `json:"id"`
+	Device     string    `json:"device"`
+	IP         string    `json:"ip"`
+	UserAgent  string    `json:"user_agent"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	Current    bool      `json:"current"`
+}
+
+// listSessionsEndpointHandler is a function that handles the HTTP request to list the sessions of the caller.
+func listSessionsEndpointHandler(svc service.Service) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal, err := currentUser(r)
+		if err != nil {
+			http.Error(w, err.Error(), errorStatus(err))
+			return
+		}
+
+		// Execute the query.
+		sessions, err := svc.ListSessions(r.Context(), queries.ListSessionsQuery{
+			UserID:           principal.UserID,
+			CurrentSessionID: principal.SessionID,
+		})
+		if err != nil {
+			http.Error(w, err.Error(), errorStatus(err))
+			return
+		}
+
+		resp := struct {
+			Sessions []SessionResponse `json:"sessions"`
+		}{Sessions: make([]SessionResponse, 0, len(sessions))}
+		for _, s := range sessions {
+			resp.Sessions = append(resp.Sessions, SessionResponse{
+				ID:         s.ID,
+				Device:     s.Device,
+				IP:         s.IP,
+				UserAgent:  s.UserAgent,
+				CreatedAt:  s.CreatedAt,
+				LastSeenAt: s.LastSeenAt,
+				ExpiresAt:  s.ExpiresAt,
+				Current:    s.Current,
+			})
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// revokeSessionEndpointHandler is a function that handles the HTTP request to revoke a session of the caller,
+// e.g. to log out or to log out a lost device.
+func revokeSessionEndpointHandler(svc service.Service) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal, err := currentUser(r)
+		if err != nil {
+			http.Error(w, err.Error(), errorStatus(err))
+			return
+		}
+
+		// Execute the command.
+		if _, err := svc.Commands.Send(r.Context(), commands.RevokeSessionCommand{
+			UserID:    principal.UserID,
+			SessionID: chi.URLParam(r, "session_id"),
+		}); err != nil {
+			http.Error(w, err.Error(), errorStatus(err))
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// revokeSessionsEndpointHandler is a function that handles the HTTP request to revoke all the user sessions.
+func revokeSessionsEndpointHandler(svc service.Service) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Execute the command.
+		if _, err := svc.Commands.Send(r.Context(), commands.RevokeSessionsCommand{
+			UserID: chi.URLParam(r, "id"),
+		}); err != nil {
+			http.Error(w, err.Error(), errorStatus(err))
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// currentUser returns the caller of the /me endpoints.
+// The API keys don't act as their owner, so they are forbidden.
+func currentUser(r *http.Request) (auth.Principal, error) {
+	p, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
+		return auth.Principal{}, auth.ErrUnauthenticated
+	}
+	if p.UserID == "" {
+		return auth.Principal{}, auth.ErrForbidden
+	}
+	return p, nil
+}
+
+// sessionClient describes the client of the login request to be recorded in the session.
+// The IP is the address of the peer: put a middleware resolving the client IP,
+// e.g. chi middleware.RealIP, in front of the server if it runs behind a trusted proxy.
+func sessionClient(r *http.Request) domain.SessionClient {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	return domain.SessionClient{
+		Device:    deviceName(r.UserAgent()),
+		IP:        ip,
+		UserAgent: r.UserAgent(),
+	}
+}
+
+// deviceName returns a coarse human readable name of the user agent, e.g. "Chrome on Windows",
+// so the users can tell their sessions apart. It's not meant to be exact.
+func deviceName(userAgent string) string {
+	// The order matters: the user agents mention the engines they are compatible with.
+	browsers := []struct{ token, name string }{
+		{"Edg/", "Edge"},
+		{"OPR/", "Opera"},
+		{"Firefox/", "Firefox"},
+		{"Chrome/", "Chrome"},
+		{"Safari/", "Safari"},
+		{"curl/", "curl"},
+	}
+	systems := []struct{ token, name string }{
+		{"Android", "Android"},
+		{"iPhone", "iOS"},
+		{"iPad", "iPadOS"},
+		{"Windows", "Windows"},
+		{"Mac OS X", "macOS"},
+		{"Linux", "Linux"},
+	}
+
+	browser, system := "", ""
+	for _, b := range browsers {
+		if strings.Contains(userAgent, b.token) {
+			browser = b.name
+			break
+		}
+	}
+	for _, s := range systems {
+		if strings.Contains(userAgent, s.token) {
+			system = s.name
+			break
+		}
+	}
+
+	switch {
+	case browser != "" && system != "":
+		return browser + " on " + system
+	case browser != "":
+		return browser
+	case system != "":
+		return system
+	default:
+		return "Unknown device"
+	}
+}
@@ -0,0 +1,112 @@
+package restapi
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/dmitrymomot/go-smart-monolith/internal/user/app/commands"
+	"github.com/dmitrymomot/go-smart-monolith/internal/user/service"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// updateProfileEndpointHandler is a function that handles the HTTP request to update the user profile.
+func updateProfileEndpointHandler(svc service.Service) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Parse the request body.
+		payload := struct {
+			DisplayName string `json:"display_name"`
+		}{}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// Check the precondition: the user must not be changed since the client read it.
+		version, ok := ifMatchVersion(r)
+		if !ok {
+			http.Error(w, "etag doesn't match", http.StatusPreconditionFailed)
+			return
+		}
+
+		// Execute the command.
+		if _, err := svc.Commands.Send(r.Context(), commands.UpdateProfileCommand{
+			UserID:          chi.URLParam(r, "id"),
+			DisplayName:     payload.DisplayName,
+			ExpectedVersion: version,
+		}); err != nil {
+			http.Error(w, err.Error(), errorStatus(err))
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// changeEmailEndpointHandler is a function that handles the HTTP request to change the user email.
+func changeEmailEndpointHandler(svc service.Service) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Parse the request body.
+		payload := struct {
+			Email string `json:"email"`
+		}{}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// Check the precondition: the user must not be changed since the client read it.
+		version, ok := ifMatchVersion(r)
+		if !ok {
+			http.Error(w, "etag doesn't match", http.StatusPreconditionFailed)
+			return
+		}
+
+		// Execute the command.
+		if _, err := svc.Commands.Send(r.Context(), commands.ChangeEmailCommand{
+			UserID:          chi.URLParam(r, "id"),
+			Email:           payload.Email,
+			ExpectedVersion: version,
+		}); err != nil {
+			http.Error(w, err.Error(), errorStatus(err))
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// changePasswordEndpointHandler is a function that handles the HTTP request to change the user password.
+func changePasswordEndpointHandler(svc service.Service) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Parse the request body.
+		payload := struct {
+			OldPassword string `json:"old_password"`
+			NewPassword string `json:"new_password"`
+		}{}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// Check the precondition: the user must not be changed since the client read it.
+		version, ok := ifMatchVersion(r)
+		if !ok {
+			http.Error(w, "etag doesn't match", http.StatusPreconditionFailed)
+			return
+		}
+
+		// Execute the command.
+		if _, err := svc.Commands.Send(r.Context(), commands.ChangePasswordCommand{
+			UserID:          chi.URLParam(r, "id"),
+			OldPassword:     payload.OldPassword,
+			NewPassword:     payload.NewPassword,
+			ExpectedVersion: version,
+		}); err != nil {
+			http.Error(w, err.Error(), errorStatus(err))
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,34 @@
+package restapi
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/dmitrymomot/go-smart-monolith/internal/user/app/commands"
+	"github.com/dmitrymomot/go-smart-monolith/internal/user/service"
+)
+
+// verifyEmailEndpointHandler is a function that handles the HTTP request to verify the user email
+// by the token sent to it. It's public: the token proves the email ownership.
+func verifyEmailEndpointHandler(svc service.Service) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Parse the request body.
+		payload := struct {
+			Token string `json:"token"`
+		}{}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// Execute the command.
+		if _, err := svc.Commands.Send(r.Context(), commands.VerifyEmailCommand{
+			Token: payload.Token,
+		}); err != nil {
+			http.Error(w, err.Error(), errorStatus(err))
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -2,36 +2,231 @@ package service
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"net/http"
+	"net/url"
+	"regexp"
+	"time"
 
 	"github.com/dmitrymomot/go-smart-monolith/internal/user/adapters/messagebus"
 	"github.com/dmitrymomot/go-smart-monolith/internal/user/adapters/players"
 	"github.com/dmitrymomot/go-smart-monolith/internal/user/adapters/storage"
 	"github.com/dmitrymomot/go-smart-monolith/internal/user/app/commands"
 	"github.com/dmitrymomot/go-smart-monolith/internal/user/app/common"
+	"github.com/dmitrymomot/go-smart-monolith/internal/user/app/decorators/authz"
 	"github.com/dmitrymomot/go-smart-monolith/internal/user/app/decorators/events"
+	"github.com/dmitrymomot/go-smart-monolith/internal/user/app/decorators/idempotent"
+	"github.com/dmitrymomot/go-smart-monolith/internal/user/app/decorators/lockout"
 	"github.com/dmitrymomot/go-smart-monolith/internal/user/app/decorators/logger"
 	"github.com/dmitrymomot/go-smart-monolith/internal/user/app/queries"
+	"github.com/dmitrymomot/go-smart-monolith/internal/user/domain"
+	"github.com/dmitrymomot/go-smart-monolith/pkg/auth"
+	"github.com/dmitrymomot/go-smart-monolith/pkg/contracts/playerapi"
+	"github.com/dmitrymomot/go-smart-monolith/pkg/dataloader"
+	"github.com/dmitrymomot/go-smart-monolith/pkg/health"
+	"github.com/dmitrymomot/go-smart-monolith/pkg/idempotency"
+	"github.com/dmitrymomot/go-smart-monolith/pkg/oidc"
+	"github.com/dmitrymomot/go-smart-monolith/pkg/ratelimit"
+	kvstorage "github.com/dmitrymomot/go-smart-monolith/pkg/storage"
 )
 
 type (
 	// Service is a user service facade.
 	// It's just a collection of the query and command handlers with the service configuration.
 	Service struct {
-		GetUser    common.QueryHandler[queries.GetUserQuery, queries.User]
-		CreateUser common.CommandHandler[commands.CreateUserCommand]
+		GetUser       common.QueryHandler[queries.GetUserQuery, queries.User]
+		GetUsersByIDs common.QueryHandler[queries.GetUsersByIDsQuery, queries.Users]
+		ListUsers     common.QueryHandler[queries.ListUsersQuery, queries.UsersPage]
+		CreateUser    common.CommandHandler[commands.CreateUserCommand]
+		Authenticate  common.QueryHandler[queries.AuthenticateQuery, auth.Principal]
+
+		UpdateProfile     common.CommandHandler[commands.UpdateProfileCommand]
+		ChangeEmail       common.CommandHandler[commands.ChangeEmailCommand]
+		ChangePassword    common.CommandHandler[commands.ChangePasswordCommand]
+		DeleteUser        common.CommandHandler[commands.DeleteUserCommand]
+		RestoreUser       common.CommandHandler[commands.RestoreUserCommand]
+		PurgeDeletedUsers common.CommandHandler[commands.PurgeDeletedUsersCommand]
+
+		RequestEmailVerification common.CommandHandler[commands.RequestEmailVerificationCommand]
+		VerifyEmail              common.CommandHandler[commands.VerifyEmailCommand]
+		RequestPasswordReset     common.CommandHandler[commands.RequestPasswordResetCommand]
+		ResetPassword            common.CommandHandler[commands.ResetPasswordCommand]
+
+		Login                   common.CommandHandler[commands.LoginCommand]
+		LoginMFA                common.CommandHandler[commands.LoginMFACommand]
+		UnlockAccount           common.CommandHandler[commands.UnlockAccountCommand]
+		EnrollMFA               common.CommandHandler[commands.EnrollMFACommand]
+		ConfirmMFA              common.CommandHandler[commands.ConfirmMFACommand]
+		DisableMFA              common.CommandHandler[commands.DisableMFACommand]
+		RegenerateRecoveryCodes common.CommandHandler[commands.RegenerateRecoveryCodesCommand]
+
+		AuthenticateAPIKey common.QueryHandler[queries.AuthenticateAPIKeyQuery, auth.Principal]
+		ListAPIKeys        common.QueryHandler[queries.ListAPIKeysQuery, []queries.APIKey]
+		CreateAPIKey       common.CommandHandler[commands.CreateAPIKeyCommand]
+		RotateAPIKey       common.CommandHandler[commands.RotateAPIKeyCommand]
+		RevokeAPIKey       common.CommandHandler[commands.RevokeAPIKeyCommand]
+
+		StartOIDCLogin    common.CommandHandler[commands.StartOIDCLoginCommand]
+		CompleteOIDCLogin common.CommandHandler[commands.CompleteOIDCLoginCommand]
+
+		ListSessions   common.QueryHandler[queries.ListSessionsQuery, []queries.Session]
+		RevokeSession  common.CommandHandler[commands.RevokeSessionCommand]
+		RevokeSessions common.CommandHandler[commands.RevokeSessionsCommand]
+
+		// Commands dispatches all the commands above by their type.
+		// The ports send the commands through it, so a middleware added with Use
+		// applies to every port: REST, gRPC, the message bus and the jobs.
+		Commands *common.CommandBus
+
+		// HealthChecks are the probes of the service-specific dependencies,
+		// e.g. other services the user service calls.
+		HealthChecks []health.Check
 	}
 
 	// Config holds the user service configuration.
+	// See pkg/config for the supported struct tags.
 	Config struct {
-		Flag              bool
-		PlayerSvcEndpoint string
+		PlayerSvcEndpoint string `yaml:"player_svc_endpoint" env:"PLAYER_SVC_ENDPOINT"`
+		// PlayerSvcTransport is one of "http", "grpc", "inproc" or empty.
+		// Empty value means the transport is chosen by the app: in-process
+		// if the players module is built into the same binary, HTTP otherwise.
+		PlayerSvcTransport string `yaml:"player_svc_transport" env:"PLAYER_SVC_TRANSPORT"`
+		// PlayerSvcGRPCEndpoints is a list of the players service gRPC instances
+		// the calls are balanced across, e.g. "players-1:9090,players-2:9090".
+		PlayerSvcGRPCEndpoints []string `yaml:"player_svc_grpc_endpoints" env:"PLAYER_SVC_GRPC_ENDPOINTS"`
+		// PlayerSvcTimeout is applied to the gRPC calls if the request context has no deadline.
+		PlayerSvcTimeout time.Duration `yaml:"player_svc_timeout" env:"PLAYER_SVC_TIMEOUT" default:"3s"`
+		// PlayerSvcMaxAttempts is the max number of gRPC call attempts, including the first one.
+		PlayerSvcMaxAttempts int `yaml:"player_svc_max_attempts" env:"PLAYER_SVC_MAX_ATTEMPTS" default:"3"`
+		// PlayerSvcBatchWait is how long the concurrent GetPlayer calls are collected
+		// into a single batch call, if the players client supports it. Zero disables batching.
+		PlayerSvcBatchWait time.Duration `yaml:"player_svc_batch_wait" env:"PLAYER_SVC_BATCH_WAIT" default:"1ms"`
+
+		// JWTSecret is the secret the access tokens are signed with.
+		// If it's empty, the callers can't be authenticated, so only the public endpoints work.
+		JWTSecret string `yaml:"jwt_secret" env:"JWT_SECRET" secret:"true"`
+		// AdminEmails are the emails of the users granted the admin role once they prove the email ownership,
+		// by the verification link or by the identity provider. See commands.AdminEmails.
+		AdminEmails []string `yaml:"admin_emails" env:"ADMIN_EMAILS"`
+
+		// DeleteRestoreWindow is how long a deleted user can be restored before it's purged.
+		DeleteRestoreWindow time.Duration `yaml:"delete_restore_window" env:"DELETE_RESTORE_WINDOW" default:"720h"`
+		// PurgeInterval is how often the deleted users are purged.
+		PurgeInterval time.Duration `yaml:"purge_interval" env:"PURGE_INTERVAL" default:"1h"`
+
+		// EmailVerificationTTL is how long the email verification link is valid.
+		EmailVerificationTTL time.Duration `yaml:"email_verification_ttl" env:"EMAIL_VERIFICATION_TTL" default:"24h"`
+		// EmailVerificationURL is the page the email verification link leads to,
+		// the token is added as the "token" query parameter.
+		EmailVerificationURL string `yaml:"email_verification_url" env:"EMAIL_VERIFICATION_URL" default:"http://localhost:8080/verify-email"`
+		// MailFrom is the sender of the user service emails.
+		MailFrom string `yaml:"mail_from" env:"MAIL_FROM" default:"no-reply@localhost"`
+
+		// PasswordResetTTL is how long the password reset link is valid.
+		PasswordResetTTL time.Duration `yaml:"password_reset_ttl" env:"PASSWORD_RESET_TTL" default:"30m"`
+		// PasswordResetURL is the page the password reset link leads to,
+		// the token is added as the "token" query parameter.
+		PasswordResetURL string `yaml:"password_reset_url" env:"PASSWORD_RESET_URL" default:"http://localhost:8080/reset-password"`
+
+		// AccessTokenTTL is how long the access token issued on login is valid.
+		AccessTokenTTL time.Duration `yaml:"access_token_ttl" env:"ACCESS_TOKEN_TTL" default:"1h"`
+		// MFAChallengeTTL is how long the user has to enter the second factor on login.
+		MFAChallengeTTL time.Duration `yaml:"mfa_challenge_ttl" env:"MFA_CHALLENGE_TTL" default:"5m"`
+		// MFAIssuer is the name the authenticator apps show the TOTP secrets under.
+		MFAIssuer string `yaml:"mfa_issuer" env:"MFA_ISSUER" default:"go-smart-monolith"`
+
+		// APIKeyDefaultTTL is the lifetime of the API keys created without the TTL.
+		APIKeyDefaultTTL time.Duration `yaml:"api_key_default_ttl" env:"API_KEY_DEFAULT_TTL" default:"2160h"`
+		// APIKeyMaxTTL is the max lifetime of the API keys.
+		APIKeyMaxTTL time.Duration `yaml:"api_key_max_ttl" env:"API_KEY_MAX_TTL" default:"8760h"`
+
+		// OIDC is the OpenID Connect provider the users can log in with, e.g. Google.
+		OIDC OIDCConfig `yaml:"oidc" envPrefix:"OIDC_"`
+		// Lockout is the login brute-force protection.
+		Lockout LockoutConfig `yaml:"lockout" envPrefix:"LOCKOUT_"`
+		// RateLimit limits the REST API requests.
+		RateLimit RateLimitConfig `yaml:"rate_limit" envPrefix:"RATE_LIMIT_"`
+		// Idempotency deduplicates the retried requests and messages.
+		Idempotency IdempotencyConfig `yaml:"idempotency" envPrefix:"IDEMPOTENCY_"`
+	}
+
+	// IdempotencyConfig holds the deduplication configuration of the retried requests and messages,
+	// see pkg/idempotency.
+	IdempotencyConfig struct {
+		// TTL is how long the results are replayed to the retries with the same idempotency key.
+		TTL time.Duration `yaml:"ttl" env:"TTL" default:"24h"`
+		// Timeout is how long a request in progress holds its key at most,
+		// so the retries are not blocked forever if it crashed.
+		Timeout time.Duration `yaml:"timeout" env:"TIMEOUT" default:"1m"`
+	}
+
+	// RateLimitConfig holds the REST API rate limits in the "<requests>/<period>" format,
+	// see ratelimit.ParseLimit. The empty limit disables it.
+	RateLimitConfig struct {
+		// Backend is one of "memory", the limits are per instance,
+		// or "storage", the limits are shared by the instances.
+		Backend string `yaml:"backend" env:"BACKEND" default:"memory"`
+		// IP limits all the requests from an IP before the callers are authenticated,
+		// so the floods don't get to the auth. It's above Default: many users may share an IP.
+		IP ratelimit.Limit `yaml:"ip" env:"IP" default:"1200/1m"`
+		// Default limits all the requests of a caller: a user, an API key or an anonymous IP.
+		Default ratelimit.Limit `yaml:"default" env:"DEFAULT" default:"600/1m"`
+		// Routes limits the requests to the routes from an IP on top of that, in the "<method> <pattern>=<limit>"
+		// format, see ratelimit.ParseRoute. By default the sign-ups, the logins, including the second
+		// factor ones, and the password reset emails are limited.
+		Routes []ratelimit.Route `yaml:"routes" env:"ROUTES" default:"POST /users=20/1h,POST /users/login*=30/1m,POST /users/password/forgot=5/1h"`
+	}
+
+	// LockoutConfig holds the login lockout configuration, see domain.LockoutPolicy.
+	LockoutConfig struct {
+		// MaxFailures is the number of the failed logins in a row to an account it's locked after.
+		MaxFailures int `yaml:"max_failures" env:"MAX_FAILURES" default:"5"`
+		// IPMaxFailures is the number of the failed logins in a row from an IP it's locked after.
+		IPMaxFailures int `yaml:"ip_max_failures" env:"IP_MAX_FAILURES" default:"50"`
+		// Duration is how long the first lock lasts, each next one lasts twice as long.
+		Duration time.Duration `yaml:"duration" env:"DURATION" default:"1m"`
+		// MaxDuration is the max lock duration.
+		MaxDuration time.Duration `yaml:"max_duration" env:"MAX_DURATION" default:"1h"`
+		// Window is how long the failed logins are remembered.
+		Window time.Duration `yaml:"window" env:"WINDOW" default:"15m"`
+	}
+
+	// OIDCConfig holds the OpenID Connect provider configuration.
+	// The login with the provider is disabled if its issuer URL is not set.
+	OIDCConfig struct {
+		// Name is the provider name in the login URLs: /users/oidc/{name}/login.
+		Name string `yaml:"name" env:"NAME"`
+		// IssuerURL is the provider issuer, e.g. "https://accounts.google.com".
+		IssuerURL    string `yaml:"issuer_url" env:"ISSUER_URL"`
+		ClientID     string `yaml:"client_id" env:"CLIENT_ID"`
+		ClientSecret string `yaml:"client_secret" env:"CLIENT_SECRET" secret:"true"`
+		// RedirectURL is the callback registered at the provider: /users/oidc/{name}/callback.
+		RedirectURL string   `yaml:"redirect_url" env:"REDIRECT_URL"`
+		Scopes      []string `yaml:"scopes" env:"SCOPES" default:"openid,email,profile"`
+		// StateTTL is how long the user has to authorize at the provider.
+		StateTTL time.Duration `yaml:"state_ttl" env:"STATE_TTL" default:"10m"`
+	}
+
+	// PlayersClient is the players service client used by the user service.
+	// See adapters/players for the implementations.
+	PlayersClient interface {
+		GetPlayer(ctx context.Context, userID string) (domain.Player, error)
+		HealthCheck(ctx context.Context) error
+	}
+
+	// batchPlayersClient is a players client with the batch API, see adapters/players.
+	batchPlayersClient interface {
+		PlayersClient
+		GetPlayers(ctx context.Context, userIDs []string) (map[string]domain.Player, error)
 	}
 
 	// low-level abstraction for the storage.
 	storageService interface {
 		Get(ctx context.Context, key string) (interface{}, error)
 		Set(ctx context.Context, key string, value interface{}) error
+		Scan(ctx context.Context, opts kvstorage.ScanOptions) ([]kvstorage.KV, error)
+		Delete(ctx context.Context, key string) error
 	}
 
 	// low-level abstraction for the logger.
@@ -39,76 +234,529 @@ type (
 		Error(err error, kv ...interface{})
 	}
 
+	// low-level abstraction for the feature flags provider.
+	featureFlags interface {
+		Enabled(ctx context.Context, flag string) bool
+	}
+
 	// low-level abstraction for the NATS client.
 	natsClient interface {
 		Publish(subject string, body []byte) error
 	}
 )
 
+// Players service transports.
+const (
+	PlayerSvcTransportHTTP      = "http"
+	PlayerSvcTransportGRPC      = "grpc"
+	PlayerSvcTransportInProcess = "inproc"
+)
+
+// Rate limiter backends.
+const (
+	RateLimitBackendMemory  = "memory"
+	RateLimitBackendStorage = "storage"
+)
+
+// minJWTSecretLength is the min length of the HS256 secret: 256 bits.
+const minJWTSecretLength = 32
+
+// oidcProviderName is the format of the identity provider names, they are used in the URLs.
+var oidcProviderName = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+
+// ErrPlayersModuleNotFound is returned when the in-process transport is requested,
+// but the players module is not built into the binary.
+var ErrPlayersModuleNotFound = errors.New("players module is not built into this binary")
+
+// Validate validates the user service configuration.
+func (c *Config) Validate() error {
+	if c.PlayerSvcEndpoint != "" {
+		u, err := url.Parse(c.PlayerSvcEndpoint)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("player_svc_endpoint: invalid URL %q", c.PlayerSvcEndpoint)
+		}
+	}
+	switch c.PlayerSvcTransport {
+	case "", PlayerSvcTransportHTTP, PlayerSvcTransportInProcess:
+	case PlayerSvcTransportGRPC:
+		if len(c.PlayerSvcGRPCEndpoints) == 0 {
+			return fmt.Errorf("player_svc_grpc_endpoints: required for %q transport", PlayerSvcTransportGRPC)
+		}
+	default:
+		return fmt.Errorf("player_svc_transport: must be %q, %q or %q, got %q",
+			PlayerSvcTransportHTTP, PlayerSvcTransportGRPC, PlayerSvcTransportInProcess, c.PlayerSvcTransport)
+	}
+	if c.JWTSecret != "" && len(c.JWTSecret) < minJWTSecretLength {
+		return fmt.Errorf("jwt_secret: must be at least %d characters long", minJWTSecretLength)
+	}
+	if c.DeleteRestoreWindow < 0 {
+		return fmt.Errorf("delete_restore_window: must not be negative, got %s", c.DeleteRestoreWindow)
+	}
+	if c.PurgeInterval <= 0 {
+		return fmt.Errorf("purge_interval: must be positive, got %s", c.PurgeInterval)
+	}
+	if c.EmailVerificationTTL <= 0 {
+		return fmt.Errorf("email_verification_ttl: must be positive, got %s", c.EmailVerificationTTL)
+	}
+	if u, err := url.Parse(c.EmailVerificationURL); err != nil || u.Scheme == "" || u.Host == "" {
+		return fmt.Errorf("email_verification_url: invalid URL %q", c.EmailVerificationURL)
+	}
+	if c.PasswordResetTTL <= 0 {
+		return fmt.Errorf("password_reset_ttl: must be positive, got %s", c.PasswordResetTTL)
+	}
+	if u, err := url.Parse(c.PasswordResetURL); err != nil || u.Scheme == "" || u.Host == "" {
+		return fmt.Errorf("password_reset_url: invalid URL %q", c.PasswordResetURL)
+	}
+	if c.AccessTokenTTL <= 0 {
+		return fmt.Errorf("access_token_ttl: must be positive, got %s", c.AccessTokenTTL)
+	}
+	if c.MFAChallengeTTL <= 0 {
+		return fmt.Errorf("mfa_challenge_ttl: must be positive, got %s", c.MFAChallengeTTL)
+	}
+	if c.MFAIssuer == "" {
+		return fmt.Errorf("mfa_issuer: required")
+	}
+	if c.APIKeyDefaultTTL <= 0 || c.APIKeyDefaultTTL > c.APIKeyMaxTTL {
+		return fmt.Errorf("api_key_default_ttl: must be positive and not longer than api_key_max_ttl, got %s", c.APIKeyDefaultTTL)
+	}
+	if c.MailFrom == "" {
+		return fmt.Errorf("mail_from: required")
+	}
+	if c.PlayerSvcMaxAttempts < 0 {
+		return fmt.Errorf("player_svc_max_attempts: must not be negative, got %d", c.PlayerSvcMaxAttempts)
+	}
+	return nil
+}
+
+// Validate validates the OpenID Connect provider configuration.
+func (c *OIDCConfig) Validate() error {
+	if c.IssuerURL == "" {
+		return nil
+	}
+	if u, err := url.Parse(c.IssuerURL); err != nil || u.Scheme == "" || u.Host == "" {
+		return fmt.Errorf("issuer_url: invalid URL %q", c.IssuerURL)
+	}
+	if !oidcProviderName.MatchString(c.Name) {
+		return fmt.Errorf("name: must be lowercase letters, digits and dashes, got %q", c.Name)
+	}
+	if c.ClientID == "" {
+		return fmt.Errorf("client_id: required")
+	}
+	if u, err := url.Parse(c.RedirectURL); err != nil || u.Scheme == "" || u.Host == "" {
+		return fmt.Errorf("redirect_url: invalid URL %q", c.RedirectURL)
+	}
+	if c.StateTTL <= 0 {
+		return fmt.Errorf("state_ttl: must be positive, got %s", c.StateTTL)
+	}
+	return nil
+}
+
+// Validate validates the login lockout configuration.
+func (c *LockoutConfig) Validate() error {
+	if c.MaxFailures <= 0 {
+		return fmt.Errorf("max_failures: must be positive, got %d", c.MaxFailures)
+	}
+	if c.IPMaxFailures < c.MaxFailures {
+		return fmt.Errorf("ip_max_failures: must not be less than max_failures, got %d", c.IPMaxFailures)
+	}
+	if c.Duration <= 0 || c.Duration > c.MaxDuration {
+		return fmt.Errorf("duration: must be positive and not longer than max_duration, got %s", c.Duration)
+	}
+	if c.Window <= 0 {
+		return fmt.Errorf("window: must be positive, got %s", c.Window)
+	}
+	return nil
+}
+
+// options returns the lockout policies of the accounts and of the IPs.
+func (c LockoutConfig) options() lockout.Options {
+	policy := domain.LockoutPolicy{
+		MaxFailures: c.MaxFailures,
+		Lockout:     c.Duration,
+		MaxLockout:  c.MaxDuration,
+		Window:      c.Window,
+	}
+	ipPolicy := policy
+	ipPolicy.MaxFailures = c.IPMaxFailures
+	return lockout.Options{Account: policy, IP: ipPolicy}
+}
+
+// Validate validates the rate limits configuration.
+func (c *RateLimitConfig) Validate() error {
+	switch c.Backend {
+	case RateLimitBackendMemory, RateLimitBackendStorage:
+	default:
+		return fmt.Errorf("backend: must be %q or %q, got %q", RateLimitBackendMemory, RateLimitBackendStorage, c.Backend)
+	}
+	return nil
+}
+
+// Validate validates the idempotency configuration.
+func (c *IdempotencyConfig) Validate() error {
+	if c.TTL <= 0 {
+		return fmt.Errorf("ttl: must be positive, got %s", c.TTL)
+	}
+	if c.Timeout <= 0 {
+		return fmt.Errorf("timeout: must be positive, got %s", c.Timeout)
+	}
+	return nil
+}
+
+// options returns the deduplication options of the commands.
+func (c IdempotencyConfig) options() idempotent.Options {
+	return idempotent.Options{TTL: c.TTL, Timeout: c.Timeout}
+}
+
+// NewPlayersClient returns the players service client for the configured transport.
+// Pass the players module as local if it's built into the same binary, or nil otherwise.
+// The gRPC transport is used only if it's set explicitly. Its client holds the
+// connections to the players service, so close it if it implements io.Closer.
+func NewPlayersClient(cnf Config, local playerapi.Service) (PlayersClient, error) {
+	transport := cnf.PlayerSvcTransport
+	if transport == "" {
+		transport = PlayerSvcTransportHTTP
+		if local != nil {
+			transport = PlayerSvcTransportInProcess
+		}
+	}
+
+	switch transport {
+	case PlayerSvcTransportInProcess:
+		if local == nil {
+			return nil, ErrPlayersModuleNotFound
+		}
+		return players.NewInProcess(local), nil
+	case PlayerSvcTransportGRPC:
+		return players.NewGRPC(players.GRPCConfig{
+			Endpoints:   cnf.PlayerSvcGRPCEndpoints,
+			Timeout:     cnf.PlayerSvcTimeout,
+			MaxAttempts: cnf.PlayerSvcMaxAttempts,
+		})
+	}
+
+	return players.New(players.Config{
+		Endpoint: cnf.PlayerSvcEndpoint,
+	}, &http.Client{}), nil
+}
+
 // NewService returns a new app service instance.
 // It's just a factory function that creates a new app service instance.
 // It's a good place to apply all the decorators to the app service.
 // You can create more different factory functions for different environments
 // (e.g. for testing, for production, etc.) with env-specific decorators applied.
-func NewService(stor storageService, log loggerX, nc natsClient, cnf Config) Service {
+func NewService(stor storageService, log loggerX, nc natsClient, flags featureFlags, playerClient PlayersClient, cnf Config) Service {
 	// Init the user repository.
 	userRepo := storage.New(stor)
 
-	// Init the player client.
-	playerClient := players.New(players.Config{
-		Endpoint: cnf.PlayerSvcEndpoint,
-	}, &http.Client{})
+	// Init the idempotency records store, the commands run by the messages are deduplicated.
+	dedup := idempotency.NewStore(stor, time.Now)
 
-	// Init the message bus adapter.
+	// Init the message bus adapters.
 	messageBus := messagebus.NewEventSender(nc)
+	mailQueue := messagebus.NewMailQueue(nc)
+
+	// Init the access tokens issuer.
+	tokens := auth.NewJWT(cnf.JWTSecret)
+	loginOpts := commands.LoginOptions{
+		AccessTokenTTL:  cnf.AccessTokenTTL,
+		MFAChallengeTTL: cnf.MFAChallengeTTL,
+	}
+
+	// Coalesce the concurrent players calls if the client supports batching.
+	if bc, ok := playerClient.(batchPlayersClient); ok && cnf.PlayerSvcBatchWait > 0 {
+		playerClient = players.NewBatcher(bc,
+			dataloader.WithWait(cnf.PlayerSvcBatchWait),
+			dataloader.WithMaxBatch(queries.MaxUsersPerBatch),
+		)
+	}
+
+	// Init the identity providers the users can log in with.
+	providers := commands.IdentityProviders{}
+	if cnf.OIDC.IssuerURL != "" {
+		providers[cnf.OIDC.Name] = oidc.NewProvider(oidc.Config{
+			IssuerURL:    cnf.OIDC.IssuerURL,
+			ClientID:     cnf.OIDC.ClientID,
+			ClientSecret: cnf.OIDC.ClientSecret,
+			RedirectURL:  cnf.OIDC.RedirectURL,
+			Scopes:       cnf.OIDC.Scopes,
+		}, &http.Client{Timeout: 10 * time.Second})
+	}
+
+	// The users are created by signup and on the first login with an identity provider.
+	createUser := common.ApplyCommandDecorators(
+		commands.CreateUser(userRepo, flags),
+		logger.CommandErrorLogger[commands.CreateUserCommand](log), // Logs the error if any.
+		events.EventSender[commands.CreateUserCommand](messageBus), // Sends the event to the message bus.
+	)
+
+	// Init the authorization rules of the operations allowed not only to the owner.
+	policy := newPolicy()
 
 	// Create the app instance with all the decorators applied.
 	userApp := Service{
 		GetUser: common.ApplyQueryDecorators(
 			queries.GetUser(userRepo, playerClient),
+			authz.Query[queries.GetUserQuery, queries.User](policy),          // Only the user itself or the admins can get the user.
 			logger.QueryErrorLogger[queries.GetUserQuery, queries.User](log), // Logs the error if any. So you don't need to care about this in the query handler.
 		),
-		CreateUser: common.ApplyCommandDecorators(
-			commands.CreateUser(userRepo, true),
-			logger.CommandErrorLogger[commands.CreateUserCommand](log), // Logs the error if any.
-			events.EventSender[commands.CreateUserCommand](messageBus), // Sends the event to the message bus.
+		GetUsersByIDs: common.ApplyQueryDecorators(
+			queries.GetUsersByIDs(userRepo, playerClient),
+			authz.Query[queries.GetUsersByIDsQuery, queries.Users](policy),
+			logger.QueryErrorLogger[queries.GetUsersByIDsQuery, queries.Users](log),
+		),
+		ListUsers: common.ApplyQueryDecorators(
+			queries.ListUsers(userRepo, playerClient),
+			authz.Query[queries.ListUsersQuery, queries.UsersPage](policy),
+			logger.QueryErrorLogger[queries.ListUsersQuery, queries.UsersPage](log),
+		),
+		Authenticate: common.ApplyQueryDecorators(
+			queries.Authenticate(userRepo, time.Now),
+			logger.QueryErrorLogger[queries.AuthenticateQuery, auth.Principal](log),
+		),
+		CreateUser: createUser,
+		UpdateProfile: common.ApplyCommandDecorators(
+			commands.UpdateProfile(userRepo),
+			authz.OwnerOnly[commands.UpdateProfileCommand](), // Only the user can update its own profile.
+			logger.CommandErrorLogger[commands.UpdateProfileCommand](log),
+			events.EventSender[commands.UpdateProfileCommand](messageBus),
+		),
+		ChangeEmail: common.ApplyCommandDecorators(
+			commands.ChangeEmail(userRepo, flags),
+			authz.OwnerOnly[commands.ChangeEmailCommand](),
+			logger.CommandErrorLogger[commands.ChangeEmailCommand](log),
+			events.EventSender[commands.ChangeEmailCommand](messageBus),
+		),
+		ChangePassword: common.ApplyCommandDecorators(
+			commands.ChangePassword(userRepo),
+			authz.OwnerOnly[commands.ChangePasswordCommand](),
+			logger.CommandErrorLogger[commands.ChangePasswordCommand](log),
+			events.EventSender[commands.ChangePasswordCommand](messageBus),
+		),
+		DeleteUser: common.ApplyCommandDecorators(
+			commands.DeleteUser(userRepo, cnf.DeleteRestoreWindow, time.Now),
+			authz.Command[commands.DeleteUserCommand](policy), // The user itself or the admins.
+			logger.CommandErrorLogger[commands.DeleteUserCommand](log),
+			events.EventSender[commands.DeleteUserCommand](messageBus),
+		),
+		RestoreUser: common.ApplyCommandDecorators(
+			commands.RestoreUser(userRepo, cnf.DeleteRestoreWindow, time.Now),
+			authz.Command[commands.RestoreUserCommand](policy),
+			logger.CommandErrorLogger[commands.RestoreUserCommand](log),
+			events.EventSender[commands.RestoreUserCommand](messageBus),
+		),
+		PurgeDeletedUsers: common.ApplyCommandDecorators(
+			commands.PurgeDeletedUsers(userRepo, cnf.DeleteRestoreWindow, time.Now), // System command, run by the module job.
+			logger.CommandErrorLogger[commands.PurgeDeletedUsersCommand](log),
+			events.EventSender[commands.PurgeDeletedUsersCommand](messageBus),
+		),
+		RequestEmailVerification: common.ApplyCommandDecorators(
+			commands.RequestEmailVerification(userRepo, mailQueue, commands.EmailVerificationOptions{
+				TTL:  cnf.EmailVerificationTTL,
+				URL:  cnf.EmailVerificationURL,
+				From: cnf.MailFrom,
+			}, cnf.AdminEmails, time.Now), // System command, run on the user events.
+			logger.CommandErrorLogger[commands.RequestEmailVerificationCommand](log),
+			events.EventSender[commands.RequestEmailVerificationCommand](messageBus),
+			idempotent.Command[commands.RequestEmailVerificationCommand](dedup, cnf.Idempotency.options()), // The redelivered events don't send the email again.
+		),
+		VerifyEmail: common.ApplyCommandDecorators(
+			commands.VerifyEmail(userRepo, cnf.AdminEmails, time.Now), // Public: the token proves the email ownership.
+			logger.CommandErrorLogger[commands.VerifyEmailCommand](log),
+			events.EventSender[commands.VerifyEmailCommand](messageBus),
+		),
+		RequestPasswordReset: common.ApplyCommandDecorators(
+			commands.RequestPasswordReset(userRepo, mailQueue, commands.PasswordResetOptions{
+				TTL:  cnf.PasswordResetTTL,
+				URL:  cnf.PasswordResetURL,
+				From: cnf.MailFrom,
+			}, time.Now), // Public: it doesn't reveal whether the user exists.
+			logger.CommandErrorLogger[commands.RequestPasswordResetCommand](log),
+			events.EventSender[commands.RequestPasswordResetCommand](messageBus),
+		),
+		ResetPassword: common.ApplyCommandDecorators(
+			commands.ResetPassword(userRepo, time.Now), // Public: the token proves the email ownership.
+			logger.CommandErrorLogger[commands.ResetPasswordCommand](log),
+			events.EventSender[commands.ResetPasswordCommand](messageBus),
+		),
+		Login: common.ApplyCommandDecorators(
+			commands.Login(userRepo, tokens, loginOpts, time.Now), // Public: the password proves the identity.
+			lockout.Guard[commands.LoginCommand](userRepo, cnf.Lockout.options(), time.Now),
+			logger.CommandErrorLogger[commands.LoginCommand](log),
+			events.EventSender[commands.LoginCommand](messageBus),
 		),
+		LoginMFA: common.ApplyCommandDecorators(
+			commands.LoginMFA(userRepo, tokens, loginOpts, time.Now), // Public: the challenge token proves the password was checked.
+			lockout.Guard[commands.LoginMFACommand](userRepo, cnf.Lockout.options(), time.Now),
+			logger.CommandErrorLogger[commands.LoginMFACommand](log),
+			events.EventSender[commands.LoginMFACommand](messageBus),
+		),
+		EnrollMFA: common.ApplyCommandDecorators(
+			commands.EnrollMFA(userRepo, cnf.MFAIssuer),
+			authz.OwnerOnly[commands.EnrollMFACommand](),
+			logger.CommandErrorLogger[commands.EnrollMFACommand](log),
+			events.EventSender[commands.EnrollMFACommand](messageBus),
+		),
+		ConfirmMFA: common.ApplyCommandDecorators(
+			commands.ConfirmMFA(userRepo, time.Now),
+			authz.OwnerOnly[commands.ConfirmMFACommand](),
+			logger.CommandErrorLogger[commands.ConfirmMFACommand](log),
+			events.EventSender[commands.ConfirmMFACommand](messageBus),
+		),
+		DisableMFA: common.ApplyCommandDecorators(
+			commands.DisableMFA(userRepo, time.Now),
+			authz.OwnerOnly[commands.DisableMFACommand](),
+			logger.CommandErrorLogger[commands.DisableMFACommand](log),
+			events.EventSender[commands.DisableMFACommand](messageBus),
+		),
+		RegenerateRecoveryCodes: common.ApplyCommandDecorators(
+			commands.RegenerateRecoveryCodes(userRepo, time.Now),
+			authz.OwnerOnly[commands.RegenerateRecoveryCodesCommand](),
+			logger.CommandErrorLogger[commands.RegenerateRecoveryCodesCommand](log),
+			events.EventSender[commands.RegenerateRecoveryCodesCommand](messageBus),
+		),
+		AuthenticateAPIKey: common.ApplyQueryDecorators(
+			queries.AuthenticateAPIKey(userRepo, time.Now),
+			logger.QueryErrorLogger[queries.AuthenticateAPIKeyQuery, auth.Principal](log),
+		),
+		ListAPIKeys: common.ApplyQueryDecorators(
+			queries.ListAPIKeys(userRepo),
+			authz.Query[queries.ListAPIKeysQuery, []queries.APIKey](policy),
+			logger.QueryErrorLogger[queries.ListAPIKeysQuery, []queries.APIKey](log),
+		),
+		CreateAPIKey: common.ApplyCommandDecorators(
+			commands.CreateAPIKey(userRepo, commands.APIKeyOptions{
+				DefaultTTL: cnf.APIKeyDefaultTTL,
+				MaxTTL:     cnf.APIKeyMaxTTL,
+			}, time.Now),
+			authz.OwnerOnly[commands.CreateAPIKeyCommand](), // The API keys can't manage the API keys: they don't act as the owner.
+			logger.CommandErrorLogger[commands.CreateAPIKeyCommand](log),
+			events.EventSender[commands.CreateAPIKeyCommand](messageBus),
+		),
+		RotateAPIKey: common.ApplyCommandDecorators(
+			commands.RotateAPIKey(userRepo, time.Now),
+			authz.OwnerOnly[commands.RotateAPIKeyCommand](),
+			logger.CommandErrorLogger[commands.RotateAPIKeyCommand](log),
+			events.EventSender[commands.RotateAPIKeyCommand](messageBus),
+		),
+		RevokeAPIKey: common.ApplyCommandDecorators(
+			commands.RevokeAPIKey(userRepo, time.Now),
+			authz.OwnerOnly[commands.RevokeAPIKeyCommand](),
+			logger.CommandErrorLogger[commands.RevokeAPIKeyCommand](log),
+			events.EventSender[commands.RevokeAPIKeyCommand](messageBus),
+		),
+		StartOIDCLogin: common.ApplyCommandDecorators(
+			commands.StartOIDCLogin(userRepo, providers, commands.OIDCOptions{StateTTL: cnf.OIDC.StateTTL}, time.Now), // Public: starts the login.
+			logger.CommandErrorLogger[commands.StartOIDCLoginCommand](log),
+			events.EventSender[commands.StartOIDCLoginCommand](messageBus),
+		),
+		CompleteOIDCLogin: common.ApplyCommandDecorators(
+			commands.CompleteOIDCLogin(userRepo, providers, createUser, tokens, loginOpts, cnf.AdminEmails, time.Now), // Public: the provider proves the identity.
+			logger.CommandErrorLogger[commands.CompleteOIDCLoginCommand](log),
+			events.EventSender[commands.CompleteOIDCLoginCommand](messageBus),
+		),
+		UnlockAccount: common.ApplyCommandDecorators(
+			commands.UnlockAccount(userRepo),
+			authz.Command[commands.UnlockAccountCommand](policy), // The admins only: the locked user can't log in.
+			logger.CommandErrorLogger[commands.UnlockAccountCommand](log),
+			events.EventSender[commands.UnlockAccountCommand](messageBus),
+		),
+		ListSessions: common.ApplyQueryDecorators(
+			queries.ListSessions(userRepo, time.Now),
+			authz.Query[queries.ListSessionsQuery, []queries.Session](policy),
+			logger.QueryErrorLogger[queries.ListSessionsQuery, []queries.Session](log),
+		),
+		RevokeSession: common.ApplyCommandDecorators(
+			commands.RevokeSession(userRepo),
+			authz.OwnerOnly[commands.RevokeSessionCommand](),
+			logger.CommandErrorLogger[commands.RevokeSessionCommand](log),
+			events.EventSender[commands.RevokeSessionCommand](messageBus),
+		),
+		RevokeSessions: common.ApplyCommandDecorators(
+			commands.RevokeSessions(userRepo, time.Now),
+			authz.Command[commands.RevokeSessionsCommand](policy), // The user itself or the support staff.
+			logger.CommandErrorLogger[commands.RevokeSessionsCommand](log),
+			events.EventSender[commands.RevokeSessionsCommand](messageBus),
+		),
+		HealthChecks: []health.Check{
+			{
+				Name:     "players",
+				Check:    playerClient.HealthCheck,
+				Timeout:  time.Second,
+				Critical: false, // GetUser fails without players service, but CreateUser still works.
+			},
+		},
 	}
+	userApp.Commands = newCommandBus(userApp)
 
 	return userApp
 }
 
+// newCommandBus registers the command handlers of the service on the command bus.
+// The handlers are decorated already, so the bus has no global middlewares.
+// A handler registered twice is a programming error, so it panics.
+func newCommandBus(svc Service) *common.CommandBus {
+	bus := common.NewCommandBus()
+	if err := errors.Join(
+		common.RegisterCommand(bus, svc.CreateUser),
+		common.RegisterCommand(bus, svc.UpdateProfile),
+		common.RegisterCommand(bus, svc.ChangeEmail),
+		common.RegisterCommand(bus, svc.ChangePassword),
+		common.RegisterCommand(bus, svc.DeleteUser),
+		common.RegisterCommand(bus, svc.RestoreUser),
+		common.RegisterCommand(bus, svc.PurgeDeletedUsers),
+		common.RegisterCommand(bus, svc.RequestEmailVerification),
+		common.RegisterCommand(bus, svc.VerifyEmail),
+		common.RegisterCommand(bus, svc.RequestPasswordReset),
+		common.RegisterCommand(bus, svc.ResetPassword),
+		common.RegisterCommand(bus, svc.Login),
+		common.RegisterCommand(bus, svc.LoginMFA),
+		common.RegisterCommand(bus, svc.UnlockAccount),
+		common.RegisterCommand(bus, svc.EnrollMFA),
+		common.RegisterCommand(bus, svc.ConfirmMFA),
+		common.RegisterCommand(bus, svc.DisableMFA),
+		common.RegisterCommand(bus, svc.RegenerateRecoveryCodes),
+		common.RegisterCommand(bus, svc.CreateAPIKey),
+		common.RegisterCommand(bus, svc.RotateAPIKey),
+		common.RegisterCommand(bus, svc.RevokeAPIKey),
+		common.RegisterCommand(bus, svc.StartOIDCLogin),
+		common.RegisterCommand(bus, svc.CompleteOIDCLogin),
+		common.RegisterCommand(bus, svc.RevokeSession),
+		common.RegisterCommand(bus, svc.RevokeSessions),
+	); err != nil {
+		panic(fmt.Sprintf("user service: %v", err))
+	}
+	return bus
+}
+
+// newPolicy returns the authorization rules of the commands and queries
+// decorated with authz.Command and authz.Query.
+func newPolicy() *authz.Policy {
+	policy := authz.NewPolicy()
+	authz.Register[queries.GetUserQuery](policy, authz.Rule{Owner: true, Permission: domain.PermissionReadUsers})
+	authz.Register[queries.GetUsersByIDsQuery](policy, authz.Rule{Permission: domain.PermissionReadUsers})
+	authz.Register[queries.ListUsersQuery](policy, authz.Rule{Permission: domain.PermissionListUsers})
+	authz.Register[commands.DeleteUserCommand](policy, authz.Rule{Owner: true, Permission: domain.PermissionDeleteUsers})
+	authz.Register[commands.RestoreUserCommand](policy, authz.Rule{Owner: true, Permission: domain.PermissionDeleteUsers})
+	authz.Register[queries.ListAPIKeysQuery](policy, authz.Rule{Owner: true})
+	authz.Register[queries.ListSessionsQuery](policy, authz.Rule{Owner: true})
+	authz.Register[commands.UnlockAccountCommand](policy, authz.Rule{Permission: domain.PermissionUnlockUsers})
+	authz.Register[commands.RevokeSessionsCommand](policy, authz.Rule{Owner: true, Permission: domain.PermissionRevokeSessions})
+	return policy
+}
+
 // httpClient is a low-level abstraction for the HTTP client.
 type httpClient interface {
 	Get(url string) (resp *http.Response, err error)
 }
 
 // NewTestService returns a new app service instance for testing.
-// It's almost the same as the NewService function but with the test-specific decorators applied.
-func NewTestService(stor storageService, log loggerX, nc natsClient, cnf Config, httpc httpClient) Service {
-	// Init the user repository.
-	userRepo := storage.New(stor)
-
+// It's almost the same as the NewService function but the players service
+// is called over HTTP with the given client.
+func NewTestService(stor storageService, log loggerX, nc natsClient, flags featureFlags, cnf Config, httpc httpClient) Service {
 	// Init the player client.
 	playerClient := players.New(players.Config{
 		Endpoint: cnf.PlayerSvcEndpoint,
 	}, httpc)
 
-	// Init the message bus adapter.
-	messageBus := messagebus.NewEventSender(nc)
-
-	// Create the app instance with all the decorators applied.
-	userApp := Service{
-		GetUser: common.ApplyQueryDecorators(
-			queries.GetUser(userRepo, playerClient),
-			logger.QueryErrorLogger[queries.GetUserQuery, queries.User](log), // Logs the error if any. So you don't need to care about this in the query handler.
-		),
-		CreateUser: common.ApplyCommandDecorators(
-			commands.CreateUser(userRepo, true),
-			logger.CommandErrorLogger[commands.CreateUserCommand](log), // Logs the error if any.
-			events.EventSender[commands.CreateUserCommand](messageBus), // Sends the event to the message bus.
-		),
-	}
-
-	return userApp
+	return NewService(stor, log, nc, flags, playerClient, cnf)
 }
@@ -3,15 +3,22 @@ package service_test
 import (
 	"bytes"
 	"context"
-	"errors"
 	"io"
 	"net/http"
+	"reflect"
+	"sort"
+	"strings"
 	"testing"
 
+	"github.com/dmitrymomot/go-smart-monolith/internal/user/adapters/players"
 	"github.com/dmitrymomot/go-smart-monolith/internal/user/app/commands"
 	"github.com/dmitrymomot/go-smart-monolith/internal/user/app/queries"
 	"github.com/dmitrymomot/go-smart-monolith/internal/user/domain"
 	"github.com/dmitrymomot/go-smart-monolith/internal/user/service"
+	"github.com/dmitrymomot/go-smart-monolith/pkg/auth"
+	"github.com/dmitrymomot/go-smart-monolith/pkg/contracts/playerapi"
+	"github.com/dmitrymomot/go-smart-monolith/pkg/featureflag"
+	kvstorage "github.com/dmitrymomot/go-smart-monolith/pkg/storage"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
@@ -33,6 +40,18 @@ func (m *storageService) Set(ctx context.Context, key string, value interface{})
 	return args.Error(0)
 }
 
+// Scan is a mock implementation of the Scan method.
+func (m *storageService) Scan(ctx context.Context, opts kvstorage.ScanOptions) ([]kvstorage.KV, error) {
+	args := m.Called(ctx, opts)
+	return args.Get(0).([]kvstorage.KV), args.Error(1)
+}
+
+// Delete is a mock implementation of the Delete method.
+func (m *storageService) Delete(ctx context.Context, key string) error {
+	args := m.Called(ctx, key)
+	return args.Error(0)
+}
+
 // loggerX is a mock of the loggerX interface.
 type loggerX struct {
 	mock.Mock
@@ -71,8 +90,10 @@ func TestService_CreateUser(t *testing.T) {
 
 	// Create a new mock for the storageService.
 	stor := new(storageService)
-	stor.On("Get", mock.Anything, email).Return(nil, errors.New("error"))
-	stor.On("Set", mock.Anything, email, mock.Anything).Return(nil)
+	stor.On("Get", mock.Anything, "user_email:"+email).Return(nil, kvstorage.ErrNotFound)
+	stor.On("Get", mock.Anything, mock.AnythingOfType("string")).Return(nil, kvstorage.ErrNotFound) // by ID: it's a new user
+	stor.On("Set", mock.Anything, "user_email:"+email, mock.AnythingOfType("string")).Return(nil)   // the email is claimed by the user ID
+	stor.On("Set", mock.Anything, mock.AnythingOfType("string"), mock.Anything).Return(nil)         // by ID and the creation time index
 
 	// Set mocks.
 	log := new(loggerX)
@@ -83,7 +104,7 @@ func TestService_CreateUser(t *testing.T) {
 	nc.On("Publish", mock.Anything, mock.Anything).Return(nil)
 
 	// Create a new service instance.
-	svc := service.NewTestService(stor, log, nc, service.Config{}, httpc)
+	svc := service.NewTestService(stor, log, nc, featureflag.NewStatic(), service.Config{}, httpc)
 
 	// Call the CreateUser command handler.
 	events, err := svc.CreateUser(context.Background(), commands.CreateUserCommand{
@@ -110,7 +131,7 @@ func TestService_GetUser(t *testing.T) {
 
 	// Create a new mock for the storageService.
 	stor := new(storageService)
-	stor.On("Get", mock.Anything, user.ID).Return(user, nil)
+	stor.On("Get", mock.Anything, "user:"+user.ID).Return(user, nil)
 
 	// Create a new mock for the loggerX.
 	log := new(loggerX)
@@ -125,13 +146,13 @@ func TestService_GetUser(t *testing.T) {
 	}, nil)
 
 	// Create a new service instance.
-	svc := service.NewTestService(stor, log, nc, service.Config{
-		Flag:              true,
+	svc := service.NewTestService(stor, log, nc, featureflag.NewStatic(), service.Config{
 		PlayerSvcEndpoint: "http://localhost:8080",
 	}, httpc)
 
-	// Call the CreateUser command handler.
-	resp, err := svc.GetUser(context.Background(), queries.GetUserQuery{
+	// Call the GetUser query handler as the user itself.
+	ctx := auth.WithPrincipal(context.Background(), auth.Principal{UserID: user.ID})
+	resp, err := svc.GetUser(ctx, queries.GetUserQuery{
 		ID: user.ID,
 	})
 
@@ -147,3 +168,132 @@ func TestService_GetUser(t *testing.T) {
 	log.AssertExpectations(t)
 	nc.AssertExpectations(t)
 }
+
+// playersModule is a mock of the players module called in-process.
+type playersModule struct {
+	mock.Mock
+}
+
+// GetPlayer is a mock implementation of the GetPlayer method.
+func (m *playersModule) GetPlayer(ctx context.Context, userID string) (playerapi.Player, error) {
+	args := m.Called(ctx, userID)
+	return args.Get(0).(playerapi.Player), args.Error(1)
+}
+
+func TestService_GetUser_InProcess(t *testing.T) {
+	// Test data.
+	user := domain.NewUser("test@mail.dev", "password")
+
+	// Create a new mock for the storageService.
+	stor := new(storageService)
+	stor.On("Get", mock.Anything, "user:"+user.ID).Return(user, nil)
+
+	// The players module is built into the same binary.
+	local := new(playersModule)
+	local.On("GetPlayer", mock.Anything, user.ID).Return(playerapi.Player{
+		UserID:     user.ID,
+		PlayerName: "local player",
+	}, nil)
+
+	// Transport is chosen automatically.
+	playerClient, err := service.NewPlayersClient(service.Config{}, local)
+	assert.NoError(t, err)
+
+	svc := service.NewService(stor, new(loggerX), new(natsClient), featureflag.NewStatic(), playerClient, service.Config{})
+
+	// Call the GetUser query handler as the user itself.
+	ctx := auth.WithPrincipal(context.Background(), auth.Principal{UserID: user.ID})
+	resp, err := svc.GetUser(ctx, queries.GetUserQuery{
+		ID: user.ID,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "local player", resp.PlayerName)
+
+	// Assert that mocks expectations were met.
+	stor.AssertExpectations(t)
+	local.AssertExpectations(t)
+}
+
+func TestService_Authorization(t *testing.T) {
+	user := domain.NewUser("test@mail.dev", "password")
+
+	stor := new(storageService)
+	stor.On("Get", mock.Anything, mock.Anything).Return(nil, kvstorage.ErrNotFound)
+	log := new(loggerX)
+	log.On("Error", mock.Anything, mock.Anything)
+	svc := service.NewTestService(stor, log, new(natsClient), featureflag.NewStatic(), service.Config{}, new(httpClient))
+
+	// Anonymous callers are not authenticated.
+	_, err := svc.GetUser(context.Background(), queries.GetUserQuery{ID: user.ID})
+	assert.ErrorIs(t, err, auth.ErrUnauthenticated)
+
+	// Users can get only themselves and can't list the users.
+	ctx := auth.WithPrincipal(context.Background(), auth.Principal{UserID: "other"})
+	_, err = svc.GetUser(ctx, queries.GetUserQuery{ID: user.ID})
+	assert.ErrorIs(t, err, auth.ErrForbidden)
+	_, err = svc.ListUsers(ctx, queries.ListUsersQuery{})
+	assert.ErrorIs(t, err, auth.ErrForbidden)
+	_, err = svc.DeleteUser(ctx, commands.DeleteUserCommand{UserID: user.ID})
+	assert.ErrorIs(t, err, auth.ErrForbidden)
+
+	// Admins can get any user: the query gets to the storage.
+	ctx = auth.WithPrincipal(context.Background(), auth.Principal{
+		UserID:      "admin",
+		Permissions: []string{string(domain.PermissionReadUsers)},
+	})
+	_, err = svc.GetUser(ctx, queries.GetUserQuery{ID: user.ID})
+	assert.ErrorIs(t, err, domain.ErrUserNotFound)
+}
+
+func TestNewPlayersClient(t *testing.T) {
+	// HTTP transport is used if there is no local players module.
+	c, err := service.NewPlayersClient(service.Config{PlayerSvcEndpoint: "http://players"}, nil)
+	assert.NoError(t, err)
+	assert.IsType(t, &players.Player{}, c)
+
+	// HTTP transport can be forced even if the players module is built in.
+	c, err = service.NewPlayersClient(service.Config{PlayerSvcTransport: service.PlayerSvcTransportHTTP}, new(playersModule))
+	assert.NoError(t, err)
+	assert.IsType(t, &players.Player{}, c)
+
+	// In-process transport requires the players module.
+	_, err = service.NewPlayersClient(service.Config{PlayerSvcTransport: service.PlayerSvcTransportInProcess}, nil)
+	assert.ErrorIs(t, err, service.ErrPlayersModuleNotFound)
+
+	// gRPC transport is used only if it's set explicitly.
+	c, err = service.NewPlayersClient(service.Config{
+		PlayerSvcTransport:     service.PlayerSvcTransportGRPC,
+		PlayerSvcGRPCEndpoints: []string{"players:9090"},
+	}, new(playersModule))
+	assert.NoError(t, err)
+	assert.IsType(t, &players.GRPC{}, c)
+	assert.NoError(t, c.(*players.GRPC).Close())
+
+	// gRPC transport requires the endpoints.
+	cnf := service.Config{PlayerSvcTransport: service.PlayerSvcTransportGRPC}
+	assert.Error(t, cnf.Validate())
+}
+
+func TestService_Commands(t *testing.T) {
+	log := new(loggerX)
+	log.On("Error", auth.ErrUnauthenticated, mock.Anything).Return()
+	svc := service.NewTestService(new(storageService), log, new(natsClient), featureflag.NewStatic(), service.Config{}, new(httpClient))
+
+	// Every command handler of the service is dispatched by the command bus.
+	var want []string
+	st := reflect.TypeOf(svc)
+	for i := 0; i < st.NumField(); i++ {
+		ft := st.Field(i).Type
+		if ft.Kind() == reflect.Func && strings.HasPrefix(ft.Name(), "CommandHandler[") {
+			want = append(want, ft.In(1).String())
+		}
+	}
+	sort.Strings(want)
+	assert.NotEmpty(t, want)
+	assert.Equal(t, want, svc.Commands.Commands())
+
+	// The commands are dispatched through the same decorators.
+	_, err := svc.Commands.Send(context.Background(), commands.UnlockAccountCommand{UserID: "u1"})
+	assert.ErrorIs(t, err, auth.ErrUnauthenticated)
+	log.AssertExpectations(t)
+}
@@ -0,0 +1,290 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/dmitrymomot/go-smart-monolith/pkg/featureflag"
+	"github.com/dmitrymomot/go-smart-monolith/pkg/health"
+	"github.com/dmitrymomot/go-smart-monolith/pkg/lifecycle"
+	"github.com/dmitrymomot/go-smart-monolith/pkg/logx"
+	"github.com/dmitrymomot/go-smart-monolith/pkg/mailer"
+	"github.com/dmitrymomot/go-smart-monolith/pkg/module"
+	"github.com/dmitrymomot/go-smart-monolith/pkg/nats"
+	"github.com/dmitrymomot/go-smart-monolith/pkg/outbox"
+	"github.com/dmitrymomot/go-smart-monolith/pkg/storage"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"google.golang.org/grpc"
+	grpchealth "google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+)
+
+// App is an application built of the registered modules.
+// The same modules can be built into the monolith (cmd/api)
+// or into a standalone service binary (e.g. cmd/user).
+type App struct {
+	cnf       Config
+	log       *logx.Logger
+	router    chi.Router
+	lifecycle *lifecycle.Lifecycle
+	checks    *health.Registry
+
+	grpc       *grpc.Server
+	grpcHealth *grpchealth.Server
+}
+
+// New builds the application: initializes the shared dependencies
+// and all the modules, and mounts the modules HTTP endpoints.
+// Module configs must be already loaded, see Registry.LoadConfig.
+func New(cnf Config, mods *module.Registry) (*App, error) {
+	// init router
+	// Using chi router here, but you can use any other router as well.
+	r := chi.NewRouter()
+	// ...Set up all global middlewares your app needs here, like
+	// request logging, tracing, auth, cors, etc.
+	// Some more specific middlewares might need to be set on
+	// the individual routes in the services transport layer.
+	r.Use(middleware.Recoverer)
+
+	// init logger
+	// Using wrapper instead of direct logger initialization
+	// to be able to change logger implementation in the future.
+	log := logx.New()
+
+	// init application lifecycle
+	// Each dependency registers its own start/stop hooks.
+	// Stop hooks are called in the reverse order, so the HTTP server
+	// is drained first and the storage is closed last.
+	app := lifecycle.New(log, lifecycle.WithStopTimeout(cnf.Shutdown.Timeout))
+
+	// init health checks registry
+	// Each dependency registers its own named probe.
+	checks := health.New()
+	r.Get("/healthz", checks.LivenessHandler())
+	r.Get("/readyz", checks.ReadinessHandler())
+
+	// init app storage
+	// low-level storage implementation, that can be used by service adapters,
+	// like repositories, etc.
+	stor := storage.New()
+	app.Append(lifecycle.Hook{
+		Name:   "storage",
+		OnStop: stor.Close,
+	})
+	checks.Register(health.Check{
+		Name:     "storage",
+		Check:    stor.Ping,
+		Timeout:  time.Second,
+		Critical: true,
+	})
+
+	// init nats client
+	nc := nats.NewClient()
+	app.Append(lifecycle.Hook{
+		Name:   "nats",
+		OnStop: nc.Close, // Flushes pending messages before closing the connection.
+	})
+	checks.Register(health.Check{
+		Name:     "nats",
+		Check:    nc.Ping,
+		Timeout:  time.Second,
+		Critical: true,
+	})
+
+	// init events outbox
+	// The modules publish the events to the outbox, so the events are kept in the storage
+	// until NATS accepts them. The pending events are flushed on shutdown, before NATS is closed.
+	box := outbox.New(stor, nc, log, cnf.Outbox.FlushInterval)
+	boxCtx, stopBox := context.WithCancel(context.Background())
+	boxDone := make(chan struct{})
+	app.Append(lifecycle.Hook{
+		Name: "outbox",
+		OnStart: func(context.Context) error {
+			go func() {
+				defer close(boxDone)
+				box.Run(boxCtx)
+			}()
+			return nil
+		},
+		OnStop: func(ctx context.Context) error {
+			stopBox()
+			select {
+			case <-boxDone:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			return box.Flush(ctx)
+		},
+	})
+
+	// init feature flags provider
+	var flags featureflag.Provider = featureflag.NewStatic(cnf.Features.Enabled...)
+	if cnf.Features.File != "" {
+		fileFlags, err := featureflag.NewFile(cnf.Features.File, cnf.Features.WatchInterval, log)
+		if err != nil {
+			return nil, err
+		}
+		watchCtx, stopWatch := context.WithCancel(context.Background())
+		app.Append(lifecycle.Hook{
+			Name: "feature_flags",
+			OnStart: func(context.Context) error {
+				go fileFlags.Watch(watchCtx)
+				return nil
+			},
+			OnStop: func(context.Context) error {
+				stopWatch()
+				return nil
+			},
+		})
+		flags = fileFlags
+	}
+
+	// init mailer
+	// The emails are written to files in development, if no SMTP server is configured.
+	var mail module.Mailer = mailer.NewFile(cnf.Mailer.Dir)
+	if cnf.Mailer.SMTPAddr != "" {
+		mail = mailer.NewSMTP(mailer.SMTPConfig{
+			Addr:     cnf.Mailer.SMTPAddr,
+			Username: cnf.Mailer.SMTPUsername,
+			Password: cnf.Mailer.SMTPPassword,
+		})
+	}
+
+	// init and mount all the modules
+	if err := mods.Init(module.Deps{
+		Storage:   stor,
+		Logger:    log,
+		NATS:      box,
+		Flags:     flags,
+		Mailer:    mail,
+		Transport: cnf.Transport,
+	}); err != nil {
+		return nil, err
+	}
+	mods.Mount(r)
+	mods.RegisterHealthChecks(checks)
+	mods.Start(app, nc, log)
+
+	a := &App{
+		cnf:       cnf,
+		log:       log,
+		router:    r,
+		lifecycle: app,
+		checks:    checks,
+	}
+
+	// init grpc server
+	// It's shared by all the modules exposing gRPC services,
+	// the same way the router is shared by the HTTP endpoints.
+	srv := grpc.NewServer(grpc.ChainUnaryInterceptor(mods.GRPCInterceptors()...))
+	if mods.RegisterGRPC(srv) > 0 {
+		a.grpc = srv
+		a.grpcHealth = grpchealth.NewServer()
+		healthpb.RegisterHealthServer(srv, a.grpcHealth)
+		reflection.Register(srv)
+	}
+
+	return a, nil
+}
+
+// Handler returns the application HTTP handler.
+// It's useful to test the whole app with httptest.
+func (a *App) Handler() http.Handler {
+	return a.router
+}
+
+// GRPCServer returns the application gRPC server,
+// or nil if none of the modules exposes gRPC services.
+// It's useful to test the gRPC services with bufconn.
+func (a *App) GRPCServer() *grpc.Server {
+	return a.grpc
+}
+
+// Run starts the HTTP and gRPC servers and all the modules,
+// and blocks until the context is canceled or SIGINT/SIGTERM is received.
+func (a *App) Run(ctx context.Context) error {
+	// init http server
+	srv := &http.Server{
+		Addr:              fmt.Sprintf(":%d", a.cnf.HTTP.Port),
+		Handler:           a.router,
+		ReadHeaderTimeout: a.cnf.HTTP.ReadHeaderTimeout,
+		ReadTimeout:       a.cnf.HTTP.ReadTimeout,
+		WriteTimeout:      a.cnf.HTTP.WriteTimeout,
+		IdleTimeout:       a.cnf.HTTP.IdleTimeout,
+	}
+	a.lifecycle.Append(lifecycle.Hook{
+		Name: "http",
+		OnStart: func(ctx context.Context) error {
+			// Listen synchronously to fail fast if the port is already in use.
+			ln, err := net.Listen("tcp", srv.Addr)
+			if err != nil {
+				return err
+			}
+			go func() {
+				if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+					a.lifecycle.Shutdown(err)
+				}
+			}()
+			return nil
+		},
+		OnStop: srv.Shutdown, // Stops accepting new connections and waits for active ones.
+	})
+
+	// init grpc listener
+	if a.grpc != nil {
+		a.lifecycle.Append(lifecycle.Hook{
+			Name: "grpc",
+			OnStart: func(ctx context.Context) error {
+				ln, err := net.Listen("tcp", fmt.Sprintf(":%d", a.cnf.GRPC.Port))
+				if err != nil {
+					return err
+				}
+				go func() {
+					if err := a.grpc.Serve(ln); err != nil && !errors.Is(err, grpc.ErrServerStopped) {
+						a.lifecycle.Shutdown(err)
+					}
+				}()
+				return nil
+			},
+			OnStop: func(ctx context.Context) error {
+				// Waits for active RPCs, but not longer than the shutdown timeout.
+				done := make(chan struct{})
+				go func() {
+					a.grpc.GracefulStop()
+					close(done)
+				}()
+				select {
+				case <-done:
+					return nil
+				case <-ctx.Done():
+					a.grpc.Stop()
+					return ctx.Err()
+				}
+			},
+		})
+	}
+
+	// flip readiness first on shutdown
+	// It's registered last, so its stop hook is called before the HTTP server is drained.
+	// The delay gives load balancers time to notice the instance is not ready anymore.
+	a.lifecycle.Append(lifecycle.Hook{
+		Name: "readiness",
+		OnStop: func(ctx context.Context) error {
+			a.checks.Shutdown()
+			select {
+			case <-time.After(a.cnf.Shutdown.Delay):
+			case <-ctx.Done():
+			}
+			return nil
+		},
+	})
+
+	return a.lifecycle.Run(ctx)
+}
@@ -0,0 +1,42 @@
+package apptest
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dmitrymomot/go-smart-monolith/pkg/app"
+	"github.com/dmitrymomot/go-smart-monolith/pkg/config"
+	"github.com/dmitrymomot/go-smart-monolith/pkg/module"
+)
+
+// NewServer builds the app of the given modules, configured with the env map only,
+// and starts it on a random local port. The server is closed on the test cleanup.
+// It's used to test different deployment topologies built of the same modules.
+func NewServer(t testing.TB, env map[string]string, mods ...module.Module) *httptest.Server {
+	t.Helper()
+
+	lookup := config.WithLookup(func(key string) (string, bool) {
+		v, ok := env[key]
+		return v, ok
+	})
+
+	reg, err := module.NewRegistry(mods...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var cnf app.Config
+	if err := config.Merge(config.Load(&cnf, lookup), reg.LoadConfig(lookup)); err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := app.New(cnf, reg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewServer(a.Handler())
+	t.Cleanup(srv.Close)
+
+	return srv
+}
@@ -0,0 +1,99 @@
+package app
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/dmitrymomot/go-smart-monolith/pkg/module"
+)
+
+type (
+	// Config is the application configuration.
+	// It's populated from the optional config file and env variables,
+	// see pkg/config for details.
+	Config struct {
+		HTTP     HTTPConfig     `yaml:"http"`
+		GRPC     GRPCConfig     `yaml:"grpc"`
+		Shutdown ShutdownConfig `yaml:"shutdown"`
+		Features FeaturesConfig `yaml:"features"`
+		Mailer   MailerConfig   `yaml:"mailer"`
+		Outbox   OutboxConfig   `yaml:"outbox"`
+
+		// Transport defines how modules call their dependencies:
+		// "inproc" calls the dependency module directly if it's built into the same binary,
+		// "remote" always uses the network adapters (e.g. HTTP).
+		Transport module.Transport `yaml:"transport" env:"DEPS_TRANSPORT" default:"inproc"`
+
+		// Per-service configs are declared by the modules themselves.
+	}
+
+	// HTTPConfig holds the HTTP server configuration.
+	HTTPConfig struct {
+		Port              int           `yaml:"port" env:"HTTP_PORT" default:"8080"`
+		ReadHeaderTimeout time.Duration `yaml:"read_header_timeout" env:"HTTP_READ_HEADER_TIMEOUT" default:"5s"`
+		ReadTimeout       time.Duration `yaml:"read_timeout" env:"HTTP_READ_TIMEOUT" default:"15s"`
+		WriteTimeout      time.Duration `yaml:"write_timeout" env:"HTTP_WRITE_TIMEOUT" default:"15s"`
+		IdleTimeout       time.Duration `yaml:"idle_timeout" env:"HTTP_IDLE_TIMEOUT" default:"60s"`
+	}
+
+	// GRPCConfig holds the gRPC server configuration.
+	// The server is started only if any module exposes gRPC services.
+	GRPCConfig struct {
+		Port int `yaml:"port" env:"GRPC_PORT" default:"9090"`
+	}
+
+	// ShutdownConfig holds the graceful shutdown configuration.
+	ShutdownConfig struct {
+		// Deadline for the graceful shutdown: draining HTTP connections,
+		// flushing the outbox and the message bus and closing the storage.
+		Timeout time.Duration `yaml:"timeout" env:"SHUTDOWN_TIMEOUT" default:"15s"`
+		// Delay between flipping readiness to failing and draining HTTP connections.
+		Delay time.Duration `yaml:"delay" env:"SHUTDOWN_DELAY" default:"0s"`
+	}
+)
+
+// FeaturesConfig holds the feature flags configuration.
+// If the file is set, flags are read from it and reloaded on change,
+// otherwise the static list of enabled flags is used.
+type FeaturesConfig struct {
+	Enabled       []string      `yaml:"enabled" env:"FEATURES_ENABLED"`
+	File          string        `yaml:"file" env:"FEATURES_FILE"`
+	WatchInterval time.Duration `yaml:"watch_interval" env:"FEATURES_WATCH_INTERVAL" default:"10s"`
+}
+
+// MailerConfig holds the mailer configuration.
+// The emails are sent through the SMTP server if its address is set,
+// otherwise they are written to the directory as .eml files, see pkg/mailer.
+type MailerConfig struct {
+	SMTPAddr     string `yaml:"smtp_addr" env:"MAILER_SMTP_ADDR"`
+	SMTPUsername string `yaml:"smtp_username" env:"MAILER_SMTP_USERNAME"`
+	SMTPPassword string `yaml:"smtp_password" env:"MAILER_SMTP_PASSWORD" secret:"true"`
+	Dir          string `yaml:"dir" env:"MAILER_DIR" default:"mail"`
+}
+
+// OutboxConfig holds the events outbox configuration.
+// The events are stored in the outbox and published to the message bus
+// as soon as they are stored, and retried every flush interval, see pkg/outbox.
+type OutboxConfig struct {
+	FlushInterval time.Duration `yaml:"flush_interval" env:"OUTBOX_FLUSH_INTERVAL" default:"1s"`
+}
+
+// Validate validates the application configuration.
+func (c *Config) Validate() error {
+	if c.HTTP.Port <= 0 || c.HTTP.Port > 65535 {
+		return fmt.Errorf("http.port: must be in range 1..65535, got %d", c.HTTP.Port)
+	}
+	if c.GRPC.Port <= 0 || c.GRPC.Port > 65535 {
+		return fmt.Errorf("grpc.port: must be in range 1..65535, got %d", c.GRPC.Port)
+	}
+	if c.Mailer.SMTPAddr == "" && c.Mailer.Dir == "" {
+		return fmt.Errorf("mailer: either smtp_addr or dir is required")
+	}
+	if c.Outbox.FlushInterval <= 0 {
+		return fmt.Errorf("outbox.flush_interval: must be positive, got %s", c.Outbox.FlushInterval)
+	}
+	if c.Transport != module.TransportInProcess && c.Transport != module.TransportRemote {
+		return fmt.Errorf("transport: must be %q or %q, got %q", module.TransportInProcess, module.TransportRemote, c.Transport)
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package app
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/dmitrymomot/go-smart-monolith/pkg/config"
+	"github.com/dmitrymomot/go-smart-monolith/pkg/module"
+)
+
+// Main is the entry point shared by all the binaries:
+// the monolith and the standalone services differ only in the list of modules.
+// It parses the command line flags, loads the config and runs the app.
+func Main(mods ...module.Module) {
+	// parse command line flags
+	configFile := flag.String("config", os.Getenv("CONFIG_FILE"), "path to the YAML or JSON config file")
+	printConfig := flag.Bool("print-config", false, "print the resolved config with secrets redacted and exit")
+	transport := flag.String("deps", "", `how modules call their dependencies: "inproc" or "remote" (overrides DEPS_TRANSPORT)`)
+	flag.Parse()
+
+	// init modules registry
+	reg, err := module.NewRegistry(mods...)
+	if err != nil {
+		exit(err)
+	}
+
+	// load config
+	// All the problems are reported at once, so you can fix them in one go.
+	var cnf Config
+	if err := config.Merge(
+		config.Load(&cnf, config.WithFile(*configFile)),
+		reg.LoadConfig(config.WithFile(*configFile)),
+	); err != nil {
+		exit(err)
+	}
+	if *transport != "" {
+		cnf.Transport = module.Transport(*transport)
+		if err := cnf.Validate(); err != nil {
+			exit(err)
+		}
+	}
+	if *printConfig {
+		if err := config.Print(os.Stdout, cnf, reg.ConfigSections()...); err != nil {
+			exit(err)
+		}
+		return
+	}
+
+	// build and run the app
+	app, err := New(cnf, reg)
+	if err != nil {
+		exit(err)
+	}
+	if err := app.Run(context.Background()); err != nil {
+		app.log.Fatal(err)
+	}
+}
+
+func exit(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(1)
+}
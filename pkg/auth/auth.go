@@ -0,0 +1,55 @@
+// Package auth holds the identity of the caller in the request context.
+// The transport layer (HTTP middleware, gRPC interceptor) authenticates the caller
+// and puts the principal into the context, the app layer reads it to authorize the call.
+package auth
+
+import (
+	"context"
+	"errors"
+)
+
+var (
+	// ErrUnauthenticated is returned when the caller is not authenticated.
+	ErrUnauthenticated = errors.New("unauthenticated")
+	// ErrForbidden is returned when the caller is not allowed to perform the action.
+	ErrForbidden = errors.New("forbidden")
+)
+
+type (
+	// Principal is the authenticated caller.
+	Principal struct {
+		// UserID is the ID of the user the caller acts as. Empty for the non-user callers.
+		UserID string
+		// APIKeyID is the ID of the API key the caller is authenticated with, if any.
+		APIKeyID string
+		// SessionID is the ID of the session the caller is authenticated with, if any.
+		SessionID string
+		// Roles are the names of the caller roles.
+		Roles []string
+		// Permissions are the actions the roles allow to the caller.
+		Permissions []string
+	}
+
+	principalCtxKey struct{}
+)
+
+// HasPermission reports whether the caller has the permission.
+func (p Principal) HasPermission(permission string) bool {
+	for _, perm := range p.Permissions {
+		if perm == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// WithPrincipal returns a copy of the context with the principal.
+func WithPrincipal(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, principalCtxKey{}, p)
+}
+
+// PrincipalFromContext returns the principal from the context if any.
+func PrincipalFromContext(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(principalCtxKey{}).(Principal)
+	return p, ok
+}
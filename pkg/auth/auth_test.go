@@ -0,0 +1,65 @@
+package auth_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dmitrymomot/go-smart-monolith/pkg/auth"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrincipal(t *testing.T) {
+	_, ok := auth.PrincipalFromContext(context.Background())
+	require.False(t, ok)
+
+	ctx := auth.WithPrincipal(context.Background(), auth.Principal{UserID: "1"})
+	p, ok := auth.PrincipalFromContext(ctx)
+	require.True(t, ok)
+	require.Equal(t, "1", p.UserID)
+}
+
+func TestJWT(t *testing.T) {
+	j := auth.NewJWT("secret")
+
+	token, err := j.Issue("user-1", time.Minute)
+	require.NoError(t, err)
+
+	claims, err := j.Verify(token)
+	require.NoError(t, err)
+	require.Equal(t, "user-1", claims.Subject)
+
+	t.Run("session", func(t *testing.T) {
+		token, err := j.IssueSession("user-1", "session-1", time.Minute)
+		require.NoError(t, err)
+		claims, err := j.Verify(token)
+		require.NoError(t, err)
+		require.Equal(t, "session-1", claims.SessionID)
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		token, err := j.Issue("user-1", -time.Second)
+		require.NoError(t, err)
+		_, err = j.Verify(token)
+		require.ErrorIs(t, err, auth.ErrTokenExpired)
+	})
+
+	t.Run("wrong secret", func(t *testing.T) {
+		_, err := auth.NewJWT("other").Verify(token)
+		require.ErrorIs(t, err, auth.ErrInvalidToken)
+	})
+
+	t.Run("no secret", func(t *testing.T) {
+		_, err := auth.NewJWT("").Issue("user-1", time.Minute)
+		require.ErrorIs(t, err, auth.ErrNoSecret)
+		_, err = auth.NewJWT("").Verify(token)
+		require.ErrorIs(t, err, auth.ErrInvalidToken)
+	})
+
+	t.Run("malformed", func(t *testing.T) {
+		_, err := j.Verify("a.b.c")
+		require.ErrorIs(t, err, auth.ErrInvalidToken)
+		_, err = j.Verify(token + "x")
+		require.ErrorIs(t, err, auth.ErrInvalidToken)
+	})
+}
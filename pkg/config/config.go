@@ -0,0 +1,375 @@
+package config
+
+import (
+	"encoding"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Struct tags used by the loader.
+//
+//	type Config struct {
+//		Port    int           `yaml:"port" env:"HTTP_PORT" default:"8080"`
+//		Timeout time.Duration `yaml:"timeout" env:"TIMEOUT" default:"5s"`
+//		Secret  string        `yaml:"secret" env:"SECRET" required:"true" secret:"true"`
+//		User    UserConfig    `yaml:"user" envPrefix:"USER_"`
+//	}
+const (
+	tagEnv       = "env"
+	tagEnvPrefix = "envPrefix"
+	tagDefault   = "default"
+	tagRequired  = "required"
+	tagSecret    = "secret"
+	tagFile      = "yaml"
+)
+
+// Redacted is a placeholder for secret values in the printed config.
+const Redacted = "******"
+
+var (
+	// ErrInvalidTarget is returned when the target is not a pointer to a struct.
+	ErrInvalidTarget = errors.New("config target must be a non-nil pointer to a struct")
+	// ErrUnsupportedFile is returned when the config file extension is unknown.
+	ErrUnsupportedFile = errors.New("unsupported config file format")
+)
+
+var (
+	durationType        = reflect.TypeOf(time.Duration(0))
+	urlType             = reflect.TypeOf(url.URL{})
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+type (
+	// ValidationError holds all the problems found while loading the config.
+	// It lists every problem at once, so you don't need to restart the app
+	// to find the next one.
+	ValidationError struct {
+		Problems []string
+	}
+
+	// Validator can be implemented by any config struct to add custom validation.
+	// It's called after all the values are loaded.
+	Validator interface {
+		Validate() error
+	}
+
+	// Option configures the loader.
+	Option func(*loader)
+
+	loader struct {
+		file      string
+		section   string
+		envPrefix string
+		lookup    func(key string) (string, bool)
+		problems  []string
+	}
+)
+
+// Error implements the error interface.
+func (e *ValidationError) Error() string {
+	return "invalid configuration:\n  - " + strings.Join(e.Problems, "\n  - ")
+}
+
+// Merge combines the validation errors of several Load calls into a single one,
+// so all the problems are listed together. Other errors are returned as is.
+func Merge(errs ...error) error {
+	var (
+		problems []string
+		other    []error
+	)
+	for _, err := range errs {
+		var verr *ValidationError
+		switch {
+		case err == nil:
+		case errors.As(err, &verr):
+			problems = append(problems, verr.Problems...)
+		default:
+			other = append(other, err)
+		}
+	}
+	if len(other) > 0 {
+		return errors.Join(other...)
+	}
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+// WithFile sets the optional config file path.
+// Supported formats are YAML (.yaml, .yml) and JSON (.json).
+// Empty path is ignored.
+func WithFile(path string) Option {
+	return func(l *loader) {
+		l.file = path
+	}
+}
+
+// WithSection loads the config from the given top-level section of the file
+// and prefixes all env variable names with envPrefix.
+// It's used to load per-module configs from the shared file, e.g.
+// section "user" with prefix "USER_".
+func WithSection(section, envPrefix string) Option {
+	return func(l *loader) {
+		l.section = section
+		l.envPrefix = envPrefix
+	}
+}
+
+// WithLookup overrides the environment lookup function. Useful for testing.
+func WithLookup(fn func(key string) (string, bool)) Option {
+	return func(l *loader) {
+		l.lookup = fn
+	}
+}
+
+// Load populates the given struct pointer.
+// Values are applied in the following order, each next source overrides the previous one:
+// defaults from the struct tags, the config file, environment variables.
+// Then required fields and custom validators are checked.
+func Load(dst interface{}, opts ...Option) error {
+	rv := reflect.ValueOf(dst)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return ErrInvalidTarget
+	}
+
+	l := &loader{lookup: os.LookupEnv}
+	for _, opt := range opts {
+		opt(l)
+	}
+
+	var fileValues map[string]interface{}
+	if l.file != "" {
+		var err error
+		if fileValues, err = readFile(l.file); err != nil {
+			return err
+		}
+		if l.section != "" {
+			fileValues, _ = fileValues[l.section].(map[string]interface{})
+		}
+	}
+
+	l.load(rv.Elem(), l.section, l.envPrefix, fileValues)
+
+	if len(l.problems) > 0 {
+		return &ValidationError{Problems: l.problems}
+	}
+	return nil
+}
+
+// load walks the struct fields and populates them from all the sources.
+func (l *loader) load(v reflect.Value, path, envPrefix string, fileValues map[string]interface{}) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+		fv := v.Field(i)
+		key := fileKey(sf)
+		fieldPath := joinPath(path, key)
+
+		if isNested(sf.Type) {
+			nested, _ := fileValues[key].(map[string]interface{})
+			l.load(fv, fieldPath, envPrefix+sf.Tag.Get(tagEnvPrefix), nested)
+			continue
+		}
+
+		// defaults
+		if def, ok := sf.Tag.Lookup(tagDefault); ok {
+			l.set(fv, def, fieldPath, "default")
+		}
+
+		// config file
+		if raw, ok := fileValues[key]; ok && raw != nil {
+			l.set(fv, fileValueString(raw), fieldPath, "file")
+		}
+
+		// environment
+		envKey := sf.Tag.Get(tagEnv)
+		if envKey != "" {
+			envKey = envPrefix + envKey
+			if raw, ok := l.lookup(envKey); ok {
+				l.set(fv, raw, fieldPath, envKey)
+			}
+		}
+
+		if sf.Tag.Get(tagRequired) == "true" && fv.IsZero() {
+			src := fieldPath
+			if envKey != "" {
+				src += " (" + envKey + ")"
+			}
+			l.problems = append(l.problems, src+": required value is missing")
+		}
+	}
+
+	// Custom validation of the whole struct.
+	if val, ok := v.Addr().Interface().(Validator); ok {
+		if err := val.Validate(); err != nil {
+			prefix := ""
+			if path != "" {
+				prefix = path + ": "
+			}
+			l.problems = append(l.problems, prefix+err.Error())
+		}
+	}
+}
+
+// set parses the raw string value and sets it to the field.
+func (l *loader) set(fv reflect.Value, raw, path, src string) {
+	if err := setValue(fv, raw); err != nil {
+		l.problems = append(l.problems, fmt.Sprintf("%s: invalid value %q from %s: %v", path, raw, src, err))
+	}
+}
+
+// setValue parses the raw string according to the field type.
+func setValue(fv reflect.Value, raw string) error {
+	if fv.Kind() == reflect.Pointer {
+		ptr := reflect.New(fv.Type().Elem())
+		if err := setValue(ptr.Elem(), raw); err != nil {
+			return err
+		}
+		fv.Set(ptr)
+		return nil
+	}
+
+	switch {
+	case fv.Type() == durationType:
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return err
+		}
+		fv.SetInt(int64(d))
+		return nil
+	case fv.Type() == urlType:
+		u, err := url.Parse(raw)
+		if err != nil {
+			return err
+		}
+		if u.Scheme == "" || u.Host == "" {
+			return errors.New("absolute URL expected")
+		}
+		fv.Set(reflect.ValueOf(*u))
+		return nil
+	case reflect.PointerTo(fv.Type()).Implements(textUnmarshalerType):
+		return fv.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(raw))
+	}
+
+	switch fv.Kind() {
+	case reflect.String:
+		fv.SetString(raw)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		fv.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(raw, 10, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(raw, 10, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(raw, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetFloat(n)
+	case reflect.Slice:
+		parts := strings.Split(raw, ",")
+		s := reflect.MakeSlice(fv.Type(), 0, len(parts))
+		for _, p := range parts {
+			p = strings.TrimSpace(p)
+			if p == "" {
+				continue
+			}
+			item := reflect.New(fv.Type().Elem()).Elem()
+			if err := setValue(item, p); err != nil {
+				return err
+			}
+			s = reflect.Append(s, item)
+		}
+		fv.Set(s)
+	default:
+		return fmt.Errorf("unsupported type %s", fv.Type())
+	}
+	return nil
+}
+
+// readFile reads the config file into a generic map.
+func readFile(path string) (map[string]interface{}, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read config file: %w", err)
+	}
+
+	values := make(map[string]interface{})
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &values)
+	case ".json":
+		err = json.Unmarshal(data, &values)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedFile, path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parse config file: %w", err)
+	}
+
+	return values, nil
+}
+
+// fileValueString converts a value decoded from the config file to the string,
+// so it can be parsed the same way as env variables.
+func fileValueString(v interface{}) string {
+	switch val := v.(type) {
+	case []interface{}:
+		parts := make([]string, 0, len(val))
+		for _, p := range val {
+			parts = append(parts, fileValueString(p))
+		}
+		return strings.Join(parts, ",")
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64)
+	default:
+		return fmt.Sprint(val)
+	}
+}
+
+// isNested reports whether the field is a nested config section.
+func isNested(t reflect.Type) bool {
+	return t.Kind() == reflect.Struct && t != urlType &&
+		!reflect.PointerTo(t).Implements(textUnmarshalerType)
+}
+
+// fileKey returns the field key in the config file.
+func fileKey(sf reflect.StructField) string {
+	if name, _, _ := strings.Cut(sf.Tag.Get(tagFile), ","); name != "" {
+		return name
+	}
+	return strings.ToLower(sf.Name)
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
@@ -0,0 +1,118 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"reflect"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Section is a named config section, e.g. a per-module config.
+type Section struct {
+	Name   string
+	Config interface{}
+}
+
+// Print writes the config as YAML with all the secret values redacted.
+// Fields are printed in the declaration order, URL passwords are always redacted.
+// Sections are appended as top-level keys after the config fields.
+func Print(w io.Writer, cfg interface{}, sections ...Section) error {
+	node, err := structNode(cfg)
+	if err != nil {
+		return err
+	}
+	for _, s := range sections {
+		sn, err := structNode(s.Config)
+		if err != nil {
+			return err
+		}
+		node.Content = append(node.Content, scalar(s.Name), sn)
+	}
+
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(node); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// structNode converts the struct or pointer to struct to the YAML node.
+func structNode(cfg interface{}) (*yaml.Node, error) {
+	rv := reflect.ValueOf(cfg)
+	if rv.Kind() == reflect.Pointer {
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil, ErrInvalidTarget
+	}
+	return toNode(rv), nil
+}
+
+// toNode converts the struct to the ordered YAML mapping node.
+func toNode(v reflect.Value) *yaml.Node {
+	node := &yaml.Node{Kind: yaml.MappingNode}
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+		fv := v.Field(i)
+
+		var val *yaml.Node
+		switch {
+		case isNested(sf.Type):
+			val = toNode(fv)
+		case sf.Tag.Get(tagSecret) == "true":
+			val = scalar(Redacted)
+			if fv.IsZero() {
+				val = scalar("")
+			}
+		default:
+			val = scalar(printValue(fv))
+		}
+
+		node.Content = append(node.Content, scalar(fileKey(sf)), val)
+	}
+	return node
+}
+
+// printValue returns a human-readable representation of the value.
+func printValue(v reflect.Value) string {
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return ""
+		}
+		v = v.Elem()
+	}
+
+	switch val := v.Interface().(type) {
+	case time.Duration:
+		return val.String()
+	case url.URL:
+		return val.Redacted()
+	case fmt.Stringer:
+		return val.String()
+	}
+
+	if v.Kind() == reflect.Slice {
+		s := ""
+		for i := 0; i < v.Len(); i++ {
+			if i > 0 {
+				s += ","
+			}
+			s += printValue(v.Index(i))
+		}
+		return s
+	}
+
+	return fmt.Sprint(v.Interface())
+}
+
+func scalar(s string) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Value: s}
+}
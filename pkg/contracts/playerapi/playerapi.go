@@ -0,0 +1,35 @@
+package playerapi
+
+import (
+	"context"
+	"errors"
+)
+
+// ModuleName is the players service module name.
+// Use it to look up the players module built into the same binary.
+const ModuleName = "player"
+
+// ErrPlayerNotFound is returned when the player doesn't exist.
+var ErrPlayerNotFound = errors.New("player not found")
+
+type (
+	// Player is the public representation of a player.
+	// It's the same for all the transports: HTTP, in-process, etc.
+	Player struct {
+		UserID     string `json:"user_id"`
+		PlayerName string `json:"player_name"`
+	}
+
+	// Service is the public API of the players service.
+	// The players module implements it to be called in-process,
+	// so other modules don't depend on the players service internals.
+	Service interface {
+		GetPlayer(ctx context.Context, userID string) (Player, error)
+	}
+
+	// BatchService is an optional extension of Service to get many players in one call.
+	// The users without a player are not included in the result.
+	BatchService interface {
+		GetPlayers(ctx context.Context, userIDs []string) (map[string]Player, error)
+	}
+)
@@ -0,0 +1,20 @@
+package userapi
+
+import (
+	"context"
+
+	"github.com/dmitrymomot/go-smart-monolith/pkg/auth"
+)
+
+// ModuleName is the user service module name.
+// Use it to look up the user module built into the same binary.
+const ModuleName = "user"
+
+// Authenticator is the part of the user service public API that authenticates the callers.
+// The user module implements it, so other modules built into the same binary
+// accept the same bearer tokens as the user service: the access tokens and the API keys.
+type Authenticator interface {
+	// Authenticate returns the caller the token is issued to, or an error if the token
+	// is invalid, expired or revoked.
+	Authenticate(ctx context.Context, token string) (auth.Principal, error)
+}
@@ -0,0 +1,151 @@
+// Package dataloader coalesces concurrent loads of single keys into batch calls.
+// It's useful to avoid N+1 calls to another service when many handlers
+// ask for the items one by one at the same time.
+package dataloader
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrNotFound is returned by Load when the batch result has no value for the key.
+var ErrNotFound = errors.New("dataloader: key not found")
+
+// Default options.
+const (
+	DefaultWait     = time.Millisecond
+	DefaultMaxBatch = 100
+)
+
+type (
+	// BatchFunc loads the values of the given keys in one call.
+	// The keys are unique. The missing keys must not be included in the result.
+	BatchFunc[K comparable, V any] func(ctx context.Context, keys []K) (map[K]V, error)
+
+	// Loader collects the keys loaded within the wait window into a batch,
+	// and calls the batch function once per batch.
+	// It doesn't cache the results, so it's safe to share between requests.
+	Loader[K comparable, V any] struct {
+		fn   BatchFunc[K, V]
+		opts options
+
+		mu    sync.Mutex
+		batch *batch[K, V]
+	}
+
+	// Option configures the loader.
+	Option func(*options)
+
+	options struct {
+		wait     time.Duration
+		maxBatch int
+	}
+
+	batch[K comparable, V any] struct {
+		ctx     context.Context
+		keys    []K
+		seen    map[K]struct{}
+		once    sync.Once
+		done    chan struct{}
+		results map[K]V
+		err     error
+	}
+)
+
+// WithWait sets how long the loader waits for more keys before calling the batch function.
+func WithWait(d time.Duration) Option {
+	return func(o *options) {
+		o.wait = d
+	}
+}
+
+// WithMaxBatch sets the max number of keys per batch.
+// The batch is dispatched immediately once it's full.
+func WithMaxBatch(n int) Option {
+	return func(o *options) {
+		if n > 0 {
+			o.maxBatch = n
+		}
+	}
+}
+
+// New creates a new loader with the given batch function.
+func New[K comparable, V any](fn BatchFunc[K, V], opts ...Option) *Loader[K, V] {
+	o := options{
+		wait:     DefaultWait,
+		maxBatch: DefaultMaxBatch,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return &Loader[K, V]{fn: fn, opts: o}
+}
+
+// Load loads the value of the key as a part of the current batch.
+// It blocks until the batch is loaded or the context is done.
+// The batch function is called with the context of the first load in the batch,
+// but without its cancellation, so one canceled caller doesn't fail the others.
+func (l *Loader[K, V]) Load(ctx context.Context, key K) (V, error) {
+	b := l.add(ctx, key)
+
+	var zero V
+	select {
+	case <-b.done:
+	case <-ctx.Done():
+		return zero, ctx.Err()
+	}
+
+	if b.err != nil {
+		return zero, b.err
+	}
+	v, ok := b.results[key]
+	if !ok {
+		return zero, ErrNotFound
+	}
+	return v, nil
+}
+
+// add adds the key to the current batch, starting a new one if needed.
+func (l *Loader[K, V]) add(ctx context.Context, key K) *batch[K, V] {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b := l.batch
+	if b == nil {
+		b = &batch[K, V]{
+			ctx:  context.WithoutCancel(ctx),
+			seen: make(map[K]struct{}),
+			done: make(chan struct{}),
+		}
+		l.batch = b
+		time.AfterFunc(l.opts.wait, func() { l.dispatch(b) })
+	}
+
+	if _, ok := b.seen[key]; !ok {
+		b.seen[key] = struct{}{}
+		b.keys = append(b.keys, key)
+	}
+
+	if len(b.keys) >= l.opts.maxBatch {
+		l.batch = nil // The next key starts a new batch.
+		go l.dispatch(b)
+	}
+
+	return b
+}
+
+// dispatch calls the batch function once per batch.
+func (l *Loader[K, V]) dispatch(b *batch[K, V]) {
+	b.once.Do(func() {
+		l.mu.Lock()
+		if l.batch == b {
+			l.batch = nil
+		}
+		l.mu.Unlock()
+
+		b.results, b.err = l.fn(b.ctx, b.keys)
+		close(b.done)
+	})
+}
@@ -0,0 +1,119 @@
+package dataloader_test
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dmitrymomot/go-smart-monolith/pkg/dataloader"
+	"github.com/stretchr/testify/require"
+)
+
+// recorder records the batches the loader calls the batch function with.
+type recorder struct {
+	mu      sync.Mutex
+	batches [][]int
+	err     error
+}
+
+func (r *recorder) load(_ context.Context, keys []int) (map[int]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.batches = append(r.batches, append([]int(nil), keys...))
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	res := make(map[int]string, len(keys))
+	for _, k := range keys {
+		if k >= 0 {
+			res[k] = string(rune('a' + k))
+		}
+	}
+	return res, nil
+}
+
+func (r *recorder) calls() [][]int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.batches
+}
+
+// loadAll loads the keys concurrently and returns the values and errors by key.
+func loadAll(l *dataloader.Loader[int, string], keys ...int) (map[int]string, map[int]error) {
+	var (
+		mu   sync.Mutex
+		wg   sync.WaitGroup
+		vals = map[int]string{}
+		errs = map[int]error{}
+	)
+	for _, k := range keys {
+		wg.Add(1)
+		go func(k int) {
+			defer wg.Done()
+			v, err := l.Load(context.Background(), k)
+			mu.Lock()
+			defer mu.Unlock()
+			vals[k], errs[k] = v, err
+		}(k)
+	}
+	wg.Wait()
+	return vals, errs
+}
+
+func TestLoader_Coalesce(t *testing.T) {
+	r := &recorder{}
+	l := dataloader.New(r.load, dataloader.WithWait(20*time.Millisecond))
+
+	vals, errs := loadAll(l, 0, 1, 2, 1, -1)
+
+	require.Len(t, r.calls(), 1, "concurrent loads must be coalesced into one batch")
+	keys := r.calls()[0]
+	sort.Ints(keys)
+	require.Equal(t, []int{-1, 0, 1, 2}, keys, "keys must be unique")
+
+	require.Equal(t, "a", vals[0])
+	require.Equal(t, "b", vals[1])
+	require.Equal(t, "c", vals[2])
+	require.ErrorIs(t, errs[-1], dataloader.ErrNotFound)
+}
+
+func TestLoader_MaxBatch(t *testing.T) {
+	r := &recorder{}
+	l := dataloader.New(r.load, dataloader.WithWait(time.Hour), dataloader.WithMaxBatch(2))
+
+	// The wait window is too long, so the batches are dispatched only when they are full.
+	_, errs := loadAll(l, 0, 1, 2, 3)
+
+	require.Len(t, r.calls(), 2)
+	for _, b := range r.calls() {
+		require.Len(t, b, 2)
+	}
+	for _, err := range errs {
+		require.NoError(t, err)
+	}
+}
+
+func TestLoader_Error(t *testing.T) {
+	r := &recorder{err: errors.New("boom")}
+	l := dataloader.New(r.load)
+
+	_, errs := loadAll(l, 0, 1)
+	require.EqualError(t, errs[0], "boom")
+	require.EqualError(t, errs[1], "boom")
+}
+
+func TestLoader_ContextCanceled(t *testing.T) {
+	r := &recorder{}
+	l := dataloader.New(r.load, dataloader.WithWait(time.Hour))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := l.Load(ctx, 0)
+	require.ErrorIs(t, err, context.Canceled)
+}
@@ -0,0 +1,88 @@
+package featureflag
+
+import (
+	"context"
+	"hash/fnv"
+)
+
+type (
+	// Provider evaluates feature flags.
+	// Unknown flags are always disabled.
+	Provider interface {
+		Enabled(ctx context.Context, flag string) bool
+	}
+
+	// EvalContext holds the attributes the flags are evaluated against.
+	// Put it to the request context with WithEvalContext, e.g. in an HTTP middleware.
+	EvalContext struct {
+		UserID   string
+		TenantID string
+	}
+
+	// Rule describes how a single flag is evaluated.
+	// Explicit user and tenant lists take precedence over the percentage rollout,
+	// which takes precedence over the Enabled value.
+	Rule struct {
+		// Enabled is the flag value for everyone not matched by other rules.
+		Enabled bool `json:"enabled" yaml:"enabled"`
+		// Percentage enables the flag for the given share of users (0..100).
+		// Users are bucketed by the hash of the flag name and the user ID (or tenant ID if no user),
+		// so the same user always gets the same result.
+		Percentage *int `json:"percentage,omitempty" yaml:"percentage,omitempty"`
+		// Users is the list of user IDs the flag is always enabled for.
+		Users []string `json:"users,omitempty" yaml:"users,omitempty"`
+		// Tenants is the list of tenant IDs the flag is always enabled for.
+		Tenants []string `json:"tenants,omitempty" yaml:"tenants,omitempty"`
+	}
+
+	evalContextKey struct{}
+)
+
+// WithEvalContext returns a new context with the evaluation context attached.
+func WithEvalContext(ctx context.Context, ec EvalContext) context.Context {
+	return context.WithValue(ctx, evalContextKey{}, ec)
+}
+
+// EvalContextFromContext returns the evaluation context attached to the ctx, if any.
+func EvalContextFromContext(ctx context.Context) EvalContext {
+	ec, _ := ctx.Value(evalContextKey{}).(EvalContext)
+	return ec
+}
+
+// Evaluate evaluates the rule against the evaluation context.
+func (r Rule) Evaluate(flag string, ec EvalContext) bool {
+	if ec.UserID != "" && contains(r.Users, ec.UserID) {
+		return true
+	}
+	if ec.TenantID != "" && contains(r.Tenants, ec.TenantID) {
+		return true
+	}
+	if r.Percentage != nil {
+		key := ec.UserID
+		if key == "" {
+			key = ec.TenantID
+		}
+		if key == "" {
+			// Nothing to bucket by, so fallback to the default value.
+			return r.Enabled
+		}
+		return bucket(flag, key) < *r.Percentage
+	}
+	return r.Enabled
+}
+
+// bucket returns a stable bucket number in range 0..99 for the given flag and key.
+func bucket(flag, key string) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(flag + ":" + key))
+	return int(h.Sum32() % 100)
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
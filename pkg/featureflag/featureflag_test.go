@@ -0,0 +1,87 @@
+package featureflag_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dmitrymomot/go-smart-monolith/pkg/featureflag"
+
+	"github.com/stretchr/testify/require"
+)
+
+// nopLogger is a logger that does nothing.
+type nopLogger struct{}
+
+func (nopLogger) Error(err error, kv ...interface{}) {}
+
+func userCtx(userID, tenantID string) context.Context {
+	return featureflag.WithEvalContext(context.Background(), featureflag.EvalContext{
+		UserID:   userID,
+		TenantID: tenantID,
+	})
+}
+
+func TestStatic(t *testing.T) {
+	t.Parallel()
+
+	p := featureflag.NewStaticRules(map[string]featureflag.Rule{
+		"on":     {Enabled: true},
+		"tenant": {Tenants: []string{"acme"}},
+		"user":   {Users: []string{"u1"}},
+	})
+
+	require.True(t, p.Enabled(context.Background(), "on"))
+	require.False(t, p.Enabled(context.Background(), "unknown"))
+	require.True(t, p.Enabled(userCtx("u2", "acme"), "tenant"))
+	require.False(t, p.Enabled(userCtx("u2", "other"), "tenant"))
+	require.True(t, p.Enabled(userCtx("u1", ""), "user"))
+	require.False(t, p.Enabled(userCtx("u2", ""), "user"))
+}
+
+func TestPercentage(t *testing.T) {
+	t.Parallel()
+
+	p := featureflag.NewPercentage(map[string]int{"none": 0, "all": 100, "half": 50})
+
+	// No one to bucket by.
+	require.False(t, p.Enabled(context.Background(), "all"))
+
+	enabled := 0
+	for i := 0; i < 1000; i++ {
+		ctx := userCtx(fmt.Sprintf("user-%d", i), "")
+		require.False(t, p.Enabled(ctx, "none"))
+		require.True(t, p.Enabled(ctx, "all"))
+		if p.Enabled(ctx, "half") {
+			enabled++
+		}
+		// Result is stable for the same user.
+		require.Equal(t, p.Enabled(ctx, "half"), p.Enabled(ctx, "half"))
+	}
+	require.InDelta(t, 500, enabled, 100)
+}
+
+func TestFile(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "flags.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("new_signup:\n  enabled: false\n"), 0o600))
+
+	p, err := featureflag.NewFile(path, 5*time.Millisecond, nopLogger{})
+	require.NoError(t, err)
+	require.False(t, p.Enabled(context.Background(), "new_signup"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go p.Watch(ctx)
+
+	// Flag is switched at runtime.
+	require.NoError(t, os.WriteFile(path, []byte("new_signup:\n  enabled: true\n"), 0o600))
+	require.NoError(t, os.Chtimes(path, time.Now(), time.Now().Add(time.Minute)))
+	require.Eventually(t, func() bool {
+		return p.Enabled(context.Background(), "new_signup")
+	}, time.Second, 5*time.Millisecond)
+}
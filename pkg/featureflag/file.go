@@ -0,0 +1,119 @@
+package featureflag
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+type (
+	// File is a provider that reads flag rules from a YAML or JSON file
+	// and reloads them when the file changes, so flags can be switched without a redeploy.
+	//
+	//	require_email_verification:
+	//	  enabled: false
+	//	  percentage: 10
+	//	  tenants: [acme]
+	File struct {
+		path     string
+		interval time.Duration
+		log      logger
+
+		mu      sync.RWMutex
+		rules   map[string]Rule
+		modTime time.Time
+	}
+
+	// low-level abstraction for the logger.
+	logger interface {
+		Error(err error, kv ...interface{})
+	}
+)
+
+// NewFile creates a file-based provider and loads the flags.
+// Call Watch to reload the flags on file change.
+func NewFile(path string, interval time.Duration, log logger) (*File, error) {
+	f := &File{
+		path:     path,
+		interval: interval,
+		log:      log,
+	}
+	if err := f.reload(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Enabled reports whether the flag is enabled for the evaluation context in ctx.
+func (f *File) Enabled(ctx context.Context, flag string) bool {
+	f.mu.RLock()
+	rule, ok := f.rules[flag]
+	f.mu.RUnlock()
+	if !ok {
+		return false
+	}
+	return rule.Evaluate(flag, EvalContextFromContext(ctx))
+}
+
+// Watch polls the file for changes until the context is done.
+// If the changed file can't be parsed, the previous rules are kept.
+func (f *File) Watch(ctx context.Context) {
+	ticker := time.NewTicker(f.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := f.reload(); err != nil {
+				f.log.Error(err, "feature_flags_file", f.path)
+			}
+		}
+	}
+}
+
+// reload reads the file if it was modified since the last read.
+func (f *File) reload() error {
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return fmt.Errorf("feature flags: %w", err)
+	}
+
+	f.mu.RLock()
+	unchanged := info.ModTime().Equal(f.modTime)
+	f.mu.RUnlock()
+	if unchanged {
+		return nil
+	}
+
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		return fmt.Errorf("feature flags: %w", err)
+	}
+
+	rules := make(map[string]Rule)
+	switch strings.ToLower(filepath.Ext(f.path)) {
+	case ".json":
+		err = json.Unmarshal(data, &rules)
+	default:
+		err = yaml.Unmarshal(data, &rules)
+	}
+	if err != nil {
+		return fmt.Errorf("feature flags: parse %s: %w", f.path, err)
+	}
+
+	f.mu.Lock()
+	f.rules = rules
+	f.modTime = info.ModTime()
+	f.mu.Unlock()
+
+	return nil
+}
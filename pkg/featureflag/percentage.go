@@ -0,0 +1,24 @@
+package featureflag
+
+import "context"
+
+// Percentage is a provider that gradually rolls out flags to the given share of users.
+type Percentage struct {
+	percentages map[string]int
+}
+
+// NewPercentage creates a percentage rollout provider.
+// The map value is the share of users (0..100) the flag is enabled for.
+func NewPercentage(percentages map[string]int) *Percentage {
+	return &Percentage{percentages: percentages}
+}
+
+// Enabled reports whether the flag is enabled for the evaluation context in ctx.
+// The flag is always disabled if there is no user or tenant in the context.
+func (p *Percentage) Enabled(ctx context.Context, flag string) bool {
+	pct, ok := p.percentages[flag]
+	if !ok {
+		return false
+	}
+	return Rule{Percentage: &pct}.Evaluate(flag, EvalContextFromContext(ctx))
+}
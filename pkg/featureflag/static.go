@@ -0,0 +1,32 @@
+package featureflag
+
+import "context"
+
+// Static is a provider with flags defined at startup, e.g. from the app config.
+// Flags can't be changed without restart.
+type Static struct {
+	rules map[string]Rule
+}
+
+// NewStatic creates a static provider with the given flags enabled for everyone.
+func NewStatic(enabled ...string) *Static {
+	rules := make(map[string]Rule, len(enabled))
+	for _, flag := range enabled {
+		rules[flag] = Rule{Enabled: true}
+	}
+	return &Static{rules: rules}
+}
+
+// NewStaticRules creates a static provider with the given rules.
+func NewStaticRules(rules map[string]Rule) *Static {
+	return &Static{rules: rules}
+}
+
+// Enabled reports whether the flag is enabled for the evaluation context in ctx.
+func (s *Static) Enabled(ctx context.Context, flag string) bool {
+	rule, ok := s.rules[flag]
+	if !ok {
+		return false
+	}
+	return rule.Evaluate(flag, EvalContextFromContext(ctx))
+}
@@ -0,0 +1,206 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Status values used in the health report.
+const (
+	StatusUp       = "up"
+	StatusDown     = "down"
+	StatusDegraded = "degraded"
+)
+
+// Default timeout for a single check.
+const defaultTimeout = 2 * time.Second
+
+// ErrShuttingDown is reported by the readiness probe during the graceful shutdown.
+var ErrShuttingDown = errors.New("shutting down")
+
+type (
+	// Registry holds all the registered dependency checks
+	// and aggregates them into liveness and readiness reports.
+	Registry struct {
+		mu           sync.RWMutex
+		checks       []Check
+		shuttingDown atomic.Bool
+	}
+
+	// Check is a named dependency probe.
+	Check struct {
+		// Name is a unique check name, e.g. "storage", "nats", "players".
+		Name string
+		// Check returns an error if the dependency is not healthy.
+		Check func(ctx context.Context) error
+		// Timeout limits a single check execution. Default is 2s.
+		Timeout time.Duration
+		// Critical checks make readiness fail,
+		// non-critical ones only degrade the report.
+		Critical bool
+		// Liveness marks the check to be included in the liveness report.
+		// Keep it for checks of the process itself only, since
+		// a failed liveness probe usually means the process restart.
+		Liveness bool
+	}
+
+	// Report represents the aggregated health report.
+	Report struct {
+		Status string                 `json:"status"`
+		Checks map[string]CheckResult `json:"checks,omitempty"`
+	}
+
+	// CheckResult represents a single check result.
+	CheckResult struct {
+		Status   string `json:"status"`
+		Critical bool   `json:"critical"`
+		Duration string `json:"duration"`
+		Error    string `json:"error,omitempty"`
+	}
+)
+
+// New creates a new health registry.
+func New() *Registry {
+	return &Registry{}
+}
+
+// Register adds checks to the registry.
+func (r *Registry) Register(checks ...Check) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, c := range checks {
+		if c.Timeout <= 0 {
+			c.Timeout = defaultTimeout
+		}
+		r.checks = append(r.checks, c)
+	}
+}
+
+// Shutdown flips readiness to failing.
+// Call it at the very beginning of the graceful shutdown,
+// so load balancers stop sending new requests to the instance.
+func (r *Registry) Shutdown() {
+	r.shuttingDown.Store(true)
+}
+
+// Liveness runs the liveness checks and returns the aggregated report.
+func (r *Registry) Liveness(ctx context.Context) Report {
+	return r.run(ctx, func(c Check) bool { return c.Liveness })
+}
+
+// Readiness runs all the checks and returns the aggregated report.
+func (r *Registry) Readiness(ctx context.Context) Report {
+	rep := r.run(ctx, func(Check) bool { return true })
+	if r.shuttingDown.Load() {
+		rep.Status = StatusDown
+		rep.Checks["shutdown"] = CheckResult{
+			Status:   StatusDown,
+			Critical: true,
+			Duration: "0s",
+			Error:    ErrShuttingDown.Error(),
+		}
+	}
+	return rep
+}
+
+// LivenessHandler returns an HTTP handler for the liveness probe, e.g. GET /healthz.
+func (r *Registry) LivenessHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		writeReport(w, r.Liveness(req.Context()))
+	}
+}
+
+// ReadinessHandler returns an HTTP handler for the readiness probe, e.g. GET /readyz.
+func (r *Registry) ReadinessHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		writeReport(w, r.Readiness(req.Context()))
+	}
+}
+
+// run executes the filtered checks concurrently and aggregates the results.
+func (r *Registry) run(ctx context.Context, filter func(Check) bool) Report {
+	r.mu.RLock()
+	checks := make([]Check, 0, len(r.checks))
+	for _, c := range r.checks {
+		if filter(c) {
+			checks = append(checks, c)
+		}
+	}
+	r.mu.RUnlock()
+
+	results := make([]CheckResult, len(checks))
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Add(1)
+		go func(i int, c Check) {
+			defer wg.Done()
+			results[i] = runCheck(ctx, c)
+		}(i, c)
+	}
+	wg.Wait()
+
+	rep := Report{
+		Status: StatusUp,
+		Checks: make(map[string]CheckResult, len(checks)),
+	}
+	for i, c := range checks {
+		res := results[i]
+		rep.Checks[c.Name] = res
+		if res.Status == StatusUp {
+			continue
+		}
+		if c.Critical {
+			rep.Status = StatusDown
+		} else if rep.Status == StatusUp {
+			rep.Status = StatusDegraded
+		}
+	}
+
+	return rep
+}
+
+// runCheck executes a single check within its timeout.
+func runCheck(ctx context.Context, c Check) CheckResult {
+	ctx, cancel := context.WithTimeout(ctx, c.Timeout)
+	defer cancel()
+
+	start := time.Now()
+	errCh := make(chan error, 1)
+	go func() { errCh <- c.Check(ctx) }()
+
+	var err error
+	select {
+	case err = <-errCh:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	res := CheckResult{
+		Status:   StatusUp,
+		Critical: c.Critical,
+		Duration: time.Since(start).String(),
+	}
+	if err != nil {
+		res.Status = StatusDown
+		res.Error = err.Error()
+	}
+	return res
+}
+
+// writeReport writes the report as JSON.
+// Only the down status is reported as 503, degraded service still can serve requests.
+func writeReport(w http.ResponseWriter, rep Report) {
+	code := http.StatusOK
+	if rep.Status == StatusDown {
+		code = http.StatusServiceUnavailable
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(rep)
+}
@@ -0,0 +1,110 @@
+package health_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dmitrymomot/go-smart-monolith/pkg/health"
+
+	"github.com/stretchr/testify/require"
+)
+
+func ok(ctx context.Context) error { return nil }
+
+func fail(ctx context.Context) error { return errors.New("connection refused") }
+
+func TestRegistry_Readiness(t *testing.T) {
+	t.Parallel()
+
+	// All checks pass.
+	t.Run("up", func(t *testing.T) {
+		reg := health.New()
+		reg.Register(
+			health.Check{Name: "storage", Check: ok, Critical: true},
+			health.Check{Name: "players", Check: ok},
+		)
+
+		rep := reg.Readiness(context.Background())
+		require.Equal(t, health.StatusUp, rep.Status)
+		require.Len(t, rep.Checks, 2)
+	})
+
+	// Non-critical dependency is down.
+	t.Run("degraded", func(t *testing.T) {
+		reg := health.New()
+		reg.Register(
+			health.Check{Name: "storage", Check: ok, Critical: true},
+			health.Check{Name: "players", Check: fail},
+		)
+
+		rep := reg.Readiness(context.Background())
+		require.Equal(t, health.StatusDegraded, rep.Status)
+		require.Equal(t, "connection refused", rep.Checks["players"].Error)
+	})
+
+	// Critical dependency is down.
+	t.Run("down", func(t *testing.T) {
+		reg := health.New()
+		reg.Register(health.Check{Name: "storage", Check: fail, Critical: true})
+
+		rep := reg.Readiness(context.Background())
+		require.Equal(t, health.StatusDown, rep.Status)
+	})
+
+	// Check takes longer than its timeout.
+	t.Run("timeout", func(t *testing.T) {
+		reg := health.New()
+		reg.Register(health.Check{
+			Name: "nats",
+			Check: func(ctx context.Context) error {
+				time.Sleep(time.Second)
+				return nil
+			},
+			Timeout:  10 * time.Millisecond,
+			Critical: true,
+		})
+
+		rep := reg.Readiness(context.Background())
+		require.Equal(t, health.StatusDown, rep.Status)
+		require.Equal(t, context.DeadlineExceeded.Error(), rep.Checks["nats"].Error)
+	})
+
+	// Readiness fails during the graceful shutdown.
+	t.Run("shutting_down", func(t *testing.T) {
+		reg := health.New()
+		reg.Register(health.Check{Name: "storage", Check: ok, Critical: true})
+		reg.Shutdown()
+
+		rep := reg.Readiness(context.Background())
+		require.Equal(t, health.StatusDown, rep.Status)
+
+		// Liveness is not affected.
+		require.Equal(t, health.StatusUp, reg.Liveness(context.Background()).Status)
+	})
+}
+
+func TestRegistry_Handlers(t *testing.T) {
+	t.Parallel()
+
+	reg := health.New()
+	reg.Register(health.Check{Name: "storage", Check: fail, Critical: true})
+
+	// Liveness doesn't include the dependency checks by default.
+	rec := httptest.NewRecorder()
+	reg.LivenessHandler()(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	rec = httptest.NewRecorder()
+	reg.ReadinessHandler()(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	require.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	require.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+
+	var rep health.Report
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&rep))
+	require.Equal(t, health.StatusDown, rep.Checks["storage"].Status)
+}
@@ -0,0 +1,171 @@
+// Package idempotency executes the retried requests once: the result of the first request
+// is stored under its idempotency key, and the retries with the same key get it replayed.
+// See Middleware for the HTTP requests, the commands are deduplicated by the key put into
+// the context with WithKey, e.g. by a command decorator.
+package idempotency
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/dmitrymomot/go-smart-monolith/pkg/storage"
+)
+
+// storePrefix is the key prefix of the records in the storage.
+const storePrefix = "idempotency:"
+
+var (
+	// ErrInProgress is returned when the request with the same key is still being executed.
+	ErrInProgress = errors.New("a request with the same idempotency key is in progress")
+	// ErrKeyReused is returned when the key is reused for a different request.
+	ErrKeyReused = errors.New("the idempotency key is already used for a different request")
+
+	// errReplay aborts the update of the completed record, it's replayed as is.
+	errReplay = errors.New("replay")
+)
+
+type (
+	// Record is the state of the request with the idempotency key.
+	Record struct {
+		// Fingerprint identifies the request, so the key can't be reused for another one.
+		Fingerprint string
+		// Done reports whether the request is completed and its result can be replayed.
+		Done bool
+		// Result is the result of the completed request, e.g. the HTTP response.
+		Result interface{}
+		// LockedUntil is when the request in progress releases the key,
+		// so the retries are not blocked forever if it crashed.
+		LockedUntil time.Time
+	}
+
+	// Client is the low-level storage the Store keeps the records in, see pkg/storage.
+	Client interface {
+		Get(ctx context.Context, key string) (interface{}, error)
+		Set(ctx context.Context, key string, value interface{}) error
+		Delete(ctx context.Context, key string) error
+	}
+
+	// Optional atomic read-modify-write of the storage client setting the key TTL,
+	// e.g. WATCH/MULTI with SET ... EX in redis.
+	// Without it the concurrent duplicates may be executed both.
+	ttlUpdater interface {
+		UpdateWithTTL(ctx context.Context, key string, fn func(v interface{}, ok bool) (interface{}, time.Duration, error)) error
+	}
+
+	// Optional capability of the storage client to expire the keys.
+	// Without it the records are kept forever.
+	ttlSetter interface {
+		SetWithTTL(ctx context.Context, key string, value interface{}, ttl time.Duration) error
+	}
+
+	ctxKey struct{}
+)
+
+// WithKey returns a copy of the context with the idempotency key of the request.
+func WithKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, ctxKey{}, key)
+}
+
+// KeyFromContext returns the idempotency key of the request, if any.
+func KeyFromContext(ctx context.Context) (string, bool) {
+	key, ok := ctx.Value(ctxKey{}).(string)
+	return key, ok && key != ""
+}
+
+// Fingerprint returns the fingerprint of the request made of the parts, e.g. the method, the path and the body.
+func Fingerprint(parts ...[]byte) string {
+	h := sha256.New()
+	for _, p := range parts {
+		h.Write(p)
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Store keeps the idempotency records in the shared storage,
+// so the retries are deduplicated by all the app instances.
+type Store struct {
+	client Client
+	now    func() time.Time
+}
+
+// NewStore creates a new idempotency records store on the storage client.
+func NewStore(client Client, now func() time.Time) *Store {
+	return &Store{client: client, now: now}
+}
+
+// Begin claims the key for the request with the fingerprint for the timeout.
+// It returns the completed record to be replayed and false if the request has been executed,
+// or ErrInProgress or ErrKeyReused. Otherwise the request should be executed and
+// then completed with Complete, or released with Release to let it be retried.
+func (s *Store) Begin(ctx context.Context, key, fingerprint string, timeout time.Duration) (Record, bool, error) {
+	var (
+		rec   Record
+		begun bool
+	)
+	update := func(v interface{}, ok bool) (interface{}, time.Duration, error) {
+		now := s.now()
+		if ok {
+			rec = v.(Record)
+			switch {
+			case rec.Fingerprint != fingerprint:
+				return nil, 0, ErrKeyReused
+			case rec.Done:
+				return nil, 0, errReplay
+			case now.Before(rec.LockedUntil):
+				return nil, 0, ErrInProgress
+			}
+		}
+		rec = Record{Fingerprint: fingerprint, LockedUntil: now.Add(timeout)}
+		begun = true
+		return rec, timeout, nil
+	}
+
+	var err error
+	if u, ok := s.client.(ttlUpdater); ok {
+		err = u.UpdateWithTTL(ctx, storePrefix+key, update)
+	} else {
+		err = s.getAndSet(ctx, key, update)
+	}
+	if errors.Is(err, errReplay) {
+		return rec, false, nil
+	}
+	if err != nil {
+		return Record{}, false, err
+	}
+	return rec, begun, nil
+}
+
+// Complete stores the result of the request begun with Begin, so it's replayed to the retries for the ttl.
+func (s *Store) Complete(ctx context.Context, key, fingerprint string, result interface{}, ttl time.Duration) error {
+	rec := Record{Fingerprint: fingerprint, Done: true, Result: result}
+	if c, ok := s.client.(ttlSetter); ok {
+		return c.SetWithTTL(ctx, storePrefix+key, rec, ttl)
+	}
+	return s.client.Set(ctx, storePrefix+key, rec)
+}
+
+// Release releases the key of the request begun with Begin without the result,
+// e.g. if it failed, so the retries are executed again.
+func (s *Store) Release(ctx context.Context, key string) error {
+	return s.client.Delete(ctx, storePrefix+key)
+}
+
+// getAndSet is the non-atomic fallback of UpdateWithTTL.
+func (s *Store) getAndSet(ctx context.Context, key string, fn func(v interface{}, ok bool) (interface{}, time.Duration, error)) error {
+	v, err := s.client.Get(ctx, storePrefix+key)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		return err
+	}
+	next, ttl, err := fn(v, err == nil)
+	if err != nil {
+		return err
+	}
+	if c, ok := s.client.(ttlSetter); ok {
+		return c.SetWithTTL(ctx, storePrefix+key, next, ttl)
+	}
+	return s.client.Set(ctx, storePrefix+key, next)
+}
@@ -0,0 +1,198 @@
+package idempotency_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dmitrymomot/go-smart-monolith/pkg/auth"
+	"github.com/dmitrymomot/go-smart-monolith/pkg/idempotency"
+	"github.com/dmitrymomot/go-smart-monolith/pkg/storage"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStore(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	s := idempotency.NewStore(storage.New(), func() time.Time { return now })
+	ctx := context.Background()
+
+	_, begun, err := s.Begin(ctx, "k1", "a", time.Minute)
+	require.NoError(t, err)
+	require.True(t, begun)
+
+	_, _, err = s.Begin(ctx, "k1", "a", time.Minute)
+	require.ErrorIs(t, err, idempotency.ErrInProgress)
+	_, _, err = s.Begin(ctx, "k1", "b", time.Minute)
+	require.ErrorIs(t, err, idempotency.ErrKeyReused)
+
+	// The crashed request releases the key after the timeout.
+	now = now.Add(time.Minute)
+	_, begun, err = s.Begin(ctx, "k1", "a", time.Minute)
+	require.NoError(t, err)
+	require.True(t, begun)
+
+	require.NoError(t, s.Complete(ctx, "k1", "a", "result", time.Hour))
+	rec, begun, err := s.Begin(ctx, "k1", "a", time.Minute)
+	require.NoError(t, err)
+	require.False(t, begun)
+	require.Equal(t, "result", rec.Result)
+	_, _, err = s.Begin(ctx, "k1", "b", time.Minute)
+	require.ErrorIs(t, err, idempotency.ErrKeyReused)
+
+	// The released key is executed again.
+	_, begun, err = s.Begin(ctx, "k2", "a", time.Minute)
+	require.NoError(t, err)
+	require.True(t, begun)
+	require.NoError(t, s.Release(ctx, "k2"))
+	_, begun, err = s.Begin(ctx, "k2", "b", time.Minute)
+	require.NoError(t, err)
+	require.True(t, begun)
+
+	ctx = idempotency.WithKey(ctx, "k3")
+	key, ok := idempotency.KeyFromContext(ctx)
+	require.True(t, ok)
+	require.Equal(t, "k3", key)
+	_, ok = idempotency.KeyFromContext(context.Background())
+	require.False(t, ok)
+}
+
+func TestMiddleware(t *testing.T) {
+	t.Parallel()
+
+	// newServer returns the server creating the items, and the number of the created items.
+	newServer := func(status int, block chan struct{}) (http.Handler, *int32) {
+		var created int32
+		h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if block != nil {
+				block <- struct{}{}
+				<-block
+			}
+			body, _ := io.ReadAll(r.Body)
+			n := atomic.AddInt32(&created, 1)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(status)
+			fmt.Fprintf(w, `{"id":%d,"body":%q}`, n, body)
+		})
+		mw := idempotency.Middleware(idempotency.NewStore(storage.New(), time.Now), time.Hour, time.Minute)
+		// The outer middleware sets its own headers, they are not replayed.
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("RateLimit-Remaining", fmt.Sprint(atomic.LoadInt32(&created)))
+			mw(h).ServeHTTP(w, r)
+		}), &created
+	}
+	call := func(h http.Handler, method, key, body string, p *auth.Principal) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, "/items", strings.NewReader(body))
+		if key != "" {
+			r.Header.Set(idempotency.Header, key)
+		}
+		if p != nil {
+			r = r.WithContext(auth.WithPrincipal(r.Context(), *p))
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	t.Run("replay", func(t *testing.T) {
+		t.Parallel()
+		h, created := newServer(http.StatusCreated, nil)
+
+		first := call(h, http.MethodPost, "k1", "item", nil)
+		require.Equal(t, http.StatusCreated, first.Code)
+		require.Empty(t, first.Header().Get(idempotency.ReplayedHeader))
+
+		retry := call(h, http.MethodPost, "k1", "item", nil)
+		require.Equal(t, http.StatusCreated, retry.Code)
+		require.Equal(t, first.Body.String(), retry.Body.String())
+		require.Equal(t, "application/json", retry.Header().Get("Content-Type"))
+		require.Equal(t, "true", retry.Header().Get(idempotency.ReplayedHeader))
+		require.Equal(t, "1", retry.Header().Get("RateLimit-Remaining"))
+		require.EqualValues(t, 1, *created)
+
+		require.Equal(t, http.StatusUnprocessableEntity, call(h, http.MethodPost, "k1", "other", nil).Code)
+		require.Equal(t, http.StatusCreated, call(h, http.MethodPost, "k2", "item", nil).Code)
+		require.Equal(t, http.StatusCreated, call(h, http.MethodPost, "", "item", nil).Code)
+		require.Equal(t, http.StatusCreated, call(h, http.MethodPut, "k1", "item", nil).Code, "only POST and PATCH are deduplicated")
+		require.EqualValues(t, 4, *created)
+	})
+
+	t.Run("caller scope", func(t *testing.T) {
+		t.Parallel()
+		h, created := newServer(http.StatusCreated, nil)
+
+		call(h, http.MethodPost, "k1", "item", &auth.Principal{UserID: "u1"})
+		call(h, http.MethodPost, "k1", "item", &auth.Principal{UserID: "u2"})
+		call(h, http.MethodPost, "k1", "item", &auth.Principal{UserID: "u1", APIKeyID: "key1"})
+		call(h, http.MethodPost, "k1", "item", nil)
+		require.EqualValues(t, 4, *created)
+		call(h, http.MethodPost, "k1", "item", &auth.Principal{UserID: "u1"})
+		require.EqualValues(t, 4, *created)
+	})
+
+	t.Run("anonymous callers are scoped by IP", func(t *testing.T) {
+		t.Parallel()
+		h, created := newServer(http.StatusCreated, nil)
+
+		for _, addr := range []string{"10.0.0.1:1234", "10.0.0.1:5678", "10.0.0.2:1234"} {
+			r := httptest.NewRequest(http.MethodPost, "/items", strings.NewReader("item"))
+			r.RemoteAddr = addr
+			r.Header.Set(idempotency.Header, "k1")
+			h.ServeHTTP(httptest.NewRecorder(), r)
+		}
+		require.EqualValues(t, 2, *created)
+	})
+
+	t.Run("body too large", func(t *testing.T) {
+		t.Parallel()
+		h, created := newServer(http.StatusCreated, nil)
+
+		w := call(h, http.MethodPost, "k1", strings.Repeat("a", 1<<20+1), nil)
+		require.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+		require.EqualValues(t, 0, *created)
+	})
+
+	t.Run("server errors are not stored", func(t *testing.T) {
+		t.Parallel()
+		h, created := newServer(http.StatusServiceUnavailable, nil)
+
+		for i := 0; i < 2; i++ {
+			w := call(h, http.MethodPost, "k1", "item", nil)
+			require.Equal(t, http.StatusServiceUnavailable, w.Code)
+			require.Empty(t, w.Header().Get(idempotency.ReplayedHeader))
+		}
+		require.EqualValues(t, 2, *created)
+	})
+
+	t.Run("concurrent duplicate", func(t *testing.T) {
+		t.Parallel()
+		block := make(chan struct{})
+		h, created := newServer(http.StatusCreated, block)
+
+		done := make(chan *httptest.ResponseRecorder)
+		go func() { done <- call(h, http.MethodPost, "k1", "item", nil) }()
+		<-block // The first request is in the handler.
+
+		w := call(h, http.MethodPost, "k1", "item", nil)
+		require.Equal(t, http.StatusConflict, w.Code)
+		require.Equal(t, "1", w.Header().Get("Retry-After"))
+
+		block <- struct{}{}
+		require.Equal(t, http.StatusCreated, (<-done).Code)
+		require.EqualValues(t, 1, *created)
+	})
+
+	t.Run("key too long", func(t *testing.T) {
+		t.Parallel()
+		h, _ := newServer(http.StatusCreated, nil)
+		require.Equal(t, http.StatusBadRequest, call(h, http.MethodPost, strings.Repeat("k", 256), "item", nil).Code)
+	})
+}
@@ -0,0 +1,177 @@
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/dmitrymomot/go-smart-monolith/pkg/auth"
+)
+
+const (
+	// Header is the request header with the idempotency key.
+	Header = "Idempotency-Key"
+	// ReplayedHeader is the response header set on the replayed responses.
+	ReplayedHeader = "Idempotent-Replayed"
+
+	// maxKeyLength is the max length of the idempotency key, a UUID is recommended.
+	maxKeyLength = 255
+	// maxBodySize is the max size of the request body read to fingerprint the request.
+	maxBodySize = 1 << 20
+)
+
+// Response is the HTTP response replayed to the retries.
+type Response struct {
+	Status int
+	Header http.Header
+	Body   []byte
+}
+
+// Middleware executes the POST and PATCH requests with the Idempotency-Key header once per key and caller:
+// the response of the first request is stored for the ttl and replayed to the retries with the same key.
+// The keys of the different callers don't clash, see callerScope, and a key reused for another request
+// fails with 422. The body is fingerprinted salted with the key, it's up to 1 MiB, the larger ones fail with 413.
+// Don't apply it to the endpoints whose responses carry the credentials, e.g. the access tokens:
+// the responses are stored as is. A retry of the request still in progress fails with 409, the request holds the key
+// for the timeout at most. The server errors and 429 are not stored, so they can be retried.
+// The requests without the header are passed as is.
+// Place it after the auth middleware putting the principal into the context.
+func Middleware(s *Store, ttl, timeout time.Duration) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(Header)
+			if key == "" || (r.Method != http.MethodPost && r.Method != http.MethodPatch) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if len(key) > maxKeyLength {
+				http.Error(w, "idempotency key is too long", http.StatusBadRequest)
+				return
+			}
+
+			body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodySize))
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+				return
+			}
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			key = "http:" + callerScope(r) + ":" + key
+			fingerprint := Fingerprint([]byte(key), []byte(r.Method), []byte(r.URL.Path), body)
+			rec, begun, err := s.Begin(r.Context(), key, fingerprint, timeout)
+			switch {
+			case errors.Is(err, ErrInProgress):
+				w.Header().Set("Retry-After", "1")
+				http.Error(w, err.Error(), http.StatusConflict)
+				return
+			case errors.Is(err, ErrKeyReused):
+				http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+				return
+			case err != nil:
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			case !begun:
+				replay(w, rec.Result.(Response))
+				return
+			}
+
+			before := w.Header().Clone()
+			rw := &recorder{ResponseWriter: w}
+			next.ServeHTTP(rw, r)
+
+			status := rw.status
+			if status == 0 {
+				status = http.StatusOK
+			}
+
+			// The response is stored even if the client is gone, that's when it retries.
+			// The store errors are not reported: the response is already sent,
+			// and the key is released by the timeout anyway.
+			ctx := context.WithoutCancel(r.Context())
+			if status >= http.StatusInternalServerError || status == http.StatusTooManyRequests {
+				_ = s.Release(ctx, key)
+				return
+			}
+			_ = s.Complete(ctx, key, fingerprint, Response{
+				Status: status,
+				Header: handlerHeader(before, w.Header()),
+				Body:   rw.body.Bytes(),
+			}, ttl)
+		})
+	}
+}
+
+// callerScope returns the scope of the idempotency keys of the caller:
+// the API key, the user, or the client IP of the anonymous callers, so they don't get each other's responses.
+// The IP is the address of the peer, see ratelimit.ByIP.
+func callerScope(r *http.Request) string {
+	p, ok := auth.PrincipalFromContext(r.Context())
+	switch {
+	case ok && p.APIKeyID != "":
+		return "api_key:" + p.APIKeyID
+	case ok && p.UserID != "":
+		return "user:" + p.UserID
+	default:
+		ip, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			ip = r.RemoteAddr
+		}
+		return "ip:" + ip
+	}
+}
+
+// replay writes the stored response.
+func replay(w http.ResponseWriter, res Response) {
+	for k, v := range res.Header {
+		w.Header()[k] = slices.Clone(v)
+	}
+	w.Header().Set(ReplayedHeader, "true")
+	w.WriteHeader(res.Status)
+	_, _ = w.Write(res.Body)
+}
+
+// handlerHeader returns the headers set by the handler, without the ones set by the outer middlewares,
+// e.g. the rate limits, which are set again on the replay.
+func handlerHeader(before, after http.Header) http.Header {
+	h := http.Header{}
+	for k, v := range after {
+		if !slices.Equal(before[k], v) {
+			h[k] = slices.Clone(v)
+		}
+	}
+	return h
+}
+
+// recorder records the response status and body.
+type recorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+// WriteHeader records the status.
+func (r *recorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Write records the body.
+func (r *recorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
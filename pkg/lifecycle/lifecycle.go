@@ -0,0 +1,151 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// ErrAlreadyRunning is returned when Run is called more than once.
+var ErrAlreadyRunning = errors.New("lifecycle is already running")
+
+type (
+	// Lifecycle manages the application start/stop sequence.
+	// Each module registers its own hooks, so main() doesn't need to know
+	// how to start or close every single dependency.
+	// Hooks are started in the order they were appended and stopped in the reverse order.
+	Lifecycle struct {
+		mu      sync.Mutex
+		hooks   []Hook
+		running bool
+		stopped chan struct{}
+		errOnce sync.Once
+		err     error
+
+		log         logger
+		stopTimeout time.Duration
+		signals     []os.Signal
+	}
+
+	// Hook is a pair of start/stop functions registered by a module.
+	// OnStart must not block: long-running work (e.g. serving HTTP) should be
+	// started in a goroutine, and its failure should be reported via Lifecycle.Shutdown.
+	Hook struct {
+		Name    string
+		OnStart func(ctx context.Context) error
+		OnStop  func(ctx context.Context) error
+	}
+
+	// Option is a function that configures the lifecycle.
+	Option func(*Lifecycle)
+
+	// low-level abstraction for the logger.
+	logger interface {
+		Error(err error, kv ...interface{})
+	}
+)
+
+// New creates a new lifecycle instance.
+func New(log logger, opts ...Option) *Lifecycle {
+	l := &Lifecycle{
+		stopped:     make(chan struct{}),
+		log:         log,
+		stopTimeout: 15 * time.Second,
+		signals:     []os.Signal{syscall.SIGINT, syscall.SIGTERM},
+	}
+	for _, opt := range opts {
+		opt(l)
+	}
+	return l
+}
+
+// WithStopTimeout sets the deadline for all stop hooks to complete.
+func WithStopTimeout(d time.Duration) Option {
+	return func(l *Lifecycle) {
+		l.stopTimeout = d
+	}
+}
+
+// WithSignals overrides the list of OS signals that trigger the shutdown.
+func WithSignals(sig ...os.Signal) Option {
+	return func(l *Lifecycle) {
+		l.signals = sig
+	}
+}
+
+// Append registers a new hook.
+func (l *Lifecycle) Append(h Hook) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.hooks = append(l.hooks, h)
+}
+
+// Shutdown triggers the graceful shutdown.
+// The err is returned from Run, pass nil for a regular shutdown.
+// It's safe to call it multiple times, only the first call takes effect.
+func (l *Lifecycle) Shutdown(err error) {
+	l.errOnce.Do(func() {
+		l.err = err
+		close(l.stopped)
+	})
+}
+
+// Run starts all the registered hooks and blocks until the context is canceled,
+// one of the registered signals is received or Shutdown is called.
+// Then it stops all the started hooks in the reverse order within the stop timeout.
+func (l *Lifecycle) Run(ctx context.Context) error {
+	l.mu.Lock()
+	if l.running {
+		l.mu.Unlock()
+		return ErrAlreadyRunning
+	}
+	l.running = true
+	hooks := make([]Hook, len(l.hooks))
+	copy(hooks, l.hooks)
+	l.mu.Unlock()
+
+	ctx, stop := signal.NotifyContext(ctx, l.signals...)
+	defer stop()
+
+	// Start hooks one by one, if any of them fails, stop already started ones.
+	started := 0
+	for _, h := range hooks {
+		if h.OnStart != nil {
+			if err := h.OnStart(ctx); err != nil {
+				l.Shutdown(fmt.Errorf("start %s: %w", h.Name, err))
+				break
+			}
+		}
+		started++
+	}
+
+	select {
+	case <-ctx.Done():
+		l.Shutdown(nil)
+	case <-l.stopped:
+	}
+
+	// Use a fresh context, because the parent one is already canceled.
+	stopCtx, cancel := context.WithTimeout(context.Background(), l.stopTimeout)
+	defer cancel()
+
+	errs := []error{l.err}
+	for i := started - 1; i >= 0; i-- {
+		h := hooks[i]
+		if h.OnStop == nil {
+			continue
+		}
+		if err := h.OnStop(stopCtx); err != nil {
+			err = fmt.Errorf("stop %s: %w", h.Name, err)
+			l.log.Error(err)
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
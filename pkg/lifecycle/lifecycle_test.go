@@ -0,0 +1,87 @@
+package lifecycle_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/dmitrymomot/go-smart-monolith/pkg/lifecycle"
+
+	"github.com/stretchr/testify/require"
+)
+
+// nopLogger is a logger that does nothing.
+type nopLogger struct{}
+
+func (nopLogger) Error(err error, kv ...interface{}) {}
+
+func TestLifecycle_Run(t *testing.T) {
+	t.Parallel()
+
+	// Stop hooks must be called in the reverse order.
+	t.Run("stop_in_reverse_order", func(t *testing.T) {
+		var calls []string
+		hook := func(name string) lifecycle.Hook {
+			return lifecycle.Hook{
+				Name: name,
+				OnStart: func(ctx context.Context) error {
+					calls = append(calls, "start:"+name)
+					return nil
+				},
+				OnStop: func(ctx context.Context) error {
+					calls = append(calls, "stop:"+name)
+					return nil
+				},
+			}
+		}
+
+		app := lifecycle.New(nopLogger{})
+		app.Append(hook("a"))
+		app.Append(hook("b"))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		require.NoError(t, app.Run(ctx))
+		require.Equal(t, []string{"start:a", "start:b", "stop:b", "stop:a"}, calls)
+	})
+
+	// Failed start hook stops already started hooks only.
+	t.Run("start_failed", func(t *testing.T) {
+		var stopped []string
+		startErr := errors.New("start failed")
+
+		app := lifecycle.New(nopLogger{})
+		app.Append(lifecycle.Hook{
+			Name:   "a",
+			OnStop: func(ctx context.Context) error { stopped = append(stopped, "a"); return nil },
+		})
+		app.Append(lifecycle.Hook{
+			Name:    "b",
+			OnStart: func(ctx context.Context) error { return startErr },
+			OnStop:  func(ctx context.Context) error { stopped = append(stopped, "b"); return nil },
+		})
+
+		err := app.Run(context.Background())
+		require.ErrorIs(t, err, startErr)
+		require.Equal(t, []string{"a"}, stopped)
+	})
+
+	// Stop hooks get a context with the stop timeout.
+	t.Run("shutdown_with_deadline", func(t *testing.T) {
+		app := lifecycle.New(nopLogger{}, lifecycle.WithStopTimeout(10*time.Millisecond))
+		app.Append(lifecycle.Hook{
+			Name: "slow",
+			OnStop: func(ctx context.Context) error {
+				<-ctx.Done()
+				return ctx.Err()
+			},
+		})
+
+		go app.Shutdown(nil)
+
+		err := app.Run(context.Background())
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+}
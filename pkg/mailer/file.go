@@ -0,0 +1,42 @@
+package mailer
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// File writes the emails to the directory as .eml files instead of sending them.
+// It's used in development to read the emails without a mail server.
+type File struct {
+	dir string
+}
+
+// NewFile creates a new file mailer.
+// The directory is created on the first email.
+func NewFile(dir string) *File {
+	return &File{dir: dir}
+}
+
+// Send writes the message to a new file named by the send time,
+// so the files are sorted in the order the emails were sent.
+func (f *File) Send(ctx context.Context, msg Message) error {
+	if err := msg.Validate(); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(f.dir, 0o755); err != nil {
+		return err
+	}
+
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return err
+	}
+	now := time.Now()
+	name := fmt.Sprintf("%s-%s.eml", now.UTC().Format("20060102T150405.000000000"), hex.EncodeToString(suffix))
+	return os.WriteFile(filepath.Join(f.dir, name), Format(msg, now), 0o644)
+}
@@ -0,0 +1,54 @@
+package mailer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// SendEmailSubject is the message bus subject of the emails queued to be sent.
+// The services queue the emails instead of sending them directly,
+// so a slow or unavailable mail server doesn't fail the requests.
+const SendEmailSubject = "mailer.send_email"
+
+// ErrInvalidMessage is returned when the message can't be sent as is.
+var ErrInvalidMessage = errors.New("invalid email message")
+
+type (
+	// Message is a plain text email message.
+	Message struct {
+		From    string   `json:"from"`
+		To      []string `json:"to"`
+		Subject string   `json:"subject"`
+		Body    string   `json:"body"`
+	}
+
+	// Mailer sends the email messages.
+	// See SMTP for the real implementation, File and Memory for the development and tests.
+	Mailer interface {
+		Send(ctx context.Context, msg Message) error
+	}
+)
+
+// Validate checks that the message has the sender and at least one recipient.
+func (m Message) Validate() error {
+	if m.From == "" {
+		return fmt.Errorf("%w: no sender", ErrInvalidMessage)
+	}
+	if len(m.To) == 0 {
+		return fmt.Errorf("%w: no recipients", ErrInvalidMessage)
+	}
+	return nil
+}
+
+// Handler returns a message bus handler that sends the emails queued to SendEmailSubject.
+func Handler(m Mailer) func(ctx context.Context, body []byte) error {
+	return func(ctx context.Context, body []byte) error {
+		var msg Message
+		if err := json.Unmarshal(body, &msg); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidMessage, err)
+		}
+		return m.Send(ctx, msg)
+	}
+}
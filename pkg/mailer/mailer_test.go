@@ -0,0 +1,152 @@
+package mailer_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dmitrymomot/go-smart-monolith/pkg/mailer"
+	"github.com/stretchr/testify/require"
+)
+
+var testMessage = mailer.Message{
+	From:    "no-reply@mail.dev",
+	To:      []string{"test@mail.dev"},
+	Subject: "Hello",
+	Body:    "line 1\nline 2",
+}
+
+func TestHandler(t *testing.T) {
+	m := mailer.NewMemory()
+	handle := mailer.Handler(m)
+
+	body, err := json.Marshal(testMessage)
+	require.NoError(t, err)
+	require.NoError(t, handle(context.Background(), body))
+	require.Equal(t, []mailer.Message{testMessage}, m.Messages())
+
+	// The invalid messages are not sent.
+	require.ErrorIs(t, handle(context.Background(), []byte("{")), mailer.ErrInvalidMessage)
+	require.ErrorIs(t, handle(context.Background(), []byte(`{"from":"no-reply@mail.dev"}`)), mailer.ErrInvalidMessage)
+	require.Len(t, m.Messages(), 1)
+}
+
+func TestFile(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "mail")
+	m := mailer.NewFile(dir)
+	require.NoError(t, m.Send(context.Background(), testMessage))
+	require.NoError(t, m.Send(context.Background(), testMessage))
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.eml"))
+	require.NoError(t, err)
+	require.Len(t, files, 2)
+
+	b, err := os.ReadFile(files[0])
+	require.NoError(t, err)
+	require.Contains(t, string(b), "To: test@mail.dev\r\n")
+	require.True(t, strings.HasSuffix(string(b), "\r\n\r\nline 1\r\nline 2"))
+}
+
+func TestFormat(t *testing.T) {
+	msg := testMessage
+	msg.To = []string{"a@mail.dev", "b@mail.dev"}
+	date := time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	require.Equal(t, "From: no-reply@mail.dev\r\n"+
+		"To: a@mail.dev, b@mail.dev\r\n"+
+		"Subject: Hello\r\n"+
+		"Date: Mon, 02 Jan 2023 03:04:05 +0000\r\n"+
+		"MIME-Version: 1.0\r\n"+
+		"Content-Type: text/plain; charset=UTF-8\r\n"+
+		"\r\n"+
+		"line 1\r\nline 2", string(mailer.Format(msg, date)))
+}
+
+func TestFormat_HeaderInjection(t *testing.T) {
+	msg := testMessage
+	msg.Subject = "Hello\r\nBcc: victim@mail.dev"
+
+	b := string(mailer.Format(msg, time.Now()))
+	require.Contains(t, b, "Subject: Hello  Bcc: victim@mail.dev\r\n")
+	require.NotContains(t, b, "\r\nBcc:")
+}
+
+// smtpServer is a fake SMTP server, it accepts every message and sends it to the channel.
+// If stall is true, it accepts the connections but never replies.
+func smtpServer(t *testing.T, stall bool) (string, <-chan string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = ln.Close() })
+
+	data := make(chan string, 1)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				if stall {
+					_, _ = io.Copy(io.Discard, conn) // until the client closes the connection
+					data <- "closed"
+					return
+				}
+				tc := textproto.NewConn(conn)
+				_ = tc.PrintfLine("220 localhost ESMTP")
+				for {
+					line, err := tc.ReadLine()
+					if err != nil {
+						return
+					}
+					switch cmd := strings.ToUpper(strings.SplitN(line, " ", 2)[0]); cmd {
+					case "EHLO", "HELO":
+						_ = tc.PrintfLine("250 localhost")
+					case "DATA":
+						_ = tc.PrintfLine("354 go ahead")
+						lines, _ := tc.ReadDotLines()
+						data <- strings.Join(lines, "\n")
+						_ = tc.PrintfLine("250 ok")
+					case "QUIT":
+						_ = tc.PrintfLine("221 bye")
+						return
+					default:
+						_ = tc.PrintfLine("250 ok")
+					}
+				}
+			}()
+		}
+	}()
+	return ln.Addr().String(), data
+}
+
+func TestSMTP(t *testing.T) {
+	t.Run("send", func(t *testing.T) {
+		addr, data := smtpServer(t, false)
+		require.NoError(t, mailer.NewSMTP(mailer.SMTPConfig{Addr: addr}).Send(context.Background(), testMessage))
+		require.Contains(t, <-data, "Subject: Hello")
+	})
+
+	t.Run("context done", func(t *testing.T) {
+		addr, data := smtpServer(t, true)
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		err := mailer.NewSMTP(mailer.SMTPConfig{Addr: addr}).Send(ctx, testMessage)
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+		select {
+		case <-data:
+			// The connection is closed, the session is not left behind.
+		case <-time.After(time.Second):
+			t.Fatal("the connection is not closed")
+		}
+	})
+}
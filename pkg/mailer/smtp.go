@@ -0,0 +1,126 @@
+package mailer
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// SMTPConfig holds the SMTP server connection settings.
+type SMTPConfig struct {
+	// Addr is the server address, e.g. "smtp.example.com:587".
+	Addr     string
+	Username string
+	Password string
+}
+
+// SMTP sends the emails through an SMTP server.
+// The connection is upgraded with STARTTLS if the server supports it.
+type SMTP struct {
+	cnf SMTPConfig
+}
+
+// NewSMTP creates a new SMTP mailer.
+func NewSMTP(cnf SMTPConfig) *SMTP {
+	return &SMTP{cnf: cnf}
+}
+
+// Send sends the message.
+// net/smtp doesn't support the context, so the connection is dialed with the context
+// and is closed as soon as the context is done, which interrupts the SMTP session in progress.
+func (s *SMTP) Send(ctx context.Context, msg Message) (err error) {
+	if err := msg.Validate(); err != nil {
+		return err
+	}
+
+	host, _, err := net.SplitHostPort(s.cnf.Addr)
+	if err != nil {
+		return fmt.Errorf("invalid smtp address %q: %w", s.cnf.Addr, err)
+	}
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", s.cnf.Addr)
+	if err != nil {
+		return err
+	}
+	stop := context.AfterFunc(ctx, func() { _ = conn.Close() })
+	defer func() {
+		stop()
+		// The session failed because the context is done.
+		if err != nil && ctx.Err() != nil {
+			err = ctx.Err()
+		}
+	}()
+
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		_ = conn.Close()
+		return err
+	}
+	defer c.Close()
+	return s.send(c, host, msg)
+}
+
+// send sends the message in the SMTP session, same as smtp.SendMail.
+func (s *SMTP) send(c *smtp.Client, host string, msg Message) error {
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if s.cnf.Username != "" {
+		if ok, _ := c.Extension("AUTH"); !ok {
+			return errors.New("smtp: server doesn't support AUTH")
+		}
+		if err := c.Auth(smtp.PlainAuth("", s.cnf.Username, s.cnf.Password, host)); err != nil {
+			return err
+		}
+	}
+
+	if err := c.Mail(msg.From); err != nil {
+		return err
+	}
+	for _, to := range msg.To {
+		if err := c.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(Format(msg, time.Now())); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// headerReplacer removes the line breaks from the header values,
+// so the user input can't inject the headers.
+var headerReplacer = strings.NewReplacer("\r", " ", "\n", " ")
+
+func headerValue(v string) string {
+	return headerReplacer.Replace(v)
+}
+
+// Format formats the message in the RFC 5322 format.
+func Format(msg Message, date time.Time) []byte {
+	var b strings.Builder
+	b.WriteString("From: " + headerValue(msg.From) + "\r\n")
+	b.WriteString("To: " + headerValue(strings.Join(msg.To, ", ")) + "\r\n")
+	b.WriteString("Subject: " + headerValue(msg.Subject) + "\r\n")
+	b.WriteString("Date: " + date.Format(time.RFC1123Z) + "\r\n")
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return []byte(b.String())
+}
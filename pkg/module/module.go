@@ -0,0 +1,114 @@
+package module
+
+import (
+	"context"
+
+	"github.com/dmitrymomot/go-smart-monolith/pkg/featureflag"
+	"github.com/dmitrymomot/go-smart-monolith/pkg/health"
+	"github.com/dmitrymomot/go-smart-monolith/pkg/mailer"
+	"github.com/dmitrymomot/go-smart-monolith/pkg/storage"
+
+	"github.com/go-chi/chi/v5"
+	"google.golang.org/grpc"
+)
+
+// Supported transports.
+const (
+	// TransportInProcess calls the dependency module directly
+	// if it's built into the same binary, otherwise falls back to the remote transport.
+	TransportInProcess Transport = "inproc"
+	// TransportRemote always calls the dependency over the network.
+	TransportRemote Transport = "remote"
+)
+
+type (
+	// Module is a self-contained service that can be plugged into the monolith
+	// or started alone as its own binary.
+	// Each internal/<service> package implements it.
+	Module interface {
+		// Name returns the unique module name.
+		// It's used as the config section name and the env variables prefix.
+		Name() string
+		// Config returns a pointer to the module config struct.
+		// It's populated by the registry before Init is called.
+		// Return nil if the module has no config.
+		Config() interface{}
+		// Init builds the module with the shared dependencies.
+		Init(deps Deps) error
+		// Routes mounts the module HTTP endpoints.
+		Routes(r chi.Router)
+		// Subscribers returns the module message bus subscribers.
+		Subscribers() []Subscriber
+		// Jobs returns the module background jobs.
+		Jobs() []Job
+		// HealthChecks returns the module dependency probes.
+		HealthChecks() []health.Check
+	}
+
+	// GRPCService is an optional interface a module implements
+	// to expose its gRPC services on the app gRPC server.
+	GRPCService interface {
+		// RegisterGRPC registers the module gRPC services.
+		RegisterGRPC(s grpc.ServiceRegistrar)
+		// GRPCInterceptors returns the module unary interceptors.
+		// They are chained for the whole server, so they must skip
+		// the methods of other services.
+		GRPCInterceptors() []grpc.UnaryServerInterceptor
+	}
+
+	// Deps is a set of the shared low-level dependencies
+	// the modules are built with.
+	Deps struct {
+		Storage Storage
+		Logger  Logger
+		NATS    MessageBus
+		Flags   featureflag.Provider
+		Mailer  Mailer
+
+		// Transport defines how the module should call other modules.
+		Transport Transport
+		// Modules is the registry of all the modules built into the same binary.
+		// Use it to find a dependency module to call it in-process.
+		Modules *Registry
+	}
+
+	// Transport defines how a module calls other modules.
+	Transport string
+
+	// Subscriber is a message bus subscriber.
+	Subscriber struct {
+		Subject string
+		Handler func(ctx context.Context, body []byte) error
+	}
+
+	// Job is a background job.
+	// Run must block until the context is done.
+	Job struct {
+		Name string
+		Run  func(ctx context.Context) error
+	}
+
+	// Storage is a low-level abstraction for the storage.
+	Storage interface {
+		Get(ctx context.Context, key string) (interface{}, error)
+		Set(ctx context.Context, key string, value interface{}) error
+		Scan(ctx context.Context, opts storage.ScanOptions) ([]storage.KV, error)
+		Delete(ctx context.Context, key string) error
+	}
+
+	// Mailer is a low-level abstraction for the email sender.
+	Mailer interface {
+		Send(ctx context.Context, msg mailer.Message) error
+	}
+
+	// Logger is a low-level abstraction for the logger.
+	Logger interface {
+		Error(err error, kv ...interface{})
+	}
+
+	// MessageBus is a low-level abstraction for the NATS client.
+	MessageBus interface {
+		Publish(subject string, body []byte) error
+		Subscribe(subject string, handler func(body []byte)) error
+	}
+)
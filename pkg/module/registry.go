@@ -0,0 +1,187 @@
+package module
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/dmitrymomot/go-smart-monolith/pkg/config"
+	"github.com/dmitrymomot/go-smart-monolith/pkg/health"
+	"github.com/dmitrymomot/go-smart-monolith/pkg/lifecycle"
+
+	"github.com/go-chi/chi/v5"
+	"google.golang.org/grpc"
+)
+
+// ErrDuplicateModule is returned when a module with the same name is already registered.
+var ErrDuplicateModule = errors.New("module is already registered")
+
+// Registry holds the modules the application is built of.
+// Adding a new service to the app means adding one more Register call.
+type Registry struct {
+	modules []Module
+}
+
+// NewRegistry creates a new registry with the given modules.
+func NewRegistry(mods ...Module) (*Registry, error) {
+	r := &Registry{}
+	for _, m := range mods {
+		if err := r.Register(m); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// Register adds the module to the registry.
+func (r *Registry) Register(m Module) error {
+	for _, existing := range r.modules {
+		if existing.Name() == m.Name() {
+			return fmt.Errorf("%w: %s", ErrDuplicateModule, m.Name())
+		}
+	}
+	r.modules = append(r.modules, m)
+	return nil
+}
+
+// Modules returns all the registered modules in the registration order.
+func (r *Registry) Modules() []Module {
+	return r.modules
+}
+
+// Lookup returns the module with the given name if it's registered.
+func (r *Registry) Lookup(name string) (Module, bool) {
+	for _, m := range r.modules {
+		if m.Name() == name {
+			return m, true
+		}
+	}
+	return nil, false
+}
+
+// LoadConfig populates each module config from its own section of the config file
+// and the env variables prefixed with the upper-cased module name, e.g. USER_.
+// All the problems of all the modules are reported at once.
+func (r *Registry) LoadConfig(opts ...config.Option) error {
+	errs := make([]error, 0, len(r.modules))
+	for _, m := range r.modules {
+		if cnf := m.Config(); cnf != nil {
+			errs = append(errs, config.Load(cnf, append(opts, config.WithSection(m.Name(), EnvPrefix(m)))...))
+		}
+	}
+	return config.Merge(errs...)
+}
+
+// ConfigSections returns the module configs to be printed with config.Print.
+func (r *Registry) ConfigSections() []config.Section {
+	sections := make([]config.Section, 0, len(r.modules))
+	for _, m := range r.modules {
+		if cnf := m.Config(); cnf != nil {
+			sections = append(sections, config.Section{Name: m.Name(), Config: cnf})
+		}
+	}
+	return sections
+}
+
+// Init initializes all the modules with the shared dependencies.
+// Modules are initialized in the registration order,
+// so register dependencies before the modules that use them.
+func (r *Registry) Init(deps Deps) error {
+	deps.Modules = r
+	if deps.Transport == "" {
+		deps.Transport = TransportInProcess
+	}
+	for _, m := range r.modules {
+		if err := m.Init(deps); err != nil {
+			return fmt.Errorf("init %s module: %w", m.Name(), err)
+		}
+	}
+	return nil
+}
+
+// Mount mounts the HTTP endpoints of all the modules.
+func (r *Registry) Mount(router chi.Router) {
+	for _, m := range r.modules {
+		m.Routes(router)
+	}
+}
+
+// GRPCInterceptors returns the unary interceptors of all the modules
+// implementing GRPCService, in the registration order.
+func (r *Registry) GRPCInterceptors() []grpc.UnaryServerInterceptor {
+	var interceptors []grpc.UnaryServerInterceptor
+	for _, m := range r.modules {
+		if s, ok := m.(GRPCService); ok {
+			interceptors = append(interceptors, s.GRPCInterceptors()...)
+		}
+	}
+	return interceptors
+}
+
+// RegisterGRPC registers the gRPC services of all the modules implementing GRPCService.
+// It returns the number of such modules, so the caller can skip serving gRPC if there are none.
+func (r *Registry) RegisterGRPC(s grpc.ServiceRegistrar) int {
+	n := 0
+	for _, m := range r.modules {
+		if gs, ok := m.(GRPCService); ok {
+			gs.RegisterGRPC(s)
+			n++
+		}
+	}
+	return n
+}
+
+// RegisterHealthChecks registers the dependency probes of all the modules.
+func (r *Registry) RegisterHealthChecks(checks *health.Registry) {
+	for _, m := range r.modules {
+		checks.Register(m.HealthChecks()...)
+	}
+}
+
+// Start registers the lifecycle hooks to subscribe the modules to the message bus
+// and to run their background jobs until the app is stopped.
+func (r *Registry) Start(app *lifecycle.Lifecycle, bus MessageBus, log Logger) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	for _, m := range r.modules {
+		m := m
+		app.Append(lifecycle.Hook{
+			Name: m.Name(),
+			OnStart: func(context.Context) error {
+				for _, s := range m.Subscribers() {
+					s := s
+					if err := bus.Subscribe(s.Subject, func(body []byte) {
+						if err := s.Handler(ctx, body); err != nil {
+							log.Error(err, "module", m.Name(), "subject", s.Subject)
+						}
+					}); err != nil {
+						return fmt.Errorf("subscribe to %s: %w", s.Subject, err)
+					}
+				}
+				for _, j := range m.Jobs() {
+					j := j
+					go func() {
+						if err := j.Run(ctx); err != nil && !errors.Is(err, context.Canceled) {
+							log.Error(err, "module", m.Name(), "job", j.Name)
+						}
+					}()
+				}
+				return nil
+			},
+		})
+	}
+
+	app.Append(lifecycle.Hook{
+		Name: "modules",
+		OnStop: func(context.Context) error {
+			cancel() // Stops all the background jobs.
+			return nil
+		},
+	})
+}
+
+// EnvPrefix returns the env variables prefix of the module, e.g. "USER_".
+func EnvPrefix(m Module) string {
+	return strings.ToUpper(m.Name()) + "_"
+}
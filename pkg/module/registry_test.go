@@ -0,0 +1,142 @@
+package module_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dmitrymomot/go-smart-monolith/pkg/config"
+	"github.com/dmitrymomot/go-smart-monolith/pkg/health"
+	"github.com/dmitrymomot/go-smart-monolith/pkg/lifecycle"
+	"github.com/dmitrymomot/go-smart-monolith/pkg/module"
+	"github.com/dmitrymomot/go-smart-monolith/pkg/nats"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/require"
+)
+
+// nopLogger is a logger that does nothing.
+type nopLogger struct{}
+
+func (nopLogger) Error(err error, kv ...interface{}) {}
+
+// testModule is a minimal module implementation.
+type testModule struct {
+	cnf struct {
+		Greeting string `yaml:"greeting" env:"GREETING" required:"true"`
+	}
+	received chan string
+	jobDone  chan struct{}
+}
+
+func newTestModule() *testModule {
+	return &testModule{received: make(chan string, 1), jobDone: make(chan struct{})}
+}
+
+func (m *testModule) Name() string                { return "test" }
+func (m *testModule) Config() interface{}         { return &m.cnf }
+func (m *testModule) Init(deps module.Deps) error { return nil }
+
+func (m *testModule) Routes(r chi.Router) {
+	r.Get("/test", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(m.cnf.Greeting))
+	})
+}
+
+func (m *testModule) Subscribers() []module.Subscriber {
+	return []module.Subscriber{{
+		Subject: "test_topic",
+		Handler: func(ctx context.Context, body []byte) error {
+			m.received <- string(body)
+			return nil
+		},
+	}}
+}
+
+func (m *testModule) Jobs() []module.Job {
+	return []module.Job{{
+		Name: "test_job",
+		Run: func(ctx context.Context) error {
+			<-ctx.Done()
+			close(m.jobDone)
+			return ctx.Err()
+		},
+	}}
+}
+
+func (m *testModule) HealthChecks() []health.Check {
+	return []health.Check{{Name: "test", Check: func(context.Context) error { return nil }}}
+}
+
+func TestRegistry(t *testing.T) {
+	t.Parallel()
+
+	mod := newTestModule()
+	reg, err := module.NewRegistry(mod)
+	require.NoError(t, err)
+
+	// Duplicate module names are not allowed.
+	require.ErrorIs(t, reg.Register(newTestModule()), module.ErrDuplicateModule)
+
+	// Config is loaded from the module section with the module env prefix.
+	require.NoError(t, reg.LoadConfig(config.WithLookup(func(key string) (string, bool) {
+		if key == "TEST_GREETING" {
+			return "hello", true
+		}
+		return "", false
+	})))
+
+	bus := nats.NewClient()
+	require.NoError(t, reg.Init(module.Deps{Logger: nopLogger{}, NATS: bus}))
+
+	// Routes are mounted.
+	r := chi.NewRouter()
+	reg.Mount(r)
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/test", nil))
+	require.Equal(t, "hello", rec.Body.String())
+
+	// Health checks are registered.
+	checks := health.New()
+	reg.RegisterHealthChecks(checks)
+	require.Contains(t, checks.Readiness(context.Background()).Checks, "test")
+
+	// Subscribers and jobs are started with the app and stopped on shutdown.
+	app := lifecycle.New(nopLogger{})
+	reg.Start(app, bus, nopLogger{})
+	app.Append(lifecycle.Hook{
+		Name: "publisher",
+		OnStart: func(context.Context) error {
+			return bus.Publish("test_topic", []byte("event"))
+		},
+	})
+
+	done := make(chan error)
+	go func() { done <- app.Run(context.Background()) }()
+
+	select {
+	case body := <-mod.received:
+		require.Equal(t, "event", body)
+	case <-time.After(time.Second):
+		t.Fatal("message is not delivered")
+	}
+
+	app.Shutdown(nil)
+	require.NoError(t, <-done)
+	<-mod.jobDone
+}
+
+func TestRegistry_LoadConfig(t *testing.T) {
+	t.Parallel()
+
+	reg, err := module.NewRegistry(newTestModule())
+	require.NoError(t, err)
+
+	err = reg.LoadConfig(config.WithLookup(func(string) (string, bool) { return "", false }))
+	var verr *config.ValidationError
+	require.True(t, errors.As(err, &verr))
+	require.Equal(t, []string{"test.greeting (TEST_GREETING): required value is missing"}, verr.Problems)
+}
@@ -1,19 +1,98 @@
 package nats
 
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrClientClosed is returned when the client is already closed.
+var ErrClientClosed = errors.New("nats client is closed")
+
 // Client is a client for the NATS messaging system.
+// This example implementation delivers messages to the local subscribers only,
+// but it has the same API as a real client would have.
 type Client struct {
+	mu       sync.RWMutex
+	closed   bool
+	handlers map[string][]func(body []byte)
+	inflight sync.WaitGroup
 	// ...
 }
 
 // NewClient creates a new Client.
 func NewClient() *Client {
 	return &Client{
+		handlers: make(map[string][]func(body []byte)),
 		// ...
 	}
 }
 
 // Publish publishes a message.
 func (c *Client) Publish(subject string, body []byte) error {
-	// ...
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.closed {
+		return ErrClientClosed
+	}
+
+	// Deliver the message asynchronously, like a real broker does.
+	for _, h := range c.handlers[subject] {
+		c.inflight.Add(1)
+		go func(h func(body []byte)) {
+			defer c.inflight.Done()
+			h(body)
+		}(h)
+	}
 	return nil
 }
+
+// Subscribe registers a handler for the subject.
+func (c *Client) Subscribe(subject string, handler func(body []byte)) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return ErrClientClosed
+	}
+	c.handlers[subject] = append(c.handlers[subject], handler)
+	return nil
+}
+
+// Flush waits until all the published messages are delivered
+// or the context is done.
+func (c *Client) Flush(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		c.inflight.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close flushes pending messages and closes the connection.
+// Publishing after Close returns ErrClientClosed.
+func (c *Client) Close(ctx context.Context) error {
+	c.mu.Lock()
+	c.closed = true
+	c.mu.Unlock()
+
+	return c.Flush(ctx)
+}
+
+// Ping checks the connection to the server.
+// It's used by the health checks.
+func (c *Client) Ping(ctx context.Context) error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.closed {
+		return ErrClientClosed
+	}
+	// ...
+	return ctx.Err()
+}
@@ -0,0 +1,253 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// clockSkew is the allowed clock difference between the provider and the relying party.
+const clockSkew = time.Minute
+
+// minKeyBits is the min size of the provider RSA keys, the weaker keys are ignored.
+const minKeyBits = 2048
+
+type (
+	// header is the JOSE header of the ID token.
+	header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+
+	// claims are the ID token claims as they are encoded.
+	claims struct {
+		Issuer        string   `json:"iss"`
+		Subject       string   `json:"sub"`
+		Audience      audience `json:"aud"`
+		AuthorizedBy  string   `json:"azp"`
+		IssuedAt      int64    `json:"iat"`
+		Expiry        int64    `json:"exp"`
+		Nonce         string   `json:"nonce"`
+		Email         string   `json:"email"`
+		EmailVerified flexBool `json:"email_verified"`
+		Name          string   `json:"name"`
+	}
+
+	// audience is the "aud" claim: a single string or an array of strings.
+	audience []string
+
+	// flexBool is a boolean claim some providers encode as a string, e.g. "true".
+	flexBool bool
+
+	// jwks is the provider JSON Web Key Set.
+	jwks struct {
+		Keys []jwk `json:"keys"`
+	}
+
+	// jwk is the JSON Web Key, only the RSA signing keys are used.
+	jwk struct {
+		Kty string `json:"kty"`
+		Kid string `json:"kid"`
+		Use string `json:"use"`
+		Alg string `json:"alg"`
+		N   string `json:"n"`
+		E   string `json:"e"`
+	}
+)
+
+// VerifyIDToken verifies the ID token signature against the provider keys and its claims:
+// the issuer, the audience, the expiration and the nonce the authorization was started with.
+func (p *Provider) VerifyIDToken(ctx context.Context, raw, nonce string) (IDToken, error) {
+	parts := strings.Split(raw, ".")
+	if len(parts) != 3 {
+		return IDToken{}, fmt.Errorf("%w: malformed", ErrInvalidIDToken)
+	}
+
+	var h header
+	if err := decodeSegment(parts[0], &h); err != nil {
+		return IDToken{}, fmt.Errorf("%w: malformed header", ErrInvalidIDToken)
+	}
+	// The algorithm is fixed, so the token can't choose "none" or HMAC with the public key.
+	if h.Alg != "RS256" {
+		return IDToken{}, fmt.Errorf("%w: unsupported algorithm %q", ErrInvalidIDToken, h.Alg)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return IDToken{}, fmt.Errorf("%w: malformed signature", ErrInvalidIDToken)
+	}
+
+	key, err := p.key(ctx, h.Kid)
+	if err != nil {
+		return IDToken{}, err
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], sig); err != nil {
+		return IDToken{}, fmt.Errorf("%w: invalid signature", ErrInvalidIDToken)
+	}
+
+	var c claims
+	if err := decodeSegment(parts[1], &c); err != nil {
+		return IDToken{}, fmt.Errorf("%w: malformed claims", ErrInvalidIDToken)
+	}
+	if err := p.validate(ctx, c, nonce); err != nil {
+		return IDToken{}, err
+	}
+
+	return IDToken{
+		Issuer:        c.Issuer,
+		Subject:       c.Subject,
+		Audience:      c.Audience,
+		IssuedAt:      time.Unix(c.IssuedAt, 0).UTC(),
+		Expiry:        time.Unix(c.Expiry, 0).UTC(),
+		Nonce:         c.Nonce,
+		Email:         c.Email,
+		EmailVerified: bool(c.EmailVerified),
+		Name:          c.Name,
+	}, nil
+}
+
+// validate validates the claims of the token with the valid signature.
+func (p *Provider) validate(ctx context.Context, c claims, nonce string) error {
+	meta, err := p.Metadata(ctx)
+	if err != nil {
+		return err
+	}
+	now := p.now()
+
+	switch {
+	case c.Issuer != meta.Issuer:
+		return fmt.Errorf("%w: unexpected issuer %q", ErrInvalidIDToken, c.Issuer)
+	case c.Subject == "":
+		return fmt.Errorf("%w: no subject", ErrInvalidIDToken)
+	case !c.Audience.contains(p.cnf.ClientID):
+		return fmt.Errorf("%w: issued for another client", ErrInvalidIDToken)
+	case c.AuthorizedBy != "" && c.AuthorizedBy != p.cnf.ClientID:
+		return fmt.Errorf("%w: authorized by another client", ErrInvalidIDToken)
+	case !now.Before(time.Unix(c.Expiry, 0).Add(clockSkew)):
+		return fmt.Errorf("%w: expired", ErrInvalidIDToken)
+	case time.Unix(c.IssuedAt, 0).After(now.Add(clockSkew)):
+		return fmt.Errorf("%w: issued in the future", ErrInvalidIDToken)
+	case subtle.ConstantTimeCompare([]byte(c.Nonce), []byte(nonce)) != 1 || nonce == "":
+		return fmt.Errorf("%w: nonce mismatch", ErrInvalidIDToken)
+	}
+	return nil
+}
+
+// key returns the provider key by its ID. The keys are fetched again if the key is unknown,
+// as the provider may have rotated them. An empty ID is allowed if the provider has a single key.
+func (p *Provider) key(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	meta, err := p.Metadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if key, ok := lookupKey(p.keys, kid); ok {
+		return key, nil
+	}
+
+	var set jwks
+	if err := p.getJSON(ctx, meta.JWKSURI, &set); err != nil {
+		return nil, fmt.Errorf("%w: failed to fetch keys: %v", ErrDiscovery, err)
+	}
+	p.keys = parseKeys(set)
+
+	if key, ok := lookupKey(p.keys, kid); ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("%w: unknown key %q", ErrInvalidIDToken, kid)
+}
+
+func lookupKey(keys map[string]*rsa.PublicKey, kid string) (*rsa.PublicKey, bool) {
+	if kid == "" && len(keys) == 1 {
+		for _, key := range keys {
+			return key, true
+		}
+	}
+	key, ok := keys[kid]
+	return key, ok
+}
+
+// parseKeys returns the RSA signing keys of the set by their IDs, the other keys are skipped.
+func parseKeys(set jwks) map[string]*rsa.PublicKey {
+	keys := make(map[string]*rsa.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" || (k.Use != "" && k.Use != "sig") || (k.Alg != "" && k.Alg != "RS256") {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			continue
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil || len(e) == 0 || len(e) > 4 {
+			continue
+		}
+		key := &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+		if key.N.BitLen() < minKeyBits {
+			continue
+		}
+		keys[k.Kid] = key
+	}
+	return keys
+}
+
+// decodeSegment decodes the base64url encoded JSON segment of the token.
+func decodeSegment(seg string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (a *audience) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		*a = audience{s}
+		return nil
+	}
+	var ss []string
+	if err := json.Unmarshal(b, &ss); err != nil {
+		return err
+	}
+	*a = ss
+	return nil
+}
+
+func (a audience) contains(clientID string) bool {
+	for _, aud := range a {
+		if aud == clientID {
+			return true
+		}
+	}
+	return false
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (f *flexBool) UnmarshalJSON(b []byte) error {
+	var v bool
+	if err := json.Unmarshal(b, &v); err == nil {
+		*f = flexBool(v)
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	*f = s == "true"
+	return nil
+}
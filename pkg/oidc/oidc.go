@@ -0,0 +1,256 @@
+// Package oidc implements the OpenID Connect relying party: the authorization code flow
+// with PKCE (RFC 7636), the provider discovery and the ID token validation against
+// the provider keys. Only RS256 signed ID tokens are supported, the providers use it by default.
+package oidc
+
+import (
+	"context"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ScopeOpenID is the scope every OpenID Connect authorization request must include.
+const ScopeOpenID = "openid"
+
+// maxResponseSize limits the provider responses read into memory.
+const maxResponseSize = 1 << 20
+
+var (
+	// ErrDiscovery is returned when the provider metadata can't be fetched or is invalid.
+	ErrDiscovery = errors.New("oidc discovery failed")
+	// ErrExchange is returned when the provider refuses to exchange the authorization code.
+	ErrExchange = errors.New("oidc code exchange failed")
+	// ErrInvalidIDToken is returned when the ID token is malformed, its signature is invalid,
+	// or its claims don't match the relying party.
+	ErrInvalidIDToken = errors.New("invalid id token")
+)
+
+type (
+	// Config is the relying party registration at the provider.
+	Config struct {
+		// IssuerURL is the provider issuer identifier, the discovery document is served under it.
+		IssuerURL    string
+		ClientID     string
+		ClientSecret string
+		// RedirectURL is the callback the provider redirects the user back to with the code.
+		RedirectURL string
+		// Scopes are requested in addition to ScopeOpenID, e.g. "email" and "profile".
+		Scopes []string
+	}
+
+	// Metadata is the part of the provider discovery document the relying party uses.
+	Metadata struct {
+		Issuer                string `json:"issuer"`
+		AuthorizationEndpoint string `json:"authorization_endpoint"`
+		TokenEndpoint         string `json:"token_endpoint"`
+		JWKSURI               string `json:"jwks_uri"`
+	}
+
+	// Token is the token endpoint response.
+	Token struct {
+		AccessToken string `json:"access_token"`
+		TokenType   string `json:"token_type"`
+		IDToken     string `json:"id_token"`
+	}
+
+	// IDToken holds the verified ID token claims.
+	IDToken struct {
+		Issuer   string
+		Subject  string
+		Audience []string
+		IssuedAt time.Time
+		Expiry   time.Time
+		Nonce    string
+		// Email is set if the "email" scope is granted.
+		// It can be trusted only if EmailVerified is set.
+		Email         string
+		EmailVerified bool
+		Name          string
+	}
+
+	// Provider is the OpenID Connect provider client of the relying party.
+	// The metadata and the keys are fetched on the first use and cached,
+	// the keys are fetched again when a token is signed with an unknown key.
+	// It's safe for concurrent use.
+	Provider struct {
+		cnf    Config
+		client *http.Client
+		now    func() time.Time
+
+		mu   sync.Mutex
+		meta *Metadata
+		keys map[string]*rsa.PublicKey
+	}
+)
+
+// NewProvider creates a new provider client. Nil client means http.DefaultClient.
+func NewProvider(cnf Config, client *http.Client) *Provider {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &Provider{
+		cnf:    cnf,
+		client: client,
+		now:    time.Now,
+	}
+}
+
+// Metadata returns the provider discovery document.
+// The issuer in the document must match the configured one, so it can't be served by someone else.
+func (p *Provider) Metadata(ctx context.Context) (Metadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.meta != nil {
+		return *p.meta, nil
+	}
+
+	var meta Metadata
+	discoveryURL := strings.TrimSuffix(p.cnf.IssuerURL, "/") + "/.well-known/openid-configuration"
+	if err := p.getJSON(ctx, discoveryURL, &meta); err != nil {
+		return Metadata{}, fmt.Errorf("%w: %v", ErrDiscovery, err)
+	}
+	if meta.Issuer != p.cnf.IssuerURL {
+		return Metadata{}, fmt.Errorf("%w: issuer %q doesn't match %q", ErrDiscovery, meta.Issuer, p.cnf.IssuerURL)
+	}
+	if meta.AuthorizationEndpoint == "" || meta.TokenEndpoint == "" || meta.JWKSURI == "" {
+		return Metadata{}, fmt.Errorf("%w: missing endpoints", ErrDiscovery)
+	}
+	p.meta = &meta
+	return meta, nil
+}
+
+// AuthCodeURL returns the provider page the user is redirected to for the authorization.
+// The state and the nonce must be random and kept by the relying party until the callback,
+// the same as the PKCE code verifier, see S256Challenge.
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, codeVerifier string) (string, error) {
+	meta, err := p.Metadata(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	q := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.cnf.ClientID},
+		"redirect_uri":          {p.cnf.RedirectURL},
+		"scope":                 {strings.Join(p.scopes(), " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {S256Challenge(codeVerifier)},
+		"code_challenge_method": {"S256"},
+	}
+	sep := "?"
+	if strings.Contains(meta.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return meta.AuthorizationEndpoint + sep + q.Encode(), nil
+}
+
+// Exchange exchanges the authorization code for the tokens.
+// The code verifier must be the one the authorization URL was built with.
+func (p *Provider) Exchange(ctx context.Context, code, codeVerifier string) (Token, error) {
+	meta, err := p.Metadata(ctx)
+	if err != nil {
+		return Token{}, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.cnf.RedirectURL},
+		"code_verifier": {codeVerifier},
+		"client_id":     {p.cnf.ClientID},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, meta.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return Token{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.cnf.ClientSecret != "" {
+		// RFC 6749 2.3.1: the credentials are form-encoded before the basic auth encoding.
+		req.SetBasicAuth(url.QueryEscape(p.cnf.ClientID), url.QueryEscape(p.cnf.ClientSecret))
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return Token{}, fmt.Errorf("%w: %v", ErrExchange, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return Token{}, fmt.Errorf("%w: %v", ErrExchange, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		var e struct {
+			Error string `json:"error"`
+		}
+		_ = json.Unmarshal(body, &e)
+		return Token{}, fmt.Errorf("%w: status %d %s", ErrExchange, resp.StatusCode, e.Error)
+	}
+
+	var token Token
+	if err := json.Unmarshal(body, &token); err != nil {
+		return Token{}, fmt.Errorf("%w: %v", ErrExchange, err)
+	}
+	if token.IDToken == "" {
+		return Token{}, fmt.Errorf("%w: no id token", ErrExchange)
+	}
+	return token, nil
+}
+
+// Authenticate exchanges the authorization code and verifies the returned ID token.
+func (p *Provider) Authenticate(ctx context.Context, code, codeVerifier, nonce string) (IDToken, error) {
+	token, err := p.Exchange(ctx, code, codeVerifier)
+	if err != nil {
+		return IDToken{}, err
+	}
+	return p.VerifyIDToken(ctx, token.IDToken, nonce)
+}
+
+// S256Challenge returns the PKCE code challenge of the code verifier.
+func S256Challenge(codeVerifier string) string {
+	sum := sha256.Sum256([]byte(codeVerifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// scopes returns the requested scopes with ScopeOpenID first.
+func (p *Provider) scopes() []string {
+	scopes := []string{ScopeOpenID}
+	for _, s := range p.cnf.Scopes {
+		if s != ScopeOpenID {
+			scopes = append(scopes, s)
+		}
+	}
+	return scopes
+}
+
+// getJSON fetches the JSON document into v.
+func (p *Provider) getJSON(ctx context.Context, url string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d from %s", resp.StatusCode, url)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(v)
+}
@@ -0,0 +1,190 @@
+package oidc_test
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dmitrymomot/go-smart-monolith/pkg/oidc"
+	"github.com/dmitrymomot/go-smart-monolith/pkg/oidc/oidctest"
+	"github.com/stretchr/testify/require"
+)
+
+const redirectURL = "http://localhost:8080/users/oidc/test/callback"
+
+var testIdentity = oidctest.Identity{
+	Subject:       "subject-1",
+	Email:         "test@mail.dev",
+	EmailVerified: true,
+	Name:          "Test",
+}
+
+func TestProvider_Authenticate(t *testing.T) {
+	ctx := context.Background()
+	idp := oidctest.NewProvider(t)
+	idp.SignIn(testIdentity)
+	p := oidc.NewProvider(idp.Config(redirectURL), nil)
+
+	authURL, err := p.AuthCodeURL(ctx, "state-1", "nonce-1", "verifier-verifier-verifier-verifier-verifier")
+	require.NoError(t, err)
+	q := mustParse(t, authURL).Query()
+	require.Equal(t, "openid email profile", q.Get("scope"))
+	require.Equal(t, oidc.S256Challenge("verifier-verifier-verifier-verifier-verifier"), q.Get("code_challenge"))
+
+	code, state := authorize(t, authURL)
+	require.Equal(t, "state-1", state)
+
+	token, err := p.Authenticate(ctx, code, "verifier-verifier-verifier-verifier-verifier", "nonce-1")
+	require.NoError(t, err)
+	require.Equal(t, idp.Issuer(), token.Issuer)
+	require.Equal(t, "subject-1", token.Subject)
+	require.Equal(t, "test@mail.dev", token.Email)
+	require.True(t, token.EmailVerified)
+	require.Equal(t, "Test", token.Name)
+
+	// The code is single-use.
+	_, err = p.Authenticate(ctx, code, "verifier-verifier-verifier-verifier-verifier", "nonce-1")
+	require.ErrorIs(t, err, oidc.ErrExchange)
+}
+
+func TestProvider_Authenticate_PKCE(t *testing.T) {
+	ctx := context.Background()
+	idp := oidctest.NewProvider(t)
+	p := oidc.NewProvider(idp.Config(redirectURL), nil)
+
+	authURL, err := p.AuthCodeURL(ctx, "state", "nonce", "verifier-verifier-verifier-verifier-verifier")
+	require.NoError(t, err)
+	code, _ := authorize(t, authURL)
+
+	// The intercepted code is useless without the verifier.
+	_, err = p.Authenticate(ctx, code, "another-verifier-verifier-verifier-verifier", "nonce")
+	require.ErrorIs(t, err, oidc.ErrExchange)
+}
+
+func TestProvider_Authenticate_Nonce(t *testing.T) {
+	ctx := context.Background()
+	idp := oidctest.NewProvider(t)
+	p := oidc.NewProvider(idp.Config(redirectURL), nil)
+
+	authURL, err := p.AuthCodeURL(ctx, "state", "nonce", "verifier-verifier-verifier-verifier-verifier")
+	require.NoError(t, err)
+	code, _ := authorize(t, authURL)
+
+	// The token issued for another login is replayed.
+	_, err = p.Authenticate(ctx, code, "verifier-verifier-verifier-verifier-verifier", "another nonce")
+	require.ErrorIs(t, err, oidc.ErrInvalidIDToken)
+}
+
+func TestProvider_VerifyIDToken(t *testing.T) {
+	ctx := context.Background()
+	idp := oidctest.NewProvider(t)
+	p := oidc.NewProvider(idp.Config(redirectURL), nil)
+
+	valid := idp.Claims(testIdentity, "nonce")
+	_, err := p.VerifyIDToken(ctx, idp.Sign(valid), "nonce")
+	require.NoError(t, err)
+
+	tests := map[string]func(claims map[string]interface{}){
+		"another issuer":   func(c map[string]interface{}) { c["iss"] = "https://evil.dev" },
+		"another audience": func(c map[string]interface{}) { c["aud"] = "another-client" },
+		"another azp":      func(c map[string]interface{}) { c["aud"] = []string{oidctest.ClientID, "x"}; c["azp"] = "x" },
+		"no subject":       func(c map[string]interface{}) { delete(c, "sub") },
+		"expired":          func(c map[string]interface{}) { c["exp"] = time.Now().Add(-2 * time.Minute).Unix() },
+		"future":           func(c map[string]interface{}) { c["iat"] = time.Now().Add(time.Hour).Unix() },
+		"no nonce":         func(c map[string]interface{}) { delete(c, "nonce") },
+	}
+	for name, modify := range tests {
+		t.Run(name, func(t *testing.T) {
+			claims := idp.Claims(testIdentity, "nonce")
+			modify(claims)
+			_, err := p.VerifyIDToken(ctx, idp.Sign(claims), "nonce")
+			require.ErrorIs(t, err, oidc.ErrInvalidIDToken)
+		})
+	}
+
+	t.Run("multiple audiences", func(t *testing.T) {
+		claims := idp.Claims(testIdentity, "nonce")
+		claims["aud"] = []string{"x", oidctest.ClientID}
+		claims["email_verified"] = "true"
+		token, err := p.VerifyIDToken(ctx, idp.Sign(claims), "nonce")
+		require.NoError(t, err)
+		require.True(t, token.EmailVerified)
+	})
+
+	t.Run("tampered", func(t *testing.T) {
+		token := idp.Sign(valid)
+		other := idp.Sign(idp.Claims(oidctest.Identity{Subject: "admin"}, "nonce"))
+		_, err := p.VerifyIDToken(ctx, headerOf(token)+"."+payloadOf(other)+"."+signatureOf(token), "nonce")
+		require.ErrorIs(t, err, oidc.ErrInvalidIDToken)
+	})
+
+	t.Run("alg none", func(t *testing.T) {
+		token := idp.Sign(valid)
+		none := "eyJhbGciOiJub25lIn0" // {"alg":"none"}
+		_, err := p.VerifyIDToken(ctx, none+"."+payloadOf(token)+".", "nonce")
+		require.ErrorIs(t, err, oidc.ErrInvalidIDToken)
+	})
+}
+
+func TestProvider_VerifyIDToken_KeyRotation(t *testing.T) {
+	ctx := context.Background()
+	idp := oidctest.NewProvider(t)
+	p := oidc.NewProvider(idp.Config(redirectURL), nil)
+
+	_, err := p.VerifyIDToken(ctx, idp.Sign(idp.Claims(testIdentity, "nonce")), "nonce")
+	require.NoError(t, err)
+
+	// The keys are fetched again for the unknown key.
+	idp.RotateKey()
+	_, err = p.VerifyIDToken(ctx, idp.Sign(idp.Claims(testIdentity, "nonce")), "nonce")
+	require.NoError(t, err)
+}
+
+func TestProvider_Metadata(t *testing.T) {
+	idp := oidctest.NewProvider(t)
+
+	// The discovery document must be served by the issuer itself.
+	cnf := idp.Config(redirectURL)
+	cnf.IssuerURL += "/"
+	_, err := oidc.NewProvider(cnf, nil).Metadata(context.Background())
+	require.ErrorIs(t, err, oidc.ErrDiscovery)
+
+	cnf.IssuerURL = "http://127.0.0.1:1"
+	_, err = oidc.NewProvider(cnf, nil).AuthCodeURL(context.Background(), "state", "nonce", "verifier")
+	require.ErrorIs(t, err, oidc.ErrDiscovery)
+}
+
+// authorize follows the authorization URL as the user would,
+// and returns the code and the state the provider redirects back with.
+func authorize(t *testing.T, authURL string) (code, state string) {
+	t.Helper()
+	client := &http.Client{
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+	resp, err := client.Get(authURL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusFound, resp.StatusCode)
+
+	callback := mustParse(t, resp.Header.Get("Location"))
+	require.Equal(t, redirectURL, callback.Scheme+"://"+callback.Host+callback.Path)
+	return callback.Query().Get("code"), callback.Query().Get("state")
+}
+
+func mustParse(t *testing.T, raw string) *url.URL {
+	t.Helper()
+	u, err := url.Parse(raw)
+	require.NoError(t, err)
+	return u
+}
+
+func headerOf(token string) string    { return segment(token, 0) }
+func payloadOf(token string) string   { return segment(token, 1) }
+func signatureOf(token string) string { return segment(token, 2) }
+
+func segment(token string, i int) string {
+	return strings.Split(token, ".")[i]
+}
@@ -0,0 +1,147 @@
+// Package outbox keeps the messages in the storage until the message bus accepts them,
+// so the messages published while the bus is down are not lost,
+// and the pending ones are published on shutdown, before the bus is closed.
+//
+// The messages are delivered at least once: a message is published again
+// if it can't be deleted from the outbox after it was published.
+// The outbox is written after the state change, not in the same transaction,
+// since the kv storage has no transactions across keys: the messages of the process
+// crashed in between are lost.
+package outbox
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dmitrymomot/go-smart-monolith/pkg/storage"
+)
+
+// keyPrefix is the key prefix of the pending messages.
+// The keys are "<prefix><unix nanoseconds>:<sequence>", so the messages are scanned in the publishing order.
+const keyPrefix = "outbox:"
+
+// batchSize is the max number of the messages published by one scan of the outbox.
+const batchSize = 100
+
+type (
+	// Outbox is a message bus decorator that stores the published messages
+	// and publishes them to the bus by Flush, see Run.
+	Outbox struct {
+		store    store
+		bus      messageBus
+		log      logger
+		interval time.Duration
+
+		seq    uint64        // the sequence of the messages published within the same nanosecond
+		flush  sync.Mutex    // serializes the flushes, so the messages are published in order
+		notify chan struct{} // wakes up Run once a message is stored
+	}
+
+	// message is the pending message.
+	message struct {
+		Subject string
+		Body    []byte
+	}
+
+	// low-level abstraction for the storage.
+	store interface {
+		Set(ctx context.Context, key string, value interface{}) error
+		Scan(ctx context.Context, opts storage.ScanOptions) ([]storage.KV, error)
+		Delete(ctx context.Context, key string) error
+	}
+
+	// low-level abstraction for the message bus, e.g. the NATS client.
+	messageBus interface {
+		Publish(subject string, body []byte) error
+		Subscribe(subject string, handler func(body []byte)) error
+	}
+
+	// low-level abstraction for the logger.
+	logger interface {
+		Error(err error, kv ...interface{})
+	}
+)
+
+// New creates a new outbox of the message bus.
+// The pending messages are published every interval, or as soon as they are stored, see Run.
+func New(store store, bus messageBus, log logger, interval time.Duration) *Outbox {
+	return &Outbox{
+		store:    store,
+		bus:      bus,
+		log:      log,
+		interval: interval,
+		notify:   make(chan struct{}, 1),
+	}
+}
+
+// Publish stores the message to be published to the bus by Flush.
+// It has the same signature as the bus Publish, so the outbox replaces the bus for the publishers.
+func (o *Outbox) Publish(subject string, body []byte) error {
+	key := fmt.Sprintf("%s%020d:%020d", keyPrefix, time.Now().UnixNano(), atomic.AddUint64(&o.seq, 1))
+	if err := o.store.Set(context.Background(), key, message{Subject: subject, Body: body}); err != nil {
+		return fmt.Errorf("outbox: %w", err)
+	}
+
+	select {
+	case o.notify <- struct{}{}:
+	default: // Run is notified already.
+	}
+	return nil
+}
+
+// Subscribe subscribes the handler to the bus directly, the outbox is only for the published messages.
+func (o *Outbox) Subscribe(subject string, handler func(body []byte)) error {
+	return o.bus.Subscribe(subject, handler)
+}
+
+// Flush publishes the pending messages to the bus in the publishing order and deletes them from the outbox.
+// It stops at the first message the bus doesn't accept, so the order is kept.
+func (o *Outbox) Flush(ctx context.Context) error {
+	o.flush.Lock()
+	defer o.flush.Unlock()
+
+	for {
+		kvs, err := o.store.Scan(ctx, storage.ScanOptions{Prefix: keyPrefix, Limit: batchSize})
+		if err != nil {
+			return fmt.Errorf("outbox: %w", err)
+		}
+		if len(kvs) == 0 {
+			return nil
+		}
+
+		for _, kv := range kvs {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			msg := kv.Value.(message)
+			if err := o.bus.Publish(msg.Subject, msg.Body); err != nil {
+				return fmt.Errorf("outbox: publish to %s: %w", msg.Subject, err)
+			}
+			if err := o.store.Delete(ctx, kv.Key); err != nil {
+				return fmt.Errorf("outbox: %w", err)
+			}
+		}
+	}
+}
+
+// Run flushes the outbox every interval and once a message is stored,
+// until the context is canceled. The failed flushes are retried on the next tick.
+func (o *Outbox) Run(ctx context.Context) {
+	ticker := time.NewTicker(o.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-o.notify:
+		}
+		if err := o.Flush(ctx); err != nil && ctx.Err() == nil {
+			o.log.Error(err)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package outbox_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dmitrymomot/go-smart-monolith/pkg/outbox"
+	"github.com/dmitrymomot/go-smart-monolith/pkg/storage"
+
+	"github.com/stretchr/testify/require"
+)
+
+// nopLogger is a logger that does nothing.
+type nopLogger struct{}
+
+func (nopLogger) Error(err error, kv ...interface{}) {}
+
+// bus records the published messages, or fails if err is set.
+type bus struct {
+	mu   sync.Mutex
+	err  error
+	msgs []string
+}
+
+func (b *bus) Publish(subject string, body []byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.err != nil {
+		return b.err
+	}
+	b.msgs = append(b.msgs, subject+":"+string(body))
+	return nil
+}
+
+func (b *bus) Subscribe(subject string, handler func(body []byte)) error {
+	return nil
+}
+
+func (b *bus) setErr(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.err = err
+}
+
+func (b *bus) published() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]string(nil), b.msgs...)
+}
+
+func TestOutbox_Flush(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	stor := storage.New()
+	b := &bus{err: errors.New("bus is down")}
+	box := outbox.New(stor, b, nopLogger{}, time.Hour)
+
+	for _, body := range []string{"1", "2", "3"} {
+		require.NoError(t, box.Publish("events", []byte(body)))
+	}
+
+	// The messages are kept while the bus is down.
+	require.Error(t, box.Flush(ctx))
+	require.Empty(t, b.published())
+
+	// The messages are published in order and deleted from the outbox.
+	b.setErr(nil)
+	require.NoError(t, box.Flush(ctx))
+	require.Equal(t, []string{"events:1", "events:2", "events:3"}, b.published())
+
+	require.NoError(t, box.Flush(ctx))
+	require.Len(t, b.published(), 3)
+}
+
+func TestOutbox_Run(t *testing.T) {
+	t.Parallel()
+
+	b := &bus{}
+	box := outbox.New(storage.New(), b, nopLogger{}, time.Hour)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go box.Run(ctx)
+
+	// The message is published once it's stored, without waiting for the interval.
+	require.NoError(t, box.Publish("events", []byte("1")))
+	require.Eventually(t, func() bool {
+		return len(b.published()) == 1
+	}, time.Second, 5*time.Millisecond)
+}
@@ -0,0 +1,65 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often Memory forgets the full buckets.
+const sweepInterval = time.Minute
+
+// memoryBucket is a bucket with the time it's full again, so it can be forgotten.
+type memoryBucket struct {
+	bucket
+	fullAt time.Time
+}
+
+// Memory is the in-memory limiter.
+// The limits are per instance, use Store if the app runs several instances.
+type Memory struct {
+	mu        sync.Mutex
+	buckets   map[string]memoryBucket
+	now       func() time.Time
+	lastSweep time.Time
+}
+
+// NewMemory creates a new in-memory limiter.
+func NewMemory(now func() time.Time) *Memory {
+	return &Memory{
+		buckets:   make(map[string]memoryBucket),
+		now:       now,
+		lastSweep: now(),
+	}
+}
+
+// Allow takes a token from the bucket of the key, if there is one.
+func (m *Memory) Allow(ctx context.Context, key string, limit Limit) (Result, error) {
+	if limit.IsZero() {
+		return Result{Limit: limit, Allowed: true}, nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	m.sweep(now)
+
+	b, res := m.buckets[key].take(limit, now)
+	m.buckets[key] = memoryBucket{bucket: b, fullAt: now.Add(res.Reset)}
+	return res, nil
+}
+
+// sweep forgets the buckets refilled to the full, they are the same as the missing ones.
+// It must be called with the lock held.
+func (m *Memory) sweep(now time.Time) {
+	if now.Sub(m.lastSweep) < sweepInterval {
+		return
+	}
+	m.lastSweep = now
+	for key, b := range m.buckets {
+		if !now.Before(b.fullAt) {
+			delete(m.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/dmitrymomot/go-smart-monolith/pkg/auth"
+)
+
+// KeyFunc returns the key the request is limited by, e.g. the client IP.
+type KeyFunc func(r *http.Request) string
+
+// ByIP limits the requests by the client IP.
+// The IP is the address of the peer: put a middleware resolving the client IP,
+// e.g. chi middleware.RealIP, in front of the limiter if the app runs behind a trusted proxy.
+func ByIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	return "ip:" + ip
+}
+
+// ByPrincipal limits the requests by the authenticated caller: the API key, so each key of a user
+// has its own limit, or the user. The anonymous requests are limited by the client IP.
+// The limiter must be placed after the auth middleware putting the principal into the context.
+func ByPrincipal(r *http.Request) string {
+	p, ok := auth.PrincipalFromContext(r.Context())
+	switch {
+	case ok && p.APIKeyID != "":
+		return "api_key:" + p.APIKeyID
+	case ok && p.UserID != "":
+		return "user:" + p.UserID
+	default:
+		return ByIP(r)
+	}
+}
+
+// Middleware limits the requests to the limit per key, the zero limit disables it.
+// The name separates the buckets of the different limits of the same key, e.g. per route.
+// The responses get the RateLimit-Limit, RateLimit-Remaining, RateLimit-Reset and RateLimit-Policy
+// headers, the rejected ones get 429 Too Many Requests with Retry-After.
+// The requests are allowed if the limiter fails: it's better than failing the whole API
+// when the storage is down.
+func Middleware(l Limiter, name string, limit Limit, key KeyFunc) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if limit.IsZero() {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			res, err := l.Allow(r.Context(), name+":"+key(r), limit)
+			if err != nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			h := w.Header()
+			h.Set("RateLimit-Limit", strconv.Itoa(limit.Requests))
+			h.Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+			h.Set("RateLimit-Reset", strconv.Itoa(seconds(res.Reset)))
+			h.Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d", limit.Requests, seconds(limit.Period)))
+			if !res.Allowed {
+				h.Set("Retry-After", strconv.Itoa(seconds(res.RetryAfter)))
+				http.Error(w, "too many requests", http.StatusTooManyRequests)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// seconds rounds the duration up to the whole seconds, so the clients don't retry too early.
+func seconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,126 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalidLimit is returned when the limit can't be parsed.
+var ErrInvalidLimit = errors.New("invalid rate limit")
+
+type (
+	// Limit is the max number of the requests in the period, e.g. 10 requests per minute.
+	// The requests are limited by the token bucket: it holds up to Requests tokens,
+	// each request takes one, and the tokens are refilled evenly over the period.
+	// So the bursts up to Requests are allowed, and then the requests are spread over the period.
+	// The zero limit doesn't limit the requests.
+	Limit struct {
+		Requests int
+		Period   time.Duration
+	}
+
+	// Result is the outcome of a request against the limit.
+	Result struct {
+		Limit Limit
+		// Allowed reports whether the request is allowed.
+		Allowed bool
+		// Remaining is the number of the requests allowed right away after this one.
+		Remaining int
+		// Reset is how long it takes to refill the bucket, so the full limit is available again.
+		Reset time.Duration
+		// RetryAfter is how long to wait before the next request is allowed, if this one is not.
+		RetryAfter time.Duration
+	}
+
+	// Limiter counts the requests of the keys against the limits.
+	// See Memory for a single instance and Store for the limits shared by the instances.
+	Limiter interface {
+		Allow(ctx context.Context, key string, limit Limit) (Result, error)
+	}
+
+	// bucket is the state of the token bucket of a key.
+	bucket struct {
+		Tokens    float64   `json:"tokens"`
+		UpdatedAt time.Time `json:"updated_at"`
+	}
+)
+
+// ParseLimit parses the limit in the "<requests>/<period>" format, e.g. "10/1m" or "1000/24h".
+// The period defaults to a second if it's omitted: "5" is 5 requests per second.
+// The empty string and "0" are the zero limit.
+func ParseLimit(s string) (Limit, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return Limit{}, nil
+	}
+
+	requests, period, hasPeriod := strings.Cut(s, "/")
+	n, err := strconv.Atoi(strings.TrimSpace(requests))
+	if err != nil || n < 0 {
+		return Limit{}, fmt.Errorf("%w %q: requests must be a non-negative integer", ErrInvalidLimit, s)
+	}
+	if n == 0 {
+		return Limit{}, nil
+	}
+
+	l := Limit{Requests: n, Period: time.Second}
+	if hasPeriod {
+		if l.Period, err = time.ParseDuration(strings.TrimSpace(period)); err != nil || l.Period <= 0 {
+			return Limit{}, fmt.Errorf("%w %q: period must be a positive duration", ErrInvalidLimit, s)
+		}
+	}
+	return l, nil
+}
+
+// String returns the limit in the ParseLimit format.
+func (l Limit) String() string {
+	if l.IsZero() {
+		return ""
+	}
+	return fmt.Sprintf("%d/%s", l.Requests, l.Period)
+}
+
+// UnmarshalText parses the limit in the ParseLimit format, e.g. from the config.
+func (l *Limit) UnmarshalText(text []byte) error {
+	parsed, err := ParseLimit(string(text))
+	if err != nil {
+		return err
+	}
+	*l = parsed
+	return nil
+}
+
+// IsZero reports whether the limit doesn't limit the requests.
+func (l Limit) IsZero() bool {
+	return l.Requests <= 0 || l.Period <= 0
+}
+
+// take refills the bucket by the time passed since its last update and
+// takes a token for the request, if there is one.
+func (b bucket) take(limit Limit, now time.Time) (bucket, Result) {
+	capacity := float64(limit.Requests)
+	interval := limit.Period / time.Duration(limit.Requests) // time to refill one token
+
+	if b.UpdatedAt.IsZero() {
+		b.Tokens = capacity
+	} else if elapsed := now.Sub(b.UpdatedAt); elapsed > 0 {
+		b.Tokens = math.Min(capacity, b.Tokens+float64(elapsed)/float64(interval))
+	}
+	b.UpdatedAt = now
+
+	res := Result{Limit: limit}
+	if b.Tokens >= 1 {
+		b.Tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = time.Duration((1 - b.Tokens) * float64(interval))
+	}
+	res.Remaining = int(b.Tokens)
+	res.Reset = time.Duration((capacity - b.Tokens) * float64(interval))
+	return b, res
+}
@@ -0,0 +1,263 @@
+package ratelimit_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dmitrymomot/go-smart-monolith/pkg/auth"
+	"github.com/dmitrymomot/go-smart-monolith/pkg/ratelimit"
+	"github.com/dmitrymomot/go-smart-monolith/pkg/storage"
+
+	"github.com/stretchr/testify/require"
+)
+
+// failingLimiter is a limiter whose storage is down.
+type failingLimiter struct{}
+
+func (failingLimiter) Allow(ctx context.Context, key string, limit ratelimit.Limit) (ratelimit.Result, error) {
+	return ratelimit.Result{}, errors.New("storage is down")
+}
+
+func TestParseLimit(t *testing.T) {
+	t.Parallel()
+
+	for s, want := range map[string]ratelimit.Limit{
+		"":         {},
+		"0":        {},
+		"0/1m":     {},
+		"5":        {Requests: 5, Period: time.Second},
+		"10/1m":    {Requests: 10, Period: time.Minute},
+		" 100/1h ": {Requests: 100, Period: time.Hour},
+	} {
+		l, err := ratelimit.ParseLimit(s)
+		require.NoError(t, err, s)
+		require.Equal(t, want, l, s)
+	}
+	for _, s := range []string{"ten/1m", "-1/1m", "10/", "10/minute", "10/-1m"} {
+		_, err := ratelimit.ParseLimit(s)
+		require.ErrorIs(t, err, ratelimit.ErrInvalidLimit, s)
+	}
+
+	var l ratelimit.Limit
+	require.NoError(t, l.UnmarshalText([]byte("10/1m0s")))
+	require.Equal(t, "10/1m0s", l.String())
+}
+
+func TestLimiters(t *testing.T) {
+	t.Parallel()
+
+	limiters := map[string]func(now func() time.Time) ratelimit.Limiter{
+		"memory": func(now func() time.Time) ratelimit.Limiter { return ratelimit.NewMemory(now) },
+		"store":  func(now func() time.Time) ratelimit.Limiter { return ratelimit.NewStore(storage.New(), now) },
+	}
+	for name, newLimiter := range limiters {
+		newLimiter := newLimiter
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			// The buckets expire by the storage TTL, so the clock starts at the real time.
+			now := time.Now()
+			l := newLimiter(func() time.Time { return now })
+			ctx := context.Background()
+			limit := ratelimit.Limit{Requests: 3, Period: 3 * time.Second}
+
+			// The burst is allowed.
+			for i := 2; i >= 0; i-- {
+				res, err := l.Allow(ctx, "a", limit)
+				require.NoError(t, err)
+				require.True(t, res.Allowed)
+				require.Equal(t, i, res.Remaining)
+			}
+
+			res, err := l.Allow(ctx, "a", limit)
+			require.NoError(t, err)
+			require.False(t, res.Allowed)
+			require.Equal(t, time.Second, res.RetryAfter)
+			require.Equal(t, 3*time.Second, res.Reset)
+
+			// Other keys have their own buckets.
+			res, err = l.Allow(ctx, "b", limit)
+			require.NoError(t, err)
+			require.True(t, res.Allowed)
+
+			// A token is refilled each second.
+			now = now.Add(time.Second)
+			res, err = l.Allow(ctx, "a", limit)
+			require.NoError(t, err)
+			require.True(t, res.Allowed)
+			require.Equal(t, 0, res.Remaining)
+			res, err = l.Allow(ctx, "a", limit)
+			require.NoError(t, err)
+			require.False(t, res.Allowed)
+
+			// The bucket isn't refilled over the limit.
+			now = now.Add(time.Hour)
+			for i := 0; i < 3; i++ {
+				res, err = l.Allow(ctx, "a", limit)
+				require.NoError(t, err)
+				require.True(t, res.Allowed)
+			}
+			res, err = l.Allow(ctx, "a", limit)
+			require.NoError(t, err)
+			require.False(t, res.Allowed)
+
+			// The zero limit doesn't limit.
+			res, err = l.Allow(ctx, "a", ratelimit.Limit{})
+			require.NoError(t, err)
+			require.True(t, res.Allowed)
+		})
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	t.Parallel()
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	call := func(h http.Handler, remoteAddr string, p *auth.Principal) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/", nil)
+		r.RemoteAddr = remoteAddr
+		if p != nil {
+			r = r.WithContext(auth.WithPrincipal(r.Context(), *p))
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+	limit := ratelimit.Limit{Requests: 2, Period: time.Minute}
+
+	t.Run("headers", func(t *testing.T) {
+		t.Parallel()
+		h := ratelimit.Middleware(ratelimit.NewMemory(time.Now), "test", limit, ratelimit.ByIP)(ok)
+
+		w := call(h, "10.0.0.1:1234", nil)
+		require.Equal(t, http.StatusNoContent, w.Code)
+		require.Equal(t, "2", w.Header().Get("RateLimit-Limit"))
+		require.Equal(t, "1", w.Header().Get("RateLimit-Remaining"))
+		require.Equal(t, "30", w.Header().Get("RateLimit-Reset"))
+		require.Equal(t, "2;w=60", w.Header().Get("RateLimit-Policy"))
+		require.Empty(t, w.Header().Get("Retry-After"))
+
+		require.Equal(t, http.StatusNoContent, call(h, "10.0.0.1:1234", nil).Code)
+		w = call(h, "10.0.0.1:5678", nil)
+		require.Equal(t, http.StatusTooManyRequests, w.Code)
+		require.Equal(t, "0", w.Header().Get("RateLimit-Remaining"))
+		require.Equal(t, "30", w.Header().Get("Retry-After"))
+
+		require.Equal(t, http.StatusNoContent, call(h, "10.0.0.2:1234", nil).Code, "other IPs are not limited")
+	})
+
+	t.Run("by principal", func(t *testing.T) {
+		t.Parallel()
+		h := ratelimit.Middleware(ratelimit.NewMemory(time.Now), "test", limit, ratelimit.ByPrincipal)(ok)
+		user := &auth.Principal{UserID: "u1"}
+		key := &auth.Principal{UserID: "u1", APIKeyID: "k1"}
+
+		for i := 0; i < 2; i++ {
+			require.Equal(t, http.StatusNoContent, call(h, "10.0.0.1:1234", user).Code)
+		}
+		require.Equal(t, http.StatusTooManyRequests, call(h, "10.0.0.2:1234", user).Code, "the user is limited from any IP")
+		require.Equal(t, http.StatusNoContent, call(h, "10.0.0.1:1234", key).Code, "the API key has its own limit")
+		require.Equal(t, http.StatusNoContent, call(h, "10.0.0.1:1234", nil).Code, "the anonymous requests are limited by IP")
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		t.Parallel()
+		h := ratelimit.Middleware(ratelimit.NewMemory(time.Now), "test", ratelimit.Limit{}, ratelimit.ByIP)(ok)
+		for i := 0; i < 10; i++ {
+			w := call(h, "10.0.0.1:1234", nil)
+			require.Equal(t, http.StatusNoContent, w.Code)
+			require.Empty(t, w.Header().Get("RateLimit-Limit"))
+		}
+	})
+
+	t.Run("limiter failure", func(t *testing.T) {
+		t.Parallel()
+		h := ratelimit.Middleware(failingLimiter{}, "test", limit, ratelimit.ByIP)(ok)
+		require.Equal(t, http.StatusNoContent, call(h, "10.0.0.1:1234", nil).Code)
+	})
+}
+
+func TestParseRoute(t *testing.T) {
+	t.Parallel()
+
+	r, err := ratelimit.ParseRoute(" post /users/login*=30/1m ")
+	require.NoError(t, err)
+	require.Equal(t, ratelimit.Route{
+		Method:  http.MethodPost,
+		Pattern: "/users/login*",
+		Limit:   ratelimit.Limit{Requests: 30, Period: time.Minute},
+	}, r)
+	require.Equal(t, "POST /users/login*=30/1m0s", r.String())
+
+	for _, s := range []string{"", "POST /users", "/users=1/1m", "POST users=1/1m", "POST /users=x"} {
+		_, err := ratelimit.ParseRoute(s)
+		require.ErrorIs(t, err, ratelimit.ErrInvalidLimit, s)
+	}
+}
+
+func TestRoute_Match(t *testing.T) {
+	t.Parallel()
+
+	for pattern, paths := range map[string]map[string]bool{
+		"POST /users": {
+			"POST /users":   true,
+			"POST /users/":  true,
+			"GET /users":    false,
+			"POST /users/1": false,
+		},
+		"POST /users/login*": {
+			"POST /users/login":     true,
+			"POST /users/login/mfa": true,
+			"POST /users/logout":    false,
+		},
+		"* /users/{id}/email": {
+			"PUT /users/1/email":  true,
+			"PUT /users/1/email/": true,
+			"POST /users/2/email": true,
+			"PUT /users//email":   false,
+			"PUT /users/1":        false,
+		},
+	} {
+		route, err := ratelimit.ParseRoute(pattern + "=1/1m")
+		require.NoError(t, err)
+		for req, want := range paths {
+			method, path, _ := strings.Cut(req, " ")
+			require.Equal(t, want, route.Match(httptest.NewRequest(method, path, nil)), pattern+" "+req)
+		}
+	}
+}
+
+func TestRoutes(t *testing.T) {
+	t.Parallel()
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	h := ratelimit.Routes(ratelimit.NewMemory(time.Now), "test", []ratelimit.Route{
+		{Method: http.MethodPost, Pattern: "/login*", Limit: ratelimit.Limit{Requests: 2, Period: time.Minute}},
+		{Method: http.MethodPost, Pattern: "/signup", Limit: ratelimit.Limit{Requests: 1, Period: time.Minute}},
+	}, ratelimit.ByIP)(ok)
+	call := func(path string) int {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, path, nil))
+		return w.Code
+	}
+
+	// The login steps share the bucket.
+	require.Equal(t, http.StatusNoContent, call("/login"))
+	require.Equal(t, http.StatusNoContent, call("/login/mfa"))
+	require.Equal(t, http.StatusTooManyRequests, call("/login"))
+
+	require.Equal(t, http.StatusNoContent, call("/signup"), "the routes have their own buckets")
+	require.Equal(t, http.StatusTooManyRequests, call("/signup"))
+	for i := 0; i < 3; i++ {
+		require.Equal(t, http.StatusNoContent, call("/other"), "the other routes are not limited")
+	}
+}
@@ -0,0 +1,108 @@
+package ratelimit
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Route is the limit of the requests to the routes matching the method and the path pattern,
+// e.g. "POST /users/login*=30/1m", see ParseRoute.
+type Route struct {
+	// Method is the HTTP method, "*" matches any.
+	Method string
+	// Pattern is the request path, the "{name}" segments match any segment
+	// and the trailing "*" matches any suffix. The trailing slash of the path is ignored.
+	Pattern string
+	Limit   Limit
+}
+
+// ParseRoute parses the route limit in the "<method> <pattern>=<limit>" format,
+// e.g. "POST /users/{id}/email=10/1h", see ParseLimit for the limit format.
+func ParseRoute(s string) (Route, error) {
+	route, limit, ok := strings.Cut(strings.TrimSpace(s), "=")
+	method, pattern, hasPattern := strings.Cut(strings.TrimSpace(route), " ")
+	pattern = strings.TrimSpace(pattern)
+	if !ok || !hasPattern || method == "" || !strings.HasPrefix(pattern, "/") {
+		return Route{}, fmt.Errorf("%w %q: expected \"<method> <pattern>=<limit>\"", ErrInvalidLimit, s)
+	}
+
+	l, err := ParseLimit(limit)
+	if err != nil {
+		return Route{}, err
+	}
+	return Route{Method: strings.ToUpper(method), Pattern: pattern, Limit: l}, nil
+}
+
+// String returns the route limit in the ParseRoute format.
+func (r Route) String() string {
+	return r.Method + " " + r.Pattern + "=" + r.Limit.String()
+}
+
+// UnmarshalText parses the route limit in the ParseRoute format, e.g. from the config.
+func (r *Route) UnmarshalText(text []byte) error {
+	parsed, err := ParseRoute(string(text))
+	if err != nil {
+		return err
+	}
+	*r = parsed
+	return nil
+}
+
+// Match reports whether the request is sent to the route.
+func (r Route) Match(req *http.Request) bool {
+	if r.Method != "*" && r.Method != req.Method {
+		return false
+	}
+
+	pattern, path := r.Pattern, req.URL.Path
+	prefix := strings.HasSuffix(pattern, "*")
+	pattern = strings.TrimSuffix(pattern, "*")
+	// The routers send "/users/" to the same handler as "/users", so it can't skip the limit.
+	if !prefix && len(path) > 1 {
+		path = strings.TrimSuffix(path, "/")
+	}
+	want, got := strings.Split(pattern, "/"), strings.Split(path, "/")
+	if len(got) < len(want) || (!prefix && len(got) != len(want)) {
+		return false
+	}
+	for i, seg := range want {
+		last := i == len(want)-1
+		switch {
+		case strings.HasPrefix(seg, "{") && strings.HasSuffix(seg, "}"):
+			if got[i] == "" {
+				return false
+			}
+		case prefix && last:
+			if !strings.HasPrefix(got[i], seg) {
+				return false
+			}
+		case got[i] != seg:
+			return false
+		}
+	}
+	return true
+}
+
+// Routes limits the requests to each of the routes per key, see Middleware.
+// The name separates the buckets of the routes from the other limits of the same key.
+// The requests matching several routes are counted against each of them,
+// and the requests to the routes sharing a pattern share the bucket,
+// e.g. "POST /users/login*" limits both the login steps together.
+func Routes(l Limiter, name string, routes []Route, key KeyFunc) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		h := next
+		for i := len(routes) - 1; i >= 0; i-- {
+			route, skip := routes[i], h
+			limited := Middleware(l, name+":"+route.Method+" "+route.Pattern, route.Limit, key)(skip)
+			h = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if route.Match(r) {
+					limited.ServeHTTP(w, r)
+					return
+				}
+				skip.ServeHTTP(w, r)
+			})
+		}
+		return h
+	}
+}
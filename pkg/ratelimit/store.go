@@ -0,0 +1,82 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/dmitrymomot/go-smart-monolith/pkg/storage"
+)
+
+// storePrefix is the key prefix of the buckets in the storage.
+const storePrefix = "ratelimit:"
+
+type (
+	// Client is the low-level storage the Store keeps the buckets in, see pkg/storage.
+	Client interface {
+		Get(ctx context.Context, key string) (interface{}, error)
+		Set(ctx context.Context, key string, value interface{}) error
+	}
+
+	// Optional atomic read-modify-write of the storage client setting the key TTL,
+	// e.g. WATCH/MULTI with SET ... EX in redis.
+	// Without it the concurrent requests may take the same token.
+	ttlUpdater interface {
+		UpdateWithTTL(ctx context.Context, key string, fn func(v interface{}, ok bool) (interface{}, time.Duration, error)) error
+	}
+
+	// Optional capability of the storage client to expire the keys.
+	// Without it the buckets are kept forever.
+	ttlSetter interface {
+		SetWithTTL(ctx context.Context, key string, value interface{}, ttl time.Duration) error
+	}
+)
+
+// Store is the limiter keeping the buckets in the shared storage,
+// so the limits are shared by all the app instances.
+// The buckets expire once they are full again, if the storage supports the TTL.
+type Store struct {
+	client Client
+	now    func() time.Time
+}
+
+// NewStore creates a new limiter on the storage client.
+func NewStore(client Client, now func() time.Time) *Store {
+	return &Store{client: client, now: now}
+}
+
+// Allow takes a token from the bucket of the key, if there is one.
+func (s *Store) Allow(ctx context.Context, key string, limit Limit) (Result, error) {
+	if limit.IsZero() {
+		return Result{Limit: limit, Allowed: true}, nil
+	}
+
+	var res Result
+	update := func(v interface{}, ok bool) (interface{}, time.Duration, error) {
+		var b bucket
+		if ok {
+			b = v.(bucket)
+		}
+		b, res = b.take(limit, s.now())
+		// The full bucket is the same as the missing one, so it can expire then.
+		return b, res.Reset, nil
+	}
+
+	if u, ok := s.client.(ttlUpdater); ok {
+		// res is set by update, so it's returned only after UpdateWithTTL is done.
+		err := u.UpdateWithTTL(ctx, storePrefix+key, update)
+		return res, err
+	}
+
+	v, err := s.client.Get(ctx, storePrefix+key)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		return Result{}, err
+	}
+	next, ttl, _ := update(v, err == nil)
+	if c, ok := s.client.(ttlSetter); ok {
+		err = c.SetWithTTL(ctx, storePrefix+key, next, ttl)
+	} else {
+		err = s.client.Set(ctx, storePrefix+key, next)
+	}
+	return res, err
+}
@@ -3,7 +3,37 @@ package storage
 import (
 	"context"
 	"errors"
+	"sort"
+	"strings"
 	"sync"
+	"time"
+)
+
+// ErrNotFound is returned when the key doesn't exist.
+var ErrNotFound = errors.New("not found")
+
+type (
+	// ScanOptions defines the range of keys to scan.
+	// The keys are scanned in the lexicographical order, so encode the sortable
+	// fields into the keys, e.g. a fixed-width timestamp, to scan them in order.
+	ScanOptions struct {
+		// Prefix limits the scan to the keys with the prefix.
+		Prefix string
+		// Start is the inclusive lower bound of the keys. Empty means no bound.
+		Start string
+		// End is the exclusive upper bound of the keys. Empty means no bound.
+		End string
+		// Reverse scans the keys in the descending order.
+		Reverse bool
+		// Limit is the max number of the returned items. Zero means no limit.
+		Limit int
+	}
+
+	// KV is a key-value pair returned by Scan.
+	KV struct {
+		Key   string
+		Value interface{}
+	}
 )
 
 // Storage represents a kv storage example.
@@ -14,29 +44,210 @@ import (
 type Storage struct {
 	sync.RWMutex
 	kv map[string]interface{}
+	// expires holds the expiration times of the keys set with a TTL.
+	expires map[string]time.Time
 }
 
 // New creates a new storage.
 func New() *Storage {
 	return &Storage{
-		kv: make(map[string]interface{}),
+		kv:      make(map[string]interface{}),
+		expires: make(map[string]time.Time),
 	}
 }
 
 // Get gets a value from the storage.
 func (s *Storage) Get(ctx context.Context, key string) (interface{}, error) {
 	s.RLock()
-	defer s.RUnlock()
-	if v, ok := s.kv[key]; ok {
+	v, ok := s.kv[key]
+	expired := ok && s.isExpired(key, time.Now())
+	s.RUnlock()
+
+	if expired {
+		s.deleteExpired(key)
+		return nil, ErrNotFound
+	}
+	if ok {
 		return v, nil
 	}
-	return nil, errors.New("not found")
+	return nil, ErrNotFound
+}
+
+// GetMulti gets the values of the given keys in one call.
+// The missing keys are not included in the result.
+func (s *Storage) GetMulti(ctx context.Context, keys []string) (map[string]interface{}, error) {
+	s.RLock()
+	defer s.RUnlock()
+	res := make(map[string]interface{}, len(keys))
+	now := time.Now()
+	for _, key := range keys {
+		if v, ok := s.kv[key]; ok && !s.isExpired(key, now) {
+			res[key] = v
+		}
+	}
+	return res, nil
+}
+
+// Scan returns the key-value pairs in the given range of keys.
+// It's an analogue of the range queries of the ordered kv storages and
+// the ORDER BY ... LIMIT queries of the SQL databases.
+func (s *Storage) Scan(ctx context.Context, opts ScanOptions) ([]KV, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	keys := make([]string, 0)
+	now := time.Now()
+	for k := range s.kv {
+		if s.isExpired(k, now) ||
+			!strings.HasPrefix(k, opts.Prefix) ||
+			(opts.Start != "" && k < opts.Start) ||
+			(opts.End != "" && k >= opts.End) {
+			continue
+		}
+		keys = append(keys, k)
+	}
+
+	if opts.Reverse {
+		sort.Sort(sort.Reverse(sort.StringSlice(keys)))
+	} else {
+		sort.Strings(keys)
+	}
+	if opts.Limit > 0 && len(keys) > opts.Limit {
+		keys = keys[:opts.Limit]
+	}
+
+	res := make([]KV, 0, len(keys))
+	for _, k := range keys {
+		res = append(res, KV{Key: k, Value: s.kv[k]})
+	}
+	return res, ctx.Err()
 }
 
 // Set sets a value to the storage.
+// The key doesn't expire, even if it was set with a TTL before.
 func (s *Storage) Set(ctx context.Context, key string, value interface{}) error {
 	s.Lock()
 	defer s.Unlock()
 	s.kv[key] = value
+	delete(s.expires, key)
 	return nil
 }
+
+// SetWithTTL sets a value to the storage, the key expires after the ttl.
+// The expired keys are not returned, as if they were deleted.
+// It's an analogue of SET ... EX in redis.
+func (s *Storage) SetWithTTL(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
+	s.Lock()
+	defer s.Unlock()
+	s.kv[key] = value
+	s.expires[key] = time.Now().Add(ttl)
+	return nil
+}
+
+// Update atomically replaces the value of the key with the result of fn.
+// fn gets the current value, or nil and false if the key doesn't exist.
+// If fn returns an error, the value is not changed and the error is returned.
+// The TTL of the key is kept, the expired key doesn't exist for fn.
+// It's an analogue of the WATCH/MULTI transactions in redis and
+// the SELECT ... FOR UPDATE queries of the SQL databases.
+func (s *Storage) Update(ctx context.Context, key string, fn func(v interface{}, ok bool) (interface{}, error)) error {
+	return s.update(key, func(v interface{}, ok bool) (interface{}, time.Duration, error) {
+		nv, err := fn(v, ok)
+		return nv, -1, err
+	})
+}
+
+// UpdateWithTTL is the same as Update, but fn also returns the new TTL of the key,
+// e.g. to extend it on every change. Zero TTL means the key doesn't expire.
+func (s *Storage) UpdateWithTTL(ctx context.Context, key string, fn func(v interface{}, ok bool) (interface{}, time.Duration, error)) error {
+	return s.update(key, func(v interface{}, ok bool) (interface{}, time.Duration, error) {
+		nv, ttl, err := fn(v, ok)
+		if err == nil && ttl < 0 {
+			ttl = 0
+		}
+		return nv, ttl, err
+	})
+}
+
+// update replaces the value of the key with the result of fn,
+// the negative TTL keeps the key expiration as is.
+func (s *Storage) update(key string, fn func(v interface{}, ok bool) (interface{}, time.Duration, error)) error {
+	s.Lock()
+	defer s.Unlock()
+	now := time.Now()
+	if s.isExpired(key, now) {
+		delete(s.kv, key)
+		delete(s.expires, key)
+	}
+	v, ok := s.kv[key]
+	nv, ttl, err := fn(v, ok)
+	if err != nil {
+		return err
+	}
+	s.kv[key] = nv
+	switch {
+	case ttl > 0:
+		s.expires[key] = now.Add(ttl)
+	case ttl == 0:
+		delete(s.expires, key)
+	}
+	return nil
+}
+
+// GetDelete atomically gets the value of the key and deletes the key,
+// so only one of the concurrent callers gets the value, e.g. to use a one-time token.
+// It returns ErrNotFound if the key doesn't exist. It's an analogue of GETDEL in redis.
+func (s *Storage) GetDelete(ctx context.Context, key string) (interface{}, error) {
+	s.Lock()
+	defer s.Unlock()
+	v, ok := s.kv[key]
+	expired := ok && s.isExpired(key, time.Now())
+	delete(s.kv, key)
+	delete(s.expires, key)
+	if !ok || expired {
+		return nil, ErrNotFound
+	}
+	return v, nil
+}
+
+// Delete deletes the key from the storage.
+// Deleting a missing key is not an error.
+func (s *Storage) Delete(ctx context.Context, key string) error {
+	s.Lock()
+	defer s.Unlock()
+	delete(s.kv, key)
+	delete(s.expires, key)
+	return nil
+}
+
+// isExpired reports whether the key is expired at the given time.
+// It must be called with the lock held.
+func (s *Storage) isExpired(key string, now time.Time) bool {
+	t, ok := s.expires[key]
+	return ok && !now.Before(t)
+}
+
+// deleteExpired deletes the key if it's still expired: it may have been set again meanwhile.
+func (s *Storage) deleteExpired(key string) {
+	s.Lock()
+	defer s.Unlock()
+	if s.isExpired(key, time.Now()) {
+		delete(s.kv, key)
+		delete(s.expires, key)
+	}
+}
+
+// Close closes the storage.
+// In-memory storage has nothing to release, but a real database client would
+// close its connection pool here.
+func (s *Storage) Close(ctx context.Context) error {
+	return nil
+}
+
+// Ping checks the storage availability.
+// It's used by the health checks.
+func (s *Storage) Ping(ctx context.Context) error {
+	s.RLock()
+	defer s.RUnlock()
+	return ctx.Err()
+}
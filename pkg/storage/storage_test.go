@@ -0,0 +1,173 @@
+package storage_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dmitrymomot/go-smart-monolith/pkg/storage"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStorage_Scan(t *testing.T) {
+	ctx := context.Background()
+	s := storage.New()
+	for _, k := range []string{"a:3", "a:1", "a:2", "a:4", "b:1"} {
+		require.NoError(t, s.Set(ctx, k, k))
+	}
+
+	keys := func(kvs []storage.KV) []string {
+		res := make([]string, 0, len(kvs))
+		for _, kv := range kvs {
+			res = append(res, kv.Key)
+		}
+		return res
+	}
+
+	kvs, err := s.Scan(ctx, storage.ScanOptions{Prefix: "a:"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"a:1", "a:2", "a:3", "a:4"}, keys(kvs))
+	require.Equal(t, "a:1", kvs[0].Value)
+
+	kvs, err = s.Scan(ctx, storage.ScanOptions{Prefix: "a:", Start: "a:2", End: "a:4"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"a:2", "a:3"}, keys(kvs))
+
+	kvs, err = s.Scan(ctx, storage.ScanOptions{Prefix: "a:", Reverse: true, Limit: 2})
+	require.NoError(t, err)
+	require.Equal(t, []string{"a:4", "a:3"}, keys(kvs))
+}
+
+func TestStorage_GetMulti(t *testing.T) {
+	ctx := context.Background()
+	s := storage.New()
+	require.NoError(t, s.Set(ctx, "a", 1))
+
+	res, err := s.GetMulti(ctx, []string{"a", "b"})
+	require.NoError(t, err)
+	require.Equal(t, map[string]interface{}{"a": 1}, res)
+}
+
+func TestStorage_Update(t *testing.T) {
+	ctx := context.Background()
+	s := storage.New()
+
+	// The concurrent increments are not lost.
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			require.NoError(t, s.Update(ctx, "counter", func(v interface{}, ok bool) (interface{}, error) {
+				if !ok {
+					return 1, nil
+				}
+				return v.(int) + 1, nil
+			}))
+		}()
+	}
+	wg.Wait()
+
+	v, err := s.Get(ctx, "counter")
+	require.NoError(t, err)
+	require.Equal(t, 100, v)
+
+	// The value is not changed on error.
+	errConflict := errors.New("conflict")
+	err = s.Update(ctx, "counter", func(v interface{}, ok bool) (interface{}, error) {
+		return nil, errConflict
+	})
+	require.ErrorIs(t, err, errConflict)
+	v, err = s.Get(ctx, "counter")
+	require.NoError(t, err)
+	require.Equal(t, 100, v)
+}
+
+func TestStorage_GetDelete(t *testing.T) {
+	ctx := context.Background()
+	s := storage.New()
+	require.NoError(t, s.Set(ctx, "token", 1))
+
+	// Only one of the concurrent callers gets the value.
+	var (
+		wg  sync.WaitGroup
+		got int32
+	)
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, err := s.GetDelete(ctx, "token")
+			if errors.Is(err, storage.ErrNotFound) {
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, 1, v)
+			atomic.AddInt32(&got, 1)
+		}()
+	}
+	wg.Wait()
+	require.EqualValues(t, 1, got)
+
+	_, err := s.Get(ctx, "token")
+	require.ErrorIs(t, err, storage.ErrNotFound)
+
+	// The expired key doesn't exist.
+	require.NoError(t, s.SetWithTTL(ctx, "expired", 1, time.Nanosecond))
+	time.Sleep(time.Millisecond)
+	_, err = s.GetDelete(ctx, "expired")
+	require.ErrorIs(t, err, storage.ErrNotFound)
+}
+
+func TestStorage_SetWithTTL(t *testing.T) {
+	ctx := context.Background()
+	s := storage.New()
+	require.NoError(t, s.SetWithTTL(ctx, "a", 1, 50*time.Millisecond))
+	require.NoError(t, s.SetWithTTL(ctx, "b", 2, time.Hour))
+
+	v, err := s.Get(ctx, "a")
+	require.NoError(t, err)
+	require.Equal(t, 1, v)
+
+	// The update keeps the TTL.
+	require.NoError(t, s.Update(ctx, "a", func(v interface{}, ok bool) (interface{}, error) {
+		return v.(int) + 1, nil
+	}))
+
+	time.Sleep(100 * time.Millisecond)
+
+	// The expired key doesn't exist.
+	_, err = s.Get(ctx, "a")
+	require.ErrorIs(t, err, storage.ErrNotFound)
+	res, err := s.GetMulti(ctx, []string{"a", "b"})
+	require.NoError(t, err)
+	require.Equal(t, map[string]interface{}{"b": 2}, res)
+	kvs, err := s.Scan(ctx, storage.ScanOptions{})
+	require.NoError(t, err)
+	require.Len(t, kvs, 1)
+	require.NoError(t, s.Update(ctx, "a", func(v interface{}, ok bool) (interface{}, error) {
+		require.False(t, ok)
+		return 1, nil
+	}))
+
+	// The update with TTL sets it.
+	require.NoError(t, s.UpdateWithTTL(ctx, "b", func(v interface{}, ok bool) (interface{}, time.Duration, error) {
+		return v.(int) + 1, 50 * time.Millisecond, nil
+	}))
+	v, err = s.Get(ctx, "b")
+	require.NoError(t, err)
+	require.Equal(t, 3, v)
+
+	// Set removes the TTL.
+	require.NoError(t, s.SetWithTTL(ctx, "c", 3, 50*time.Millisecond))
+	require.NoError(t, s.Set(ctx, "c", 4))
+	time.Sleep(100 * time.Millisecond)
+	v, err = s.Get(ctx, "c")
+	require.NoError(t, err)
+	require.Equal(t, 4, v)
+	_, err = s.Get(ctx, "b")
+	require.ErrorIs(t, err, storage.ErrNotFound)
+}
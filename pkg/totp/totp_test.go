@@ -0,0 +1,60 @@
+package totp_test
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/dmitrymomot/go-smart-monolith/pkg/totp"
+	"github.com/stretchr/testify/require"
+)
+
+// rfcSecret is the SHA1 secret of the RFC 6238 test vectors: "12345678901234567890" in base32.
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestCode(t *testing.T) {
+	// The RFC 6238 test vectors truncated to 6 digits.
+	for ts, want := range map[int64]string{
+		59:         "287082",
+		1111111109: "081804",
+		1111111111: "050471",
+		1234567890: "005924",
+		2000000000: "279037",
+	} {
+		got, err := totp.Code(rfcSecret, time.Unix(ts, 0))
+		require.NoError(t, err)
+		require.Equal(t, want, got, "time %d", ts)
+	}
+
+	_, err := totp.Code("not base32!", time.Now())
+	require.ErrorIs(t, err, totp.ErrInvalidSecret)
+}
+
+func TestValidate(t *testing.T) {
+	secret, err := totp.GenerateSecret()
+	require.NoError(t, err)
+	now := time.Unix(1700000000, 0)
+
+	code, err := totp.Code(secret, now.Add(-totp.Period))
+	require.NoError(t, err)
+
+	// The previous step code is accepted within the skew.
+	step, ok := totp.Validate(secret, code, now, 1)
+	require.True(t, ok)
+	require.Equal(t, totp.Step(now)-1, step)
+
+	_, ok = totp.Validate(secret, code, now, 0)
+	require.False(t, ok)
+	_, ok = totp.Validate(secret, "12345", now, 1)
+	require.False(t, ok)
+}
+
+func TestURI(t *testing.T) {
+	u, err := url.Parse(totp.URI("My App", "test@mail.dev", rfcSecret))
+	require.NoError(t, err)
+	require.Equal(t, "otpauth", u.Scheme)
+	require.Equal(t, "totp", u.Host)
+	require.Equal(t, "/My App:test@mail.dev", u.Path)
+	require.Equal(t, rfcSecret, u.Query().Get("secret"))
+	require.Equal(t, "My App", u.Query().Get("issuer"))
+}